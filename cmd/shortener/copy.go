@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inbolt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inpsql"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/transfer"
+)
+
+// copyUsage describes the copy command, storages are given as file:<path>, bolt:<path> or a PSQL DSN.
+const copyUsage = "usage: shortener copy -from <storage> -to <storage> [-dry-run] [-on-conflict skip|fail] [-batch-size n] [-checkpoint path]"
+
+// runCopy copies all URL entries from one storage to another without starting the server.
+func runCopy(args []string) error {
+	flags := flag.NewFlagSet("copy", flag.ContinueOnError)
+	from := flags.String("from", "", "Source storage: file:<path>, bolt:<path> or PSQL DSN")
+	to := flags.String("to", "", "Destination storage: file:<path>, bolt:<path> or PSQL DSN")
+	dryRun := flags.Bool("dry-run", false, "Check entries against the destination without writing them")
+	onConflict := flags.String("on-conflict", transfer.ConflictSkip, "Conflict policy: skip or fail")
+	batchSize := flags.Int("batch-size", transfer.DefaultBatchSize, "Number of entries copied at once")
+	checkpoint := flags.String("checkpoint", "url_copy.checkpoint", "File keeping progress for resuming an interrupted copy")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New(copyUsage)
+	}
+	if *from == *to {
+		return errors.New("source and destination storages must differ")
+	}
+	// storage settings other than locations are taken from environment and the configuration file, the
+	// config parser reads os.Args, hence hide all arguments from it
+	os.Args = os.Args[:1]
+	cfg := config.NewDefaultConfiguration()
+	err = cfg.Parse()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	// stop background routines of storages and wait for them to flush their state
+	defer wg.Wait()
+	defer cancel()
+	src, err := openStorage(ctx, wg, *cfg, *from)
+	if err != nil {
+		return err
+	}
+	dst, err := openStorage(ctx, wg, *cfg, *to)
+	if err != nil {
+		return err
+	}
+	report, err := transfer.Copy(ctx, src, dst, transfer.Options{
+		BatchSize:  *batchSize,
+		OnConflict: *onConflict,
+		DryRun:     *dryRun,
+		Checkpoint: *checkpoint,
+	})
+	if report.ResumedAfter != "" {
+		fmt.Println("Resumed after", report.ResumedAfter)
+	}
+	fmt.Printf("Scanned %d, copied %d, identical %d, conflicting %d\n", report.Scanned, report.Copied, report.Identical, report.Conflicts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Source: %d entries, destination: %d entries before, %d entries after\n", report.SourceURLs, report.DestinationURLsBefore, report.DestinationURLsAfter)
+	if *dryRun {
+		fmt.Println("Dry run, nothing was written")
+	}
+	return report.Reconcile(*dryRun)
+}
+
+// openStorage initializes a URL storage located by locator, cfg is a copy of the base configuration.
+func openStorage(ctx context.Context, wg *sync.WaitGroup, cfg config.Config, locator string) (storage.URLStorage, error) {
+	cfg.FileStoragePath, cfg.BoltStoragePath, cfg.DatabaseDSN = "", "", ""
+	var s storage.URLStorage
+	var err error
+	// each storage runs a background routine which is a member of wg
+	wg.Add(1)
+	switch {
+	case strings.HasPrefix(locator, "file:"):
+		cfg.FileStoragePath = strings.TrimPrefix(locator, "file:")
+		s, err = infile.InitStorage(ctx, wg, &cfg)
+	case strings.HasPrefix(locator, "bolt:"):
+		cfg.BoltStoragePath = strings.TrimPrefix(locator, "bolt:")
+		s, err = inbolt.InitStorage(ctx, wg, &cfg)
+	case strings.HasPrefix(locator, "postgres://"), strings.HasPrefix(locator, "postgresql://"):
+		cfg.DatabaseDSN = locator
+		s, err = inpsql.InitStorage(ctx, wg, &cfg)
+	default:
+		err = fmt.Errorf("%s: storage must be given as file:<path>, bolt:<path> or PSQL DSN", locator)
+	}
+	if err != nil {
+		wg.Done()
+		return nil, err
+	}
+	return s, nil
+}
@@ -19,8 +19,12 @@ import (
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/secretary/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/cached"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/guarded"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inbolt"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inpsql"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/sharded"
 	"google.golang.org/grpc"
 )
 
@@ -53,6 +57,28 @@ func printBuildMetadata() {
 }
 
 func main() {
+	// handle the migrate, copy and rebalance commands which do not start the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "copy" {
+		err := runCopy(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rebalance" {
+		err := runRebalance(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	// print out build parameters
 	printBuildMetadata()
 	// make a top-level file logger for logging critical errors
@@ -74,15 +100,44 @@ func main() {
 	if err != nil {
 		mainlog.Fatal(err)
 	}
-	// initialize (or retrieve if present) storage, switch between "infile" and "inpsql" modules
+	// initialize (or retrieve if present) storage, switch between "sharded", "inpsql", "inbolt" and "infile"
+	// modules in the order of precedence
 	var errInit error
 	var storageInit storage.URLStorage
-	switch cfg.DatabaseDSN {
-	case "":
-		storageInit, errInit = infile.InitStorage(ctx, wg, cfg)
-	default:
+	var clickStorageInit storage.ClickStorage
+	switch {
+	case len(cfg.DatabaseShards) > 0:
+		storageInit, errInit = sharded.InitStorage(ctx, wg, cfg)
+		// click events are not sharded and are kept in the first shard
+		if errInit == nil {
+			clickCfg := *cfg
+			clickCfg.DatabaseDSN = cfg.DatabaseShards[0]
+			clickStorageInit, errInit = inpsql.InitClickStorage(ctx, wg, &clickCfg)
+		}
+	case cfg.DatabaseDSN != "":
 		storageInit, errInit = inpsql.InitStorage(ctx, wg, cfg)
+		if errInit == nil {
+			clickStorageInit, errInit = inpsql.InitClickStorage(ctx, wg, cfg)
+		}
+	case cfg.BoltStoragePath != "":
+		storageInit, errInit = inbolt.InitStorage(ctx, wg, cfg)
+		// click events are kept in a local file next to the bolt DB
+		if errInit == nil {
+			clickStorageInit, errInit = infile.InitClickStorage(ctx, wg, cfg)
+		}
+	default:
+		storageInit, errInit = infile.InitStorage(ctx, wg, cfg)
+		if errInit == nil {
+			clickStorageInit, errInit = infile.InitClickStorage(ctx, wg, cfg)
+		}
+	}
+	if errInit != nil {
+		mainlog.Fatal(errInit)
 	}
+	// serve hot sURL lookups from memory
+	storageInit = cached.InitStorage(storageInit, cfg)
+	// block links to malicious domains, the guard wraps the cache so that blocked links are never served from it
+	storageInit, errInit = guarded.InitStorage(ctx, wg, storageInit, cfg)
 	if errInit != nil {
 		mainlog.Fatal(errInit)
 	}
@@ -91,7 +146,7 @@ func main() {
 	switch cfg.UseGRPC {
 	case false:
 		// initialize server
-		server, err := rest.InitServer(ctx, cfg, storageInit)
+		server, err := rest.InitServer(ctx, cfg, storageInit, clickStorageInit)
 		if err != nil {
 			mainlog.Fatal(err)
 		}
@@ -123,7 +178,7 @@ func main() {
 		}
 	case true:
 		// initialize server
-		server, err := handlers.InitServer(ctx, cfg, storageInit)
+		server, err := handlers.InitServer(ctx, cfg, storageInit, clickStorageInit)
 		if err != nil {
 			mainlog.Fatal(err)
 		}
@@ -137,7 +192,10 @@ func main() {
 		// initialize an interceptor service
 		interceptorService := interceptors.NewAuthHandler(secretaryService, cfg)
 		// create a new GRPC server
-		s := grpc.NewServer(grpc.UnaryInterceptor(interceptorService.UnaryServerInterceptor()))
+		s := grpc.NewServer(
+			grpc.UnaryInterceptor(interceptorService.UnaryServerInterceptor()),
+			grpc.StreamInterceptor(interceptorService.StreamServerInterceptor()),
+		)
 		// set a listener for os.Signal
 		done := make(chan os.Signal, 1)
 		signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
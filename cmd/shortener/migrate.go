@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inpsql"
+)
+
+// migrateUsage describes the migrate command, flags are the same as for the server and precede the action.
+const migrateUsage = "usage: shortener migrate [flags] up|down [steps]|status"
+
+// runMigrate applies, rolls back or reports PSQL DB migrations without starting the server.
+func runMigrate(args []string) error {
+	// config parser reads os.Args, hence hide the command name from it
+	os.Args = append([]string{os.Args[0]}, args...)
+	cfg := config.NewDefaultConfiguration()
+	err := cfg.Parse()
+	if err != nil {
+		return err
+	}
+	if cfg.DatabaseDSN == "" {
+		return errors.New("migrations are supported for PSQL DB only, set DATABASE_DSN or -d flag")
+	}
+	if flag.NArg() < 1 {
+		return errors.New(migrateUsage)
+	}
+	db, err := sql.Open("pgx", cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := inpsql.MigrateUp(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d %s\n", migration.Version, migration.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Println("DB schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				return fmt.Errorf("%s: number of steps must be a positive integer", flag.Arg(1))
+			}
+		}
+		rolledBack, err := inpsql.MigrateDown(ctx, db, steps)
+		if err != nil {
+			return err
+		}
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %04d %s\n", migration.Version, migration.Name)
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No migrations to roll back")
+		}
+	case "status":
+		states, err := inpsql.MigrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			switch state.Applied {
+			case true:
+				fmt.Printf("%04d %s: applied at %s\n", state.Version, state.Name, state.AppliedAt.Format(time.RFC3339))
+			default:
+				fmt.Printf("%04d %s: pending\n", state.Version, state.Name)
+			}
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
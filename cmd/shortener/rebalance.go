@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/sharded"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/transfer"
+)
+
+// rebalanceUsage describes the rebalance command, topologies are comma-separated lists of storages in shard order.
+const rebalanceUsage = "usage: shortener rebalance -from <storage,...> -to <storage,...> [-dry-run] [-on-conflict skip|fail] [-batch-size n] [-checkpoint path]"
+
+// runRebalance moves URL entries from one shard topology to another without starting the server, e.g. to
+// add shards to a topology, see sharded.Rebalance.
+func runRebalance(args []string) error {
+	flags := flag.NewFlagSet("rebalance", flag.ContinueOnError)
+	from := flags.String("from", "", "Source shards in order: comma-separated file:<path>, bolt:<path> or PSQL DSNs")
+	to := flags.String("to", "", "Target shards in order: comma-separated file:<path>, bolt:<path> or PSQL DSNs")
+	dryRun := flags.Bool("dry-run", false, "Check entries against the target shards without writing them")
+	onConflict := flags.String("on-conflict", transfer.ConflictSkip, "Conflict policy: skip or fail")
+	batchSize := flags.Int("batch-size", transfer.DefaultBatchSize, "Number of entries copied at once")
+	checkpoint := flags.String("checkpoint", "url_rebalance.checkpoint", "File keeping progress for resuming an interrupted rebalance")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New(rebalanceUsage)
+	}
+	fromLocators := strings.Split(*from, ",")
+	toLocators := strings.Split(*to, ",")
+	// storage settings other than locations are taken from environment and the configuration file, the
+	// config parser reads os.Args, hence hide all arguments from it
+	os.Args = os.Args[:1]
+	cfg := config.NewDefaultConfiguration()
+	err = cfg.Parse()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	// stop background routines of storages and wait for them to flush their state
+	defer wg.Wait()
+	defer cancel()
+	// shards of both topologies are opened once so that entries moved off them are removed
+	opened := make(map[string]storage.URLStorage)
+	src, err := openShards(ctx, wg, *cfg, fromLocators, opened)
+	if err != nil {
+		return err
+	}
+	dst, err := openShards(ctx, wg, *cfg, toLocators, opened)
+	if err != nil {
+		return err
+	}
+	report, err := sharded.Rebalance(ctx, src, dst, transfer.Options{
+		BatchSize:  *batchSize,
+		OnConflict: *onConflict,
+		DryRun:     *dryRun,
+		Checkpoint: *checkpoint,
+	})
+	if report.ResumedAfter != "" {
+		fmt.Println("Resumed after", report.ResumedAfter)
+	}
+	fmt.Printf("Scanned %d, kept %d, copied %d, identical %d, conflicting %d, removed %d\n", report.Scanned, report.Kept, report.Copied, report.Identical, report.Conflicts, report.Removed)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Source: %d entries, target: %d entries before, %d entries after\n", report.SourceURLs, report.DestinationURLsBefore, report.DestinationURLsAfter)
+	for i, shard := range dst {
+		nURLs, _, err := shard.GetStats(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Target shard %d: %d entries\n", i, nURLs)
+	}
+	if *dryRun {
+		fmt.Println("Dry run, nothing was written")
+	}
+	return report.Reconcile(*dryRun)
+}
+
+// openShards initializes URL storages located by locators in order, storages found in opened are reused and
+// initialized ones are added to it.
+func openShards(ctx context.Context, wg *sync.WaitGroup, cfg config.Config, locators []string, opened map[string]storage.URLStorage) ([]storage.URLStorage, error) {
+	shards := make([]storage.URLStorage, 0, len(locators))
+	for _, locator := range locators {
+		s, ok := opened[locator]
+		if !ok {
+			var err error
+			s, err = openStorage(ctx, wg, cfg, locator)
+			if err != nil {
+				return nil, err
+			}
+			opened[locator] = s
+		}
+		shards = append(shards, s)
+	}
+	return shards, nil
+}
@@ -0,0 +1,88 @@
+// Package clientip provides resolution of client IP addresses behind reverse proxies.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+)
+
+// Resolver resolves client IP addresses of requests, addresses forwarded by reverse proxies are only taken into
+// account for requests received from trusted proxies since any client is able to set forwarding headers.
+type Resolver struct {
+	proxies []*net.IPNet
+}
+
+// NewResolver initializes a Resolver trusting proxies given by cfg.TrustedProxies either as networks in CIDR
+// notation or as single addresses, forwarding headers are ignored if no proxy is given.
+func NewResolver(cfg *config.Config) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range cfg.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("%s: trusted proxy must be either an IP address or a network in CIDR notation", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			r.proxies = append(r.proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: trusted proxy must be either an IP address or a network in CIDR notation", proxy)
+		}
+		r.proxies = append(r.proxies, ipNet)
+	}
+	return r, nil
+}
+
+// Resolve returns the client IP address of a request received from remoteAddr. If remoteAddr is a trusted proxy,
+// realIP and forwardedFor holding X-Real-IP and X-Forwarded-For header values are looked at: realIP is taken if
+// set, otherwise forwardedFor is walked from the nearest hop and the first address which is not a trusted proxy
+// is taken.
+func (r *Resolver) Resolve(remoteAddr, realIP, forwardedFor string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if !r.isTrusted(net.ParseIP(host)) {
+		return host
+	}
+	if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+		return ip.String()
+	}
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return host
+}
+
+// isTrusted checks whether ip belongs to a trusted proxy.
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range r.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package clientip
+
+import (
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests
+
+func TestNewResolver_Fail(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.TrustedProxies = []string{"some_proxy"}
+	_, err := NewResolver(cfg)
+	assert.NotNil(t, err)
+	cfg.TrustedProxies = []string{"10.0.0.0/33"}
+	_, err = NewResolver(cfg)
+	assert.NotNil(t, err)
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.168.0.1"}
+	r, err := NewResolver(cfg)
+	assert.Nil(t, err)
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIP       string
+		forwardedFor string
+		want         string
+	}{
+		{
+			name:       "Direct request",
+			remoteAddr: "1.2.3.4:5678",
+			want:       "1.2.3.4",
+		},
+		{
+			name:         "Direct request with forged headers",
+			remoteAddr:   "1.2.3.4:5678",
+			realIP:       "5.6.7.8",
+			forwardedFor: "5.6.7.8",
+			want:         "1.2.3.4",
+		},
+		{
+			name:       "Trusted proxy setting X-Real-IP",
+			remoteAddr: "192.168.0.1:5678",
+			realIP:     "5.6.7.8",
+			want:       "5.6.7.8",
+		},
+		{
+			name:         "Trusted proxies appending X-Forwarded-For",
+			remoteAddr:   "10.0.0.2:5678",
+			forwardedFor: "9.9.9.9, 5.6.7.8, 10.0.0.1",
+			want:         "5.6.7.8",
+		},
+		{
+			name:         "Trusted proxies only",
+			remoteAddr:   "10.0.0.2:5678",
+			forwardedFor: "10.0.0.1",
+			want:         "10.0.0.1",
+		},
+		{
+			name:       "Trusted proxy without headers",
+			remoteAddr: "10.0.0.2:5678",
+			want:       "10.0.0.2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Resolve(tt.remoteAddr, tt.realIP, tt.forwardedFor))
+		})
+	}
+
+	// headers are ignored if no proxy is trusted
+	r, _ = NewResolver(config.NewDefaultConfiguration())
+	assert.Equal(t, "10.0.0.2", r.Resolve("10.0.0.2:5678", "5.6.7.8", "5.6.7.8"))
+}
@@ -4,26 +4,42 @@ package handlers
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/clientip"
 	pb "github.com/danilovkiri/dk_go_url_shortener/internal/api/grpc/proto"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	analyticsProcessor "github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics/v1"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	processor "github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
 	serverStart = time.Now()
 )
 
+// importBatchSize is the number of imported URLs shortened at once.
+const importBatchSize = 1000
+
+// policyDomain is a domain of reasons of destination policy violations given in error details.
+const policyDomain = "shortener.policy"
+
 // uptime returns time in seconds since the server start-up.
 func uptime() int64 {
 	return int64(time.Since(serverStart).Seconds())
@@ -33,16 +49,26 @@ func uptime() int64 {
 type ShortenerServer struct {
 	pb.UnimplementedShortenerServer
 	processor processor.Processor
+	analytics analyticsProcessor.Processor
 	cfg       *config.Config
+	clientIP  *clientip.Resolver
 }
 
 // InitServer returns a ShortenerServer object ready to be listening and serving.
-func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStorage) (server *ShortenerServer, err error) {
-	shortenerService, err := shortener.InitShortener(storage)
+func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStorage, clickStorage storage.ClickStorage) (server *ShortenerServer, err error) {
+	shortenerService, err := shortener.InitShortener(storage, cfg)
+	if err != nil {
+		return nil, err
+	}
+	analyticsService, err := analytics.InitAnalytics(storage, clickStorage)
 	if err != nil {
 		return nil, err
 	}
-	return &ShortenerServer{processor: shortenerService, cfg: cfg}, nil
+	resolver, err := clientip.NewResolver(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ShortenerServer{processor: shortenerService, analytics: analyticsService, cfg: cfg, clientIP: resolver}, nil
 }
 
 // GetUptime is a GRPC method for getting server uptime data.
@@ -81,6 +107,26 @@ func (s *ShortenerServer) GetStats(ctx context.Context, _ *emptypb.Empty) (*pb.G
 		Users: nUsers,
 		Urls:  nURLs,
 	}
+	purgeStats, err := s.processor.GetPurgeStats(ctx)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		var purgeNotSupported *serviceErrors.ServicePurgeNotSupported
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandleGetStats:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if !errors.As(err, &purgeNotSupported) {
+			log.Println("HandleGetStats:", err)
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else {
+		response.Purge = &pb.PurgeStats{
+			PurgedUrls:     purgeStats.PurgedURLs,
+			LastPurgedUrls: purgeStats.LastPurgedURLs,
+		}
+		if purgeStats.LastPurgeAt != nil {
+			response.Purge.LastPurgeAt = timestamppb.New(*purgeStats.LastPurgeAt)
+		}
+	}
 	return &response, nil
 }
 
@@ -89,13 +135,37 @@ func (s *ShortenerServer) GetURL(ctx context.Context, request *pb.GetURLRequest)
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 	sURL := request.ShortUrlId
-	URL, err := s.processor.Decode(ctx, sURL)
+	referrer, userAgent, clientIP := s.getClientInfo(ctx)
+	var URL string
+	var err error
+	if request.Password != "" {
+		URL, err = s.processor.Unlock(ctx, sURL, request.Password, clientIP)
+	} else {
+		URL, err = s.processor.Decode(ctx, sURL)
+	}
 	if err != nil {
 		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 		var deletedError *storageErrors.DeletedError
+		var expiredError *storageErrors.ExpiredError
+		var blockedError *storageErrors.BlockedError
+		var passwordRequiredError *serviceErrors.ServicePasswordRequired
+		var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+		var tooManyAttemptsError *serviceErrors.ServiceTooManyAttempts
 		if errors.As(err, &contextTimeoutExceededError) {
 			log.Println("HandleGetURL:", err)
 			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if errors.As(err, &passwordRequiredError) || errors.As(err, &incorrectPasswordError) {
+			log.Println("HandleGetURL:", err)
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		} else if errors.As(err, &tooManyAttemptsError) {
+			log.Println("HandleGetURL:", err)
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		} else if errors.As(err, &blockedError) {
+			log.Println("HandleGetURL:", err)
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		} else if errors.As(err, &expiredError) {
+			log.Println("HandleGetURL:", err)
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
 		} else if errors.As(err, &deletedError) {
 			log.Println("HandleGetURL:", err)
 			return nil, status.Error(codes.NotFound, err.Error())
@@ -104,6 +174,8 @@ func (s *ShortenerServer) GetURL(ctx context.Context, request *pb.GetURLRequest)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	log.Println("HandleGetURL: retrieved URL", URL)
+	// record a click event asynchronously, it does not delay the response
+	s.analytics.RecordClick(sURL, referrer, userAgent, clientIP)
 	response := pb.GetURLResponse{
 		RedirectTo: URL,
 	}
@@ -138,14 +210,70 @@ func (s *ShortenerServer) GetURLsByUserID(ctx context.Context, _ *emptypb.Empty)
 	for _, fullURL := range URLs {
 		u.Path = fullURL.SURL
 		responseURL := pb.ResponsePairURL{
-			FullUrl:  fullURL.URL,
+			FullUrl:  fullURL.Submitted(),
 			ShortUrl: u.String(),
 		}
+		if fullURL.OriginalURL != "" {
+			responseURL.CanonicalUrl = fullURL.URL
+		}
 		response.ResponsePairsUrls = append(response.ResponsePairsUrls, &responseURL)
 	}
 	return &response, nil
 }
 
+// GetURLStats is a GRPC method for getting click statistics of a shortened URL owned by the user.
+func (s *ShortenerServer) GetURLStats(ctx context.Context, request *pb.GetURLStatsRequest) (*pb.GetURLStatsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	userID := s.getUserID(ctx)
+	// unset range bounds are left zero so that the service applies defaults
+	var from, to time.Time
+	if request.From != nil {
+		from = request.From.AsTime()
+	}
+	if request.To != nil {
+		to = request.To.AsTime()
+	}
+	stats, err := s.analytics.GetClickStats(ctx, request.ShortUrlId, userID, from, to)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		var incorrectStatsRangeError *serviceErrors.ServiceIncorrectStatsRange
+		var notOwnedURLError *serviceErrors.ServiceNotOwnedURL
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandleGetURLStats:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if errors.As(err, &incorrectStatsRangeError) {
+			log.Println("HandleGetURLStats:", err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		} else if errors.As(err, &notOwnedURLError) {
+			log.Println("HandleGetURLStats:", err)
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		log.Println("HandleGetURLStats:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response := pb.GetURLStatsResponse{
+		ShortUrlId:     request.ShortUrlId,
+		From:           timestamppb.New(stats.From),
+		To:             timestamppb.New(stats.To),
+		TotalClicks:    stats.TotalClicks,
+		UniqueVisitors: stats.UniqueVisitors,
+	}
+	for _, bucket := range stats.Hourly {
+		response.Hourly = append(response.Hourly, &pb.ClickBucket{Start: timestamppb.New(bucket.Start), Clicks: bucket.Clicks})
+	}
+	for _, bucket := range stats.Daily {
+		response.Daily = append(response.Daily, &pb.ClickBucket{Start: timestamppb.New(bucket.Start), Clicks: bucket.Clicks})
+	}
+	for _, counter := range stats.TopReferrers {
+		response.TopReferrers = append(response.TopReferrers, &pb.ClickCounter{Value: counter.Value, Clicks: counter.Clicks})
+	}
+	for _, counter := range stats.TopUserAgents {
+		response.TopUserAgents = append(response.TopUserAgents, &pb.ClickCounter{Value: counter.Value, Clicks: counter.Clicks})
+	}
+	return &response, nil
+}
+
 // PostURL is a GRPC method to get a shortened URL for an original URL and store them in DB.
 func (s *ShortenerServer) PostURL(ctx context.Context, request *pb.PostURLRequest) (*pb.PostURLResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
@@ -157,13 +285,34 @@ func (s *ShortenerServer) PostURL(ctx context.Context, request *pb.PostURLReques
 		log.Println("HandlePostURL:", err)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	sURL, err := s.processor.Encode(ctx, URL, userID)
+	opts := modelurl.EncodeOptions{Alias: request.Alias, Password: request.Password}
+	if request.ExpiresAt != nil {
+		expiresAt := request.ExpiresAt.AsTime()
+		opts.ExpiresAt = &expiresAt
+	}
+	sURL, err := s.processor.Encode(ctx, URL, userID, opts)
 	if err != nil {
 		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 		var alreadyExistsError *storageErrors.AlreadyExistsError
+		var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+		var urlTakenError *storageErrors.URLTakenError
+		var incorrectAliasError *serviceErrors.ServiceIncorrectAlias
+		var incorrectExpirationError *serviceErrors.ServiceIncorrectExpiration
+		var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+		var destinationDenied *serviceErrors.ServiceDestinationDenied
 		if errors.As(err, &contextTimeoutExceededError) {
 			log.Println("HandlePostURL:", err)
 			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if errors.As(err, &destinationDenied) {
+			log.Println("HandlePostURL:", err)
+			return nil, deniedStatus(destinationDenied)
+		} else if errors.As(err, &incorrectAliasError) || errors.As(err, &incorrectExpirationError) || errors.As(err, &incorrectPasswordError) {
+			log.Println("HandlePostURL:", err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		} else if errors.As(err, &sURLAlreadyExistsError) || errors.As(err, &urlTakenError) {
+			// requested alias or URL is taken, there is no valid sURL to respond with
+			log.Println("HandlePostURL:", err)
+			return nil, status.Error(codes.AlreadyExists, err.Error())
 		} else if errors.As(err, &alreadyExistsError) {
 			u.Path = alreadyExistsError.ValidSURL
 			response := pb.PostURLResponse{
@@ -184,8 +333,6 @@ func (s *ShortenerServer) PostURL(ctx context.Context, request *pb.PostURLReques
 
 // PostURLBatch is a GRPC method to get shortened URLs for a batch of original URLs and store them in DB.
 func (s *ShortenerServer) PostURLBatch(ctx context.Context, request *pb.PostURLBatchRequest) (*pb.PostURLBatchResponse, error) {
-	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
-	defer cancel()
 	userID := s.getUserID(ctx)
 	u, err := url.Parse(s.cfg.BaseURL)
 	if err != nil {
@@ -196,52 +343,252 @@ func (s *ShortenerServer) PostURLBatch(ctx context.Context, request *pb.PostURLB
 		log.Println("HandlePostURLBatch:", "empty request")
 		return nil, status.Error(codes.Internal, "Empty request")
 	}
-	response := pb.PostURLBatchResponse{}
+	items := make([]modelurl.BatchItem, 0, len(request.RequestUrls))
 	for _, requestBatchURL := range request.RequestUrls {
-		sURL, err1 := s.processor.Encode(ctx, requestBatchURL.Url, userID)
-		if err1 != nil {
-			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
-			var alreadyExistsError *storageErrors.AlreadyExistsError
-			if errors.As(err1, &contextTimeoutExceededError) {
-				log.Println("HandlePostURLBatch:", err1)
-				return nil, status.Error(codes.DeadlineExceeded, err1.Error())
-			} else if errors.As(err1, &alreadyExistsError) {
-				sURL = alreadyExistsError.ValidSURL
-				u.Path = sURL
-				responseBatchURL := pb.PostURLBatch{
-					CorrelationId: requestBatchURL.CorrelationId,
-					Url:           u.String(),
-				}
-				response.ResponseUrls = append(response.ResponseUrls, &responseBatchURL)
-				continue
-			}
-			log.Println("HandlePostURLBatch:", err1)
-			return nil, status.Error(codes.Internal, err1.Error())
+		item := modelurl.BatchItem{
+			URL:  requestBatchURL.Url,
+			Opts: modelurl.EncodeOptions{Alias: requestBatchURL.Alias, Password: requestBatchURL.Password},
+		}
+		if requestBatchURL.ExpiresAt != nil {
+			expiresAt := requestBatchURL.ExpiresAt.AsTime()
+			item.Opts.ExpiresAt = &expiresAt
+		}
+		items = append(items, item)
+	}
+	ctx, cancel := context.WithTimeout(ctx, modelurl.BatchTimeout(items))
+	defer cancel()
+	results, err := s.processor.EncodeBatch(ctx, items, userID)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandlePostURLBatch:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
 		}
-		log.Println("HandlePostURLBatch: stored", requestBatchURL.Url, "as", sURL)
-		u.Path = sURL
+		log.Println("HandlePostURLBatch:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response := pb.PostURLBatchResponse{}
+	for i, result := range results {
 		responseBatchURL := pb.PostURLBatch{
-			CorrelationId: requestBatchURL.CorrelationId,
-			Url:           u.String(),
+			CorrelationId: request.RequestUrls[i].CorrelationId,
+			Status:        result.Status,
 		}
+		if result.SURL != "" {
+			u.Path = result.SURL
+			responseBatchURL.Url = u.String()
+		}
+		if result.Err != nil && responseBatchURL.Status != modelurl.BatchStatusExists {
+			responseBatchURL.Error = result.Err.Error()
+		}
+		log.Println("HandlePostURLBatch:", request.RequestUrls[i].Url, responseBatchURL.Status, result.SURL)
 		response.ResponseUrls = append(response.ResponseUrls, &responseBatchURL)
 	}
 	return &response, nil
 }
 
 // DeleteURLBatch is a GRPC method for deleting DB entries based on a batch of shortened URL IDs.
-func (s *ShortenerServer) DeleteURLBatch(ctx context.Context, request *pb.DeleteURLBatchRequest) (*emptypb.Empty, error) {
+func (s *ShortenerServer) DeleteURLBatch(ctx context.Context, request *pb.DeleteURLBatchRequest) (*pb.DeleteURLBatchResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 	userID := s.getUserID(ctx)
 	deleteURLs := make([]string, 0)
-	deleteURLs = append(deleteURLs, request.RequestUrls.Urls...)
+	deleteURLs = append(deleteURLs, request.GetRequestUrls().GetUrls()...)
 	log.Println("DELETE request detected for", deleteURLs)
-	s.processor.Delete(ctx, deleteURLs, userID)
-	var response emptypb.Empty
+	jobID, err := s.processor.Delete(ctx, deleteURLs, userID)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		var serviceIncorrectInputURL *serviceErrors.ServiceIncorrectInputURL
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandleDeleteURLBatch:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if errors.As(err, &serviceIncorrectInputURL) {
+			log.Println("HandleDeleteURLBatch:", err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		log.Println("HandleDeleteURLBatch:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response := pb.DeleteURLBatchResponse{JobId: jobID}
 	return &response, nil
 }
 
+// RestoreURLBatch is a GRPC method for restoring DB entries deleted within the grace window based on a batch of
+// shortened URL IDs, restored entries keep their IDs.
+func (s *ShortenerServer) RestoreURLBatch(ctx context.Context, request *pb.RestoreURLBatchRequest) (*pb.RestoreURLBatchResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	userID := s.getUserID(ctx)
+	log.Println("RESTORE request detected for", request.Urls)
+	results, err := s.processor.Restore(ctx, request.Urls, userID)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		var serviceIncorrectInputURL *serviceErrors.ServiceIncorrectInputURL
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandleRestoreURLBatch:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if errors.As(err, &serviceIncorrectInputURL) {
+			log.Println("HandleRestoreURLBatch:", err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		log.Println("HandleRestoreURLBatch:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var response pb.RestoreURLBatchResponse
+	for _, result := range results {
+		response.Results = append(response.Results, &pb.RestoreURLResult{ShortUrlId: result.SURL, Status: result.Status})
+	}
+	return &response, nil
+}
+
+// GetDeleteJob is a GRPC method for retrieving a status of a deletion job and outcomes of its sURLs.
+func (s *ShortenerServer) GetDeleteJob(ctx context.Context, request *pb.GetDeleteJobRequest) (*pb.GetDeleteJobResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	userID := s.getUserID(ctx)
+	job, err := s.processor.GetDeleteJob(ctx, request.JobId, userID)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		var jobNotFoundError *storageErrors.JobNotFoundError
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandleGetDeleteJob:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		} else if errors.As(err, &jobNotFoundError) {
+			log.Println("HandleGetDeleteJob:", err)
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		log.Println("HandleGetDeleteJob:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response := pb.GetDeleteJobResponse{
+		JobId:    job.ID,
+		Status:   job.Status,
+		Deleted:  job.Deleted,
+		NotOwned: job.NotOwned,
+		NotFound: job.NotFound,
+		Pending:  job.Pending,
+		Error:    job.Error,
+	}
+	return &response, nil
+}
+
+// ExportURLs is a GRPC method for streaming all URLs of a user along with their metadata, URLs are read and sent
+// page by page for as long as the stream lasts.
+func (s *ShortenerServer) ExportURLs(_ *emptypb.Empty, stream pb.Shortener_ExportURLsServer) error {
+	ctx := stream.Context()
+	userID := s.getUserID(ctx)
+	u, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		log.Println("HandleExportURLs:", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+	var sendErr error
+	err = s.processor.ExportByUserID(ctx, userID, func(URLs []modelurl.FullURL) error {
+		for _, fullURL := range URLs {
+			u.Path = fullURL.SURL
+			exportedURL := pb.ExportedURL{
+				ShortUrl: u.String(),
+				FullUrl:  fullURL.Submitted(),
+			}
+			if fullURL.ExpiresAt != nil {
+				exportedURL.ExpiresAt = timestamppb.New(*fullURL.ExpiresAt)
+			}
+			sendErr = stream.Send(&exportedURL)
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("HandleExportURLs:", err)
+		if sendErr != nil {
+			return sendErr
+		}
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		if errors.As(err, &contextTimeoutExceededError) {
+			return status.Error(codes.DeadlineExceeded, err.Error())
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// ImportURLs is a GRPC method for shortening a stream of imported URLs, results are reported per row once
+// the stream is closed by the client.
+func (s *ShortenerServer) ImportURLs(stream pb.Shortener_ImportURLsServer) error {
+	userID := s.getUserID(stream.Context())
+	response := pb.ImportURLsResponse{}
+	items := make([]modelurl.BatchItem, 0, importBatchSize)
+	for {
+		request, err := stream.Recv()
+		if err != nil && err != io.EOF {
+			log.Println("HandleImportURLs:", err)
+			return err
+		}
+		if request != nil {
+			item := modelurl.BatchItem{URL: request.FullUrl, Opts: modelurl.EncodeOptions{Alias: modelurl.ImportAlias(request.ShortUrl)}}
+			if request.ExpiresAt != nil {
+				expiresAt := request.ExpiresAt.AsTime()
+				item.Opts.ExpiresAt = &expiresAt
+			}
+			items = append(items, item)
+		}
+		if len(items) > 0 && (len(items) == importBatchSize || err == io.EOF) {
+			results, err := s.importBatch(stream.Context(), items, userID, int64(len(response.Results)))
+			if err != nil {
+				return err
+			}
+			response.Results = append(response.Results, results...)
+			items = items[:0]
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(response.Results) == 0 {
+		log.Println("HandleImportURLs:", "empty import received")
+		return status.Error(codes.InvalidArgument, "empty import received")
+	}
+	return stream.SendAndClose(&response)
+}
+
+// importBatch shortens imported items at once, rows of the items are numbered starting after offset.
+func (s *ShortenerServer) importBatch(ctx context.Context, items []modelurl.BatchItem, userID string, offset int64) ([]*pb.ImportURLResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	results, err := s.processor.EncodeBatch(ctx, items, userID)
+	if err != nil {
+		var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+		if errors.As(err, &contextTimeoutExceededError) {
+			log.Println("HandleImportURLs:", err)
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		}
+		log.Println("HandleImportURLs:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	u, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		log.Println("HandleImportURLs:", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	importResults := make([]*pb.ImportURLResult, 0, len(results))
+	for i, result := range results {
+		importResult := pb.ImportURLResult{
+			Row:    offset + int64(i) + 1,
+			Status: result.Status,
+		}
+		if result.SURL != "" {
+			u.Path = result.SURL
+			importResult.ShortUrl = u.String()
+		}
+		if result.Err != nil && importResult.Status != modelurl.BatchStatusExists {
+			importResult.Error = result.Err.Error()
+		}
+		importResults = append(importResults, &importResult)
+	}
+	return importResults, nil
+}
+
 // getUserID retrieves user identifier as a value of GRPC metadata.
 func (s *ShortenerServer) getUserID(ctx context.Context) string {
 	md, _ := metadata.FromIncomingContext(ctx)
@@ -249,3 +596,34 @@ func (s *ShortenerServer) getUserID(ctx context.Context) string {
 	userID := values[0]
 	return userID
 }
+
+// getClientInfo retrieves referrer, user agent and client IP address from GRPC metadata and peer info, addresses
+// forwarded in metadata are only trusted if the call was received from a trusted proxy.
+func (s *ShortenerServer) getClientInfo(ctx context.Context) (referrer, userAgent, clientIP string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("referer"); len(values) > 0 {
+		referrer = values[0]
+	}
+	if values := md.Get("user-agent"); len(values) > 0 {
+		userAgent = values[0]
+	}
+	var remoteAddr, realIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	if values := md.Get("x-real-ip"); len(values) > 0 {
+		realIP = values[0]
+	}
+	forwardedFor := strings.Join(md.Get("x-forwarded-for"), ",")
+	return referrer, userAgent, s.clientIP.Resolve(remoteAddr, realIP, forwardedFor)
+}
+
+// deniedStatus makes an InvalidArgument status of a destination policy violation carrying its reason code.
+func deniedStatus(err *serviceErrors.ServiceDestinationDenied) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: err.Reason, Domain: policyDomain})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -4,30 +4,38 @@ import (
 	"context"
 	"log"
 	"net"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/grpc/interceptors"
 	pb "github.com/danilovkiri/dk_go_url_shortener/internal/api/grpc/proto"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/policy"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/secretary/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type HandlersTestSuite struct {
 	suite.Suite
 	storage          storage.URLStorage
+	clickStorage     storage.ClickStorage
 	authHandler      *interceptors.AuthHandler
 	secretaryService *secretary.Secretary
 	router           *chi.Mux
@@ -36,6 +44,7 @@ type HandlersTestSuite struct {
 	wg               *sync.WaitGroup
 	server           *ShortenerServer
 	s                *grpc.Server
+	addr             string
 }
 
 func (suite *HandlersTestSuite) SetupTest() {
@@ -43,25 +52,34 @@ func (suite *HandlersTestSuite) SetupTest() {
 	// necessary to set default parameters here since they are set in cfg.ParseFlags() which causes error
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := suite.T().TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.UserKey = "jds__63h3_7ds"
 	cfg.AuthKey = "user"
+	cfg.RestoreGraceWindow = time.Hour
 	// parsing flags causes flag redefined errors
 	//cfg.ParseFlags()
 	suite.ctx, suite.cancel = context.WithCancel(context.Background())
 	suite.wg = &sync.WaitGroup{}
 	suite.wg.Add(1)
 	suite.storage, _ = infile.InitStorage(suite.ctx, suite.wg, cfg)
-	suite.server, _ = InitServer(suite.ctx, cfg, suite.storage)
+	suite.clickStorage, _ = infile.InitClickStorage(suite.ctx, suite.wg, cfg)
+	suite.server, _ = InitServer(suite.ctx, cfg, suite.storage, suite.clickStorage)
 	suite.secretaryService = secretary.NewSecretaryService(cfg)
 	suite.authHandler = interceptors.NewAuthHandler(suite.secretaryService, cfg)
 	suite.router = chi.NewRouter()
-	suite.s = grpc.NewServer(grpc.UnaryInterceptor(suite.authHandler.UnaryServerInterceptor()))
+	suite.s = grpc.NewServer(
+		grpc.UnaryInterceptor(suite.authHandler.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(suite.authHandler.StreamServerInterceptor()),
+	)
 	pb.RegisterShortenerServer(suite.s, suite.server)
-	listen, err := net.Listen("tcp", ":8080")
+	// listen on a free port so that other packages' servers do not conflict
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		log.Fatal(err)
 	}
+	suite.addr = listen.Addr().String()
 	go suite.s.Serve(listen)
 }
 
@@ -71,7 +89,7 @@ func TestHandlersTestSuite(t *testing.T) {
 
 func (suite *HandlersTestSuite) TestPingDB() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -101,7 +119,7 @@ func (suite *HandlersTestSuite) TestPingDB() {
 
 func (suite *HandlersTestSuite) TestGetUptime() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -130,7 +148,7 @@ func (suite *HandlersTestSuite) TestGetUptime() {
 
 func (suite *HandlersTestSuite) TestGetStats() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -161,7 +179,7 @@ func (suite *HandlersTestSuite) TestGetStats() {
 
 func (suite *HandlersTestSuite) TestPostURL() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -201,6 +219,13 @@ func (suite *HandlersTestSuite) TestPostURL() {
 				code: codes.Internal,
 			},
 		},
+		{
+			name: "Denied POST query (scheme)",
+			URL:  "javascript:alert(1)",
+			want: want{
+				code: codes.InvalidArgument,
+			},
+		},
 	}
 
 	// perform each test
@@ -212,6 +237,18 @@ func (suite *HandlersTestSuite) TestPostURL() {
 			assert.IsType(t, &pb.PostURLResponse{}, resp)
 		})
 	}
+
+	// reason codes of destination policy violations are given in error details
+	_, err = c.PostURL(ctx, &pb.PostURLRequest{FullUrl: "http://10.0.0.1/admin"})
+	e, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, e.Code())
+	var reasons []string
+	for _, detail := range e.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			reasons = append(reasons, info.Reason)
+		}
+	}
+	assert.Equal(suite.T(), []string{policy.ReasonPrivateAddress}, reasons)
 	suite.s.GracefulStop()
 	suite.cancel()
 	suite.wg.Wait()
@@ -219,7 +256,7 @@ func (suite *HandlersTestSuite) TestPostURL() {
 
 func (suite *HandlersTestSuite) TestPostURLBatch() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -231,7 +268,9 @@ func (suite *HandlersTestSuite) TestPostURLBatch() {
 
 	// set tests' parameters
 	type want struct {
-		code codes.Code
+		code     codes.Code
+		statuses []string
+		urls     []string
 	}
 	tests := []struct {
 		name  string
@@ -254,6 +293,27 @@ func (suite *HandlersTestSuite) TestPostURLBatch() {
 				code: codes.OK,
 			},
 		},
+		{
+			name: "POST batch query with options",
+			batch: []*pb.PostURLBatch{
+				{
+					CorrelationId: "test1",
+					Url:           "https://www.kinopoisk.com",
+					Alias:         "batch-alias",
+					ExpiresAt:     timestamppb.New(time.Now().Add(time.Hour)),
+				},
+				{
+					CorrelationId: "test2",
+					Url:           "https://www.vk.ru",
+					ExpiresAt:     timestamppb.New(time.Now().Add(-time.Hour)),
+				},
+			},
+			want: want{
+				code:     codes.OK,
+				statuses: []string{modelurl.BatchStatusCreated, modelurl.BatchStatusInvalid},
+				urls:     []string{"http://localhost:8080/batch-alias", ""},
+			},
+		},
 		{
 			name:  "Empty POST batch query",
 			batch: []*pb.PostURLBatch{},
@@ -270,6 +330,16 @@ func (suite *HandlersTestSuite) TestPostURLBatch() {
 			e, _ := status.FromError(err1)
 			assert.Equal(t, tt.want.code, e.Code())
 			assert.IsType(t, &pb.PostURLBatchResponse{}, resp)
+			if tt.want.statuses != nil {
+				statuses := make([]string, 0, len(resp.ResponseUrls))
+				urls := make([]string, 0, len(resp.ResponseUrls))
+				for _, responseURL := range resp.ResponseUrls {
+					statuses = append(statuses, responseURL.Status)
+					urls = append(urls, responseURL.Url)
+				}
+				assert.Equal(t, tt.want.statuses, statuses)
+				assert.Equal(t, tt.want.urls, urls)
+			}
 		})
 	}
 	suite.s.GracefulStop()
@@ -279,7 +349,7 @@ func (suite *HandlersTestSuite) TestPostURLBatch() {
 
 func (suite *HandlersTestSuite) TestGetURL() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -290,14 +360,16 @@ func (suite *HandlersTestSuite) TestGetURL() {
 	c := pb.NewShortenerClient(conn)
 
 	// set tests' parameters
-	sURL, _ := suite.server.processor.Encode(suite.ctx, "https://www.yandex.nd", token)
+	sURL, _ := suite.server.processor.Encode(suite.ctx, "https://www.yandex.nd", token, modelurl.EncodeOptions{})
+	protectedSURL, _ := suite.server.processor.Encode(suite.ctx, "https://www.yandex.ng", token, modelurl.EncodeOptions{Password: "secret"})
 	type want struct {
 		code codes.Code
 	}
 	tests := []struct {
-		name string
-		sURL string
-		want want
+		name     string
+		sURL     string
+		password string
+		want     want
 	}{
 		{
 			name: "Correct GET query",
@@ -320,12 +392,35 @@ func (suite *HandlersTestSuite) TestGetURL() {
 				code: codes.Internal,
 			},
 		},
+		{
+			name: "Protected GET query (no password)",
+			sURL: protectedSURL,
+			want: want{
+				code: codes.Unauthenticated,
+			},
+		},
+		{
+			name:     "Protected GET query (incorrect password)",
+			sURL:     protectedSURL,
+			password: "wrong",
+			want: want{
+				code: codes.Unauthenticated,
+			},
+		},
+		{
+			name:     "Protected GET query (correct password)",
+			sURL:     protectedSURL,
+			password: "secret",
+			want: want{
+				code: codes.OK,
+			},
+		},
 	}
 
 	// perform each test
 	for _, tt := range tests {
 		suite.T().Run("post", func(t *testing.T) {
-			resp, err1 := c.GetURL(ctx, &pb.GetURLRequest{ShortUrlId: tt.sURL})
+			resp, err1 := c.GetURL(ctx, &pb.GetURLRequest{ShortUrlId: tt.sURL, Password: tt.password})
 			e, _ := status.FromError(err1)
 			assert.Equal(t, tt.want.code, e.Code())
 			assert.IsType(t, &pb.GetURLResponse{}, resp)
@@ -336,9 +431,82 @@ func (suite *HandlersTestSuite) TestGetURL() {
 	suite.wg.Wait()
 }
 
+func (suite *HandlersTestSuite) TestGetURLStats() {
+	// create a client
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	token := "8773a90a68ebd0fd56dffb1441682414fbec5f454eba9be6129bb00744f50d7f19fd870e97eba101a03b857c675e4836de6f5196"
+	md := metadata.New(map[string]string{"user": token})
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	c := pb.NewShortenerClient(conn)
+
+	// set tests' parameters
+	sURL, _ := suite.server.processor.Encode(suite.ctx, "https://www.yandex.st", token, modelurl.EncodeOptions{})
+	foreignSURL, _ := suite.server.processor.Encode(suite.ctx, "https://www.yandex.sk", uuid.New().String(), modelurl.EncodeOptions{})
+	_ = suite.clickStorage.(*infile.ClickStorage).Flush([]modelstorage.ClickEntry{
+		{SURL: sURL, ClickedAt: time.Now().UTC(), Referrer: "https://www.google.com", UserAgent: "someUserAgent", ClientIP: "127.0.0.1"},
+		{SURL: sURL, ClickedAt: time.Now().UTC(), Referrer: "https://www.google.com", UserAgent: "someUserAgent", ClientIP: "127.0.0.1"},
+	})
+	type want struct {
+		code        codes.Code
+		totalClicks int64
+	}
+	tests := []struct {
+		name    string
+		request *pb.GetURLStatsRequest
+		want    want
+	}{
+		{
+			name:    "Owned sURL",
+			request: &pb.GetURLStatsRequest{ShortUrlId: sURL},
+			want: want{
+				code:        codes.OK,
+				totalClicks: 2,
+			},
+		},
+		{
+			name: "Reversed range",
+			request: &pb.GetURLStatsRequest{
+				ShortUrlId: sURL,
+				From:       timestamppb.New(time.Now()),
+				To:         timestamppb.New(time.Now().AddDate(0, 0, -7)),
+			},
+			want: want{
+				code: codes.InvalidArgument,
+			},
+		},
+		{
+			name:    "Foreign sURL",
+			request: &pb.GetURLStatsRequest{ShortUrlId: foreignSURL},
+			want: want{
+				code: codes.NotFound,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			resp, err1 := c.GetURLStats(ctx, tt.request)
+			e, _ := status.FromError(err1)
+			assert.Equal(t, tt.want.code, e.Code())
+			if tt.want.code == codes.OK {
+				assert.Equal(t, tt.want.totalClicks, resp.TotalClicks)
+				assert.Equal(t, int64(1), resp.UniqueVisitors)
+			}
+		})
+	}
+	suite.s.GracefulStop()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
 func (suite *HandlersTestSuite) TestGetURLsByUserID() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -348,9 +516,9 @@ func (suite *HandlersTestSuite) TestGetURLsByUserID() {
 	c := pb.NewShortenerClient(conn)
 
 	// set tests' parameters
-	_, _ = suite.server.processor.Encode(suite.ctx, "https://www.yandex.nd", token1)
-	_, _ = suite.server.processor.Encode(suite.ctx, "https://www.yandex.kz", token1)
-	_, _ = suite.server.processor.Encode(suite.ctx, "https://www.yandex.am", token1)
+	_, _ = suite.server.processor.Encode(suite.ctx, "https://www.yandex.nd", token1, modelurl.EncodeOptions{})
+	_, _ = suite.server.processor.Encode(suite.ctx, "https://www.yandex.kz", token1, modelurl.EncodeOptions{})
+	_, _ = suite.server.processor.Encode(suite.ctx, "https://www.yandex.am", token1, modelurl.EncodeOptions{})
 	type want struct {
 		code codes.Code
 	}
@@ -399,9 +567,123 @@ func (suite *HandlersTestSuite) TestGetURLsByUserID() {
 	suite.wg.Wait()
 }
 
+func (suite *HandlersTestSuite) TestImportExportURLs() {
+	// create a client
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	token := suite.secretaryService.Encode(uuid.New().String())
+	md := metadata.New(map[string]string{"user": token})
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	c := pb.NewShortenerClient(conn)
+
+	// import URLs keeping the sURL of the first one
+	importStream, err := c.ImportURLs(ctx)
+	if err != nil {
+		suite.T().Fatalf("Could not perform request: %s", err)
+	}
+	requests := []*pb.ImportURLRequest{
+		{ShortUrl: "http://localhost:8080/imported-grpc", FullUrl: "https://www.ozon.kz"},
+		{FullUrl: "https://www.ozon.by", ExpiresAt: timestamppb.New(time.Now().Add(time.Hour))},
+		{FullUrl: "some-invalid-url"},
+	}
+	for _, request := range requests {
+		err = importStream.Send(request)
+		assert.Nil(suite.T(), err)
+	}
+	importResponse, err := importStream.CloseAndRecv()
+	assert.Nil(suite.T(), err)
+	statuses := make([]string, 0, len(importResponse.Results))
+	for _, result := range importResponse.Results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(suite.T(), []string{modelurl.BatchStatusCreated, modelurl.BatchStatusCreated, modelurl.BatchStatusInvalid}, statuses)
+	assert.Equal(suite.T(), "http://localhost:8080/imported-grpc", importResponse.Results[0].ShortUrl)
+
+	// export them back
+	exportStream, err := c.ExportURLs(ctx, &emptypb.Empty{})
+	if err != nil {
+		suite.T().Fatalf("Could not perform request: %s", err)
+	}
+	exported := make(map[string]*pb.ExportedURL)
+	for {
+		exportedURL, err := exportStream.Recv()
+		if err != nil {
+			break
+		}
+		exported[exportedURL.FullUrl] = exportedURL
+	}
+	assert.Len(suite.T(), exported, 2)
+	assert.Equal(suite.T(), "http://localhost:8080/imported-grpc", exported["https://www.ozon.kz"].ShortUrl)
+	assert.NotNil(suite.T(), exported["https://www.ozon.by"].ExpiresAt)
+
+	// streams are authenticated as well
+	md = metadata.New(map[string]string{"user": "some_irrelevant_token"})
+	exportStream, _ = c.ExportURLs(metadata.NewOutgoingContext(context.Background(), md), &emptypb.Empty{})
+	_, err = exportStream.Recv()
+	e, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, e.Code())
+	suite.s.GracefulStop()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestRestoreURLBatch() {
+	// create a client
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL := "restoreSURL" + uuid.New().String()[:8]
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURL, URL: "https://www.yandex.ee/" + sURL, UserID: userID})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{sURL}, userID)
+	md := metadata.New(map[string]string{"user": userID})
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	c := pb.NewShortenerClient(conn)
+
+	resp, err := c.RestoreURLBatch(ctx, &pb.RestoreURLBatchRequest{Urls: []string{sURL, "unknownSURL"}})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(resp.Results))
+	assert.Equal(suite.T(), modelurl.RestoreOutcomeRestored, resp.Results[0].Status)
+	assert.Equal(suite.T(), modelurl.RestoreOutcomeNotFound, resp.Results[1].Status)
+	URL, err := suite.storage.Retrieve(suite.ctx, sURL)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ee/"+sURL, URL)
+
+	_, err = c.RestoreURLBatch(ctx, &pb.RestoreURLBatchRequest{})
+	e, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, e.Code())
+	suite.s.GracefulStop()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestGetDeleteJob_NotFound() {
+	// create a client
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	token := "8773a90a68ebd0fd56dffb1441682414fbec5f454eba9be6129bb00744f50d7f19fd870e97eba101a03b857c675e4836de6f5196"
+	md := metadata.New(map[string]string{"user": token})
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	c := pb.NewShortenerClient(conn)
+	_, err = c.GetDeleteJob(ctx, &pb.GetDeleteJobRequest{JobId: "unknownJobID"})
+	e, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.NotFound, e.Code())
+	suite.s.GracefulStop()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
 func (suite *HandlersTestSuite) TestDeleteURLBatch() {
 	// create a client
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(suite.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -427,16 +709,30 @@ func (suite *HandlersTestSuite) TestDeleteURLBatch() {
 				code: codes.OK,
 			},
 		},
+		{
+			name:  "Empty DELETE batch request",
+			batch: &pb.DeleteURLBatch{Urls: []string{}},
+			want: want{
+				code: codes.InvalidArgument,
+			},
+		},
 	}
 
 	// perform each test
 	for _, tt := range tests {
-		suite.T().Run("post", func(t *testing.T) {
+		suite.T().Run(tt.name, func(t *testing.T) {
 			resp, err1 := c.DeleteURLBatch(ctx, &pb.DeleteURLBatchRequest{RequestUrls: tt.batch})
 			e, _ := status.FromError(err1)
 			assert.Equal(t, tt.want.code, e.Code())
-			var response *emptypb.Empty
-			assert.IsType(t, response, resp)
+			if tt.want.code != codes.OK {
+				return
+			}
+			assert.NotEmpty(t, resp.JobId)
+			// the job stays pending until the deletion queue is flushed
+			job, err2 := c.GetDeleteJob(ctx, &pb.GetDeleteJobRequest{JobId: resp.JobId})
+			assert.Nil(t, err2)
+			assert.Equal(t, modelurl.DeleteJobPending, job.Status)
+			assert.ElementsMatch(t, tt.batch.Urls, job.Pending)
 		})
 	}
 	suite.s.GracefulStop()
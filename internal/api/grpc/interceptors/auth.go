@@ -71,3 +71,31 @@ func (a *AuthHandler) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 		return handler(newCtx, req)
 	}
 }
+
+// authServerStream wraps grpc.ServerStream to substitute its context with an authenticated one.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the authenticated context of the stream.
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor returns a new stream server interceptor that performs per-stream auth.
+func (a *AuthHandler) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		newCtx, token, err := a.AuthFunc(stream.Context())
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			err = stream.SendHeader(metadata.New(map[string]string{UserAuthKey: token}))
+			if err != nil {
+				return err
+			}
+		}
+		return handler(srv, &authServerStream{ServerStream: stream, ctx: newCtx})
+	}
+}
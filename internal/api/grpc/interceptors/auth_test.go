@@ -93,7 +93,8 @@ func TestAuthHandler_UnaryServerInterceptor_NoMD(t *testing.T) {
 	defer ctrl.Finish()
 	storageInit := mocks.NewMockURLStorage(ctrl)
 	storageInit.EXPECT().PingDB().Return(nil)
-	server, err := handlers.InitServer(context.Background(), cfg, storageInit)
+	clickStorageInit := mocks.NewMockClickStorage(ctrl)
+	server, err := handlers.InitServer(context.Background(), cfg, storageInit, clickStorageInit)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,7 +137,8 @@ func TestAuthHandler_UnaryServerInterceptor_CorrectMD(t *testing.T) {
 	defer ctrl.Finish()
 	storageInit := mocks.NewMockURLStorage(ctrl)
 	storageInit.EXPECT().PingDB().Return(nil)
-	server, err := handlers.InitServer(context.Background(), cfg, storageInit)
+	clickStorageInit := mocks.NewMockClickStorage(ctrl)
+	server, err := handlers.InitServer(context.Background(), cfg, storageInit, clickStorageInit)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -177,7 +179,8 @@ func TestAuthHandler_UnaryServerInterceptor_IncorrectMD(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	storageInit := mocks.NewMockURLStorage(ctrl)
-	server, err := handlers.InitServer(context.Background(), cfg, storageInit)
+	clickStorageInit := mocks.NewMockClickStorage(ctrl)
+	server, err := handlers.InitServer(context.Background(), cfg, storageInit, clickStorageInit)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,8 +29,13 @@ type ShortenerClient interface {
 	GetURLsByUserID(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetURLsByUserIDResponse, error)
 	PostURL(ctx context.Context, in *PostURLRequest, opts ...grpc.CallOption) (*PostURLResponse, error)
 	PostURLBatch(ctx context.Context, in *PostURLBatchRequest, opts ...grpc.CallOption) (*PostURLBatchResponse, error)
-	DeleteURLBatch(ctx context.Context, in *DeleteURLBatchRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteURLBatch(ctx context.Context, in *DeleteURLBatchRequest, opts ...grpc.CallOption) (*DeleteURLBatchResponse, error)
+	GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*GetDeleteJobResponse, error)
+	RestoreURLBatch(ctx context.Context, in *RestoreURLBatchRequest, opts ...grpc.CallOption) (*RestoreURLBatchResponse, error)
 	GetUptime(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetUptimeResponse, error)
+	GetURLStats(ctx context.Context, in *GetURLStatsRequest, opts ...grpc.CallOption) (*GetURLStatsResponse, error)
+	ExportURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Shortener_ExportURLsClient, error)
+	ImportURLs(ctx context.Context, opts ...grpc.CallOption) (Shortener_ImportURLsClient, error)
 }
 
 type shortenerClient struct {
@@ -95,8 +100,8 @@ func (c *shortenerClient) PostURLBatch(ctx context.Context, in *PostURLBatchRequ
 	return out, nil
 }
 
-func (c *shortenerClient) DeleteURLBatch(ctx context.Context, in *DeleteURLBatchRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
-	out := new(emptypb.Empty)
+func (c *shortenerClient) DeleteURLBatch(ctx context.Context, in *DeleteURLBatchRequest, opts ...grpc.CallOption) (*DeleteURLBatchResponse, error) {
+	out := new(DeleteURLBatchResponse)
 	err := c.cc.Invoke(ctx, "/proto.Shortener/DeleteURLBatch", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -104,6 +109,24 @@ func (c *shortenerClient) DeleteURLBatch(ctx context.Context, in *DeleteURLBatch
 	return out, nil
 }
 
+func (c *shortenerClient) GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*GetDeleteJobResponse, error) {
+	out := new(GetDeleteJobResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/GetDeleteJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) RestoreURLBatch(ctx context.Context, in *RestoreURLBatchRequest, opts ...grpc.CallOption) (*RestoreURLBatchResponse, error) {
+	out := new(RestoreURLBatchResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/RestoreURLBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerClient) GetUptime(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetUptimeResponse, error) {
 	out := new(GetUptimeResponse)
 	err := c.cc.Invoke(ctx, "/proto.Shortener/GetUptime", in, out, opts...)
@@ -113,6 +136,81 @@ func (c *shortenerClient) GetUptime(ctx context.Context, in *emptypb.Empty, opts
 	return out, nil
 }
 
+func (c *shortenerClient) GetURLStats(ctx context.Context, in *GetURLStatsRequest, opts ...grpc.CallOption) (*GetURLStatsResponse, error) {
+	out := new(GetURLStatsResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/GetURLStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) ExportURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Shortener_ExportURLsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[0], "/proto.Shortener/ExportURLs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerExportURLsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Shortener_ExportURLsClient interface {
+	Recv() (*ExportedURL, error)
+	grpc.ClientStream
+}
+
+type shortenerExportURLsClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerExportURLsClient) Recv() (*ExportedURL, error) {
+	m := new(ExportedURL)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shortenerClient) ImportURLs(ctx context.Context, opts ...grpc.CallOption) (Shortener_ImportURLsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[1], "/proto.Shortener/ImportURLs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerImportURLsClient{stream}
+	return x, nil
+}
+
+type Shortener_ImportURLsClient interface {
+	Send(*ImportURLRequest) error
+	CloseAndRecv() (*ImportURLsResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerImportURLsClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerImportURLsClient) Send(m *ImportURLRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shortenerImportURLsClient) CloseAndRecv() (*ImportURLsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportURLsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
@@ -123,8 +221,13 @@ type ShortenerServer interface {
 	GetURLsByUserID(context.Context, *emptypb.Empty) (*GetURLsByUserIDResponse, error)
 	PostURL(context.Context, *PostURLRequest) (*PostURLResponse, error)
 	PostURLBatch(context.Context, *PostURLBatchRequest) (*PostURLBatchResponse, error)
-	DeleteURLBatch(context.Context, *DeleteURLBatchRequest) (*emptypb.Empty, error)
+	DeleteURLBatch(context.Context, *DeleteURLBatchRequest) (*DeleteURLBatchResponse, error)
+	GetDeleteJob(context.Context, *GetDeleteJobRequest) (*GetDeleteJobResponse, error)
+	RestoreURLBatch(context.Context, *RestoreURLBatchRequest) (*RestoreURLBatchResponse, error)
 	GetUptime(context.Context, *emptypb.Empty) (*GetUptimeResponse, error)
+	GetURLStats(context.Context, *GetURLStatsRequest) (*GetURLStatsResponse, error)
+	ExportURLs(*emptypb.Empty, Shortener_ExportURLsServer) error
+	ImportURLs(Shortener_ImportURLsServer) error
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -150,12 +253,27 @@ func (UnimplementedShortenerServer) PostURL(context.Context, *PostURLRequest) (*
 func (UnimplementedShortenerServer) PostURLBatch(context.Context, *PostURLBatchRequest) (*PostURLBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PostURLBatch not implemented")
 }
-func (UnimplementedShortenerServer) DeleteURLBatch(context.Context, *DeleteURLBatchRequest) (*emptypb.Empty, error) {
+func (UnimplementedShortenerServer) DeleteURLBatch(context.Context, *DeleteURLBatchRequest) (*DeleteURLBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteURLBatch not implemented")
 }
+func (UnimplementedShortenerServer) GetDeleteJob(context.Context, *GetDeleteJobRequest) (*GetDeleteJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeleteJob not implemented")
+}
+func (UnimplementedShortenerServer) RestoreURLBatch(context.Context, *RestoreURLBatchRequest) (*RestoreURLBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreURLBatch not implemented")
+}
 func (UnimplementedShortenerServer) GetUptime(context.Context, *emptypb.Empty) (*GetUptimeResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUptime not implemented")
 }
+func (UnimplementedShortenerServer) GetURLStats(context.Context, *GetURLStatsRequest) (*GetURLStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetURLStats not implemented")
+}
+func (UnimplementedShortenerServer) ExportURLs(*emptypb.Empty, Shortener_ExportURLsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportURLs not implemented")
+}
+func (UnimplementedShortenerServer) ImportURLs(Shortener_ImportURLsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportURLs not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -295,6 +413,42 @@ func _Shortener_DeleteURLBatch_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_GetDeleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetDeleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/GetDeleteJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetDeleteJob(ctx, req.(*GetDeleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_RestoreURLBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreURLBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).RestoreURLBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/RestoreURLBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).RestoreURLBatch(ctx, req.(*RestoreURLBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Shortener_GetUptime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -313,6 +467,71 @@ func _Shortener_GetUptime_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_GetURLStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetURLStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetURLStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/GetURLStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetURLStats(ctx, req.(*GetURLStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_ExportURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerServer).ExportURLs(m, &shortenerExportURLsServer{stream})
+}
+
+type Shortener_ExportURLsServer interface {
+	Send(*ExportedURL) error
+	grpc.ServerStream
+}
+
+type shortenerExportURLsServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerExportURLsServer) Send(m *ExportedURL) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Shortener_ImportURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerServer).ImportURLs(&shortenerImportURLsServer{stream})
+}
+
+type Shortener_ImportURLsServer interface {
+	SendAndClose(*ImportURLsResponse) error
+	Recv() (*ImportURLRequest, error)
+	grpc.ServerStream
+}
+
+type shortenerImportURLsServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerImportURLsServer) SendAndClose(m *ImportURLsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shortenerImportURLsServer) Recv() (*ImportURLRequest, error) {
+	m := new(ImportURLRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -348,11 +567,34 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteURLBatch",
 			Handler:    _Shortener_DeleteURLBatch_Handler,
 		},
+		{
+			MethodName: "GetDeleteJob",
+			Handler:    _Shortener_GetDeleteJob_Handler,
+		},
+		{
+			MethodName: "RestoreURLBatch",
+			Handler:    _Shortener_RestoreURLBatch_Handler,
+		},
 		{
 			MethodName: "GetUptime",
 			Handler:    _Shortener_GetUptime_Handler,
 		},
+		{
+			MethodName: "GetURLStats",
+			Handler:    _Shortener_GetURLStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportURLs",
+			Handler:       _Shortener_ExportURLs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportURLs",
+			Handler:       _Shortener_ImportURLs_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "url_shortener.proto",
 }
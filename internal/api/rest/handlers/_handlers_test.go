@@ -51,7 +51,7 @@ func (suite *HandlersTestSuite) SetupTest() {
 	suite.wg = &sync.WaitGroup{}
 	suite.wg.Add(1)
 	suite.storage, _ = inpsql.InitStorage(suite.ctx, suite.wg, cfg.StorageConfig)
-	suite.shortenerService, _ = shortener.InitShortener(suite.storage)
+	suite.shortenerService, _ = shortener.InitShortener(suite.storage, cfg)
 	suite.urlHandler, _ = InitURLHandler(suite.shortenerService, cfg.ServerConfig)
 	suite.secretaryService, _ = secretary.NewSecretaryService(cfg.SecretConfig)
 	suite.cookieHandler, _ = middleware.NewCookieHandler(suite.secretaryService, cfg.SecretConfig)
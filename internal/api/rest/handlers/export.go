@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+)
+
+// formats of exported and imported URLs
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// formatContentTypes maps formats of exported and imported URLs to their content types.
+var formatContentTypes = map[string]string{
+	FormatJSON:   "application/json",
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// csvHeader defines columns of CSV exports, imports may omit all columns but original_url.
+var csvHeader = []string{"short_url", "original_url", "expires_at"}
+
+const (
+	// maxImportSize limits the size of an import request body
+	maxImportSize = 10 << 20
+	// importBatchSize is the number of imported URLs shortened at once
+	importBatchSize = 1000
+)
+
+// HandleExportURLs streams all URLs of a user along with their metadata in a format set by the format
+// query parameter, URLs are read and written page by page.
+func (h *URLHandler) HandleExportURLs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequestsExportURLs.Add(1)
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = FormatJSON
+		}
+		contentType, ok := formatContentTypes[format]
+		if !ok {
+			http.Error(w, fmt.Sprintf("%s: format must be one of json, csv or ndjson", format), http.StatusBadRequest)
+			return
+		}
+		// retrieve user identifier
+		userID, err := h.getUserID(r)
+		if err != nil {
+			log.Println("HandleExportURLs:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u, err := url.Parse(h.cfg.BaseURL)
+		if err != nil {
+			log.Println("HandleExportURLs:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		encoder := newExportEncoder(w, format)
+		// the response is started with the first page so that failures of reading it are still reported
+		started := false
+		start := func() error {
+			started = true
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="urls.%s"`, format))
+			return encoder.begin()
+		}
+		// timing DB operations is done per page by the processor, the export as a whole lasts as long as the request
+		err = h.processor.ExportByUserID(r.Context(), userID, func(URLs []modelurl.FullURL) error {
+			if !started {
+				err := start()
+				if err != nil {
+					return err
+				}
+			}
+			exportURLs := make([]modeldto.ExportURL, 0, len(URLs))
+			for _, fullURL := range URLs {
+				u.Path = fullURL.SURL
+				exportURLs = append(exportURLs, modeldto.ExportURL{SURL: u.String(), URL: fullURL.Submitted(), ExpiresAt: fullURL.ExpiresAt})
+			}
+			err := encoder.encode(exportURLs)
+			if err != nil {
+				return err
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil && !started {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleExportURLs:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			}
+			log.Println("HandleExportURLs:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the response is already being sent, hence errors are for logging only
+		if err != nil {
+			log.Println("HandleExportURLs:", err)
+			return
+		}
+		if !started {
+			err = start()
+			if err != nil {
+				log.Println("HandleExportURLs:", err)
+				return
+			}
+		}
+		err = encoder.end()
+		if err != nil {
+			log.Println("HandleExportURLs:", err)
+		}
+	}
+}
+
+// HandleImportURLs shortens URLs of an import in a format set by the format query parameter or by
+// Content-Type and reports results per row, sURLs of imported rows are kept where possible.
+func (h *URLHandler) HandleImportURLs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequestsImportURLs.Add(1)
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = importFormatByContentType(r.Header.Get("Content-Type"))
+		}
+		if _, ok := formatContentTypes[format]; !ok {
+			http.Error(w, fmt.Sprintf("%s: format must be one of json, csv or ndjson", format), http.StatusBadRequest)
+			return
+		}
+		// retrieve user identifier
+		userID, err := h.getUserID(r)
+		if err != nil {
+			log.Println("HandleImportURLs:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rows, rowErrors, err := decodeImport(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+		if err != nil {
+			log.Println("HandleImportURLs:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(rows) == 0 {
+			log.Println("HandleImportURLs:", "empty import received")
+			http.Error(w, "empty import received", http.StatusBadRequest)
+			return
+		}
+		responseImportURLs := make([]modeldto.ResponseImportURL, len(rows))
+		items := make([]modelurl.BatchItem, 0, importBatchSize)
+		positions := make([]int, 0, importBatchSize)
+		for i, row := range rows {
+			responseImportURLs[i].Row = i + 1
+			if rowErrors[i] != nil {
+				responseImportURLs[i].Status = modelurl.BatchStatusInvalid
+				responseImportURLs[i].Error = rowErrors[i].Error()
+			} else {
+				items = append(items, modelurl.BatchItem{
+					URL:  row.URL,
+					Opts: modelurl.EncodeOptions{Alias: modelurl.ImportAlias(row.SURL), ExpiresAt: row.ExpiresAt},
+				})
+				positions = append(positions, i)
+			}
+			if len(items) < importBatchSize && i < len(rows)-1 {
+				continue
+			}
+			if len(items) == 0 {
+				continue
+			}
+			err = h.importBatch(r.Context(), items, positions, userID, responseImportURLs)
+			if err != nil {
+				var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+				if errors.As(err, &contextTimeoutExceededError) {
+					log.Println("HandleImportURLs:", err)
+					http.Error(w, err.Error(), http.StatusGatewayTimeout)
+					return
+				}
+				log.Println("HandleImportURLs:", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			items = items[:0]
+			positions = positions[:0]
+		}
+		resBody, err := json.Marshal(responseImportURLs)
+		if err != nil {
+			log.Println("HandleImportURLs:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, err = w.Write(resBody)
+		if err != nil {
+			log.Println("HandleImportURLs:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
+// importBatch shortens items at once and fills responses at positions of the items.
+func (h *URLHandler) importBatch(ctx context.Context, items []modelurl.BatchItem, positions []int, userID string, responses []modeldto.ResponseImportURL) error {
+	// set context timeout to 5 s for timing DB operations on a whole batch
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	results, err := h.processor.EncodeBatch(ctx, items, userID)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(h.cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	for j, result := range results {
+		response := &responses[positions[j]]
+		response.Status = result.Status
+		if result.SURL != "" {
+			u.Path = result.SURL
+			response.SURL = u.String()
+		}
+		if result.Err != nil && response.Status != modelurl.BatchStatusExists {
+			response.Error = result.Err.Error()
+		}
+	}
+	return nil
+}
+
+// exportEncoder writes an export in a format page by page.
+type exportEncoder struct {
+	w       io.Writer
+	format  string
+	csv     *csv.Writer
+	json    *json.Encoder
+	written int
+}
+
+// newExportEncoder initializes an exportEncoder writing to w in format.
+func newExportEncoder(w io.Writer, format string) *exportEncoder {
+	return &exportEncoder{w: w, format: format, csv: csv.NewWriter(w), json: json.NewEncoder(w)}
+}
+
+// begin writes an opening of an export, it must be called before the first page.
+func (e *exportEncoder) begin() error {
+	switch e.format {
+	case FormatCSV:
+		err := e.csv.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		e.csv.Flush()
+		return e.csv.Error()
+	case FormatNDJSON:
+		return nil
+	default:
+		_, err := io.WriteString(e.w, "[")
+		return err
+	}
+}
+
+// encode writes a page of exportURLs one by one.
+func (e *exportEncoder) encode(exportURLs []modeldto.ExportURL) error {
+	switch e.format {
+	case FormatCSV:
+		for _, exportURL := range exportURLs {
+			var expiresAt string
+			if exportURL.ExpiresAt != nil {
+				expiresAt = exportURL.ExpiresAt.Format(time.RFC3339)
+			}
+			err := e.csv.Write([]string{exportURL.SURL, exportURL.URL, expiresAt})
+			if err != nil {
+				return err
+			}
+		}
+		e.csv.Flush()
+		return e.csv.Error()
+	case FormatNDJSON:
+		for _, exportURL := range exportURLs {
+			err := e.json.Encode(exportURL)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		for _, exportURL := range exportURLs {
+			b, err := json.Marshal(exportURL)
+			if err != nil {
+				return err
+			}
+			if e.written > 0 {
+				b = append([]byte(","), b...)
+			}
+			_, err = e.w.Write(b)
+			if err != nil {
+				return err
+			}
+			e.written++
+		}
+		return nil
+	}
+}
+
+// end writes a closing of an export, it must be called after the last page.
+func (e *exportEncoder) end() error {
+	if e.format == FormatJSON {
+		_, err := io.WriteString(e.w, "]")
+		return err
+	}
+	return nil
+}
+
+// decodeImport reads rows of an import in format, rowErrors hold reasons of rows which could not be parsed
+// while err is set if the import as a whole is malformed.
+func decodeImport(r io.Reader, format string) (rows []modeldto.ExportURL, rowErrors []error, err error) {
+	switch format {
+	case FormatCSV:
+		return decodeCSVImport(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxImportSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var row modeldto.ExportURL
+			rowErrors = append(rowErrors, json.Unmarshal(line, &row))
+			rows = append(rows, row)
+		}
+		return rows, rowErrors, scanner.Err()
+	default:
+		var rawRows []json.RawMessage
+		err = json.NewDecoder(r).Decode(&rawRows)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, rawRow := range rawRows {
+			var row modeldto.ExportURL
+			rowErrors = append(rowErrors, json.Unmarshal(rawRow, &row))
+			rows = append(rows, row)
+		}
+		return rows, rowErrors, nil
+	}
+}
+
+// decodeCSVImport reads rows of a CSV import with a header, columns are matched by their names.
+func decodeCSVImport(r io.Reader) (rows []modeldto.ExportURL, rowErrors []error, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil, nil, errors.New("original_url column is missing")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		row := modeldto.ExportURL{SURL: field(record, "short_url"), URL: field(record, "original_url")}
+		var rowError error
+		if expiresAt := field(record, "expires_at"); expiresAt != "" {
+			t, err := time.Parse(time.RFC3339, expiresAt)
+			if err != nil {
+				rowError = err
+			}
+			row.ExpiresAt = &t
+		}
+		rows = append(rows, row)
+		rowErrors = append(rowErrors, rowError)
+	}
+	return rows, rowErrors, nil
+}
+
+// importFormatByContentType returns a format of an import by its content type, defaults to JSON.
+func importFormatByContentType(contentType string) string {
+	for format, formatContentType := range formatContentTypes {
+		if strings.HasPrefix(contentType, formatContentType) {
+			return format
+		}
+	}
+	return FormatJSON
+}
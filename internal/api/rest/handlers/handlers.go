@@ -14,8 +14,12 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/clientip"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
 	"github.com/go-chi/chi"
@@ -30,20 +34,35 @@ var (
 	numberOfRequestsPingDB           = expvar.NewInt("handlers.numberOfRequestsPingDB")
 	numberOfRequestsDeleteURLBatch   = expvar.NewInt("handlers.numberOfRequestsDeleteURLBatch")
 	numberOfRequestsJSONPostURLBatch = expvar.NewInt("handlers.numberOfRequestsJSONPostURLBatch")
+	numberOfRequestsGetURLStats      = expvar.NewInt("handlers.numberOfRequestsGetURLStats")
+	numberOfRequestsExportURLs       = expvar.NewInt("handlers.numberOfRequestsExportURLs")
+	numberOfRequestsImportURLs       = expvar.NewInt("handlers.numberOfRequestsImportURLs")
+	numberOfRequestsGetDeleteJob     = expvar.NewInt("handlers.numberOfRequestsGetDeleteJob")
+	numberOfRequestsRestoreURLBatch  = expvar.NewInt("handlers.numberOfRequestsRestoreURLBatch")
+	numberOfRequestsPostPassword     = expvar.NewInt("handlers.numberOfRequestsPostPassword")
 )
 
 // URLHandler defines data structure handling and provides support for adding new implementations.
 type URLHandler struct {
 	processor shortener.Processor
+	analytics analytics.Processor
 	cfg       *config.Config
+	clientIP  *clientip.Resolver
 }
 
 // InitURLHandler initializes a URLHandler object and sets its attributes.
-func InitURLHandler(processor shortener.Processor, cfg *config.Config) (*URLHandler, error) {
+func InitURLHandler(processor shortener.Processor, analytics analytics.Processor, cfg *config.Config) (*URLHandler, error) {
 	if processor == nil {
 		return nil, fmt.Errorf("nil Shortener Service was passed to service URL Handler initializer")
 	}
-	return &URLHandler{processor: processor, cfg: cfg}, nil
+	if analytics == nil {
+		return nil, fmt.Errorf("nil Analytics Service was passed to service URL Handler initializer")
+	}
+	resolver, err := clientip.NewResolver(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &URLHandler{processor: processor, analytics: analytics, cfg: cfg, clientIP: resolver}, nil
 }
 
 // HandleGetStats provides client with statistics on URLs and clients.
@@ -67,6 +86,26 @@ func (h *URLHandler) HandleGetStats() http.HandlerFunc {
 			URLs:  nURLs,
 			Users: nUsers,
 		}
+		purgeStats, err := h.processor.GetPurgeStats(ctx)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var purgeNotSupported *serviceErrors.ServicePurgeNotSupported
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleGetStats:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			} else if !errors.As(err, &purgeNotSupported) {
+				log.Println("HandleGetStats:", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			responseStats.Purge = &modeldto.ResponsePurgeStats{
+				PurgedURLs:     purgeStats.PurgedURLs,
+				LastPurgeAt:    purgeStats.LastPurgeAt,
+				LastPurgedURLs: purgeStats.LastPurgedURLs,
+			}
+		}
 		resBody, err := json.Marshal(responseStats)
 		if err != nil {
 			log.Println("HandleGetStats:", err)
@@ -99,20 +138,33 @@ func (h *URLHandler) HandleGetURL() http.HandlerFunc {
 		if err != nil {
 			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 			var deletedError *storageErrors.DeletedError
+			var expiredError *storageErrors.ExpiredError
+			var blockedError *storageErrors.BlockedError
+			var passwordRequiredError *serviceErrors.ServicePasswordRequired
 			if errors.As(err, &contextTimeoutExceededError) {
 				log.Println("HandleGetURL:", err)
 				http.Error(w, err.Error(), http.StatusGatewayTimeout)
 				return
-			} else if errors.As(err, &deletedError) {
+			} else if errors.As(err, &passwordRequiredError) {
+				log.Println("HandleGetURL:", err)
+				servePasswordForm(w, http.StatusOK, "")
+				return
+			} else if errors.As(err, &deletedError) || errors.As(err, &expiredError) {
 				log.Println("HandleGetURL:", err)
 				http.Error(w, err.Error(), http.StatusGone)
 				return
+			} else if errors.As(err, &blockedError) {
+				log.Println("HandleGetURL:", err)
+				http.Error(w, err.Error(), http.StatusUnavailableForLegalReasons)
+				return
 			}
 			log.Println("HandleGetURL:", err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		log.Println("HandleGetURL: retrieved URL", URL)
+		// record a click event asynchronously, it does not delay the redirect
+		h.analytics.RecordClick(sURL, r.Referer(), r.UserAgent(), h.getClientIP(r))
 		// set and send response
 		w.Header().Set("Location", URL)
 		w.WriteHeader(http.StatusTemporaryRedirect)
@@ -161,9 +213,12 @@ func (h *URLHandler) HandleGetURLsByUserID() http.HandlerFunc {
 		for _, fullURL := range URLs {
 			u.Path = fullURL.SURL
 			responseURL := modeldto.ResponseFullURL{
-				URL:  fullURL.URL,
+				URL:  fullURL.Submitted(),
 				SURL: u.String(),
 			}
+			if fullURL.OriginalURL != "" {
+				responseURL.CanonicalURL = fullURL.URL
+			}
 			responseURLs = append(responseURLs, responseURL)
 		}
 		resBody, err := json.Marshal(responseURLs)
@@ -182,6 +237,103 @@ func (h *URLHandler) HandleGetURLsByUserID() http.HandlerFunc {
 	}
 }
 
+// HandleGetURLStats provides the owner of a shortened URL with its click statistics using modeldto.ResponseClickStats
+// schema, optional "from" and "to" query parameters define the time range in RFC 3339 format.
+func (h *URLHandler) HandleGetURLStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequestsGetURLStats.Add(1)
+		// set context timeout to 500 ms for timing DB operations
+		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		defer cancel()
+		sURL := chi.URLParam(r, "urlID")
+		// parse optional time range, zero values are replaced with defaults by the service
+		var from, to time.Time
+		var err error
+		if value := r.URL.Query().Get("from"); value != "" {
+			from, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				log.Println("HandleGetURLStats:", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if value := r.URL.Query().Get("to"); value != "" {
+			to, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				log.Println("HandleGetURLStats:", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		// retrieve user identifier
+		userID, err := h.getUserID(r)
+		if err != nil {
+			log.Println("HandleGetURLStats:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats, err := h.analytics.GetClickStats(ctx, sURL, userID, from, to)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var incorrectStatsRangeError *serviceErrors.ServiceIncorrectStatsRange
+			var notOwnedURLError *serviceErrors.ServiceNotOwnedURL
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleGetURLStats:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			} else if errors.As(err, &incorrectStatsRangeError) {
+				log.Println("HandleGetURLStats:", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if errors.As(err, &notOwnedURLError) {
+				log.Println("HandleGetURLStats:", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Println("HandleGetURLStats:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// create and serialize response object into JSON
+		responseStats := modeldto.ResponseClickStats{
+			SURL:           sURL,
+			From:           stats.From,
+			To:             stats.To,
+			TotalClicks:    stats.TotalClicks,
+			UniqueVisitors: stats.UniqueVisitors,
+			Hourly:         make([]modeldto.ResponseClickBucket, 0, len(stats.Hourly)),
+			Daily:          make([]modeldto.ResponseClickBucket, 0, len(stats.Daily)),
+			TopReferrers:   make([]modeldto.ResponseClickCounter, 0, len(stats.TopReferrers)),
+			TopUserAgents:  make([]modeldto.ResponseClickCounter, 0, len(stats.TopUserAgents)),
+		}
+		for _, bucket := range stats.Hourly {
+			responseStats.Hourly = append(responseStats.Hourly, modeldto.ResponseClickBucket{Start: bucket.Start, Clicks: bucket.Clicks})
+		}
+		for _, bucket := range stats.Daily {
+			responseStats.Daily = append(responseStats.Daily, modeldto.ResponseClickBucket{Start: bucket.Start, Clicks: bucket.Clicks})
+		}
+		for _, counter := range stats.TopReferrers {
+			responseStats.TopReferrers = append(responseStats.TopReferrers, modeldto.ResponseClickCounter{Value: counter.Value, Clicks: counter.Clicks})
+		}
+		for _, counter := range stats.TopUserAgents {
+			responseStats.TopUserAgents = append(responseStats.TopUserAgents, modeldto.ResponseClickCounter{Value: counter.Value, Clicks: counter.Clicks})
+		}
+		resBody, err := json.Marshal(responseStats)
+		if err != nil {
+			log.Println("HandleGetURLStats:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(resBody)
+		if err != nil {
+			log.Println("HandleGetURLStats:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
 // HandlePostURL stores the original URL with its shortened version.
 func (h *URLHandler) HandlePostURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -211,14 +363,25 @@ func (h *URLHandler) HandlePostURL() http.HandlerFunc {
 		}
 		log.Println("POST request detected for", string(b))
 		// encode URL into sURL and store
-		sURL, err := h.processor.Encode(ctx, string(b), userID)
+		sURL, err := h.processor.Encode(ctx, string(b), userID, modelurl.EncodeOptions{})
 		if err != nil {
 			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 			var alreadyExistsError *storageErrors.AlreadyExistsError
+			var urlTakenError *storageErrors.URLTakenError
+			var destinationDenied *serviceErrors.ServiceDestinationDenied
 			if errors.As(err, &contextTimeoutExceededError) {
 				log.Println("HandlePostURL:", err)
 				http.Error(w, err.Error(), http.StatusGatewayTimeout)
 				return
+			} else if errors.As(err, &destinationDenied) {
+				log.Println("HandlePostURL:", err)
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			} else if errors.As(err, &urlTakenError) {
+				// URL belongs to another user, there is no valid sURL to respond with
+				log.Println("HandlePostURL:", err)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
 			} else if errors.As(err, &alreadyExistsError) {
 				// response with existing sURL when URL violates unique constraint
 				u.Path = alreadyExistsError.ValidSURL
@@ -291,14 +454,26 @@ func (h *URLHandler) JSONHandlePostURL() http.HandlerFunc {
 		}
 		log.Println("JSON POST request detected for", post.URL)
 		// encode URL into sURL and store them
-		sURL, err := h.processor.Encode(ctx, post.URL, userID)
+		sURL, err := h.processor.Encode(ctx, post.URL, userID, modelurl.EncodeOptions{Alias: post.Alias, ExpiresAt: post.ExpiresAt, Password: post.Password})
 		if err != nil {
 			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
 			var alreadyExistsError *storageErrors.AlreadyExistsError
+			var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+			var urlTakenError *storageErrors.URLTakenError
+			var destinationDenied *serviceErrors.ServiceDestinationDenied
 			if errors.As(err, &contextTimeoutExceededError) {
 				log.Println("JSONHandlePostURL:", err)
 				http.Error(w, err.Error(), http.StatusGatewayTimeout)
 				return
+			} else if errors.As(err, &destinationDenied) {
+				log.Println("JSONHandlePostURL:", err)
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			} else if errors.As(err, &sURLAlreadyExistsError) || errors.As(err, &urlTakenError) {
+				// requested alias or URL is taken, there is no valid sURL to respond with
+				log.Println("JSONHandlePostURL:", err)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
 			} else if errors.As(err, &alreadyExistsError) {
 				// response with existing sURL when URL violates unique constraint
 				u.Path = alreadyExistsError.ValidSURL
@@ -349,6 +524,33 @@ func (h *URLHandler) JSONHandlePostURL() http.HandlerFunc {
 	}
 }
 
+// HandleCompact triggers compaction of the storage on demand.
+func (h *URLHandler) HandleCompact() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// compaction rewrites the whole storage, hence the timeout is longer than for regular DB operations
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		err := h.processor.Compact(ctx)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var compactionNotSupported *serviceErrors.ServiceCompactionNotSupported
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleCompact:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			} else if errors.As(err, &compactionNotSupported) {
+				log.Println("HandleCompact:", err)
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+				return
+			}
+			log.Println("HandleCompact:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 // HandlePingDB handles PSQL DB pinging to check connection status.
 func (h *URLHandler) HandlePingDB() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -376,6 +578,12 @@ func (h *URLHandler) getUserID(r *http.Request) (string, error) {
 	return hex.EncodeToString(userID), nil
 }
 
+// getClientIP retrieves client IP address, headers set by reverse proxies are only trusted if the request was
+// received from a trusted proxy.
+func (h *URLHandler) getClientIP(r *http.Request) string {
+	return h.clientIP.Resolve(r.RemoteAddr, r.Header.Get("X-Real-IP"), r.Header.Get("X-Forwarded-For"))
+}
+
 // HandleDeleteURLBatch sets a tag for deletion for a batch of URL entries in DB.
 func (h *URLHandler) HandleDeleteURLBatch() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -409,9 +617,164 @@ func (h *URLHandler) HandleDeleteURLBatch() http.HandlerFunc {
 			return
 		}
 		log.Println("DELETE request detected for", deleteURLs)
-		// perform asynchronous deletion, any underlying errors are for logging only
-		h.processor.Delete(ctx, deleteURLs, userID)
+		// perform asynchronous deletion, deletion tasks must be accepted prior to the response
+		jobID, err := h.processor.Delete(ctx, deleteURLs, userID)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var serviceIncorrectInputURL *serviceErrors.ServiceIncorrectInputURL
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleDeleteURLBatch:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			} else if errors.As(err, &serviceIncorrectInputURL) {
+				log.Println("HandleDeleteURLBatch:", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Println("HandleDeleteURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resBody, err := json.Marshal(modeldto.ResponseDeleteJob{JobID: jobID})
+		if err != nil {
+			log.Println("HandleDeleteURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// set and send response body, the job status is available at Location
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/user/jobs/"+jobID)
 		w.WriteHeader(http.StatusAccepted)
+		_, err = w.Write(resBody)
+		if err != nil {
+			log.Println("HandleDeleteURLBatch:", err)
+		}
+	}
+}
+
+// HandleRestoreURLBatch restores URLs deleted by the client within the grace window and reports an outcome per
+// sURL, restored URLs keep their sURLs.
+func (h *URLHandler) HandleRestoreURLBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequestsRestoreURLBatch.Add(1)
+		// set context timeout to 500 ms for timing DB operations
+		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		defer cancel()
+		// read POST body
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Println("HandleRestoreURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// deserialize JSON into slice
+		restoreURLs := make([]string, 0)
+		err = json.Unmarshal(b, &restoreURLs)
+		if err != nil {
+			log.Println("HandleRestoreURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// retrieve user identifier
+		userID, err := h.getUserID(r)
+		if err != nil {
+			log.Println("HandleRestoreURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Println("RESTORE request detected for", restoreURLs)
+		results, err := h.processor.Restore(ctx, restoreURLs, userID)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var serviceIncorrectInputURL *serviceErrors.ServiceIncorrectInputURL
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleRestoreURLBatch:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			} else if errors.As(err, &serviceIncorrectInputURL) {
+				log.Println("HandleRestoreURLBatch:", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Println("HandleRestoreURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		responseURLs := make([]modeldto.ResponseRestoreURL, 0, len(results))
+		for _, result := range results {
+			responseURLs = append(responseURLs, modeldto.ResponseRestoreURL{SURL: result.SURL, Status: result.Status})
+		}
+		resBody, err := json.Marshal(responseURLs)
+		if err != nil {
+			log.Println("HandleRestoreURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(resBody)
+		if err != nil {
+			log.Println("HandleRestoreURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
+// HandleGetDeleteJob provides client with a status of a deletion job and outcomes of its sURLs.
+func (h *URLHandler) HandleGetDeleteJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequestsGetDeleteJob.Add(1)
+		// set context timeout to 500 ms for timing DB operations
+		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		defer cancel()
+		jobID := chi.URLParam(r, "jobID")
+		// retrieve user identifier
+		userID, err := h.getUserID(r)
+		if err != nil {
+			log.Println("HandleGetDeleteJob:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		job, err := h.processor.GetDeleteJob(ctx, jobID, userID)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var jobNotFoundError *storageErrors.JobNotFoundError
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("HandleGetDeleteJob:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+				return
+			} else if errors.As(err, &jobNotFoundError) {
+				log.Println("HandleGetDeleteJob:", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Println("HandleGetDeleteJob:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// lists are always present in the response, even if empty
+		responseJob := modeldto.ResponseDeleteJobStatus{
+			JobID:    job.ID,
+			Status:   job.Status,
+			Deleted:  append([]string{}, job.Deleted...),
+			NotOwned: append([]string{}, job.NotOwned...),
+			NotFound: append([]string{}, job.NotFound...),
+			Pending:  append([]string{}, job.Pending...),
+			Error:    job.Error,
+		}
+		resBody, err := json.Marshal(responseJob)
+		if err != nil {
+			log.Println("HandleGetDeleteJob:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// set and send response body
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(resBody)
+		if err != nil {
+			log.Println("HandleGetDeleteJob:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 	}
 }
 
@@ -420,9 +783,6 @@ func (h *URLHandler) HandleDeleteURLBatch() http.HandlerFunc {
 func (h *URLHandler) JSONHandlePostURLBatch() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		numberOfRequestsJSONPostURLBatch.Add(1)
-		// set context timeout to 500 ms for timing DB operations
-		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
-		defer cancel()
 		// check for POST body content type compliance
 		if r.Header.Get("Content-Type") != "application/json" {
 			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
@@ -462,40 +822,43 @@ func (h *URLHandler) JSONHandlePostURLBatch() http.HandlerFunc {
 			log.Println("JSONHandlePostURLBatch:", err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		}
-		// encode URLs into sURLs and store them
-		var responseBatchURLs []modeldto.ResponseBatchURL
+		// encode URLs into sURLs and store them at once
+		items := make([]modelurl.BatchItem, 0, len(post))
 		for _, requestBatchURL := range post {
-			sURL, err1 := h.processor.Encode(ctx, requestBatchURL.URL, userID)
-			if err1 != nil {
-				var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
-				var alreadyExistsError *storageErrors.AlreadyExistsError
-				if errors.As(err1, &contextTimeoutExceededError) {
-					// if ctx.Err() happens, abort all operations
-					log.Println("JSONHandlePostURLBatch:", err1)
-					http.Error(w, err1.Error(), http.StatusGatewayTimeout)
-					return
-				} else if errors.As(err1, &alreadyExistsError) {
-					// response with existing sURL when URL violates unique constraint
-					sURL = alreadyExistsError.ValidSURL
-					log.Println("JSONHandlePostURLBatch: stored", requestBatchURL.URL, "as", sURL)
-					u.Path = sURL
-					responseBatchURL := modeldto.ResponseBatchURL{
-						CorrelationID: requestBatchURL.CorrelationID,
-						SURL:          u.String(),
-					}
-					responseBatchURLs = append(responseBatchURLs, responseBatchURL)
-					continue
-				}
-				log.Println("JSONHandlePostURLBatch:", err1)
-				http.Error(w, err1.Error(), http.StatusBadRequest)
+			items = append(items, modelurl.BatchItem{
+				URL:  requestBatchURL.URL,
+				Opts: modelurl.EncodeOptions{Alias: requestBatchURL.Alias, ExpiresAt: requestBatchURL.ExpiresAt, Password: requestBatchURL.Password},
+			})
+		}
+		// set context timeout for timing DB operations and hashing passwords
+		ctx, cancel := context.WithTimeout(r.Context(), modelurl.BatchTimeout(items))
+		defer cancel()
+		results, err := h.processor.EncodeBatch(ctx, items, userID)
+		if err != nil {
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			if errors.As(err, &contextTimeoutExceededError) {
+				log.Println("JSONHandlePostURLBatch:", err)
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
 				return
 			}
-			log.Println("JSONHandlePostURLBatch: stored", requestBatchURL.URL, "as", sURL)
-			u.Path = sURL
+			log.Println("JSONHandlePostURLBatch:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		responseBatchURLs := make([]modeldto.ResponseBatchURL, 0, len(results))
+		for i, result := range results {
 			responseBatchURL := modeldto.ResponseBatchURL{
-				CorrelationID: requestBatchURL.CorrelationID,
-				SURL:          u.String(),
+				CorrelationID: post[i].CorrelationID,
+				Status:        result.Status,
+			}
+			if result.SURL != "" {
+				u.Path = result.SURL
+				responseBatchURL.SURL = u.String()
+			}
+			if result.Err != nil && responseBatchURL.Status != modelurl.BatchStatusExists {
+				responseBatchURL.Error = result.Err.Error()
 			}
+			log.Println("JSONHandlePostURLBatch:", post[i].URL, responseBatchURL.Status, result.SURL)
 			responseBatchURLs = append(responseBatchURLs, responseBatchURL)
 		}
 		// serialize struct into JSON
@@ -7,18 +7,26 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	analyticsService "github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/secretary/v1"
 	shortenerService "github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/guarded"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
 	"github.com/go-chi/chi"
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
@@ -42,15 +50,19 @@ func TestInitURLHandler_Fail(t *testing.T) {
 	// necessary to set default parameters here since they are set in cfg.ParseFlags() which causes error
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
-	_, err := InitURLHandler(nil, cfg)
+	dir := t.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
+	_, err := InitURLHandler(nil, nil, cfg)
 	assert.Equal(t, fmt.Errorf("nil Shortener Service was passed to service URL Handler initializer"), err)
 }
 
 type HandlersTestSuite struct {
 	suite.Suite
 	storage          storage.URLStorage
+	clickStorage     storage.ClickStorage
 	shortenerService shortenerService.Processor
+	analyticsService analyticsService.Processor
 	urlHandler       *URLHandler
 	cookieHandler    *middleware.CookieHandler
 	secretaryService *secretary.Secretary
@@ -66,16 +78,21 @@ func (suite *HandlersTestSuite) SetupTest() {
 	// necessary to set default parameters here since they are set in cfg.ParseFlags() which causes error
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := suite.T().TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
+	cfg.RestoreGraceWindow = time.Hour
 	// parsing flags causes flag redefined errors
 	//cfg.ParseFlags()
 	suite.ctx, suite.cancel = context.WithCancel(context.Background())
 	suite.wg = &sync.WaitGroup{}
 	suite.wg.Add(1)
 	suite.storage, _ = infile.InitStorage(suite.ctx, suite.wg, cfg)
-	suite.shortenerService, _ = shortener.InitShortener(suite.storage)
-	suite.urlHandler, _ = InitURLHandler(suite.shortenerService, cfg)
+	suite.clickStorage, _ = infile.InitClickStorage(suite.ctx, suite.wg, cfg)
+	suite.shortenerService, _ = shortener.InitShortener(suite.storage, cfg)
+	suite.analyticsService, _ = analytics.InitAnalytics(suite.storage, suite.clickStorage)
+	suite.urlHandler, _ = InitURLHandler(suite.shortenerService, suite.analyticsService, cfg)
 	suite.secretaryService = secretary.NewSecretaryService(cfg)
 	suite.cookieHandler, _ = middleware.NewCookieHandler(suite.secretaryService, cfg)
 	suite.router = chi.NewRouter()
@@ -88,9 +105,9 @@ func TestHandlersTestSuite(t *testing.T) {
 
 func (suite *HandlersTestSuite) TestHandleGetStats() {
 	userID := suite.secretaryService.Encode(uuid.New().String())
-	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID)
-	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.com", userID)
-	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.kz", userID)
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID, modelurl.EncodeOptions{})
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.com", userID, modelurl.EncodeOptions{})
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.kz", userID, modelurl.EncodeOptions{})
 	suite.router.Get("/api/internal/stats", suite.urlHandler.HandleGetStats())
 
 	// set tests' parameters
@@ -137,7 +154,15 @@ func (suite *HandlersTestSuite) TestHandleGetStats() {
 
 func (suite *HandlersTestSuite) TestHandleGetURL() {
 	userID := suite.secretaryService.Encode(uuid.New().String())
-	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID)
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID, modelurl.EncodeOptions{})
+	// expired entries cannot be created via service, hence put it into storage directly
+	expiredAt := time.Now().Add(-time.Minute)
+	expiredSURL := randStringBytes(10)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: expiredSURL, URL: "https://www.yandex.by", UserID: userID, ExpiresAt: &expiredAt})
+	deletedSURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.google.com", userID, modelurl.EncodeOptions{})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{deletedSURL}, userID)
+	// deletion by a user other than the owner must be ignored
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{sURL}, suite.secretaryService.Encode(uuid.New().String()))
 	suite.router.Get("/{urlID}", suite.urlHandler.HandleGetURL())
 
 	// set tests' parameters
@@ -170,6 +195,20 @@ func (suite *HandlersTestSuite) TestHandleGetURL() {
 				code: 400,
 			},
 		},
+		{
+			name: "Expired GET query",
+			sURL: expiredSURL,
+			want: want{
+				code: 410,
+			},
+		},
+		{
+			name: "Deleted GET query",
+			sURL: deletedSURL,
+			want: want{
+				code: 410,
+			},
+		},
 	}
 
 	// perform each test
@@ -191,6 +230,92 @@ func (suite *HandlersTestSuite) TestHandleGetURL() {
 	suite.wg.Wait()
 }
 
+func TestHandleGetURL_Blocked(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewDefaultConfiguration()
+	cfg.BaseURL = "http://localhost:8080"
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
+	cfg.ThreatFeedPath = filepath.Join(dir, "feed.txt")
+	_ = os.WriteFile(cfg.ThreatFeedPath, []byte("0.0.0.0 evil.com\n"), 0644)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	backend, _ := infile.InitStorage(ctx, wg, cfg)
+	clickStorage, _ := infile.InitClickStorage(ctx, wg, cfg)
+	_ = backend.Dump(ctx, modelstorage.URLStorageEntry{SURL: "someSURL", URL: "https://www.evil.com", UserID: "someUserID"})
+	s, _ := guarded.InitStorage(ctx, wg, backend, cfg)
+	shortenerService, _ := shortener.InitShortener(s, cfg)
+	analyticsService, _ := analytics.InitAnalytics(s, clickStorage)
+	urlHandler, _ := InitURLHandler(shortenerService, analyticsService, cfg)
+	router := chi.NewRouter()
+	router.Get("/{urlID}", urlHandler.HandleGetURL())
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	assert.Eventually(t, func() bool {
+		res, err := resty.New().R().Get(ts.URL + "/someSURL")
+		return err == nil && res.StatusCode() == http.StatusUnavailableForLegalReasons
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	wg.Wait()
+}
+
+func TestHandlePostPassword(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewDefaultConfiguration()
+	cfg.BaseURL = "http://localhost:8080"
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
+	cfg.PasswordAttempts = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	s, _ := infile.InitStorage(ctx, wg, cfg)
+	clickStorage, _ := infile.InitClickStorage(ctx, wg, cfg)
+	shortenerService, _ := shortener.InitShortener(s, cfg)
+	analyticsService, _ := analytics.InitAnalytics(s, clickStorage)
+	urlHandler, _ := InitURLHandler(shortenerService, analyticsService, cfg)
+	router := chi.NewRouter()
+	router.Get("/{urlID}", urlHandler.HandleGetURL())
+	router.Post("/{urlID}", urlHandler.HandlePostPassword())
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	sURL, err := shortenerService.Encode(ctx, "https://www.yandex.uz", "someUserID", modelurl.EncodeOptions{Password: "secret"})
+	assert.Nil(t, err)
+	client := resty.New().SetRedirectPolicy(resty.NoRedirectPolicy())
+
+	// the password form is served instead of a redirect
+	res, err := client.R().Get(ts.URL + "/" + sURL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+	assert.Contains(t, res.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, res.String(), `name="password"`)
+
+	// an incorrect password re-serves the form, the correct one redirects
+	res, _ = client.R().SetFormData(map[string]string{"password": "wrong"}).Post(ts.URL + "/" + sURL)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode())
+	assert.Contains(t, res.String(), "Incorrect password")
+	res, _ = client.R().SetFormData(map[string]string{"password": "secret"}).Post(ts.URL + "/" + sURL)
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode())
+	assert.Equal(t, "https://www.yandex.uz", res.Header().Get("Location"))
+
+	// attempts are rejected once too many of them fail
+	for i := 0; i < cfg.PasswordAttempts; i++ {
+		res, _ = client.R().SetFormData(map[string]string{"password": "wrong"}).Post(ts.URL + "/" + sURL)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode())
+	}
+	res, _ = client.R().SetFormData(map[string]string{"password": "secret"}).Post(ts.URL + "/" + sURL)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode())
+	assert.NotEmpty(t, res.Header().Get("Retry-After"))
+
+	// forwarding headers of clients which are not trusted proxies do not lift the limit
+	res, _ = client.R().SetHeader("X-Real-IP", "5.6.7.8").SetHeader("X-Forwarded-For", "5.6.7.8").
+		SetFormData(map[string]string{"password": "secret"}).Post(ts.URL + "/" + sURL)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode())
+	cancel()
+	wg.Wait()
+}
+
 func (suite *HandlersTestSuite) TestHandlePostURL() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	suite.router.Post("/", suite.urlHandler.HandlePostURL())
@@ -225,6 +350,20 @@ func (suite *HandlersTestSuite) TestHandlePostURL() {
 				code: 400,
 			},
 		},
+		{
+			name: "Denied POST query (scheme)",
+			URL:  "javascript:alert(1)",
+			want: want{
+				code: 422,
+			},
+		},
+		{
+			name: "Denied POST query (link-local address)",
+			URL:  "http://169.254.169.254/latest/meta-data/",
+			want: want{
+				code: 422,
+			},
+		},
 	}
 
 	// perform each test
@@ -247,6 +386,8 @@ func (suite *HandlersTestSuite) TestHandlePostURL() {
 func (suite *HandlersTestSuite) TestJSONHandlePostURL() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	suite.router.Post("/api/shorten", suite.urlHandler.JSONHandlePostURL())
+	// file storage persists between runs, hence a random alias
+	alias := randStringBytes(10)
 
 	// set tests' parameters
 	type want struct {
@@ -284,6 +425,45 @@ func (suite *HandlersTestSuite) TestJSONHandlePostURL() {
 				code: 400,
 			},
 		},
+		{
+			name: "Correct POST query with alias",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.kz",
+				Alias: alias,
+			},
+			want: want{
+				code: 201,
+			},
+		},
+		{
+			name: "Conflicting POST query with taken alias",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.by",
+				Alias: alias,
+			},
+			want: want{
+				code: 409,
+			},
+		},
+		{
+			name: "Invalid POST query (invalid alias)",
+			URL: modeldto.RequestURL{
+				URL:   "https://www.yandex.by",
+				Alias: "q3/report",
+			},
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name: "Denied POST query (file scheme)",
+			URL: modeldto.RequestURL{
+				URL: "file:///etc/passwd",
+			},
+			want: want{
+				code: 422,
+			},
+		},
 	}
 
 	// perform each test
@@ -309,7 +489,7 @@ func (suite *HandlersTestSuite) TestHandleGetURLsByUserID() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	userIDFull := suite.secretaryService.Encode(uuid.New().String())
 	userIDEmpty := suite.secretaryService.Encode(uuid.New().String())
-	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.nd", userIDFull)
+	_, _ = suite.shortenerService.Encode(suite.ctx, "https://www.yandex.nd", userIDFull, modelurl.EncodeOptions{})
 	suite.router.Get("/api/user/urls", suite.urlHandler.HandleGetURLsByUserID())
 
 	// set tests' parameters
@@ -366,13 +546,222 @@ func (suite *HandlersTestSuite) TestHandleGetURLsByUserID() {
 	suite.wg.Wait()
 }
 
+func (suite *HandlersTestSuite) TestHandleGetURLStats() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	userIDOwner := suite.secretaryService.Encode(uuid.New().String())
+	userIDOther := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.st", userIDOwner, modelurl.EncodeOptions{})
+	clickedAt := time.Now().UTC()
+	_ = suite.clickStorage.(*infile.ClickStorage).Flush([]modelstorage.ClickEntry{
+		{SURL: sURL, ClickedAt: clickedAt, Referrer: "https://www.google.com", UserAgent: "someUserAgent", ClientIP: "127.0.0.1"},
+		{SURL: sURL, ClickedAt: clickedAt, Referrer: "https://www.google.com", UserAgent: "someUserAgent", ClientIP: "127.0.0.1"},
+		{SURL: sURL, ClickedAt: clickedAt, Referrer: "", UserAgent: "someOtherUserAgent", ClientIP: "127.0.0.2"},
+	})
+	suite.router.Get("/api/user/urls/{urlID}/stats", suite.urlHandler.HandleGetURLStats())
+
+	// set tests' parameters
+	type want struct {
+		code           int
+		totalClicks    int64
+		uniqueVisitors int64
+	}
+	tests := []struct {
+		name  string
+		token string
+		query string
+		want  want
+	}{
+		{
+			name:  "Owner GET query",
+			token: userIDOwner,
+			want: want{
+				code:           200,
+				totalClicks:    3,
+				uniqueVisitors: 2,
+			},
+		},
+		{
+			name:  "Owner GET query out of range",
+			token: userIDOwner,
+			query: "?from=2022-01-01T00:00:00Z&to=2022-01-31T00:00:00Z",
+			want: want{
+				code: 200,
+			},
+		},
+		{
+			name:  "Incorrect range GET query",
+			token: userIDOwner,
+			query: "?from=yesterday",
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:  "Foreign GET query",
+			token: userIDOther,
+			want: want{
+				code: 404,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			client := resty.New()
+			client.SetCookie(&http.Cookie{
+				Name:  "user",
+				Value: tt.token,
+				Path:  "/",
+			})
+			res, err := client.R().Get(suite.ts.URL + "/api/user/urls/" + sURL + "/stats" + tt.query)
+			if err != nil {
+				t.Log(err)
+				t.Fatalf("Could not perform GET stats request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var stats modeldto.ResponseClickStats
+				err = json.Unmarshal(res.Body(), &stats)
+				if err != nil {
+					t.Fatalf("Could not unmarshal response body")
+				}
+				assert.Equal(t, tt.want.totalClicks, stats.TotalClicks)
+				assert.Equal(t, tt.want.uniqueVisitors, stats.UniqueVisitors)
+			}
+		})
+	}
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandleImportExportURLs() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	suite.router.Get("/api/user/urls/export", suite.urlHandler.HandleExportURLs())
+	suite.router.Post("/api/user/urls/import", suite.urlHandler.HandleImportURLs())
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	client := resty.New()
+	client.SetCookie(&http.Cookie{
+		Name:  "user",
+		Value: userID,
+		Path:  "/",
+	})
+
+	// set tests' parameters
+	type want struct {
+		code     int
+		statuses []string
+	}
+	tests := []struct {
+		name        string
+		format      string
+		contentType string
+		body        string
+		want        want
+	}{
+		{
+			name:        "CSV import",
+			format:      "csv",
+			contentType: "text/csv",
+			body:        "short_url,original_url,expires_at\nhttp://localhost:8080/imported-csv,https://www.avito.ru,\n,https://www.avito.kz,not-a-time\n",
+			want: want{
+				code:     201,
+				statuses: []string{modelurl.BatchStatusCreated, modelurl.BatchStatusInvalid},
+			},
+		},
+		{
+			name:        "NDJSON import detected by content type",
+			contentType: "application/x-ndjson",
+			body:        `{"original_url":"https://www.avito.by"}` + "\n\n" + `{"original_url":"https://www.avito.uz"}` + "\n",
+			want: want{
+				code:     201,
+				statuses: []string{modelurl.BatchStatusCreated, modelurl.BatchStatusCreated},
+			},
+		},
+		{
+			name:        "JSON import",
+			format:      "json",
+			contentType: "application/json",
+			body:        `[{"short_url":"imported-csv","original_url":"https://www.avito.am"}]`,
+			want: want{
+				code:     201,
+				statuses: []string{modelurl.BatchStatusConflict},
+			},
+		},
+		{
+			name:        "Malformed import",
+			format:      "json",
+			contentType: "application/json",
+			body:        `{"original_url":`,
+			want: want{
+				code: 400,
+			},
+		},
+		{
+			name:   "Unsupported format",
+			format: "xml",
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			res, err := client.R().
+				SetQueryParam("format", tt.format).
+				SetHeader("Content-Type", tt.contentType).
+				SetBody(tt.body).
+				Post(suite.ts.URL + "/api/user/urls/import")
+			if err != nil {
+				t.Fatalf("Could not perform import request")
+			}
+			t.Logf(string(res.Body()))
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.statuses != nil {
+				var responseImportURLs []modeldto.ResponseImportURL
+				_ = json.Unmarshal(res.Body(), &responseImportURLs)
+				statuses := make([]string, 0, len(responseImportURLs))
+				for _, responseImportURL := range responseImportURLs {
+					statuses = append(statuses, responseImportURL.Status)
+				}
+				assert.Equal(t, tt.want.statuses, statuses)
+			}
+		})
+	}
+
+	// export imported URLs in every format
+	res, err := client.R().Get(suite.ts.URL + "/api/user/urls/export?format=json")
+	if err != nil {
+		suite.T().Fatalf("Could not perform export request")
+	}
+	assert.Equal(suite.T(), 200, res.StatusCode())
+	assert.Equal(suite.T(), "application/json", res.Header().Get("Content-Type"))
+	var exportURLs []modeldto.ExportURL
+	err = json.Unmarshal(res.Body(), &exportURLs)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), exportURLs, 3)
+	res, _ = client.R().Get(suite.ts.URL + "/api/user/urls/export?format=csv")
+	assert.Equal(suite.T(), 200, res.StatusCode())
+	assert.Contains(suite.T(), string(res.Body()), "http://localhost:8080/imported-csv,https://www.avito.ru,")
+	res, _ = client.R().Get(suite.ts.URL + "/api/user/urls/export?format=ndjson")
+	assert.Equal(suite.T(), 200, res.StatusCode())
+	assert.Equal(suite.T(), 3, strings.Count(string(res.Body()), "\n"))
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
 func (suite *HandlersTestSuite) TestJSONHandlePostURLBatch() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	suite.router.Post("/api/shorten/batch", suite.urlHandler.JSONHandlePostURLBatch())
 
 	// set tests' parameters
 	type want struct {
-		code int
+		code     int
+		statuses []string
 	}
 	tests := []struct {
 		name  string
@@ -392,7 +781,35 @@ func (suite *HandlersTestSuite) TestJSONHandlePostURLBatch() {
 				},
 			},
 			want: want{
-				code: 201,
+				code:     201,
+				statuses: []string{modelurl.BatchStatusCreated, modelurl.BatchStatusCreated},
+			},
+		},
+		{
+			name: "Partially failed POST batch query",
+			batch: []modeldto.RequestBatchURL{
+				{
+					CorrelationID: "test1",
+					URL:           "https://www.ozon.ru",
+					Alias:         "batch-alias",
+				},
+				{
+					CorrelationID: "test2",
+					URL:           "https://www.wildberries.ru",
+					Alias:         "batch-alias",
+				},
+				{
+					CorrelationID: "test3",
+					URL:           "some-invalid-url",
+				},
+				{
+					CorrelationID: "test4",
+					URL:           "javascript:void(0)",
+				},
+			},
+			want: want{
+				code:     201,
+				statuses: []string{modelurl.BatchStatusCreated, modelurl.BatchStatusConflict, modelurl.BatchStatusInvalid, modelurl.BatchStatusDenied},
 			},
 		},
 		{
@@ -416,6 +833,15 @@ func (suite *HandlersTestSuite) TestJSONHandlePostURLBatch() {
 			}
 			t.Logf(string(res.Body()))
 			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.statuses != nil {
+				var responseBatchURLs []modeldto.ResponseBatchURL
+				_ = json.Unmarshal(res.Body(), &responseBatchURLs)
+				statuses := make([]string, 0, len(responseBatchURLs))
+				for _, responseBatchURL := range responseBatchURLs {
+					statuses = append(statuses, responseBatchURL.Status)
+				}
+				assert.Equal(t, tt.want.statuses, statuses)
+			}
 		})
 	}
 	defer suite.ts.Close()
@@ -426,6 +852,7 @@ func (suite *HandlersTestSuite) TestJSONHandlePostURLBatch() {
 func (suite *HandlersTestSuite) TestHandleDeleteURLBatch() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	suite.router.Delete("/api/user/urls", suite.urlHandler.HandleDeleteURLBatch())
+	suite.router.Get("/api/user/jobs/{jobID}", suite.urlHandler.HandleGetDeleteJob())
 
 	// set tests' parameters
 	type want struct {
@@ -443,6 +870,13 @@ func (suite *HandlersTestSuite) TestHandleDeleteURLBatch() {
 				code: 202,
 			},
 		},
+		{
+			name:  "Empty DELETE batch request",
+			batch: []string{},
+			want: want{
+				code: 400,
+			},
+		},
 	}
 
 	// perform each test
@@ -457,6 +891,30 @@ func (suite *HandlersTestSuite) TestHandleDeleteURLBatch() {
 			}
 			t.Logf(string(res.Body()))
 			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code != http.StatusAccepted {
+				return
+			}
+			var responseJob modeldto.ResponseDeleteJob
+			err = json.Unmarshal(res.Body(), &responseJob)
+			assert.Nil(t, err)
+			assert.Equal(t, "/api/user/jobs/"+responseJob.JobID, res.Header().Get("Location"))
+			// the job stays pending until the deletion queue is flushed, the client keeps the user cookie
+			res, err = client.R().Get(suite.ts.URL + "/api/user/jobs/" + responseJob.JobID)
+			if err != nil {
+				t.Fatalf("Could not perform GET request")
+			}
+			assert.Equal(t, http.StatusOK, res.StatusCode())
+			var responseStatus modeldto.ResponseDeleteJobStatus
+			err = json.Unmarshal(res.Body(), &responseStatus)
+			assert.Nil(t, err)
+			assert.Equal(t, modelurl.DeleteJobPending, responseStatus.Status)
+			assert.ElementsMatch(t, tt.batch, responseStatus.Pending)
+			// jobs of other users are not disclosed
+			res, err = resty.New().R().Get(suite.ts.URL + "/api/user/jobs/" + responseJob.JobID)
+			if err != nil {
+				t.Fatalf("Could not perform GET request")
+			}
+			assert.Equal(t, http.StatusNotFound, res.StatusCode())
 		})
 	}
 	defer suite.ts.Close()
@@ -464,6 +922,113 @@ func (suite *HandlersTestSuite) TestHandleDeleteURLBatch() {
 	suite.wg.Wait()
 }
 
+func (suite *HandlersTestSuite) TestHandleRestoreURLBatch() {
+	suite.router.Use(suite.cookieHandler.CookieHandle)
+	userIDOwner := suite.secretaryService.Encode(uuid.New().String())
+	userIDOther := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ee", userIDOwner, modelurl.EncodeOptions{})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{sURL}, userIDOwner)
+	suite.router.Post("/api/user/urls/restore", suite.urlHandler.HandleRestoreURLBatch())
+
+	// set tests' parameters
+	type want struct {
+		code    int
+		results []modeldto.ResponseRestoreURL
+	}
+	tests := []struct {
+		name  string
+		token string
+		batch []string
+		want  want
+	}{
+		{
+			name:  "Foreign restore request",
+			token: userIDOther,
+			batch: []string{sURL},
+			want: want{
+				code:    200,
+				results: []modeldto.ResponseRestoreURL{{SURL: sURL, Status: modelurl.RestoreOutcomeNotOwned}},
+			},
+		},
+		{
+			name:  "Owner restore request",
+			token: userIDOwner,
+			batch: []string{sURL, "unknownSURL"},
+			want: want{
+				code: 200,
+				results: []modeldto.ResponseRestoreURL{
+					{SURL: sURL, Status: modelurl.RestoreOutcomeRestored},
+					{SURL: "unknownSURL", Status: modelurl.RestoreOutcomeNotFound},
+				},
+			},
+		},
+		{
+			name:  "Empty restore request",
+			token: userIDOwner,
+			batch: []string{},
+			want: want{
+				code: 400,
+			},
+		},
+	}
+
+	// perform each test
+	for _, tt := range tests {
+		suite.T().Run(tt.name, func(t *testing.T) {
+			reqBody, _ := json.Marshal(tt.batch)
+			client := resty.New()
+			client.SetCookie(&http.Cookie{
+				Name:  "user",
+				Value: tt.token,
+				Path:  "/",
+			})
+			res, err := client.R().SetBody(reqBody).Post(suite.ts.URL + "/api/user/urls/restore")
+			if err != nil {
+				t.Fatalf("Could not perform POST request")
+			}
+			assert.Equal(t, tt.want.code, res.StatusCode())
+			if tt.want.code == 200 {
+				var results []modeldto.ResponseRestoreURL
+				err = json.Unmarshal(res.Body(), &results)
+				if err != nil {
+					t.Fatalf("Could not unmarshal response body")
+				}
+				assert.Equal(t, tt.want.results, results)
+			}
+		})
+	}
+	// the restored URL is served by the same sURL
+	URL, err := suite.storage.Retrieve(suite.ctx, sURL)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ee", URL)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func (suite *HandlersTestSuite) TestHandlePostCompact() {
+	userID := suite.secretaryService.Encode(uuid.New().String())
+	sURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.ru", userID, modelurl.EncodeOptions{})
+	deletedSURL, _ := suite.shortenerService.Encode(suite.ctx, "https://www.yandex.com", userID, modelurl.EncodeOptions{})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{deletedSURL}, userID)
+	suite.router.Post("/api/internal/compact", suite.urlHandler.HandleCompact())
+	client := resty.New()
+	res, err := client.R().Post(suite.ts.URL + "/api/internal/compact")
+	if err != nil {
+		suite.T().Fatalf("Could not perform POST request")
+	}
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode())
+	// compaction must not affect entries' state
+	URL, err := suite.storage.Retrieve(suite.ctx, sURL)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+	_, err = suite.storage.Retrieve(suite.ctx, deletedSURL)
+	assert.NotNil(suite.T(), err)
+	defer suite.ts.Close()
+	suite.cancel()
+	suite.wg.Wait()
+}
+
 func (suite *HandlersTestSuite) TestHandlePingDB() {
 	suite.router.Use(suite.cookieHandler.CookieHandle)
 	suite.router.Get("/ping", suite.urlHandler.HandlePingDB())
@@ -489,15 +1054,19 @@ func BenchmarkInitURLHandler(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx := context.Background()
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = InitURLHandler(svc, cfg)
+		_, _ = InitURLHandler(svc, tracker, cfg)
 	}
 }
 
@@ -505,19 +1074,23 @@ func BenchmarkURLHandler_HandleGetURL(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx := context.Background()
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	router := chi.NewRouter()
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 	userID := secretaryService.Encode(uuid.New().String())
-	sURL, _ := svc.Encode(ctx, "https://www.yandex.ru", userID)
+	sURL, _ := svc.Encode(ctx, "https://www.yandex.ru", userID, modelurl.EncodeOptions{})
 	router.Get("/{urlID}", urlHandler.HandleGetURL())
 	client := resty.New()
 	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
@@ -533,13 +1106,17 @@ func BenchmarkURLHandler_HandleGetURLsByUserID(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx := context.Background()
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	cookieHandler, _ := middleware.NewCookieHandler(secretaryService, cfg)
 	router := chi.NewRouter()
@@ -547,7 +1124,7 @@ func BenchmarkURLHandler_HandleGetURLsByUserID(b *testing.B) {
 	defer ts.Close()
 	router.Use(cookieHandler.CookieHandle)
 	userIDFull := secretaryService.Encode(uuid.New().String())
-	_, _ = svc.Encode(ctx, "https://www.yandex.nd", userIDFull)
+	_, _ = svc.Encode(ctx, "https://www.yandex.nd", userIDFull, modelurl.EncodeOptions{})
 	router.Get("/api/user/urls", urlHandler.HandleGetURLsByUserID())
 	client := resty.New()
 	client.SetCookie(&http.Cookie{
@@ -565,13 +1142,17 @@ func BenchmarkURLHandler_HandlePostURL(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx := context.Background()
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	cookieHandler, _ := middleware.NewCookieHandler(secretaryService, cfg)
 	router := chi.NewRouter()
@@ -591,13 +1172,17 @@ func BenchmarkURLHandler_JSONHandlePostURL(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	cookieHandler, _ := middleware.NewCookieHandler(secretaryService, cfg)
 	router := chi.NewRouter()
@@ -629,13 +1214,17 @@ func BenchmarkURLHandler_HandlePingDB(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	cookieHandler, _ := middleware.NewCookieHandler(secretaryService, cfg)
 	router := chi.NewRouter()
@@ -657,13 +1246,17 @@ func BenchmarkURLHandler_JSONHandlePostURLBatch(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	cookieHandler, _ := middleware.NewCookieHandler(secretaryService, cfg)
 	router := chi.NewRouter()
@@ -701,13 +1294,17 @@ func BenchmarkURLHandler_HandleDeleteURLBatch(b *testing.B) {
 	cfg := config.NewDefaultConfiguration()
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir := b.TempDir()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	svc, _ := shortener.InitShortener(strg)
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	secretaryService := secretary.NewSecretaryService(cfg)
 	cookieHandler, _ := middleware.NewCookieHandler(secretaryService, cfg)
 	router := chi.NewRouter()
@@ -742,18 +1339,23 @@ func ExampleInitURLHandler() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Set any available endpoint handler to any custom endpoint
@@ -771,18 +1373,23 @@ func ExampleURLHandler_HandleGetURL() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
@@ -796,7 +1403,7 @@ func ExampleURLHandler_HandleGetURL() {
 	router.Get("/{urlID}", urlHandler.HandleGetURL())
 	// Prepare test data
 	userID := secretaryService.Encode(uuid.New().String())
-	sURL, _ := svc.Encode(ctx, "https://www.example-url-1.com", userID)
+	sURL, _ := svc.Encode(ctx, "https://www.example-url-1.com", userID, modelurl.EncodeOptions{})
 	// Create a new client
 	client := resty.New()
 	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
@@ -820,18 +1427,23 @@ func ExampleURLHandler_HandlePostURL() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
@@ -867,18 +1479,23 @@ func ExampleURLHandler_JSONHandlePostURL() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
@@ -918,18 +1535,23 @@ func ExampleURLHandler_JSONHandlePostURLBatch() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
@@ -976,18 +1598,23 @@ func ExampleURLHandler_HandleDeleteURLBatch() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
@@ -1025,18 +1652,23 @@ func ExampleURLHandler_HandleGetURLsByUserID() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
@@ -1052,7 +1684,7 @@ func ExampleURLHandler_HandleGetURLsByUserID() {
 	router.Get("/api/user/urls", urlHandler.HandleGetURLsByUserID())
 	// prepare test data
 	userIDFull := secretaryService.Encode(uuid.New().String())
-	_, _ = svc.Encode(ctx, "https://www.example-url-6.com", userIDFull)
+	_, _ = svc.Encode(ctx, "https://www.example-url-6.com", userIDFull, modelurl.EncodeOptions{})
 	// Create a new client
 	client := resty.New()
 	client.SetCookie(&http.Cookie{
@@ -1078,18 +1710,23 @@ func ExampleURLHandler_HandlePingDB() {
 	// Set parameters explicitly for error-prone example running
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
-	cfg.FileStoragePath = "url_storage.json"
+	dir, _ := os.MkdirTemp("", "url_shortener")
+	defer os.RemoveAll(dir)
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ClickStoragePath = filepath.Join(dir, "click_storage.json")
 	cfg.AuthKey = "user"
 	// Add context and wait group for storage operation control
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
-	// Initialize storage
+	// Initialize storages
 	strg, _ := infile.InitStorage(ctx, wg, cfg)
-	// Initialize shortener service
-	svc, _ := shortener.InitShortener(strg)
+	clickStrg, _ := infile.InitClickStorage(ctx, wg, cfg)
+	// Initialize shortener and analytics services
+	svc, _ := shortener.InitShortener(strg, cfg)
+	tracker, _ := analytics.InitAnalytics(strg, clickStrg)
 	// Initialize URL handler
-	urlHandler, _ := InitURLHandler(svc, cfg)
+	urlHandler, _ := InitURLHandler(svc, tracker, cfg)
 	// Initialize router
 	router := chi.NewRouter()
 	// Initialize secretary service
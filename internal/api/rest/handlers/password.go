@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/modeldto"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/go-chi/chi"
+)
+
+// maxPasswordFormSize limits the size of a password form body.
+const maxPasswordFormSize = 4 << 10
+
+// passwordForm is a page asking for a password of a protected sURL, the form is posted back to the sURL.
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post">
+<p>This link is password-protected.</p>
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}<input type="password" name="password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// servePasswordForm renders passwordForm with an optional error message.
+func servePasswordForm(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	err := passwordForm.Execute(w, modeldto.PasswordForm{Error: message})
+	if err != nil {
+		log.Println("servePasswordForm:", err)
+	}
+}
+
+// HandlePostPassword verifies a password posted from the password form of a protected sURL and redirects to
+// the original URL once it matches, failed attempts are limited per sURL and client.
+func (h *URLHandler) HandlePostPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequestsPostPassword.Add(1)
+		// set context timeout to 500 ms for timing DB operations
+		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		defer cancel()
+		sURL := chi.URLParam(r, "urlID")
+		log.Println("POST password request detected for", sURL)
+		r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormSize)
+		err := r.ParseForm()
+		if err != nil {
+			log.Println("HandlePostPassword:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		URL, err := h.processor.Unlock(ctx, sURL, r.PostForm.Get("password"), h.getClientIP(r))
+		if err != nil {
+			var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+			var tooManyAttemptsError *serviceErrors.ServiceTooManyAttempts
+			var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+			var deletedError *storageErrors.DeletedError
+			var expiredError *storageErrors.ExpiredError
+			var blockedError *storageErrors.BlockedError
+			log.Println("HandlePostPassword:", err)
+			switch {
+			case errors.As(err, &incorrectPasswordError):
+				servePasswordForm(w, http.StatusUnauthorized, "Incorrect password, try again.")
+			case errors.As(err, &tooManyAttemptsError):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyAttemptsError.RetryAfter.Seconds()))))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+			case errors.As(err, &contextTimeoutExceededError):
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			case errors.As(err, &deletedError) || errors.As(err, &expiredError):
+				http.Error(w, err.Error(), http.StatusGone)
+			case errors.As(err, &blockedError):
+				http.Error(w, err.Error(), http.StatusUnavailableForLegalReasons)
+			default:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		log.Println("HandlePostPassword: retrieved URL", URL)
+		h.analytics.RecordClick(sURL, r.Referer(), r.UserAgent(), h.getClientIP(r))
+		// the form is not to be posted to URL, hence the redirect switches to GET
+		w.Header().Set("Location", URL)
+		w.WriteHeader(http.StatusSeeOther)
+	}
+}
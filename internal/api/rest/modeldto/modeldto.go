@@ -1,10 +1,15 @@
 // Package modeldto provides locally used types and their structure for data transfer objects.
 package modeldto
 
+import "time"
+
 type (
 	// RequestURL is used in JSONHandlePostURL
 	RequestURL struct {
-		URL string `json:"url"`
+		URL       string     `json:"url"`
+		Alias     string     `json:"alias,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		Password  string     `json:"password,omitempty"`
 	}
 
 	// ResponseURL is used in JSONHandlePostURL
@@ -12,28 +17,111 @@ type (
 		SURL string `json:"result"`
 	}
 
-	// ResponseFullURL is used in HandleGetURLsByUserID
+	// ResponseFullURL is used in HandleGetURLsByUserID, URL is given as submitted and CanonicalURL is set if it
+	// differs from URL
 	ResponseFullURL struct {
-		URL  string `json:"original_url"`
-		SURL string `json:"short_url"`
+		URL          string `json:"original_url"`
+		CanonicalURL string `json:"canonical_url,omitempty"`
+		SURL         string `json:"short_url"`
 	}
 
 	// RequestBatchURL is used in JSONHandlePostURLBatch
 	RequestBatchURL struct {
-		CorrelationID string `json:"correlation_id"`
-		URL           string `json:"original_url"`
+		CorrelationID string     `json:"correlation_id"`
+		URL           string     `json:"original_url"`
+		Alias         string     `json:"alias,omitempty"`
+		ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+		Password      string     `json:"password,omitempty"`
 	}
 
 	// ResponseBatchURL is used in JSONHandlePostURLBatch
 	ResponseBatchURL struct {
 		CorrelationID string `json:"correlation_id"`
-		SURL          string `json:"short_url"`
+		SURL          string `json:"short_url,omitempty"`
+		Status        string `json:"status"`
+		Error         string `json:"error,omitempty"`
+	}
+
+	// ExportURL is used in HandleExportURLs and HandleImportURLs, SURL is optional for imports and is either
+	// a sURL or a short URL
+	ExportURL struct {
+		SURL      string     `json:"short_url"`
+		URL       string     `json:"original_url"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+
+	// ResponseImportURL is used in HandleImportURLs
+	ResponseImportURL struct {
+		Row    int    `json:"row"`
+		SURL   string `json:"short_url,omitempty"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	// ResponseClickStats is used in HandleGetURLStats
+	ResponseClickStats struct {
+		SURL           string                 `json:"short_url"`
+		From           time.Time              `json:"from"`
+		To             time.Time              `json:"to"`
+		TotalClicks    int64                  `json:"total_clicks"`
+		UniqueVisitors int64                  `json:"unique_visitors"`
+		Hourly         []ResponseClickBucket  `json:"hourly"`
+		Daily          []ResponseClickBucket  `json:"daily"`
+		TopReferrers   []ResponseClickCounter `json:"top_referrers"`
+		TopUserAgents  []ResponseClickCounter `json:"top_user_agents"`
+	}
+
+	// ResponseClickBucket is used in HandleGetURLStats
+	ResponseClickBucket struct {
+		Start  time.Time `json:"start"`
+		Clicks int64     `json:"clicks"`
+	}
+
+	// ResponseClickCounter is used in HandleGetURLStats
+	ResponseClickCounter struct {
+		Value  string `json:"value"`
+		Clicks int64  `json:"clicks"`
 	}
 
 	// ResponseStats is used in HandleGetStats
 	// swagger:response responseStats
 	ResponseStats struct {
-		URLs  int64 `json:"urls"`
-		Users int64 `json:"users"`
+		URLs  int64               `json:"urls"`
+		Users int64               `json:"users"`
+		Purge *ResponsePurgeStats `json:"purge,omitempty"`
+	}
+
+	// ResponsePurgeStats is used in HandleGetStats if the storage supports purging
+	ResponsePurgeStats struct {
+		PurgedURLs     int64      `json:"purged_urls"`
+		LastPurgeAt    *time.Time `json:"last_purge_at,omitempty"`
+		LastPurgedURLs int64      `json:"last_purged_urls"`
+	}
+
+	// ResponseDeleteJob is used in HandleDeleteURLBatch
+	ResponseDeleteJob struct {
+		JobID string `json:"job_id"`
+	}
+
+	// ResponseDeleteJobStatus is used in HandleGetDeleteJob, lists hold sURLs grouped by their outcomes
+	ResponseDeleteJobStatus struct {
+		JobID    string   `json:"job_id"`
+		Status   string   `json:"status"`
+		Deleted  []string `json:"deleted"`
+		NotOwned []string `json:"not_owned"`
+		NotFound []string `json:"not_found"`
+		Pending  []string `json:"pending"`
+		Error    string   `json:"error,omitempty"`
+	}
+
+	// ResponseRestoreURL is used in HandleRestoreURLBatch, SURL holds a sURL as it was requested
+	ResponseRestoreURL struct {
+		SURL   string `json:"short_url_id"`
+		Status string `json:"status"`
+	}
+
+	// PasswordForm is rendered by HandleGetURL and HandlePostPassword for password-protected sURLs
+	PasswordForm struct {
+		Error string
 	}
 )
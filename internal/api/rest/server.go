@@ -15,6 +15,7 @@ import (
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/handlers"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/api/rest/middleware"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/secretary/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
@@ -32,12 +33,16 @@ func uptime() interface{} {
 }
 
 // InitServer returns a http.Server object ready to be listening and serving.
-func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStorage) (server *http.Server, err error) {
-	shortenerService, err := shortener.InitShortener(storage)
+func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStorage, clickStorage storage.ClickStorage) (server *http.Server, err error) {
+	shortenerService, err := shortener.InitShortener(storage, cfg)
 	if err != nil {
 		return nil, err
 	}
-	urlHandler, err := handlers.InitURLHandler(shortenerService, cfg)
+	analyticsService, err := analytics.InitAnalytics(storage, clickStorage)
+	if err != nil {
+		return nil, err
+	}
+	urlHandler, err := handlers.InitURLHandler(shortenerService, analyticsService, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +59,7 @@ func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStor
 	trustedGroup := r.Group(nil)
 	trustedGroup.Use(trustedNetHandler.TrustedNetworkHandler)
 	trustedGroup.Get("/api/internal/stats", urlHandler.HandleGetStats())
+	trustedGroup.Post("/api/internal/compact", urlHandler.HandleCompact())
 	trustedGroup.Mount("/debug", chiMiddleware.Profiler()) // see https://github.com/go-chi/chi/blob/master/middleware/profiler.go
 	expvar.Publish("system.uptime", expvar.Func(uptime))
 	mainGroup := r.Group(nil)
@@ -61,8 +67,14 @@ func InitServer(ctx context.Context, cfg *config.Config, storage storage.URLStor
 	mainGroup.Post("/api/shorten", urlHandler.JSONHandlePostURL())
 	mainGroup.Post("/api/shorten/batch", urlHandler.JSONHandlePostURLBatch())
 	mainGroup.Get("/{urlID}", urlHandler.HandleGetURL())
+	mainGroup.Post("/{urlID}", urlHandler.HandlePostPassword())
 	mainGroup.Get("/api/user/urls", urlHandler.HandleGetURLsByUserID())
+	mainGroup.Get("/api/user/urls/export", urlHandler.HandleExportURLs())
+	mainGroup.Post("/api/user/urls/import", urlHandler.HandleImportURLs())
+	mainGroup.Get("/api/user/urls/{urlID}/stats", urlHandler.HandleGetURLStats())
 	mainGroup.Delete("/api/user/urls", urlHandler.HandleDeleteURLBatch())
+	mainGroup.Post("/api/user/urls/restore", urlHandler.HandleRestoreURLBatch())
+	mainGroup.Get("/api/user/jobs/{jobID}", urlHandler.HandleGetDeleteJob())
 	mainGroup.Get("/ping", urlHandler.HandlePingDB())
 
 	var srv *http.Server
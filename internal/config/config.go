@@ -3,24 +3,102 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 // Config handles all constants and parameters.
 type Config struct {
-	ServerAddress   string `json:"server_address" env:"SERVER_ADDRESS"`
-	BaseURL         string `json:"base_url" env:"BASE_URL"`
-	EnableHTTPS     bool   `json:"enable_https" env:"ENABLE_HTTPS"`
-	UseGRPC         bool   `json:"use_grpc" env:"USE_GRPC"`
-	FileStoragePath string `json:"file_storage_path" env:"FILE_STORAGE_PATH"`
-	DatabaseDSN     string `json:"database_dsn" env:"DATABASE_DSN"`
-	UserKey         string `env:"USER_KEY" env-default:"jds__63h3_7ds"`
-	TrustedSubnet   string `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
-	AuthKey         string `env:"AUTH_KEY" env-default:"user"`
+	ServerAddress       string        `json:"server_address" env:"SERVER_ADDRESS"`
+	BaseURL             string        `json:"base_url" env:"BASE_URL"`
+	EnableHTTPS         bool          `json:"enable_https" env:"ENABLE_HTTPS"`
+	UseGRPC             bool          `json:"use_grpc" env:"USE_GRPC"`
+	FileStoragePath     string        `json:"file_storage_path" env:"FILE_STORAGE_PATH"`
+	ClickStoragePath    string        `json:"click_storage_path" env:"CLICK_STORAGE_PATH" env-default:"click_storage.json"`
+	FileCompactSize     int64         `json:"file_compact_size" env:"FILE_COMPACT_SIZE" env-default:"67108864"`
+	FileCompactRatio    float64       `json:"file_compact_ratio" env:"FILE_COMPACT_RATIO" env-default:"2"`
+	BoltStoragePath     string        `json:"bolt_storage_path" env:"BOLT_STORAGE_PATH"`
+	DatabaseDSN         string        `json:"database_dsn" env:"DATABASE_DSN"`
+	DatabaseShards      []string      `json:"database_shards" env:"DATABASE_SHARDS" env-separator:","`
+	DatabaseReplicas    []string      `json:"database_replicas" env:"DATABASE_REPLICAS" env-separator:","`
+	ReplicaCheckPeriod  time.Duration `json:"replica_check_period" env:"REPLICA_CHECK_PERIOD" env-default:"5s"`
+	ReplicaStickiness   time.Duration `json:"replica_stickiness" env:"REPLICA_STICKINESS" env-default:"10s"`
+	DBMaxOpenConns      int           `json:"db_max_open_conns" env:"DB_MAX_OPEN_CONNS" env-default:"25"`
+	DBMaxIdleConns      int           `json:"db_max_idle_conns" env:"DB_MAX_IDLE_CONNS" env-default:"25"`
+	DBConnMaxLifetime   time.Duration `json:"db_conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" env-default:"30m"`
+	DBConnMaxIdleTime   time.Duration `json:"db_conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" env-default:"5m"`
+	DedupScope          string        `json:"dedup_scope" env:"DEDUP_SCOPE" env-default:"user"`
+	CacheSize           int           `json:"cache_size" env:"CACHE_SIZE" env-default:"10000"`
+	CacheTTL            time.Duration `json:"cache_ttl" env:"CACHE_TTL" env-default:"1m"`
+	PurgeRetention      time.Duration `json:"purge_retention" env:"PURGE_RETENTION" env-default:"720h"`
+	PurgeInterval       time.Duration `json:"purge_interval" env:"PURGE_INTERVAL" env-default:"1h"`
+	PurgeBatchSize      int           `json:"purge_batch_size" env:"PURGE_BATCH_SIZE" env-default:"1000"`
+	RestoreGraceWindow  time.Duration `json:"restore_grace_window" env:"RESTORE_GRACE_WINDOW" env-default:"72h"`
+	SlugStrategy        string        `json:"slug_strategy" env:"SLUG_STRATEGY" env-default:"hashids"`
+	SlugSalt            string        `json:"slug_salt" env:"SLUG_SALT" env-default:"Some Hashing Key"`
+	SlugAlphabet        string        `json:"slug_alphabet" env:"SLUG_ALPHABET"`
+	SlugLength          int           `json:"slug_length" env:"SLUG_LENGTH"`
+	SlugNodeID          int64         `json:"slug_node_id" env:"SLUG_NODE_ID"`
+	SlugRetries         int           `json:"slug_retries" env:"SLUG_RETRIES" env-default:"5"`
+	URLNormalizers      []string      `json:"url_normalizers" env:"URL_NORMALIZERS" env-separator:"," env-default:"lowercase,punycode,default_port,sort_query,strip_fragment"`
+	URLTrackingParams   []string      `json:"url_tracking_params" env:"URL_TRACKING_PARAMS" env-separator:"," env-default:"utm_*,fbclid,gclid,yclid"`
+	PolicySchemes       []string      `json:"policy_schemes" env:"POLICY_SCHEMES" env-separator:"," env-default:"http,https"`
+	PolicyAllowPrivate  bool          `json:"policy_allow_private" env:"POLICY_ALLOW_PRIVATE"`
+	PolicyAllowlist     string        `json:"policy_allowlist" env:"POLICY_ALLOWLIST"`
+	PolicyDenylist      string        `json:"policy_denylist" env:"POLICY_DENYLIST"`
+	PolicyReloadPeriod  time.Duration `json:"policy_reload_period" env:"POLICY_RELOAD_PERIOD" env-default:"30s"`
+	ThreatFeedPath      string        `json:"threat_feed_path" env:"THREAT_FEED_PATH"`
+	ThreatFeedPeriod    time.Duration `json:"threat_feed_period" env:"THREAT_FEED_PERIOD" env-default:"1m"`
+	PasswordAttempts    int           `json:"password_attempts" env:"PASSWORD_ATTEMPTS" env-default:"5"`
+	PasswordLockout     time.Duration `json:"password_lockout" env:"PASSWORD_LOCKOUT" env-default:"15m"`
+	PasswordURLAttempts int           `json:"password_url_attempts" env:"PASSWORD_URL_ATTEMPTS" env-default:"100"`
+	ExportPageTimeout   time.Duration `json:"export_page_timeout" env:"EXPORT_PAGE_TIMEOUT" env-default:"500ms"`
+	UserKey             string        `env:"USER_KEY" env-default:"jds__63h3_7ds"`
+	TrustedSubnet       string        `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
+	TrustedProxies      []string      `json:"trusted_proxies" env:"TRUSTED_PROXIES" env-separator:","`
+	AuthKey             string        `env:"AUTH_KEY" env-default:"user"`
 }
 
+// scopes of original URL deduplication
+const (
+	// DedupScopeUser makes one user unable to shorten the same URL twice
+	DedupScopeUser = "user"
+	// DedupScopeGlobal makes all users unable to shorten a URL which was already shortened by anyone
+	DedupScopeGlobal = "global"
+)
+
+// strategies of sURL generation, an empty alphabet and a zero length select defaults of a strategy
+const (
+	// SlugStrategyHashids encodes the current time with hashids
+	SlugStrategyHashids = "hashids"
+	// SlugStrategyRandom draws random characters
+	SlugStrategyRandom = "random"
+	// SlugStrategySnowflake encodes monotonic IDs composed of time, SlugNodeID and a sequence number
+	SlugStrategySnowflake = "snowflake"
+	// SlugStrategyHash encodes a salted hash of the original URL
+	SlugStrategyHash = "hash"
+)
+
+// steps of original URL canonicalization, canonical URLs are deduplicated and redirected to
+const (
+	// URLNormalizerLowercase lowercases the scheme and the host
+	URLNormalizerLowercase = "lowercase"
+	// URLNormalizerPunycode converts internationalized host names to punycode
+	URLNormalizerPunycode = "punycode"
+	// URLNormalizerDefaultPort drops ports which are default for the scheme
+	URLNormalizerDefaultPort = "default_port"
+	// URLNormalizerSortQuery sorts query parameters by name keeping the order of repeated ones
+	URLNormalizerSortQuery = "sort_query"
+	// URLNormalizerStripTracking removes query parameters matching URLTrackingParams, a trailing * matches
+	// any suffix
+	URLNormalizerStripTracking = "strip_tracking"
+	// URLNormalizerStripFragment removes fragments
+	URLNormalizerStripFragment = "strip_fragment"
+)
+
 // NewDefaultConfiguration initializes a configuration struct.
 func NewDefaultConfiguration() *Config {
 	var cfg Config
@@ -50,6 +128,21 @@ func (cfg *Config) assignValues(a, b, f, d, c, t *string, s, g *bool) error {
 	if err != nil {
 		return err
 	}
+	if cfg.DedupScope != DedupScopeUser && cfg.DedupScope != DedupScopeGlobal {
+		return fmt.Errorf("%s: dedup scope must be either %s or %s", cfg.DedupScope, DedupScopeUser, DedupScopeGlobal)
+	}
+	switch cfg.SlugStrategy {
+	case SlugStrategyHashids, SlugStrategyRandom, SlugStrategySnowflake, SlugStrategyHash:
+	default:
+		return fmt.Errorf("%s: slug strategy must be one of %s, %s, %s or %s", cfg.SlugStrategy, SlugStrategyHashids, SlugStrategyRandom, SlugStrategySnowflake, SlugStrategyHash)
+	}
+	for _, normalizer := range cfg.URLNormalizers {
+		switch normalizer {
+		case URLNormalizerLowercase, URLNormalizerPunycode, URLNormalizerDefaultPort, URLNormalizerSortQuery, URLNormalizerStripTracking, URLNormalizerStripFragment:
+		default:
+			return fmt.Errorf("%s: URL normalizer must be one of %s, %s, %s, %s, %s or %s", normalizer, URLNormalizerLowercase, URLNormalizerPunycode, URLNormalizerDefaultPort, URLNormalizerSortQuery, URLNormalizerStripTracking, URLNormalizerStripFragment)
+		}
+	}
 	if isFlagPassed("a") || cfg.ServerAddress == "" {
 		cfg.ServerAddress = *a
 	}
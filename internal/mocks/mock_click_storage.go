@@ -0,0 +1,64 @@
+// Package mocks is a generated GoMock package.
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1 (interfaces: ClickStorage)
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	modelurl "github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	modelstorage "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockClickStorage is a mock of ClickStorage interface.
+type MockClickStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockClickStorageMockRecorder
+}
+
+// MockClickStorageMockRecorder is the mock recorder for MockClickStorage.
+type MockClickStorageMockRecorder struct {
+	mock *MockClickStorage
+}
+
+// NewMockClickStorage creates a new mock instance.
+func NewMockClickStorage(ctrl *gomock.Controller) *MockClickStorage {
+	mock := &MockClickStorage{ctrl: ctrl}
+	mock.recorder = &MockClickStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClickStorage) EXPECT() *MockClickStorageMockRecorder {
+	return m.recorder
+}
+
+// RetrieveClickStats mocks base method.
+func (m *MockClickStorage) RetrieveClickStats(arg0 context.Context, arg1 string, arg2, arg3 time.Time, arg4 int) (modelurl.ClickStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetrieveClickStats", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(modelurl.ClickStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RetrieveClickStats indicates an expected call of RetrieveClickStats.
+func (mr *MockClickStorageMockRecorder) RetrieveClickStats(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetrieveClickStats", reflect.TypeOf((*MockClickStorage)(nil).RetrieveClickStats), arg0, arg1, arg2, arg3, arg4)
+}
+
+// SendClick mocks base method.
+func (m *MockClickStorage) SendClick(arg0 modelstorage.ClickEntry) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SendClick", arg0)
+}
+
+// SendClick indicates an expected call of SendClick.
+func (mr *MockClickStorageMockRecorder) SendClick(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendClick", reflect.TypeOf((*MockClickStorage)(nil).SendClick), arg0)
+}
@@ -0,0 +1,51 @@
+// Package mocks is a generated GoMock package.
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1 (interfaces: ExpiringURLGetter)
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockExpiringURLGetter is a mock of ExpiringURLGetter interface.
+type MockExpiringURLGetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockExpiringURLGetterMockRecorder
+}
+
+// MockExpiringURLGetterMockRecorder is the mock recorder for MockExpiringURLGetter.
+type MockExpiringURLGetterMockRecorder struct {
+	mock *MockExpiringURLGetter
+}
+
+// NewMockExpiringURLGetter creates a new mock instance.
+func NewMockExpiringURLGetter(ctrl *gomock.Controller) *MockExpiringURLGetter {
+	mock := &MockExpiringURLGetter{ctrl: ctrl}
+	mock.recorder = &MockExpiringURLGetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExpiringURLGetter) EXPECT() *MockExpiringURLGetterMockRecorder {
+	return m.recorder
+}
+
+// RetrieveWithExpiry mocks base method.
+func (m *MockExpiringURLGetter) RetrieveWithExpiry(arg0 context.Context, arg1 string) (string, *time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetrieveWithExpiry", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(*time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RetrieveWithExpiry indicates an expected call of RetrieveWithExpiry.
+func (mr *MockExpiringURLGetterMockRecorder) RetrieveWithExpiry(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetrieveWithExpiry", reflect.TypeOf((*MockExpiringURLGetter)(nil).RetrieveWithExpiry), arg0, arg1)
+}
@@ -0,0 +1,49 @@
+// Package mocks is a generated GoMock package.
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1 (interfaces: OwnerChecker)
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockOwnerChecker is a mock of OwnerChecker interface.
+type MockOwnerChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockOwnerCheckerMockRecorder
+}
+
+// MockOwnerCheckerMockRecorder is the mock recorder for MockOwnerChecker.
+type MockOwnerCheckerMockRecorder struct {
+	mock *MockOwnerChecker
+}
+
+// NewMockOwnerChecker creates a new mock instance.
+func NewMockOwnerChecker(ctrl *gomock.Controller) *MockOwnerChecker {
+	mock := &MockOwnerChecker{ctrl: ctrl}
+	mock.recorder = &MockOwnerCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOwnerChecker) EXPECT() *MockOwnerCheckerMockRecorder {
+	return m.recorder
+}
+
+// IsOwner mocks base method.
+func (m *MockOwnerChecker) IsOwner(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsOwner", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsOwner indicates an expected call of IsOwner.
+func (mr *MockOwnerCheckerMockRecorder) IsOwner(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsOwner", reflect.TypeOf((*MockOwnerChecker)(nil).IsOwner), arg0, arg1, arg2)
+}
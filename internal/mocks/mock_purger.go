@@ -0,0 +1,66 @@
+// Package mocks is a generated GoMock package.
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1 (interfaces: Purger)
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	modelurl "github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockPurger is a mock of Purger interface.
+type MockPurger struct {
+	ctrl     *gomock.Controller
+	recorder *MockPurgerMockRecorder
+}
+
+// MockPurgerMockRecorder is the mock recorder for MockPurger.
+type MockPurgerMockRecorder struct {
+	mock *MockPurger
+}
+
+// NewMockPurger creates a new mock instance.
+func NewMockPurger(ctrl *gomock.Controller) *MockPurger {
+	mock := &MockPurger{ctrl: ctrl}
+	mock.recorder = &MockPurgerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPurger) EXPECT() *MockPurgerMockRecorder {
+	return m.recorder
+}
+
+// GetPurgeStats mocks base method.
+func (m *MockPurger) GetPurgeStats(arg0 context.Context) (modelurl.PurgeStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPurgeStats", arg0)
+	ret0, _ := ret[0].(modelurl.PurgeStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPurgeStats indicates an expected call of GetPurgeStats.
+func (mr *MockPurgerMockRecorder) GetPurgeStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPurgeStats", reflect.TypeOf((*MockPurger)(nil).GetPurgeStats), arg0)
+}
+
+// Purge mocks base method.
+func (m *MockPurger) Purge(arg0 context.Context, arg1, arg2 time.Time, arg3 int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockPurgerMockRecorder) Purge(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockPurger)(nil).Purge), arg0, arg1, arg2, arg3)
+}
@@ -64,17 +64,32 @@ func (mr *MockURLStorageMockRecorder) DeleteBatch(arg0, arg1, arg2 interface{})
 }
 
 // Dump mocks base method.
-func (m *MockURLStorage) Dump(arg0 context.Context, arg1, arg2, arg3 string) error {
+func (m *MockURLStorage) Dump(arg0 context.Context, arg1 modelstorage.URLStorageEntry) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Dump", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "Dump", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Dump indicates an expected call of Dump.
-func (mr *MockURLStorageMockRecorder) Dump(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockURLStorageMockRecorder) Dump(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dump", reflect.TypeOf((*MockURLStorage)(nil).Dump), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dump", reflect.TypeOf((*MockURLStorage)(nil).Dump), arg0, arg1)
+}
+
+// DumpBatch mocks base method.
+func (m *MockURLStorage) DumpBatch(arg0 context.Context, arg1 []modelstorage.URLStorageEntry) ([]error, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DumpBatch", arg0, arg1)
+	ret0, _ := ret[0].([]error)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DumpBatch indicates an expected call of DumpBatch.
+func (mr *MockURLStorageMockRecorder) DumpBatch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DumpBatch", reflect.TypeOf((*MockURLStorage)(nil).DumpBatch), arg0, arg1)
 }
 
 // GetStats mocks base method.
@@ -93,6 +108,36 @@ func (mr *MockURLStorageMockRecorder) GetStats(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockURLStorage)(nil).GetStats), arg0)
 }
 
+// List mocks base method.
+func (m *MockURLStorage) List(arg0 context.Context, arg1 string, arg2 int) ([]modelstorage.URLStorageEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]modelstorage.URLStorageEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockURLStorageMockRecorder) List(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockURLStorage)(nil).List), arg0, arg1, arg2)
+}
+
+// ListByUserID mocks base method.
+func (m *MockURLStorage) ListByUserID(arg0 context.Context, arg1, arg2 string, arg3 int) ([]modelurl.FullURL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByUserID", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]modelurl.FullURL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByUserID indicates an expected call of ListByUserID.
+func (mr *MockURLStorageMockRecorder) ListByUserID(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByUserID", reflect.TypeOf((*MockURLStorage)(nil).ListByUserID), arg0, arg1, arg2, arg3)
+}
+
 // PingDB mocks base method.
 func (m *MockURLStorage) PingDB() error {
 	m.ctrl.T.Helper()
@@ -107,6 +152,21 @@ func (mr *MockURLStorageMockRecorder) PingDB() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PingDB", reflect.TypeOf((*MockURLStorage)(nil).PingDB))
 }
 
+// RestoreBatch mocks base method.
+func (m *MockURLStorage) RestoreBatch(arg0 context.Context, arg1 []string, arg2 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreBatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreBatch indicates an expected call of RestoreBatch.
+func (mr *MockURLStorageMockRecorder) RestoreBatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreBatch", reflect.TypeOf((*MockURLStorage)(nil).RestoreBatch), arg0, arg1, arg2)
+}
+
 // Retrieve mocks base method.
 func (m *MockURLStorage) Retrieve(arg0 context.Context, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -137,14 +197,31 @@ func (mr *MockURLStorageMockRecorder) RetrieveByUserID(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetrieveByUserID", reflect.TypeOf((*MockURLStorage)(nil).RetrieveByUserID), arg0, arg1)
 }
 
+// RetrieveDeleteJob mocks base method.
+func (m *MockURLStorage) RetrieveDeleteJob(arg0 context.Context, arg1, arg2 string) (modelurl.DeleteJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetrieveDeleteJob", arg0, arg1, arg2)
+	ret0, _ := ret[0].(modelurl.DeleteJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RetrieveDeleteJob indicates an expected call of RetrieveDeleteJob.
+func (mr *MockURLStorageMockRecorder) RetrieveDeleteJob(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetrieveDeleteJob", reflect.TypeOf((*MockURLStorage)(nil).RetrieveDeleteJob), arg0, arg1, arg2)
+}
+
 // SendToQueue mocks base method.
-func (m *MockURLStorage) SendToQueue(arg0 modelstorage.URLChannelEntry) {
+func (m *MockURLStorage) SendToQueue(arg0 context.Context, arg1 modelstorage.URLChannelEntry) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SendToQueue", arg0)
+	ret := m.ctrl.Call(m, "SendToQueue", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // SendToQueue indicates an expected call of SendToQueue.
-func (mr *MockURLStorageMockRecorder) SendToQueue(arg0 interface{}) *gomock.Call {
+func (mr *MockURLStorageMockRecorder) SendToQueue(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendToQueue", reflect.TypeOf((*MockURLStorage)(nil).SendToQueue), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendToQueue", reflect.TypeOf((*MockURLStorage)(nil).SendToQueue), arg0, arg1)
 }
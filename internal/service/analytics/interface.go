@@ -0,0 +1,15 @@
+// Package analytics provides interfaces for types to be in compliance with.
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+)
+
+// Processor defines a set of methods for types implementing Processor.
+type Processor interface {
+	RecordClick(sURL, referrer, userAgent, clientIP string)
+	GetClickStats(ctx context.Context, sURL, userID string, from, to time.Time) (stats modelurl.ClickStats, err error)
+}
@@ -0,0 +1,111 @@
+// Package analytics provides functionality for collecting and processing click events on sURLs.
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/analytics"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// click stats query constraints
+const (
+	DefaultStatsRange = 30 * 24 * time.Hour
+	MaxStatsRange     = 366 * 24 * time.Hour
+	TopClickCounters  = 10
+)
+
+// Check interface implementation explicitly
+var (
+	_ analytics.Processor = (*Analytics)(nil)
+)
+
+// Analytics struct defines data structure handling and provides support for adding new implementations.
+type Analytics struct {
+	URLStorage   storage.URLStorage
+	ClickStorage storage.ClickStorage
+}
+
+// InitAnalytics initializes an Analytics object and sets its attributes.
+func InitAnalytics(s storage.URLStorage, cs storage.ClickStorage) (*Analytics, error) {
+	if s == nil {
+		return nil, &serviceErrors.ServiceFoundNilStorage{Msg: "nil storage was passed to service initializer"}
+	}
+	if cs == nil {
+		return nil, &serviceErrors.ServiceFoundNilStorage{Msg: "nil click storage was passed to service initializer"}
+	}
+	return &Analytics{URLStorage: s, ClickStorage: cs}, nil
+}
+
+// RecordClick sends a click event for asynchronous storing, it never blocks the caller.
+func (a *Analytics) RecordClick(sURL, referrer, userAgent, clientIP string) {
+	item := modelstorage.ClickEntry{
+		SURL:      sURL,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		ClientIP:  clientIP,
+	}
+	a.ClickStorage.SendClick(item)
+}
+
+// GetClickStats returns click statistics of sURL owned by userID. Zero from and to default to the last
+// DefaultStatsRange, the range is then extended to whole UTC days since rollups are bucketed by hours and days.
+func (a *Analytics) GetClickStats(ctx context.Context, sURL, userID string, from, to time.Time) (stats modelurl.ClickStats, err error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-DefaultStatsRange)
+	}
+	from, to = startOfDay(from), startOfDay(to.Add(-time.Nanosecond)).AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return modelurl.ClickStats{}, &serviceErrors.ServiceIncorrectStatsRange{Msg: "stats range start must precede its end"}
+	}
+	if to.Sub(from) > MaxStatsRange {
+		return modelurl.ClickStats{}, &serviceErrors.ServiceIncorrectStatsRange{Msg: "stats range must not exceed " + MaxStatsRange.String()}
+	}
+	// only the owner may read stats, other users get the same response as for absent sURLs
+	owned, err := a.isOwner(ctx, userID, sURL)
+	if err != nil {
+		return modelurl.ClickStats{}, err
+	}
+	if !owned {
+		return modelurl.ClickStats{}, &serviceErrors.ServiceNotOwnedURL{Msg: sURL + ": not found among user URLs"}
+	}
+	stats, err = a.ClickStorage.RetrieveClickStats(ctx, sURL, from, to, TopClickCounters)
+	if err != nil {
+		return modelurl.ClickStats{}, err
+	}
+	stats.From, stats.To = from, to
+	return stats, nil
+}
+
+// isOwner reports whether userID owns sURL, storages which cannot check ownership of a single entry are looked up
+// among all URLs of userID.
+func (a *Analytics) isOwner(ctx context.Context, userID, sURL string) (bool, error) {
+	var checker storage.OwnerChecker
+	if storage.As(a.URLStorage, &checker) {
+		return checker.IsOwner(ctx, userID, sURL)
+	}
+	URLs, err := a.URLStorage.RetrieveByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, URL := range URLs {
+		if URL.SURL == sURL {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startOfDay returns the start of UTC day containing t.
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
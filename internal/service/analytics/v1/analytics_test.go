@@ -0,0 +1,145 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/mocks"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// ownerStorage is a storage mock checking ownership of single entries.
+type ownerStorage struct {
+	*mocks.MockURLStorage
+	*mocks.MockOwnerChecker
+}
+
+func newOwnerStorage(ctrl *gomock.Controller) *ownerStorage {
+	return &ownerStorage{MockURLStorage: mocks.NewMockURLStorage(ctrl), MockOwnerChecker: mocks.NewMockOwnerChecker(ctrl)}
+}
+
+// Tests
+
+func TestInitAnalytics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	_, err := InitAnalytics(nil, mocks.NewMockClickStorage(ctrl))
+	assert.Equal(t, "nil storage was passed to service initializer", err.Error())
+	_, err = InitAnalytics(mocks.NewMockURLStorage(ctrl), nil)
+	assert.Equal(t, "nil click storage was passed to service initializer", err.Error())
+}
+
+func TestAnalytics_RecordClick(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockClickStorage(ctrl)
+	var sent modelstorage.ClickEntry
+	s.EXPECT().SendClick(gomock.Any()).Do(func(item modelstorage.ClickEntry) {
+		sent = item
+	})
+	processor, _ := InitAnalytics(mocks.NewMockURLStorage(ctrl), s)
+	processor.RecordClick("someShortURL", "https://www.some-referrer.com", "someUserAgent", "127.0.0.1")
+	assert.Equal(t, "someShortURL", sent.SURL)
+	assert.Equal(t, "https://www.some-referrer.com", sent.Referrer)
+	assert.Equal(t, "someUserAgent", sent.UserAgent)
+	assert.Equal(t, "127.0.0.1", sent.ClientIP)
+	assert.False(t, sent.ClickedAt.IsZero())
+}
+
+func TestAnalytics_GetClickStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newOwnerStorage(ctrl)
+	cs := mocks.NewMockClickStorage(ctrl)
+	processor, _ := InitAnalytics(s, cs)
+	ctx := context.Background()
+	from := time.Date(2022, 5, 1, 13, 45, 0, 0, time.UTC)
+	to := time.Date(2022, 5, 3, 8, 0, 0, 0, time.UTC)
+	alignedFrom := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	alignedTo := time.Date(2022, 5, 4, 0, 0, 0, 0, time.UTC)
+	expected := modelurl.ClickStats{TotalClicks: 3, UniqueVisitors: 2}
+	s.MockOwnerChecker.EXPECT().IsOwner(ctx, "someUserID", "someShortURL").Return(true, nil)
+	cs.EXPECT().RetrieveClickStats(ctx, "someShortURL", alignedFrom, alignedTo, TopClickCounters).Return(expected, nil)
+	stats, err := processor.GetClickStats(ctx, "someShortURL", "someUserID", from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	assert.Equal(t, int64(2), stats.UniqueVisitors)
+	assert.Equal(t, alignedFrom, stats.From)
+	assert.Equal(t, alignedTo, stats.To)
+}
+
+func TestAnalytics_GetClickStatsNotOwned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newOwnerStorage(ctrl)
+	processor, _ := InitAnalytics(s, mocks.NewMockClickStorage(ctrl))
+	ctx := context.Background()
+	s.MockOwnerChecker.EXPECT().IsOwner(ctx, "someUserID", "someOtherShortURL").Return(false, nil)
+	_, err := processor.GetClickStats(ctx, "someOtherShortURL", "someUserID", time.Time{}, time.Time{})
+	var notOwnedURLError *serviceErrors.ServiceNotOwnedURL
+	assert.True(t, errors.As(err, &notOwnedURLError))
+}
+
+func TestAnalytics_GetClickStatsNotOwnedWithoutOwnerChecker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	cs := mocks.NewMockClickStorage(ctrl)
+	processor, _ := InitAnalytics(s, cs)
+	ctx := context.Background()
+	userURLs := []modelurl.FullURL{{URL: "https://www.yandex.ru", SURL: "someShortURL"}}
+	s.EXPECT().RetrieveByUserID(ctx, "someUserID").Return(userURLs, nil)
+	_, err := processor.GetClickStats(ctx, "someOtherShortURL", "someUserID", time.Time{}, time.Time{})
+	var notOwnedURLError *serviceErrors.ServiceNotOwnedURL
+	assert.True(t, errors.As(err, &notOwnedURLError))
+}
+
+func TestAnalytics_GetClickStatsIncorrectRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	processor, _ := InitAnalytics(mocks.NewMockURLStorage(ctrl), mocks.NewMockClickStorage(ctrl))
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+	}{
+		{
+			name: "reversed range",
+			from: time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "too long range",
+			from: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := processor.GetClickStats(ctx, "someShortURL", "someUserID", tt.from, tt.to)
+			var incorrectStatsRangeError *serviceErrors.ServiceIncorrectStatsRange
+			assert.True(t, errors.As(err, &incorrectStatsRangeError))
+		})
+	}
+}
+
+// Benchmarks
+
+func BenchmarkAnalytics_RecordClick(b *testing.B) {
+	ctrl := gomock.NewController(b)
+	defer ctrl.Finish()
+	s := mocks.NewMockClickStorage(ctrl)
+	s.EXPECT().SendClick(gomock.Any()).Return().AnyTimes()
+	processor, _ := InitAnalytics(mocks.NewMockURLStorage(ctrl), s)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		processor.RecordClick("someShortURL", "https://www.some-referrer.com", "someUserAgent", "127.0.0.1")
+	}
+}
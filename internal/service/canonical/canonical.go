@@ -0,0 +1,209 @@
+// Package canonical provides canonicalization of original URLs so that equivalent URLs are deduplicated.
+package canonical
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts lists ports implied by schemes.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// punycode converts host names for lookups, unlike idna.Lookup it tolerates underscores and other characters
+// which are not allowed by STD3 yet are used in real host names.
+var punycode = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// Canonicalizer runs a pipeline of normalization steps chosen by configuration, steps run in a fixed order.
+type Canonicalizer struct {
+	lowercase      bool
+	punycode       bool
+	defaultPort    bool
+	sortQuery      bool
+	stripTracking  bool
+	stripFragment  bool
+	trackingParams []string
+}
+
+// NewCanonicalizer initializes a Canonicalizer running steps given by cfg.URLNormalizers, no steps are run
+// if none are given.
+func NewCanonicalizer(cfg *config.Config) (*Canonicalizer, error) {
+	c := &Canonicalizer{}
+	for _, normalizer := range cfg.URLNormalizers {
+		switch normalizer {
+		case config.URLNormalizerLowercase:
+			c.lowercase = true
+		case config.URLNormalizerPunycode:
+			c.punycode = true
+		case config.URLNormalizerDefaultPort:
+			c.defaultPort = true
+		case config.URLNormalizerSortQuery:
+			c.sortQuery = true
+		case config.URLNormalizerStripTracking:
+			c.stripTracking = true
+		case config.URLNormalizerStripFragment:
+			c.stripFragment = true
+		default:
+			return nil, fmt.Errorf("%s: unknown URL normalizer", normalizer)
+		}
+	}
+	for _, param := range cfg.URLTrackingParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if param != "" {
+			c.trackingParams = append(c.trackingParams, param)
+		}
+	}
+	return c, nil
+}
+
+// Canonicalize returns the canonical form of URL, URL is returned unchanged if no steps are run.
+func (c *Canonicalizer) Canonicalize(URL string) (string, error) {
+	if !c.lowercase && !c.punycode && !c.defaultPort && !c.sortQuery && !c.stripTracking && !c.stripFragment {
+		return URL, nil
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "", err
+	}
+	if c.lowercase {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+	}
+	if c.punycode {
+		err = toPunycode(u)
+		if err != nil {
+			return "", err
+		}
+	}
+	if c.defaultPort {
+		dropDefaultPort(u)
+	}
+	if c.sortQuery || c.stripTracking {
+		params := splitQuery(u.RawQuery)
+		if c.stripTracking {
+			params = c.withoutTracking(params)
+		}
+		if c.sortQuery {
+			sort.SliceStable(params, func(i, j int) bool {
+				return paramName(params[i]) < paramName(params[j])
+			})
+		}
+		u.RawQuery = strings.Join(params, "&")
+		u.ForceQuery = false
+	}
+	if c.stripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u.String(), nil
+}
+
+// isTracking checks whether the query parameter named name matches one of tracking parameters.
+func (c *Canonicalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range c.trackingParams {
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+			continue
+		}
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutTracking filters tracking parameters out of params.
+func (c *Canonicalizer) withoutTracking(params []string) []string {
+	kept := params[:0]
+	for _, param := range params {
+		if !c.isTracking(paramName(param)) {
+			kept = append(kept, param)
+		}
+	}
+	return kept
+}
+
+// toPunycode converts an internationalized host name of u to its ASCII form, IP addresses and ASCII host names
+// are kept as is.
+func toPunycode(u *url.URL) error {
+	hostname := u.Hostname()
+	if isASCII(hostname) || net.ParseIP(hostname) != nil {
+		return nil
+	}
+	ascii, err := punycode.ToASCII(hostname)
+	if err != nil {
+		return err
+	}
+	u.Host = joinHostPort(ascii, u.Port())
+	return nil
+}
+
+// dropDefaultPort removes the port of u if it is implied by the scheme or empty.
+func dropDefaultPort(u *url.URL) {
+	port := u.Port()
+	if port != "" && port != defaultPorts[strings.ToLower(u.Scheme)] {
+		return
+	}
+	if strings.HasSuffix(u.Host, ":") || port != "" {
+		u.Host = joinHostPort(u.Hostname(), "")
+	}
+}
+
+// joinHostPort makes a URL host of hostname and an optional port, IPv6 addresses are enclosed in brackets.
+func joinHostPort(hostname, port string) string {
+	if strings.Contains(hostname, ":") {
+		hostname = "[" + hostname + "]"
+	}
+	if port == "" {
+		return hostname
+	}
+	return hostname + ":" + port
+}
+
+// splitQuery splits a raw query into raw parameters keeping their encoding, empty parameters are dropped.
+func splitQuery(rawQuery string) []string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// paramName returns the decoded name of a raw query parameter.
+func paramName(param string) string {
+	name := param
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		name = param[:i]
+	}
+	decoded, err := url.QueryUnescape(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// isASCII checks whether s consists of ASCII characters only.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCanonicalizer initializes a Canonicalizer running normalizers.
+func newCanonicalizer(t *testing.T, normalizers ...string) *Canonicalizer {
+	cfg := config.NewDefaultConfiguration()
+	cfg.URLNormalizers = normalizers
+	cfg.URLTrackingParams = []string{"utm_*", "fbclid"}
+	c, err := NewCanonicalizer(cfg)
+	assert.Nil(t, err)
+	return c
+}
+
+// Tests
+
+func TestCanonicalize_Equivalent(t *testing.T) {
+	c := newCanonicalizer(t, config.URLNormalizerLowercase, config.URLNormalizerPunycode, config.URLNormalizerDefaultPort, config.URLNormalizerSortQuery, config.URLNormalizerStripFragment)
+	a, err := c.Canonicalize("HTTP://Example.com:80/a?b=1&a=2")
+	assert.Nil(t, err)
+	b, err := c.Canonicalize("http://example.com/a?a=2&b=1")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://example.com/a?a=2&b=1", a)
+	assert.Equal(t, a, b)
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer string
+		URL        string
+		expected   string
+	}{
+		{name: "lowercase", normalizer: config.URLNormalizerLowercase, URL: "HTTPS://WWW.Yandex.RU/Path?Q=A", expected: "https://www.yandex.ru/Path?Q=A"},
+		{name: "punycode", normalizer: config.URLNormalizerPunycode, URL: "https://пример.рф:8080/путь", expected: "https://xn--e1afmkfd.xn--p1ai:8080/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "punycode of an ASCII host", normalizer: config.URLNormalizerPunycode, URL: "https://some_host.ru/", expected: "https://some_host.ru/"},
+		{name: "default port", normalizer: config.URLNormalizerDefaultPort, URL: "https://www.yandex.ru:443/", expected: "https://www.yandex.ru/"},
+		{name: "empty port", normalizer: config.URLNormalizerDefaultPort, URL: "http://www.yandex.ru:/", expected: "http://www.yandex.ru/"},
+		{name: "non-default port", normalizer: config.URLNormalizerDefaultPort, URL: "http://www.yandex.ru:443/", expected: "http://www.yandex.ru:443/"},
+		{name: "default port of IPv6", normalizer: config.URLNormalizerDefaultPort, URL: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "sort query", normalizer: config.URLNormalizerSortQuery, URL: "https://www.yandex.ru/?q=2&b&a=1&q=1", expected: "https://www.yandex.ru/?a=1&b&q=2&q=1"},
+		{name: "strip tracking", normalizer: config.URLNormalizerStripTracking, URL: "https://www.yandex.ru/?utm_source=x&q=1&FBCLID=y&utm=z", expected: "https://www.yandex.ru/?q=1&utm=z"},
+		{name: "strip tracking only", normalizer: config.URLNormalizerStripTracking, URL: "https://www.yandex.ru/?utm_source=x", expected: "https://www.yandex.ru/"},
+		{name: "strip fragment", normalizer: config.URLNormalizerStripFragment, URL: "https://www.yandex.ru/a#b", expected: "https://www.yandex.ru/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCanonicalizer(t, tt.normalizer)
+			canonicalURL, err := c.Canonicalize(tt.URL)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, canonicalURL)
+		})
+	}
+}
+
+func TestCanonicalize_NoSteps(t *testing.T) {
+	c := newCanonicalizer(t)
+	canonicalURL, err := c.Canonicalize("HTTP://Example.com:80/a?b=1&a=2#c")
+	assert.Nil(t, err)
+	assert.Equal(t, "HTTP://Example.com:80/a?b=1&a=2#c", canonicalURL)
+}
+
+func TestNewCanonicalizer_Fail(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.URLNormalizers = []string{"some_normalizer"}
+	_, err := NewCanonicalizer(cfg)
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,8 @@
 // Package errors provides custom errors for types implementing Processor interface.
 package errors
 
+import "time"
+
 type (
 	ServiceInitHashError struct {
 		Msg string
@@ -14,6 +16,51 @@ type (
 	ServiceIncorrectInputURL struct {
 		Msg string
 	}
+	ServiceIncorrectAlias struct {
+		Msg string
+	}
+	ServiceIncorrectExpiration struct {
+		Msg string
+	}
+	ServiceIncorrectStatsRange struct {
+		Msg string
+	}
+	ServiceNotOwnedURL struct {
+		Msg string
+	}
+	ServiceCompactionNotSupported struct {
+		Msg string
+	}
+	ServicePurgeNotSupported struct {
+		Msg string
+	}
+	ServiceSlugGenerationError struct {
+		Msg string
+	}
+	ServiceInitCanonicalizerError struct {
+		Msg string
+	}
+	ServiceInitPolicyError struct {
+		Msg string
+	}
+	// ServiceDestinationDenied is returned for URLs violating the destination policy, Reason is a code of
+	// the violated rule
+	ServiceDestinationDenied struct {
+		Msg    string
+		Reason string
+	}
+	ServiceIncorrectPassword struct {
+		Msg string
+	}
+	ServicePasswordRequired struct {
+		Msg string
+	}
+	// ServiceTooManyAttempts is returned once failed password attempts are exhausted, RetryAfter is the time left
+	// until the lockout is over
+	ServiceTooManyAttempts struct {
+		Msg        string
+		RetryAfter time.Duration
+	}
 )
 
 func (e *ServiceInitHashError) Error() string {
@@ -31,3 +78,55 @@ func (e *ServiceFoundNilSecretary) Error() string {
 func (e *ServiceIncorrectInputURL) Error() string {
 	return e.Msg
 }
+
+func (e *ServiceIncorrectAlias) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectExpiration) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceIncorrectStatsRange) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceNotOwnedURL) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceCompactionNotSupported) Error() string {
+	return e.Msg
+}
+
+func (e *ServicePurgeNotSupported) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceSlugGenerationError) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceInitCanonicalizerError) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceInitPolicyError) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceDestinationDenied) Error() string {
+	return e.Reason + ": " + e.Msg
+}
+
+func (e *ServiceIncorrectPassword) Error() string {
+	return e.Msg
+}
+
+func (e *ServicePasswordRequired) Error() string {
+	return e.Msg
+}
+
+func (e *ServiceTooManyAttempts) Error() string {
+	return e.Msg
+}
@@ -1,7 +1,186 @@
 // Package modelurl provides locally used types and their structure for URL handling between modules.
 package modelurl
 
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
 type FullURL struct {
+	URL string
+	// OriginalURL is set if URL was submitted in a form other than its canonical form URL
+	OriginalURL string
+	SURL        string
+	ExpiresAt   *time.Time
+}
+
+// Submitted returns URL in the form it was submitted in.
+func (u FullURL) Submitted() string {
+	if u.OriginalURL != "" {
+		return u.OriginalURL
+	}
+	return u.URL
+}
+
+// EncodeOptions holds optional caller-defined parameters for URL shortening.
+type EncodeOptions struct {
+	Alias     string
+	ExpiresAt *time.Time
+	// Password protects the sURL, it is stored as a bcrypt hash only
+	Password string
+}
+
+// BatchItem holds one URL of a batch to be shortened along with its options.
+type BatchItem struct {
 	URL  string
-	SURL string
+	Opts EncodeOptions
+}
+
+// BatchTimeout returns a timeout of shortening items at once, each password-protected item adds to it since
+// passwords are hashed with bcrypt which is deliberately slow.
+func BatchTimeout(items []BatchItem) time.Duration {
+	timeout := 500 * time.Millisecond
+	for _, item := range items {
+		if item.Opts.Password != "" {
+			timeout += 500 * time.Millisecond
+		}
+	}
+	return timeout
+}
+
+// BatchResult holds an outcome of shortening one URL of a batch, SURL is set either for a stored URL or
+// for an already existing one, in the latter case Err holds storage errors.AlreadyExistsError. Status is one of
+// BatchStatus constants.
+type BatchResult struct {
+	SURL   string
+	Err    error
+	Status string
+}
+
+// ImportAlias extracts a sURL of an imported row given either as a sURL or as a short URL, an empty alias is
+// returned if none can be extracted.
+func ImportAlias(sURL string) string {
+	if !strings.Contains(sURL, "/") {
+		return sURL
+	}
+	u, err := url.Parse(sURL)
+	if err != nil {
+		return ""
+	}
+	alias := path.Base(u.Path)
+	if alias == "/" || alias == "." {
+		return ""
+	}
+	return alias
+}
+
+// statuses of batch items reported to clients
+const (
+	BatchStatusCreated  = "created"
+	BatchStatusExists   = "exists"
+	BatchStatusConflict = "conflict"
+	BatchStatusInvalid  = "invalid"
+	BatchStatusDenied   = "denied"
+)
+
+// outcomes of restoring one sURL, only entries deleted by their owners within the grace window are restored
+const (
+	RestoreOutcomeRestored     = "restored"
+	RestoreOutcomeNotFound     = "not_found"
+	RestoreOutcomeNotOwned     = "not_owned"
+	RestoreOutcomeNotDeleted   = "not_deleted"
+	RestoreOutcomeExpired      = "expired"
+	RestoreOutcomeGraceExpired = "grace_expired"
+	RestoreOutcomeConflict     = "conflict"
+)
+
+// RestoreResult holds an outcome of restoring one sURL of a batch.
+type RestoreResult struct {
+	SURL   string
+	Status string
+}
+
+// statuses of asynchronous deletion jobs
+const (
+	DeleteJobPending = "pending"
+	DeleteJobDone    = "done"
+	DeleteJobFailed  = "failed"
+)
+
+// outcomes of deleting one sURL within a deletion job, an empty outcome means that the sURL is not flushed yet
+const (
+	DeleteOutcomeDeleted  = "deleted"
+	DeleteOutcomeNotOwned = "not_owned"
+	DeleteOutcomeNotFound = "not_found"
+)
+
+// DeleteJob holds a report of an asynchronous deletion job, Error is set if flushing of pending sURLs failed.
+type DeleteJob struct {
+	ID       string
+	Status   string
+	Deleted  []string
+	NotOwned []string
+	NotFound []string
+	Pending  []string
+	Error    string
+}
+
+// Add records an outcome of deleting sURL.
+func (job *DeleteJob) Add(sURL, outcome string) {
+	switch outcome {
+	case DeleteOutcomeDeleted:
+		job.Deleted = append(job.Deleted, sURL)
+	case DeleteOutcomeNotOwned:
+		job.NotOwned = append(job.NotOwned, sURL)
+	case DeleteOutcomeNotFound:
+		job.NotFound = append(job.NotFound, sURL)
+	default:
+		job.Pending = append(job.Pending, sURL)
+	}
+}
+
+// Resolve sets Status according to recorded outcomes.
+func (job *DeleteJob) Resolve() {
+	switch {
+	case len(job.Pending) == 0:
+		job.Status = DeleteJobDone
+		job.Error = ""
+	case job.Error != "":
+		job.Status = DeleteJobFailed
+	default:
+		job.Status = DeleteJobPending
+	}
+}
+
+// PurgeStats holds counters of entries hard-deleted by the purge job, LastPurgeAt is nil if nothing was purged.
+type PurgeStats struct {
+	PurgedURLs     int64
+	LastPurgeAt    *time.Time
+	LastPurgedURLs int64
+}
+
+// ClickStats holds aggregated click statistics for one sURL over [From, To) time range.
+type ClickStats struct {
+	From           time.Time
+	To             time.Time
+	TotalClicks    int64
+	UniqueVisitors int64
+	Hourly         []ClickBucket
+	Daily          []ClickBucket
+	TopReferrers   []ClickCounter
+	TopUserAgents  []ClickCounter
+}
+
+// ClickBucket holds the number of clicks within a time series bucket starting at Start.
+type ClickBucket struct {
+	Start  time.Time
+	Clicks int64
+}
+
+// ClickCounter holds the number of clicks attributed to a particular value, e.g. a referrer.
+type ClickCounter struct {
+	Value  string
+	Clicks int64
 }
@@ -0,0 +1,21 @@
+// Package policy provides methods for checking destinations of URLs to be shortened.
+package policy
+
+// reasons of denying a destination reported to clients
+const (
+	ReasonInvalidURL       = "invalid_url"
+	ReasonSchemeNotAllowed = "scheme_not_allowed"
+	ReasonPrivateAddress   = "private_address"
+	ReasonLoopbackAddress  = "loopback_address"
+	ReasonLinkLocalAddress = "link_local_address"
+	ReasonSelfReference    = "self_reference"
+	ReasonDomainDenied     = "domain_denied"
+	ReasonDomainNotAllowed = "domain_not_allowed"
+	ReasonMaliciousDomain  = "malicious_domain"
+)
+
+// Checker defines a set of methods for types implementing Checker.
+type Checker interface {
+	// Check returns errors.ServiceDestinationDenied holding one of the reasons above if URL must not be shortened.
+	Check(URL string) error
+}
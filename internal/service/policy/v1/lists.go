@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// domainList is a set of domains read from a file with one domain per line, blank lines and lines starting
+// with # are skipped. A domain matches itself and all of its subdomains.
+type domainList struct {
+	path    string
+	modTime time.Time
+	size    int64
+	domains map[string]bool
+}
+
+// loadDomainList reads a domain list from path.
+func loadDomainList(path string) (*domainList, error) {
+	list := &domainList{path: path}
+	err := list.load()
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// load reads the file of l and replaces its domains.
+func (l *domainList) load() error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[strings.TrimSuffix(strings.ToLower(line), ".")] = true
+	}
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+	l.domains, l.modTime, l.size = domains, info.ModTime(), info.Size()
+	return nil
+}
+
+// reload reads the file of l again if it has changed, the previous domains are kept if it cannot be read.
+func (l *domainList) reload() {
+	info, err := os.Stat(l.path)
+	if err == nil && info.ModTime().Equal(l.modTime) && info.Size() == l.size {
+		return
+	}
+	if err == nil {
+		err = l.load()
+	}
+	if err != nil {
+		log.Println("Reloading domain list:", l.path, err)
+		return
+	}
+	log.Println("Reloading domain list:", l.path, len(l.domains), "domains")
+}
+
+// matches checks whether host is one of the domains or a subdomain of one of them.
+func (l *domainList) matches(host string) bool {
+	for {
+		if l.domains[host] {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
@@ -0,0 +1,199 @@
+// Package policy provides a destination policy of URLs to be shortened.
+package policy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/policy"
+)
+
+// defaults applied to zero configuration values
+var (
+	DefaultSchemes      = []string{"http", "https"}
+	DefaultReloadPeriod = 30 * time.Second
+)
+
+// defaultPorts lists ports implied by schemes.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Check interface implementation explicitly
+var (
+	_ policy.Checker = (*Policy)(nil)
+)
+
+// Policy denies URLs with schemes out of the allowlist, URLs of private, loopback and link-local addresses, URLs
+// pointing back at the service and URLs of domains listed in the denylist or missing from the allowlist. Domain
+// lists are files reloaded once they change, checked at most once per reload period.
+type Policy struct {
+	schemes      map[string]bool
+	allowPrivate bool
+	// self is the host of the service base URL with an explicit port, empty if the base URL is not set
+	self         string
+	allow        *domainList
+	deny         *domainList
+	reloadPeriod time.Duration
+	mu           sync.Mutex
+	checkedAt    time.Time
+}
+
+// NewPolicy initializes a Policy configured by cfg, domain lists are read at once.
+func NewPolicy(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		schemes:      make(map[string]bool),
+		allowPrivate: cfg.PolicyAllowPrivate,
+		reloadPeriod: cfg.PolicyReloadPeriod,
+		checkedAt:    time.Now(),
+	}
+	schemes := cfg.PolicySchemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	for _, scheme := range schemes {
+		p.schemes[strings.ToLower(strings.TrimSpace(scheme))] = true
+	}
+	if p.reloadPeriod <= 0 {
+		p.reloadPeriod = DefaultReloadPeriod
+	}
+	if cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		p.self = hostPort(u)
+	}
+	var err error
+	if cfg.PolicyAllowlist != "" {
+		p.allow, err = loadDomainList(cfg.PolicyAllowlist)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PolicyDenylist != "" {
+		p.deny, err = loadDomainList(cfg.PolicyDenylist)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Check returns serviceErrors.ServiceDestinationDenied if URL violates the policy.
+func (p *Policy) Check(URL string) error {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return deny(policy.ReasonInvalidURL, err.Error())
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !p.schemes[scheme] {
+		return deny(policy.ReasonSchemeNotAllowed, fmt.Sprintf("%q scheme is not allowed", scheme))
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil
+	}
+	if !p.allowPrivate {
+		err = checkAddress(host)
+		if err != nil {
+			return err
+		}
+	}
+	if p.self != "" && hostPort(u) == p.self {
+		return deny(policy.ReasonSelfReference, "links to the service itself are not allowed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reload()
+	if p.deny != nil && p.deny.matches(host) {
+		return deny(policy.ReasonDomainDenied, fmt.Sprintf("%s is denied", host))
+	}
+	if p.allow != nil && !p.allow.matches(host) {
+		return deny(policy.ReasonDomainNotAllowed, fmt.Sprintf("%s is not allowed", host))
+	}
+	return nil
+}
+
+// reload reloads changed domain lists once per reload period, it must be called with mu held.
+func (p *Policy) reload() {
+	now := time.Now()
+	if now.Sub(p.checkedAt) < p.reloadPeriod {
+		return
+	}
+	p.checkedAt = now
+	for _, list := range []*domainList{p.allow, p.deny} {
+		if list != nil {
+			list.reload()
+		}
+	}
+}
+
+// checkAddress denies host if it is a loopback name or an IP literal of a private, loopback, link-local or
+// unspecified address.
+func checkAddress(host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return deny(policy.ReasonLoopbackAddress, fmt.Sprintf("%s is a loopback address", host))
+	}
+	ip := parseIP(host)
+	switch {
+	case ip == nil:
+		return nil
+	case ip.IsLoopback() || ip.IsUnspecified():
+		return deny(policy.ReasonLoopbackAddress, fmt.Sprintf("%s is a loopback address", host))
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return deny(policy.ReasonLinkLocalAddress, fmt.Sprintf("%s is a link-local address", host))
+	case ip.IsPrivate():
+		return deny(policy.ReasonPrivateAddress, fmt.Sprintf("%s is a private address", host))
+	}
+	return nil
+}
+
+// parseIP parses an IP literal, including IPv4 addresses in the forms accepted by inet_aton and resolved by
+// browsers, e.g. 127.1, 0177.0.0.1 or 0x7f000001, and returns nil for host names.
+func parseIP(host string) net.IP {
+	ip := net.ParseIP(host)
+	if ip != nil {
+		return ip
+	}
+	// up to four decimal, octal or hexadecimal parts, the last one fills all the remaining bytes
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var n uint64
+	for i, part := range parts {
+		bits := 8
+		if i == len(parts)-1 {
+			bits = 8 * (5 - len(parts))
+		}
+		v, err := strconv.ParseUint(part, 0, bits)
+		if err != nil {
+			return nil
+		}
+		n = n<<bits | v
+	}
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// hostPort returns the lowercased host of u with the port implied by the scheme if none is given.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), port)
+}
+
+// deny makes a policy violation error.
+func deny(reason, msg string) error {
+	return &serviceErrors.ServiceDestinationDenied{Msg: msg, Reason: reason}
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+// reason returns the reason of a policy violation or an empty string if err is not one.
+func reason(err error) string {
+	var destinationDenied *serviceErrors.ServiceDestinationDenied
+	if errors.As(err, &destinationDenied) {
+		return destinationDenied.Reason
+	}
+	return ""
+}
+
+// Tests
+
+func TestPolicy_Check(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.BaseURL = "http://localhost:8080"
+	p, err := NewPolicy(cfg)
+	assert.Nil(t, err)
+	tests := []struct {
+		URL    string
+		reason string
+	}{
+		{URL: "https://www.yandex.ru/a?b=c", reason: ""},
+		{URL: "HTTP://WWW.Yandex.RU", reason: ""},
+		{URL: "javascript:alert(1)", reason: policy.ReasonSchemeNotAllowed},
+		{URL: "file:///etc/passwd", reason: policy.ReasonSchemeNotAllowed},
+		{URL: "/relative/path", reason: policy.ReasonSchemeNotAllowed},
+		{URL: "http://169.254.169.254/latest/meta-data/", reason: policy.ReasonLinkLocalAddress},
+		{URL: "http://[fe80::1]/", reason: policy.ReasonLinkLocalAddress},
+		{URL: "http://2852039166/", reason: policy.ReasonLinkLocalAddress},
+		{URL: "http://127.0.0.1:9000/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://[::1]/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://[::ffff:127.0.0.1]/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://0x7f000001/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://127.1/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://0177.0.0.1/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://0x7f.0.0.1/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://0xa9.0xfe.0xa9fe/", reason: policy.ReasonLinkLocalAddress},
+		{URL: "http://10.0x10203/", reason: policy.ReasonPrivateAddress},
+		{URL: "http://1.2.3.4.5/", reason: ""},
+		{URL: "http://0x8.8.8.256/", reason: ""},
+		{URL: "http://0.0.0.0/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://app.localhost/", reason: policy.ReasonLoopbackAddress},
+		{URL: "http://10.1.2.3/", reason: policy.ReasonPrivateAddress},
+		{URL: "http://192.168.0.1/", reason: policy.ReasonPrivateAddress},
+		{URL: "http://[fd00::1]/", reason: policy.ReasonPrivateAddress},
+		{URL: "http://8.8.8.8/", reason: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.URL, func(t *testing.T) {
+			assert.Equal(t, tt.reason, reason(p.Check(tt.URL)))
+		})
+	}
+}
+
+func TestPolicy_Check_SelfReference(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.BaseURL = "https://sho.rt"
+	p, err := NewPolicy(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, policy.ReasonSelfReference, reason(p.Check("https://SHO.rt:443/abcde")))
+	assert.Equal(t, policy.ReasonSelfReference, reason(p.Check("https://sho.rt./abcde")))
+	assert.Nil(t, p.Check("http://sho.rt/abcde"))
+	assert.Nil(t, p.Check("https://www.sho.rt/abcde"))
+}
+
+func TestPolicy_Check_AllowPrivate(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.PolicyAllowPrivate = true
+	cfg.PolicySchemes = []string{"https", "FTP"}
+	p, err := NewPolicy(cfg)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Check("https://192.168.0.1/"))
+	assert.Nil(t, p.Check("ftp://10.0.0.1/file"))
+	assert.Equal(t, policy.ReasonSchemeNotAllowed, reason(p.Check("http://192.168.0.1/")))
+}
+
+func TestPolicy_Check_DomainLists(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewDefaultConfiguration()
+	cfg.PolicyAllowlist = filepath.Join(dir, "allowlist.txt")
+	cfg.PolicyDenylist = filepath.Join(dir, "denylist.txt")
+	cfg.PolicyReloadPeriod = time.Nanosecond
+	_ = os.WriteFile(cfg.PolicyAllowlist, []byte("# allowed domains\nyandex.ru\n\nvk.com\n"), 0644)
+	_ = os.WriteFile(cfg.PolicyDenylist, []byte("Bad.Yandex.ru\n"), 0644)
+	p, err := NewPolicy(cfg)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Check("https://yandex.ru/"))
+	assert.Nil(t, p.Check("https://www.yandex.ru/"))
+	assert.Nil(t, p.Check("https://vk.com/"))
+	assert.Equal(t, policy.ReasonDomainDenied, reason(p.Check("https://bad.yandex.ru/")))
+	assert.Equal(t, policy.ReasonDomainDenied, reason(p.Check("https://very.bad.yandex.ru/")))
+	assert.Equal(t, policy.ReasonDomainNotAllowed, reason(p.Check("https://notyandex.ru/")))
+	assert.Equal(t, policy.ReasonDomainNotAllowed, reason(p.Check("https://www.google.com/")))
+
+	// lists are reloaded once changed, while a list cannot be read the previous one is kept
+	_ = os.WriteFile(cfg.PolicyDenylist, []byte("vk.com\n"), 0644)
+	_ = os.Remove(cfg.PolicyAllowlist)
+	assert.Nil(t, p.Check("https://bad.yandex.ru/"))
+	assert.Equal(t, policy.ReasonDomainDenied, reason(p.Check("https://vk.com/")))
+	assert.Equal(t, policy.ReasonDomainNotAllowed, reason(p.Check("https://www.google.com/")))
+}
+
+func TestNewPolicy_Fail(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.PolicyDenylist = filepath.Join(t.TempDir(), "absent.txt")
+	_, err := NewPolicy(cfg)
+	assert.NotNil(t, err)
+}
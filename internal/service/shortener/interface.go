@@ -10,9 +10,16 @@ import (
 // Processor defines a set of methods for types implementing Processor.
 type Processor interface {
 	GetStats(ctx context.Context) (nURLs, nUsers int64, err error)
-	Encode(ctx context.Context, URL, userID string) (sURL string, err error)
+	Encode(ctx context.Context, URL, userID string, opts modelurl.EncodeOptions) (sURL string, err error)
+	EncodeBatch(ctx context.Context, items []modelurl.BatchItem, userID string) (results []modelurl.BatchResult, err error)
 	Decode(ctx context.Context, sURL string) (URL string, err error)
-	Delete(ctx context.Context, sURLs []string, userID string)
+	Unlock(ctx context.Context, sURL, password, clientID string) (URL string, err error)
+	Delete(ctx context.Context, sURLs []string, userID string) (jobID string, err error)
+	GetDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error)
+	Restore(ctx context.Context, sURLs []string, userID string) (results []modelurl.RestoreResult, err error)
 	DecodeByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error)
+	ExportByUserID(ctx context.Context, userID string, fn func(URLs []modelurl.FullURL) error) error
 	PingDB() error
+	Compact(ctx context.Context) error
+	GetPurgeStats(ctx context.Context) (stats modelurl.PurgeStats, err error)
 }
@@ -0,0 +1,90 @@
+package shortener
+
+import (
+	"sync"
+	"time"
+)
+
+// defaults applied to zero configuration values
+const (
+	DefaultPasswordAttempts    = 5
+	DefaultPasswordURLAttempts = 100
+	DefaultPasswordLockout     = 15 * time.Minute
+)
+
+// failedAttempts holds failed password attempts of one key since the first of them.
+type failedAttempts struct {
+	count   int
+	resetAt time.Time
+}
+
+// attemptLimiter limits failed password attempts per key, once max attempts fail within the lockout period
+// since the first of them, further attempts are rejected until the period is over.
+type attemptLimiter struct {
+	max     int
+	lockout time.Duration
+	mu      sync.Mutex
+	keys    map[string]*failedAttempts
+	// sweptAt is the time of the last removal of keys with lockout periods over
+	sweptAt time.Time
+}
+
+// newAttemptLimiter initializes an attemptLimiter.
+func newAttemptLimiter(max int, lockout time.Duration) *attemptLimiter {
+	if max <= 0 {
+		max = DefaultPasswordAttempts
+	}
+	if lockout <= 0 {
+		lockout = DefaultPasswordLockout
+	}
+	return &attemptLimiter{max: max, lockout: lockout, keys: make(map[string]*failedAttempts), sweptAt: time.Now()}
+}
+
+// acquire reserves an attempt of key unless max attempts have failed within the lockout period and returns the
+// time left until the period is over otherwise. A reserved attempt counts as failed until it is released, hence
+// concurrent attempts cannot exceed max.
+func (l *attemptLimiter) acquire(key string) (retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	attempts, found := l.keys[key]
+	if !found || !now.Before(attempts.resetAt) {
+		attempts = &failedAttempts{resetAt: now.Add(l.lockout)}
+		l.keys[key] = attempts
+	}
+	if attempts.count >= l.max {
+		return attempts.resetAt.Sub(now), false
+	}
+	attempts.count++
+	return 0, true
+}
+
+// release returns an attempt of key reserved by acquire which did not fail.
+func (l *attemptLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if attempts, found := l.keys[key]; found && attempts.count > 0 {
+		attempts.count--
+	}
+}
+
+// reset forgets failed attempts of key.
+func (l *attemptLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
+
+// sweep removes keys with lockout periods over once per lockout period, it must be called with mu held.
+func (l *attemptLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < l.lockout {
+		return
+	}
+	l.sweptAt = now
+	for key, attempts := range l.keys {
+		if !now.Before(attempts.resetAt) {
+			delete(l.keys, key)
+		}
+	}
+}
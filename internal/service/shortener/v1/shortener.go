@@ -3,19 +3,57 @@ package shortener
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/url"
+	"regexp"
+	"runtime"
+	"sync"
 	"time"
 
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/canonical"
 	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/policy"
+	destinationPolicy "github.com/danilovkiri/dk_go_url_shortener/internal/service/policy/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/shortener"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/slug"
+	slugGenerator "github.com/danilovkiri/dk_go_url_shortener/internal/service/slug/v1"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
-	"github.com/speps/go-hashids/v2"
+	"golang.org/x/crypto/bcrypt"
 )
 
-const SaltKey = "Some Hashing Key"
-const MinLength = 5
+// alias constraints for caller-chosen sURLs
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+)
+
+// MaxPasswordLength is the longest password bcrypt takes into account.
+const MaxPasswordLength = 72
+
+// export parameters
+const (
+	// ExportPageSize is the number of URLs read from the storage at once while exporting
+	ExportPageSize = 1000
+	// DefaultExportPageTimeout bounds reading one page of an export if cfg.ExportPageTimeout is not set
+	DefaultExportPageTimeout = 500 * time.Millisecond
+)
+
+// aliasPattern defines an allowed alphabet for caller-chosen sURLs.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases lists sURLs which would be shadowed by other service endpoints.
+var reservedAliases = map[string]bool{
+	"api":   true,
+	"debug": true,
+	"ping":  true,
+}
 
 // Check interface implementation explicitly
 var (
@@ -24,29 +62,56 @@ var (
 
 // Shortener struct defines data structure handling and provides support for adding new implementations.
 type Shortener struct {
-	SaltKey    string
-	MinLength  int
-	hashID     *hashids.HashID
-	URLStorage storage.URLStorage
+	generator     slug.Generator
+	canonicalizer *canonical.Canonicalizer
+	policy        policy.Checker
+	// retries is the number of times a generated sURL is replaced after colliding with a stored one
+	retries int
+	// attempts limits failed password attempts per sURL and client, urlAttempts limits them per sURL across all
+	// clients
+	attempts    *attemptLimiter
+	urlAttempts *attemptLimiter
+	// exportPageTimeout bounds reading one page of an export
+	exportPageTimeout time.Duration
+	URLStorage        storage.URLStorage
 }
 
-// InitShortener initializes a Shortener object and sets its attributes.
-func InitShortener(s storage.URLStorage) (*Shortener, error) {
+// InitShortener initializes a Shortener object and sets its attributes, sURLs are generated by the strategy
+// chosen by cfg, URLs are canonicalized by the steps chosen by cfg and checked against the destination policy.
+// Failed password attempts are limited per sURL and client as well as per sURL as configured by cfg.
+func InitShortener(s storage.URLStorage, cfg *config.Config) (*Shortener, error) {
 	if s == nil {
 		return nil, &serviceErrors.ServiceFoundNilStorage{Msg: "nil storage was passed to service initializer"}
 	}
-	hd := hashids.NewData()
-	hd.Salt = SaltKey
-	hd.MinLength = MinLength
-	hashID, err := hashids.NewWithData(hd)
+	generator, err := slugGenerator.NewGenerator(cfg)
 	if err != nil {
 		return nil, &serviceErrors.ServiceInitHashError{Msg: err.Error()}
 	}
+	canonicalizer, err := canonical.NewCanonicalizer(cfg)
+	if err != nil {
+		return nil, &serviceErrors.ServiceInitCanonicalizerError{Msg: err.Error()}
+	}
+	checker, err := destinationPolicy.NewPolicy(cfg)
+	if err != nil {
+		return nil, &serviceErrors.ServiceInitPolicyError{Msg: err.Error()}
+	}
+	urlAttempts := cfg.PasswordURLAttempts
+	if urlAttempts <= 0 {
+		urlAttempts = DefaultPasswordURLAttempts
+	}
+	exportPageTimeout := cfg.ExportPageTimeout
+	if exportPageTimeout <= 0 {
+		exportPageTimeout = DefaultExportPageTimeout
+	}
 	shortener := &Shortener{
-		SaltKey:    SaltKey,
-		MinLength:  MinLength,
-		hashID:     hashID,
-		URLStorage: s,
+		generator:         generator,
+		canonicalizer:     canonicalizer,
+		policy:            checker,
+		retries:           cfg.SlugRetries,
+		attempts:          newAttemptLimiter(cfg.PasswordAttempts, cfg.PasswordLockout),
+		urlAttempts:       newAttemptLimiter(urlAttempts, cfg.PasswordLockout),
+		exportPageTimeout: exportPageTimeout,
+		URLStorage:        s,
 	}
 	return shortener, nil
 }
@@ -60,35 +125,261 @@ func (short *Shortener) GetStats(ctx context.Context) (nURLs int64, nUsers int64
 	return nURLs, nUsers, nil
 }
 
-// Encode generates a sURL, stores URL and sURL in a storage, and returns sURL.
-func (short *Shortener) Encode(ctx context.Context, URL string, userID string) (sURL string, err error) {
-	_, err = url.ParseRequestURI(URL)
+// Encode generates a sURL (or uses a caller-chosen alias), stores URL and sURL in a storage, and returns sURL.
+// A generated sURL which collides with a stored one is regenerated up to the configured number of retries.
+func (short *Shortener) Encode(ctx context.Context, URL string, userID string, opts modelurl.EncodeOptions) (sURL string, err error) {
+	entry, err := short.newEntry(URL, userID, opts)
 	if err != nil {
-		return "", &serviceErrors.ServiceIncorrectInputURL{Msg: err.Error()}
+		return "", err
+	}
+	if opts.Password != "" {
+		entry.PasswordHash, err = hashPassword(opts.Password)
+		if err != nil {
+			return "", err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err = short.URLStorage.Dump(ctx, entry)
+		if attempt > short.retries || !isCollision(err, opts) {
+			break
+		}
+		entry.SURL, err = short.generator.Generate(entry.URL, attempt)
+		if err != nil {
+			return "", &serviceErrors.ServiceSlugGenerationError{Msg: err.Error()}
+		}
 	}
-	sURL = short.generateSlug()
-	err = short.URLStorage.Dump(ctx, URL, sURL, userID)
 	if err != nil {
-		return "", err
+		return "", asDenied(err)
 	}
-	return sURL, nil
+	return entry.SURL, nil
 }
 
-// Decode retrieves and returns URL based on the given sURL as a key.
+// EncodeBatch validates and stores a batch of URLs at once, invalid and conflicting items are reported
+// per item while err is only set if the batch as a whole could not be stored. Passwords of protected items are
+// hashed concurrently before storing the batch, see modelurl.BatchTimeout.
+func (short *Shortener) EncodeBatch(ctx context.Context, items []modelurl.BatchItem, userID string) (results []modelurl.BatchResult, err error) {
+	results = make([]modelurl.BatchResult, len(items))
+	// statuses are derived from outcomes of all items once they are known
+	defer func() {
+		for i := range results {
+			results[i].Status = batchStatus(results[i].Err)
+		}
+	}()
+	entries := make([]modelstorage.URLStorageEntry, 0, len(items))
+	positions := make([]int, 0, len(items))
+	generated := make(map[string]bool)
+	for i, item := range items {
+		entry, err := short.newEntry(item.URL, userID, item.Opts)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		// generated sURLs may repeat within one batch, e.g. for the same URL, make sure that they do not
+		for attempt := 1; item.Opts.Alias == "" && generated[entry.SURL] && attempt <= short.retries; attempt++ {
+			entry.SURL, err = short.generator.Generate(entry.URL, attempt)
+			if err != nil {
+				return nil, &serviceErrors.ServiceSlugGenerationError{Msg: err.Error()}
+			}
+		}
+		generated[entry.SURL] = true
+		entries = append(entries, entry)
+		positions = append(positions, i)
+	}
+	if len(entries) == 0 {
+		return results, nil
+	}
+	err = hashPasswords(ctx, entries, items, positions)
+	if err != nil {
+		return nil, err
+	}
+	dumpResults, err := short.URLStorage.DumpBatch(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	// regenerate sURLs which collided with stored ones and store their entries again
+	for attempt := 1; attempt <= short.retries; attempt++ {
+		var retry []int
+		var retryEntries []modelstorage.URLStorageEntry
+		for j, dumpErr := range dumpResults {
+			if !isCollision(dumpErr, items[positions[j]].Opts) {
+				continue
+			}
+			entries[j].SURL, err = short.generator.Generate(entries[j].URL, attempt)
+			if err != nil {
+				return nil, &serviceErrors.ServiceSlugGenerationError{Msg: err.Error()}
+			}
+			retry = append(retry, j)
+			retryEntries = append(retryEntries, entries[j])
+		}
+		if len(retry) == 0 {
+			break
+		}
+		retryResults, err := short.URLStorage.DumpBatch(ctx, retryEntries)
+		for k, j := range retry {
+			switch {
+			case err != nil:
+				dumpResults[j] = err
+			default:
+				dumpResults[j] = retryResults[k]
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	for j, dumpErr := range dumpResults {
+		i := positions[j]
+		var alreadyExistsError *storageErrors.AlreadyExistsError
+		switch {
+		case dumpErr == nil:
+			results[i].SURL = entries[j].SURL
+		case errors.As(dumpErr, &alreadyExistsError):
+			results[i].SURL = alreadyExistsError.ValidSURL
+			results[i].Err = dumpErr
+		default:
+			results[i].Err = asDenied(dumpErr)
+		}
+	}
+	return results, nil
+}
+
+// newEntry validates URL and options and makes a storage entry with a generated or caller-chosen sURL, the entry
+// keeps the canonical form of URL which is deduplicated and redirected to. URLs violating the destination policy
+// are rejected with serviceErrors.ServiceDestinationDenied.
+func (short *Shortener) newEntry(URL string, userID string, opts modelurl.EncodeOptions) (modelstorage.URLStorageEntry, error) {
+	_, err := url.ParseRequestURI(URL)
+	if err != nil {
+		return modelstorage.URLStorageEntry{}, &serviceErrors.ServiceIncorrectInputURL{Msg: err.Error()}
+	}
+	canonicalURL, err := short.canonicalizer.Canonicalize(URL)
+	if err != nil {
+		return modelstorage.URLStorageEntry{}, &serviceErrors.ServiceIncorrectInputURL{Msg: err.Error()}
+	}
+	err = short.policy.Check(canonicalURL)
+	if err != nil {
+		return modelstorage.URLStorageEntry{}, err
+	}
+	var sURL string
+	if opts.Alias != "" {
+		err = validateAlias(opts.Alias)
+		if err != nil {
+			return modelstorage.URLStorageEntry{}, err
+		}
+		sURL = opts.Alias
+	} else {
+		sURL, err = short.generator.Generate(canonicalURL, 0)
+		if err != nil {
+			return modelstorage.URLStorageEntry{}, &serviceErrors.ServiceSlugGenerationError{Msg: err.Error()}
+		}
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return modelstorage.URLStorageEntry{}, &serviceErrors.ServiceIncorrectExpiration{Msg: fmt.Sprintf("%s: expiration time must be in the future", opts.ExpiresAt.Format(time.RFC3339))}
+	}
+	entry := modelstorage.URLStorageEntry{
+		SURL:      sURL,
+		URL:       canonicalURL,
+		UserID:    userID,
+		ExpiresAt: opts.ExpiresAt,
+	}
+	if canonicalURL != URL {
+		entry.OriginalURL = URL
+	}
+	if opts.Password != "" {
+		err = validatePassword(opts.Password)
+		if err != nil {
+			return modelstorage.URLStorageEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// Decode retrieves and returns URL based on the given sURL as a key, password-protected sURLs are reported with
+// serviceErrors.ServicePasswordRequired and are to be decoded with Unlock.
 func (short *Shortener) Decode(ctx context.Context, sURL string) (URL string, err error) {
 	URL, err = short.URLStorage.Retrieve(ctx, sURL)
 	if err != nil {
+		var protectedError *storageErrors.ProtectedError
+		if errors.As(err, &protectedError) {
+			return "", &serviceErrors.ServicePasswordRequired{Msg: err.Error()}
+		}
 		return "", err
 	}
 	return URL, nil
 }
 
-// Delete performs soft removal of URL-sURL entries with task management and resource allocation.
-func (short *Shortener) Delete(ctx context.Context, sURLs []string, userID string) {
+// Unlock retrieves and returns URL of a password-protected sURL if password matches, sURLs which are not
+// protected are decoded regardless of password. Failed attempts are limited per sURL and clientID as well as per
+// sURL across all clients so that changing clientID does not lift the limit.
+func (short *Shortener) Unlock(ctx context.Context, sURL, password, clientID string) (URL string, err error) {
+	key := sURL + "\x00" + clientID
+	retryAfter, ok := short.attempts.acquire(key)
+	if !ok {
+		return "", &serviceErrors.ServiceTooManyAttempts{Msg: fmt.Sprintf("%s: too many failed password attempts", sURL), RetryAfter: retryAfter}
+	}
+	retryAfter, ok = short.urlAttempts.acquire(sURL)
+	if !ok {
+		short.attempts.release(key)
+		return "", &serviceErrors.ServiceTooManyAttempts{Msg: fmt.Sprintf("%s: too many failed password attempts", sURL), RetryAfter: retryAfter}
+	}
+	URL, err = short.URLStorage.Retrieve(ctx, sURL)
+	var protectedError *storageErrors.ProtectedError
+	if !errors.As(err, &protectedError) {
+		short.attempts.release(key)
+		short.urlAttempts.release(sURL)
+		return URL, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(protectedError.PasswordHash), []byte(password))
+	if err != nil {
+		return "", &serviceErrors.ServiceIncorrectPassword{Msg: fmt.Sprintf("%s: incorrect password", sURL)}
+	}
+	short.attempts.reset(key)
+	short.urlAttempts.release(sURL)
+	return protectedError.URL, nil
+}
+
+// Delete performs soft removal of URL-sURL entries with task management and resource allocation, it returns
+// an ID of the deletion job once all deletion tasks are accepted by the storage.
+func (short *Shortener) Delete(ctx context.Context, sURLs []string, userID string) (jobID string, err error) {
+	if len(sURLs) == 0 {
+		return "", &serviceErrors.ServiceIncorrectInputURL{Msg: "no short URLs to delete"}
+	}
+	jobID, err = generateJobID()
+	if err != nil {
+		return "", err
+	}
 	for i := 0; i < len(sURLs); i++ {
-		item := modelstorage.URLChannelEntry{UserID: userID, SURL: sURLs[i]}
-		short.URLStorage.SendToQueue(item)
+		item := modelstorage.URLChannelEntry{UserID: userID, SURL: sURLs[i], JobID: jobID}
+		err := short.URLStorage.SendToQueue(ctx, item)
+		if err != nil {
+			return "", err
+		}
 	}
+	return jobID, nil
+}
+
+// GetDeleteJob retrieves a report of a deletion job created by userID.
+func (short *Shortener) GetDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error) {
+	job, err = short.URLStorage.RetrieveDeleteJob(ctx, jobID, userID)
+	if err != nil {
+		return modelurl.DeleteJob{}, err
+	}
+	return job, nil
+}
+
+// Restore clears the deletion flag of URL-sURL entries deleted by userID within the grace window, sURLs are kept.
+func (short *Shortener) Restore(ctx context.Context, sURLs []string, userID string) (results []modelurl.RestoreResult, err error) {
+	if len(sURLs) == 0 {
+		return nil, &serviceErrors.ServiceIncorrectInputURL{Msg: "no short URLs to restore"}
+	}
+	outcomes, err := short.URLStorage.RestoreBatch(ctx, sURLs, userID)
+	if err != nil {
+		return nil, err
+	}
+	results = make([]modelurl.RestoreResult, len(sURLs))
+	for i, sURL := range sURLs {
+		results[i] = modelurl.RestoreResult{SURL: sURL, Status: outcomes[i]}
+	}
+	return results, nil
 }
 
 // DecodeByUserID retrieves and returns all pairs of sURL:URL for a given user ID.
@@ -100,14 +391,174 @@ func (short *Shortener) DecodeByUserID(ctx context.Context, userID string) (URLs
 	return URLs, nil
 }
 
+// ExportByUserID pages through all pairs of sURL:URL for a given user ID in ascending order of sURLs and passes
+// non-empty pages of up to ExportPageSize pairs to fn. Reading a page is bounded by cfg.ExportPageTimeout while
+// the whole export is bounded by ctx only, an error of fn stops the export and is returned as is.
+func (short *Shortener) ExportByUserID(ctx context.Context, userID string, fn func(URLs []modelurl.FullURL) error) error {
+	afterSURL := ""
+	for {
+		URLs, err := short.exportPage(ctx, userID, afterSURL)
+		if err != nil {
+			return err
+		}
+		if len(URLs) > 0 {
+			err = fn(URLs)
+			if err != nil {
+				return err
+			}
+		}
+		if len(URLs) < ExportPageSize {
+			return nil
+		}
+		afterSURL = URLs[len(URLs)-1].SURL
+	}
+}
+
+// exportPage reads a page of pairs of userID following afterSURL.
+func (short *Shortener) exportPage(ctx context.Context, userID, afterSURL string) ([]modelurl.FullURL, error) {
+	ctx, cancel := context.WithTimeout(ctx, short.exportPageTimeout)
+	defer cancel()
+	return short.URLStorage.ListByUserID(ctx, userID, afterSURL, ExportPageSize)
+}
+
 func (short *Shortener) PingDB() error {
 	err := short.URLStorage.PingDB()
 	return err
 }
 
-// generateSlug generates and returns a short unique identifier for a string.
-func (short *Shortener) generateSlug() (slug string) {
-	now := time.Now().UnixNano()
-	slug, _ = short.hashID.Encode([]int{int(now)})
-	return slug
+// Compact triggers compaction of the underlying storage if it supports one.
+func (short *Shortener) Compact(ctx context.Context) error {
+	var compactor storage.Compactor
+	if !storage.As(short.URLStorage, &compactor) {
+		return &serviceErrors.ServiceCompactionNotSupported{Msg: "storage does not support compaction"}
+	}
+	return compactor.Compact(ctx)
+}
+
+// GetPurgeStats retrieves counters of purged entries if the underlying storage supports purging.
+func (short *Shortener) GetPurgeStats(ctx context.Context) (stats modelurl.PurgeStats, err error) {
+	var purger storage.Purger
+	if !storage.As(short.URLStorage, &purger) {
+		return modelurl.PurgeStats{}, &serviceErrors.ServicePurgeNotSupported{Msg: "storage does not support purging"}
+	}
+	return purger.GetPurgeStats(ctx)
+}
+
+// isCollision reports whether err is a collision of a generated sURL with a stored one, collisions of
+// caller-chosen aliases are not retried.
+func isCollision(err error, opts modelurl.EncodeOptions) bool {
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	return opts.Alias == "" && errors.As(err, &sURLAlreadyExistsError)
+}
+
+// batchStatus maps an outcome of shortening one URL of a batch to a status reported to clients.
+func batchStatus(err error) string {
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	var urlTakenError *storageErrors.URLTakenError
+	var destinationDenied *serviceErrors.ServiceDestinationDenied
+	switch {
+	case err == nil:
+		return modelurl.BatchStatusCreated
+	case errors.As(err, &alreadyExistsError):
+		return modelurl.BatchStatusExists
+	case errors.As(err, &sURLAlreadyExistsError) || errors.As(err, &urlTakenError):
+		return modelurl.BatchStatusConflict
+	case errors.As(err, &destinationDenied):
+		return modelurl.BatchStatusDenied
+	default:
+		return modelurl.BatchStatusInvalid
+	}
+}
+
+// asDenied reports a rejected write of a URL listed in the threat feed as a destination policy violation, other
+// errors are returned as is.
+func asDenied(err error) error {
+	var blockedError *storageErrors.BlockedError
+	if errors.As(err, &blockedError) {
+		return &serviceErrors.ServiceDestinationDenied{Msg: fmt.Sprintf("%s is listed in the threat feed", blockedError.Host), Reason: policy.ReasonMaliciousDomain}
+	}
+	return err
+}
+
+// generateJobID generates a random identifier of a deletion job.
+func generateJobID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validatePassword checks a password protecting a sURL.
+func validatePassword(password string) error {
+	if len(password) > MaxPasswordLength {
+		return &serviceErrors.ServiceIncorrectPassword{Msg: fmt.Sprintf("password must not be longer than %d bytes", MaxPasswordLength)}
+	}
+	return nil
+}
+
+// hashPassword validates a password protecting a sURL and returns its bcrypt hash.
+func hashPassword(password string) (string, error) {
+	err := validatePassword(password)
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// hashPasswords sets password hashes of entries made of items at positions, hashing is spread over available CPUs
+// and stops once ctx is done so that abandoned batches do not keep CPUs busy.
+func hashPasswords(ctx context.Context, entries []modelstorage.URLStorageEntry, items []modelurl.BatchItem, positions []int) error {
+	slots := make(chan struct{}, runtime.GOMAXPROCS(0))
+	errs := make([]error, len(entries))
+	wg := &sync.WaitGroup{}
+	for j, i := range positions {
+		password := items[i].Opts.Password
+		if password == "" {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				if ctx.Err() != nil {
+					return
+				}
+				entries[j].PasswordHash, errs[j] = hashPassword(password)
+			}(j)
+		}
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAlias checks a caller-chosen sURL against the allowed alphabet, length and reserved words.
+func validateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return &serviceErrors.ServiceIncorrectAlias{Msg: fmt.Sprintf("%s: alias length must be between %d and %d", alias, MinAliasLength, MaxAliasLength)}
+	}
+	if !aliasPattern.MatchString(alias) {
+		return &serviceErrors.ServiceIncorrectAlias{Msg: fmt.Sprintf("%s: alias may only contain latin letters, digits, '-' and '_'", alias)}
+	}
+	if reservedAliases[alias] {
+		return &serviceErrors.ServiceIncorrectAlias{Msg: fmt.Sprintf("%s: alias is reserved", alias)}
+	}
+	return nil
 }
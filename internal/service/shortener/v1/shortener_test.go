@@ -3,14 +3,22 @@ package shortener
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/mocks"
+	serviceErrors "github.com/danilovkiri/dk_go_url_shortener/internal/service/errors"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/policy"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Tests
@@ -21,7 +29,7 @@ func TestInitShortener(t *testing.T) {
 	cfg.ServerAddress = ":8080"
 	cfg.BaseURL = "http://localhost:8080"
 	cfg.FileStoragePath = "url_storage.json"
-	_, err := InitShortener(nil)
+	_, err := InitShortener(nil, cfg)
 	assert.Equal(t, "nil storage was passed to service initializer", err.Error())
 }
 
@@ -30,7 +38,7 @@ func TestShortener_GetStats_Fail(t *testing.T) {
 	defer ctrl.Finish()
 	s := mocks.NewMockURLStorage(ctrl)
 	s.EXPECT().GetStats(context.Background()).Return(int64(0), int64(0), errors.New("generic error"))
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	URLs, users, err := processor.GetStats(context.Background())
 	assert.Equal(t, URLs, int64(0))
 	assert.Equal(t, users, int64(0))
@@ -42,19 +50,47 @@ func TestShortener_GetStats(t *testing.T) {
 	defer ctrl.Finish()
 	s := mocks.NewMockURLStorage(ctrl)
 	s.EXPECT().GetStats(context.Background()).Return(int64(10), int64(12), nil)
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	URLs, users, err := processor.GetStats(context.Background())
 	assert.Equal(t, URLs, int64(10))
 	assert.Equal(t, users, int64(12))
 	assert.Equal(t, err, nil)
 }
 
+// purgingURLStorage combines mocks of a storage which supports purging.
+type purgingURLStorage struct {
+	*mocks.MockURLStorage
+	*mocks.MockPurger
+}
+
+func TestShortener_GetPurgeStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := purgingURLStorage{MockURLStorage: mocks.NewMockURLStorage(ctrl), MockPurger: mocks.NewMockPurger(ctrl)}
+	lastPurgeAt := time.Now()
+	s.MockPurger.EXPECT().GetPurgeStats(context.Background()).Return(modelurl.PurgeStats{PurgedURLs: 10, LastPurgeAt: &lastPurgeAt, LastPurgedURLs: 2}, nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	stats, err := processor.GetPurgeStats(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, modelurl.PurgeStats{PurgedURLs: 10, LastPurgeAt: &lastPurgeAt, LastPurgedURLs: 2}, stats)
+}
+
+func TestShortener_GetPurgeStats_NotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.GetPurgeStats(context.Background())
+	var purgeNotSupported *serviceErrors.ServicePurgeNotSupported
+	assert.True(t, errors.As(err, &purgeNotSupported))
+}
+
 func TestShortener_PingDB(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	s := mocks.NewMockURLStorage(ctrl)
 	s.EXPECT().PingDB().Return(nil)
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	processor.PingDB()
 }
 
@@ -64,7 +100,7 @@ func TestShortener_DecodeByUserID_Fail(t *testing.T) {
 	s := mocks.NewMockURLStorage(ctrl)
 	userID := "someUserID"
 	s.EXPECT().RetrieveByUserID(context.Background(), userID).Return(nil, errors.New("generic error"))
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	_, err := processor.DecodeByUserID(context.Background(), userID)
 	assert.Equal(t, errors.New("generic error"), err)
 }
@@ -85,11 +121,49 @@ func TestShortener_DecodeByUserID(t *testing.T) {
 		},
 	}
 	s.EXPECT().RetrieveByUserID(context.Background(), userID).Return(URLs, nil)
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	res, _ := processor.DecodeByUserID(context.Background(), userID)
 	assert.Equal(t, URLs, res)
 }
 
+func TestShortener_ExportByUserID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	firstPage := make([]modelurl.FullURL, ExportPageSize)
+	for i := range firstPage {
+		firstPage[i] = modelurl.FullURL{URL: fmt.Sprintf("someURL%04d", i), SURL: fmt.Sprintf("someShortURL%04d", i)}
+	}
+	lastPage := []modelurl.FullURL{{URL: "someURL", SURL: "someShortURL"}}
+	gomock.InOrder(
+		s.EXPECT().ListByUserID(gomock.Any(), userID, "", ExportPageSize).Return(firstPage, nil),
+		s.EXPECT().ListByUserID(gomock.Any(), userID, firstPage[ExportPageSize-1].SURL, ExportPageSize).Return(lastPage, nil),
+	)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	var pages [][]modelurl.FullURL
+	err := processor.ExportByUserID(context.Background(), userID, func(URLs []modelurl.FullURL) error {
+		pages = append(pages, URLs)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]modelurl.FullURL{firstPage, lastPage}, pages)
+}
+
+func TestShortener_ExportByUserID_Fail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	s.EXPECT().ListByUserID(gomock.Any(), userID, "", ExportPageSize).Return(nil, errors.New("generic error"))
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	err := processor.ExportByUserID(context.Background(), userID, func(URLs []modelurl.FullURL) error {
+		t.Fatal("no page is expected")
+		return nil
+	})
+	assert.Equal(t, errors.New("generic error"), err)
+}
+
 func TestShortener_Delete(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -97,10 +171,79 @@ func TestShortener_Delete(t *testing.T) {
 	userID := "someUserID"
 	sURL := "someShortURL"
 	sURLs := []string{sURL}
-	item := modelstorage.URLChannelEntry{UserID: userID, SURL: sURL}
-	s.EXPECT().SendToQueue(item).Return()
-	processor, _ := InitShortener(s)
-	processor.Delete(context.Background(), sURLs, userID)
+	var item modelstorage.URLChannelEntry
+	s.EXPECT().SendToQueue(context.Background(), gomock.Any()).Do(func(_ context.Context, queued modelstorage.URLChannelEntry) {
+		item = queued
+	}).Return(nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	jobID, err := processor.Delete(context.Background(), sURLs, userID)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, jobID)
+	assert.Equal(t, modelstorage.URLChannelEntry{UserID: userID, SURL: sURL, JobID: jobID}, item)
+}
+
+func TestShortener_Delete_Empty(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Delete(context.Background(), []string{}, "someUserID")
+	var serviceIncorrectInputURL *serviceErrors.ServiceIncorrectInputURL
+	assert.ErrorAs(t, err, &serviceIncorrectInputURL)
+}
+
+func TestShortener_Delete_Fail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	sURLs := []string{"someShortURL1", "someShortURL2"}
+	// deletion stops at the first task which was not accepted
+	s.EXPECT().SendToQueue(context.Background(), gomock.Any()).Return(errors.New("generic error"))
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Delete(context.Background(), sURLs, userID)
+	assert.Equal(t, errors.New("generic error"), err)
+}
+
+func TestShortener_Restore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	sURLs := []string{"someShortURL1", "someShortURL2"}
+	s.EXPECT().RestoreBatch(context.Background(), sURLs, userID).Return([]string{modelurl.RestoreOutcomeRestored, modelurl.RestoreOutcomeNotOwned}, nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	results, err := processor.Restore(context.Background(), sURLs, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []modelurl.RestoreResult{
+		{SURL: "someShortURL1", Status: modelurl.RestoreOutcomeRestored},
+		{SURL: "someShortURL2", Status: modelurl.RestoreOutcomeNotOwned},
+	}, results)
+}
+
+func TestShortener_Restore_Fail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	sURLs := []string{"someShortURL"}
+	s.EXPECT().RestoreBatch(context.Background(), sURLs, userID).Return(nil, errors.New("generic error"))
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Restore(context.Background(), sURLs, userID)
+	assert.Equal(t, errors.New("generic error"), err)
+}
+
+func TestShortener_GetDeleteJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	job := modelurl.DeleteJob{ID: "someJobID", Status: modelurl.DeleteJobDone, Deleted: []string{"someShortURL"}}
+	s.EXPECT().RetrieveDeleteJob(context.Background(), job.ID, userID).Return(job, nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	res, err := processor.GetDeleteJob(context.Background(), job.ID, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, job, res)
 }
 
 func TestShortener_Decode_Fail(t *testing.T) {
@@ -109,7 +252,7 @@ func TestShortener_Decode_Fail(t *testing.T) {
 	s := mocks.NewMockURLStorage(ctrl)
 	sURL := "someShortURL"
 	s.EXPECT().Retrieve(context.Background(), sURL).Return("", errors.New("generic error"))
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	_, err := processor.Decode(context.Background(), sURL)
 	assert.Equal(t, errors.New("generic error"), err)
 }
@@ -121,7 +264,7 @@ func TestShortener_Decode(t *testing.T) {
 	sURL := "someShortURL"
 	URL := "someURL"
 	s.EXPECT().Retrieve(context.Background(), sURL).Return(URL, nil)
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	res, _ := processor.Decode(context.Background(), sURL)
 	assert.Equal(t, URL, res)
 }
@@ -131,8 +274,8 @@ func TestShortener_Encode_Fail1(t *testing.T) {
 	s := mocks.NewMockURLStorage(ctrl)
 	URL := "some_invalid_URL"
 	userID := "someUserID"
-	processor, _ := InitShortener(s)
-	_, err := processor.Encode(context.Background(), URL, userID)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{})
 	assert.Equal(t, "parse \"some_invalid_URL\": invalid URI for request", err.Error())
 }
 
@@ -142,9 +285,9 @@ func TestShortener_Encode_Fail2(t *testing.T) {
 	s := mocks.NewMockURLStorage(ctrl)
 	URL := "https://www.some-url.com"
 	userID := "someUserID"
-	s.EXPECT().Dump(context.Background(), URL, gomock.Any(), userID).Return(errors.New("generic error"))
-	processor, _ := InitShortener(s)
-	_, err := processor.Encode(context.Background(), URL, userID)
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Return(errors.New("generic error"))
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{})
 	assert.Equal(t, errors.New("generic error"), err)
 }
 
@@ -154,10 +297,406 @@ func TestShortener_Encode(t *testing.T) {
 	s := mocks.NewMockURLStorage(ctrl)
 	URL := "https://www.some-url.com"
 	userID := "someUserID"
-	s.EXPECT().Dump(context.Background(), URL, gomock.Any(), userID).Return(nil)
-	processor, _ := InitShortener(s)
-	_, err := processor.Encode(context.Background(), URL, userID)
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Return(nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{})
+	assert.Equal(t, nil, err)
+}
+
+func TestShortener_Encode_Alias(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	URL := "https://www.some-url.com"
+	userID := "someUserID"
+	alias := "q3-report"
+	entry := modelstorage.URLStorageEntry{SURL: alias, URL: URL, UserID: userID}
+	s.EXPECT().Dump(context.Background(), entry).Return(nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	sURL, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{Alias: alias})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, alias, sURL)
+}
+
+func TestShortener_Encode_AliasFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	URL := "https://www.some-url.com"
+	userID := "someUserID"
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	tests := []struct {
+		name  string
+		alias string
+	}{
+		{name: "too short", alias: "q3"},
+		{name: "too long", alias: strings.Repeat("q", MaxAliasLength+1)},
+		{name: "forbidden symbols", alias: "q3/report"},
+		{name: "reserved word", alias: "ping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{Alias: tt.alias})
+			var incorrectAliasError *serviceErrors.ServiceIncorrectAlias
+			assert.ErrorAs(t, err, &incorrectAliasError)
+		})
+	}
+}
+
+func TestShortener_Encode_Collision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	URL := "https://www.some-url.com"
+	userID := "someUserID"
+	cfg := config.NewDefaultConfiguration()
+	cfg.SlugStrategy = config.SlugStrategyHash
+	cfg.SlugRetries = 2
+	var collided string
+	gomock.InOrder(
+		s.EXPECT().Dump(context.Background(), gomock.Any()).Do(func(_ context.Context, entry modelstorage.URLStorageEntry) {
+			collided = entry.SURL
+		}).Return(&storageErrors.SURLAlreadyExistsError{}),
+		s.EXPECT().Dump(context.Background(), gomock.Any()).Return(nil),
+	)
+	processor, _ := InitShortener(s, cfg)
+	sURL, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{})
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, collided, sURL)
+}
+
+func TestShortener_Encode_Canonical(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	cfg := config.NewDefaultConfiguration()
+	cfg.URLNormalizers = []string{config.URLNormalizerLowercase, config.URLNormalizerDefaultPort, config.URLNormalizerSortQuery}
+	var entries []modelstorage.URLStorageEntry
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Do(func(_ context.Context, entry modelstorage.URLStorageEntry) {
+		entries = append(entries, entry)
+	}).Return(nil).Times(2)
+	processor, _ := InitShortener(s, cfg)
+	_, err := processor.Encode(context.Background(), "HTTP://Example.com:80/a?b=1&a=2", userID, modelurl.EncodeOptions{})
+	assert.Equal(t, nil, err)
+	_, err = processor.Encode(context.Background(), "http://example.com/a?a=2&b=1", userID, modelurl.EncodeOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "http://example.com/a?a=2&b=1", entries[0].URL)
+	assert.Equal(t, "HTTP://Example.com:80/a?b=1&a=2", entries[0].OriginalURL)
+	assert.Equal(t, "http://example.com/a?a=2&b=1", entries[1].URL)
+	assert.Equal(t, "", entries[1].OriginalURL)
+}
+
+func TestShortener_Encode_Denied(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	cfg := config.NewDefaultConfiguration()
+	cfg.BaseURL = "https://sho.rt"
+	processor, _ := InitShortener(s, cfg)
+	for _, URL := range []string{"javascript:alert(1)", "http://127.0.0.1/", "https://sho.rt/abcde"} {
+		_, err := processor.Encode(context.Background(), URL, "someUserID", modelurl.EncodeOptions{})
+		var destinationDenied *serviceErrors.ServiceDestinationDenied
+		assert.True(t, errors.As(err, &destinationDenied), URL)
+	}
+	results, err := processor.EncodeBatch(context.Background(), []modelurl.BatchItem{{URL: "file:///etc/passwd"}}, "someUserID")
+	assert.Nil(t, err)
+	var destinationDenied *serviceErrors.ServiceDestinationDenied
+	assert.True(t, errors.As(results[0].Err, &destinationDenied))
+}
+
+func TestShortener_Encode_Password(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	var entry modelstorage.URLStorageEntry
+	s.EXPECT().Dump(context.Background(), gomock.Any()).DoAndReturn(func(_ context.Context, e modelstorage.URLStorageEntry) error {
+		entry = e
+		return nil
+	})
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Encode(context.Background(), "https://www.some-url.com", "someUserID", modelurl.EncodeOptions{Password: "s3cret"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "s3cret", entry.PasswordHash)
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(entry.PasswordHash), []byte("s3cret")))
+
+	_, err = processor.Encode(context.Background(), "https://www.some-url.com", "someUserID", modelurl.EncodeOptions{Password: strings.Repeat("p", MaxPasswordLength+1)})
+	var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+	assert.True(t, errors.As(err, &incorrectPasswordError))
+}
+
+func TestShortener_Unlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	protected := &storageErrors.ProtectedError{SURL: "someSURL", URL: "https://www.some-url.com", PasswordHash: string(hash)}
+	s.EXPECT().Retrieve(context.Background(), "someSURL").Return("", protected).AnyTimes()
+	s.EXPECT().Retrieve(context.Background(), "otherSURL").Return("https://www.other-url.com", nil).AnyTimes()
+	cfg := config.NewDefaultConfiguration()
+	cfg.PasswordAttempts = 2
+	cfg.PasswordLockout = time.Hour
+	processor, _ := InitShortener(s, cfg)
+
+	_, err := processor.Decode(context.Background(), "someSURL")
+	var passwordRequiredError *serviceErrors.ServicePasswordRequired
+	assert.True(t, errors.As(err, &passwordRequiredError))
+	URL, err := processor.Unlock(context.Background(), "someSURL", "s3cret", "client1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.some-url.com", URL)
+	// sURLs which are not protected are decoded regardless of password
+	URL, err = processor.Unlock(context.Background(), "otherSURL", "anything", "client1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.other-url.com", URL)
+
+	// failed attempts are limited per sURL and client
+	var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+	for i := 0; i < cfg.PasswordAttempts; i++ {
+		_, err = processor.Unlock(context.Background(), "someSURL", "wrong", "client1")
+		assert.True(t, errors.As(err, &incorrectPasswordError))
+	}
+	_, err = processor.Unlock(context.Background(), "someSURL", "s3cret", "client1")
+	var tooManyAttemptsError *serviceErrors.ServiceTooManyAttempts
+	assert.True(t, errors.As(err, &tooManyAttemptsError))
+	assert.True(t, tooManyAttemptsError.RetryAfter > 0 && tooManyAttemptsError.RetryAfter <= time.Hour)
+	URL, err = processor.Unlock(context.Background(), "someSURL", "s3cret", "client2")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.some-url.com", URL)
+}
+
+func TestShortener_Unlock_URLAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	protected := &storageErrors.ProtectedError{SURL: "someSURL", URL: "https://www.some-url.com", PasswordHash: string(hash)}
+	s.EXPECT().Retrieve(context.Background(), "someSURL").Return("", protected).AnyTimes()
+	cfg := config.NewDefaultConfiguration()
+	cfg.PasswordAttempts = 2
+	cfg.PasswordURLAttempts = 3
+	processor, _ := InitShortener(s, cfg)
+
+	// failed attempts are limited per sURL regardless of clients
+	var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+	for i := 0; i < cfg.PasswordURLAttempts; i++ {
+		_, err := processor.Unlock(context.Background(), "someSURL", "wrong", fmt.Sprintf("client%d", i))
+		assert.True(t, errors.As(err, &incorrectPasswordError))
+	}
+	_, err := processor.Unlock(context.Background(), "someSURL", "s3cret", "otherClient")
+	var tooManyAttemptsError *serviceErrors.ServiceTooManyAttempts
+	assert.True(t, errors.As(err, &tooManyAttemptsError))
+}
+
+func TestShortener_Unlock_Concurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	protected := &storageErrors.ProtectedError{SURL: "someSURL", URL: "https://www.some-url.com", PasswordHash: string(hash)}
+	s.EXPECT().Retrieve(context.Background(), "someSURL").Return("", protected).AnyTimes()
+	cfg := config.NewDefaultConfiguration()
+	cfg.PasswordAttempts = 3
+	processor, _ := InitShortener(s, cfg)
+
+	// parallel guesses are let through up to the limit only
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	passed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := processor.Unlock(context.Background(), "someSURL", "wrong", "client1")
+			var incorrectPasswordError *serviceErrors.ServiceIncorrectPassword
+			if errors.As(err, &incorrectPasswordError) {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, cfg.PasswordAttempts, passed)
+}
+
+func TestShortener_Encode_Malicious(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Return(&storageErrors.BlockedError{Host: "evil.com"})
+	s.EXPECT().DumpBatch(context.Background(), gomock.Any()).Return([]error{&storageErrors.BlockedError{Host: "evil.com"}}, nil)
+	cfg := config.NewDefaultConfiguration()
+	processor, _ := InitShortener(s, cfg)
+	_, err := processor.Encode(context.Background(), "https://evil.com", "someUserID", modelurl.EncodeOptions{})
+	var destinationDenied *serviceErrors.ServiceDestinationDenied
+	assert.True(t, errors.As(err, &destinationDenied))
+	assert.Equal(t, policy.ReasonMaliciousDomain, destinationDenied.Reason)
+	results, err := processor.EncodeBatch(context.Background(), []modelurl.BatchItem{{URL: "https://evil.com"}}, "someUserID")
+	assert.Nil(t, err)
+	assert.True(t, errors.As(results[0].Err, &destinationDenied))
+	assert.Equal(t, policy.ReasonMaliciousDomain, destinationDenied.Reason)
+}
+
+func TestShortener_InitShortener_CanonicalizerFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	cfg := config.NewDefaultConfiguration()
+	cfg.URLNormalizers = []string{"some_normalizer"}
+	_, err := InitShortener(s, cfg)
+	var initCanonicalizerError *serviceErrors.ServiceInitCanonicalizerError
+	assert.True(t, errors.As(err, &initCanonicalizerError))
+}
+
+func TestShortener_Encode_CollisionFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	URL := "https://www.some-url.com"
+	userID := "someUserID"
+	cfg := config.NewDefaultConfiguration()
+	cfg.SlugRetries = 2
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Return(&storageErrors.SURLAlreadyExistsError{}).Times(3)
+	processor, _ := InitShortener(s, cfg)
+	_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{})
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.ErrorAs(t, err, &sURLAlreadyExistsError)
+
+	// caller-chosen aliases are not retried
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Return(&storageErrors.SURLAlreadyExistsError{SURL: "q3-report"})
+	_, err = processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{Alias: "q3-report"})
+	assert.ErrorAs(t, err, &sURLAlreadyExistsError)
+}
+
+func TestShortener_EncodeBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	items := []modelurl.BatchItem{
+		{URL: "https://www.some-url.com"},
+		{URL: "some-invalid-url"},
+		{URL: "https://www.another-url.com", Opts: modelurl.EncodeOptions{Alias: "q3-report"}},
+	}
+	s.EXPECT().DumpBatch(context.Background(), gomock.Len(2)).Return([]error{
+		&storageErrors.AlreadyExistsError{URL: "https://www.some-url.com", ValidSURL: "someValidSURL"},
+		nil,
+	}, nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	results, err := processor.EncodeBatch(context.Background(), items, userID)
 	assert.Equal(t, nil, err)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "someValidSURL", results[0].SURL)
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.ErrorAs(t, results[0].Err, &alreadyExistsError)
+	assert.Equal(t, modelurl.BatchStatusExists, results[0].Status)
+	var incorrectInputURL *serviceErrors.ServiceIncorrectInputURL
+	assert.ErrorAs(t, results[1].Err, &incorrectInputURL)
+	assert.Equal(t, modelurl.BatchStatusInvalid, results[1].Status)
+	assert.Equal(t, modelurl.BatchResult{SURL: "q3-report", Status: modelurl.BatchStatusCreated}, results[2])
+}
+
+func TestShortener_EncodeBatch_Collision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	userID := "someUserID"
+	items := []modelurl.BatchItem{
+		{URL: "https://www.some-url.com"},
+		{URL: "https://www.another-url.com", Opts: modelurl.EncodeOptions{Alias: "q3-report"}},
+		{URL: "https://www.third-url.com"},
+	}
+	cfg := config.NewDefaultConfiguration()
+	cfg.SlugStrategy = config.SlugStrategyRandom
+	cfg.SlugRetries = 1
+	gomock.InOrder(
+		s.EXPECT().DumpBatch(context.Background(), gomock.Len(3)).Return([]error{
+			&storageErrors.SURLAlreadyExistsError{},
+			&storageErrors.SURLAlreadyExistsError{SURL: "q3-report"},
+			nil,
+		}, nil),
+		// only the generated sURL which collided is retried
+		s.EXPECT().DumpBatch(context.Background(), gomock.Len(1)).Return([]error{nil}, nil),
+	)
+	processor, _ := InitShortener(s, cfg)
+	results, err := processor.EncodeBatch(context.Background(), items, userID)
+	assert.Equal(t, nil, err)
+	assert.Len(t, results, 3)
+	assert.Nil(t, results[0].Err)
+	assert.NotEmpty(t, results[0].SURL)
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.ErrorAs(t, results[1].Err, &sURLAlreadyExistsError)
+	assert.Nil(t, results[2].Err)
+}
+
+func TestShortener_EncodeBatch_Fail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	s.EXPECT().DumpBatch(context.Background(), gomock.Any()).Return(nil, errors.New("generic error"))
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.EncodeBatch(context.Background(), []modelurl.BatchItem{{URL: "https://www.some-url.com"}}, "someUserID")
+	assert.Equal(t, errors.New("generic error"), err)
+}
+
+func TestShortener_EncodeBatch_Passwords(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	items := make([]modelurl.BatchItem, 10)
+	for i := range items {
+		items[i] = modelurl.BatchItem{URL: fmt.Sprintf("https://www.some-url.com/%d", i), Opts: modelurl.EncodeOptions{Password: fmt.Sprintf("s3cret%d", i)}}
+	}
+	var entries []modelstorage.URLStorageEntry
+	s.EXPECT().DumpBatch(gomock.Any(), gomock.Len(len(items))).DoAndReturn(func(_ context.Context, e []modelstorage.URLStorageEntry) ([]error, error) {
+		entries = e
+		return make([]error, len(e)), nil
+	})
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	// protected batches are hashed within their own budget
+	ctx, cancel := context.WithTimeout(context.Background(), modelurl.BatchTimeout(items))
+	defer cancel()
+	results, err := processor.EncodeBatch(ctx, items, "someUserID")
+	assert.Nil(t, err)
+	for i, entry := range entries {
+		assert.Equal(t, modelurl.BatchStatusCreated, results[i].Status)
+		assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(entry.PasswordHash), []byte(items[i].Opts.Password)))
+	}
+
+	// hashing stops once the batch is abandoned
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = processor.EncodeBatch(ctx, items, "someUserID")
+	var contextTimeoutExceededError *storageErrors.ContextTimeoutExceededError
+	assert.True(t, errors.As(err, &contextTimeoutExceededError))
+}
+
+func TestShortener_Encode_Expiration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	URL := "https://www.some-url.com"
+	userID := "someUserID"
+	alias := "campaign"
+	expiresAt := time.Now().Add(time.Hour)
+	entry := modelstorage.URLStorageEntry{SURL: alias, URL: URL, UserID: userID, ExpiresAt: &expiresAt}
+	s.EXPECT().Dump(context.Background(), entry).Return(nil)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{Alias: alias, ExpiresAt: &expiresAt})
+	assert.Equal(t, nil, err)
+}
+
+func TestShortener_Encode_ExpirationFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	URL := "https://www.some-url.com"
+	userID := "someUserID"
+	expiresAt := time.Now().Add(-time.Hour)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
+	_, err := processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{ExpiresAt: &expiresAt})
+	var incorrectExpirationError *serviceErrors.ServiceIncorrectExpiration
+	assert.ErrorAs(t, err, &incorrectExpirationError)
 }
 
 // Benchmarks
@@ -168,7 +707,7 @@ func BenchmarkInitShortener(b *testing.B) {
 	defer ctrl.Finish()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = InitShortener(s)
+		_, _ = InitShortener(s, config.NewDefaultConfiguration())
 	}
 }
 
@@ -177,7 +716,7 @@ func BenchmarkShortener_PingDB(b *testing.B) {
 	defer ctrl.Finish()
 	s := mocks.NewMockURLStorage(ctrl)
 	s.EXPECT().PingDB().Return(nil).AnyTimes()
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		processor.PingDB()
@@ -190,11 +729,11 @@ func BenchmarkShortener_Encode(b *testing.B) {
 	s := mocks.NewMockURLStorage(ctrl)
 	URL := "https://www.some-url.com"
 	userID := "someUserID"
-	s.EXPECT().Dump(context.Background(), URL, gomock.Any(), userID).Return(nil).AnyTimes()
-	processor, _ := InitShortener(s)
+	s.EXPECT().Dump(context.Background(), gomock.Any()).Return(nil).AnyTimes()
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = processor.Encode(context.Background(), URL, userID)
+		_, _ = processor.Encode(context.Background(), URL, userID, modelurl.EncodeOptions{})
 	}
 }
 
@@ -205,7 +744,7 @@ func BenchmarkShortener_Decode(b *testing.B) {
 	sURL := "someShortURL"
 	URL := "someURL"
 	s.EXPECT().Retrieve(context.Background(), sURL).Return(URL, nil).AnyTimes()
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = processor.Decode(context.Background(), sURL)
@@ -228,7 +767,7 @@ func BenchmarkShortener_DecodeByUserID(b *testing.B) {
 		},
 	}
 	s.EXPECT().RetrieveByUserID(context.Background(), userID).Return(URLs, nil).AnyTimes()
-	processor, _ := InitShortener(s)
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = processor.DecodeByUserID(context.Background(), userID)
@@ -242,11 +781,10 @@ func BenchmarkShortener_Delete(b *testing.B) {
 	userID := "someUserID"
 	sURL := "someShortURL"
 	sURLs := []string{sURL}
-	item := modelstorage.URLChannelEntry{UserID: userID, SURL: sURL}
-	s.EXPECT().SendToQueue(item).Return().AnyTimes()
-	processor, _ := InitShortener(s)
+	s.EXPECT().SendToQueue(context.Background(), gomock.Any()).Return(nil).AnyTimes()
+	processor, _ := InitShortener(s, config.NewDefaultConfiguration())
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		processor.Delete(context.Background(), sURLs, userID)
+		_, _ = processor.Delete(context.Background(), sURLs, userID)
 	}
 }
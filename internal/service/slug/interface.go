@@ -0,0 +1,9 @@
+// Package slug provides methods for generating sURLs.
+package slug
+
+// Generator defines a set of methods for types implementing Generator.
+type Generator interface {
+	// Generate returns a sURL for URL, attempt is 0 for the first try and is incremented on each retry after a
+	// collision so that deterministic strategies yield another sURL.
+	Generate(URL string, attempt int) (sURL string, err error)
+}
@@ -0,0 +1,91 @@
+// Package slug provides strategies of sURL generation.
+package slug
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/slug"
+)
+
+// defaults applied to zero configuration values
+const (
+	DefaultSalt     = "Some Hashing Key"
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+	DefaultLength   = 5
+	// DefaultRandomLength is used by the random strategy instead of DefaultLength to keep collisions rare
+	DefaultRandomLength = 8
+)
+
+// NewGenerator initializes a generator of the strategy chosen by cfg.SlugStrategy.
+func NewGenerator(cfg *config.Config) (slug.Generator, error) {
+	salt, alphabet, length := cfg.SlugSalt, cfg.SlugAlphabet, cfg.SlugLength
+	if salt == "" {
+		salt = DefaultSalt
+	}
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("%d: slug length must not be negative", length)
+	}
+	switch cfg.SlugStrategy {
+	case config.SlugStrategyHashids, "":
+		if length == 0 {
+			length = DefaultLength
+		}
+		return NewHashids(salt, alphabet, length)
+	case config.SlugStrategyRandom:
+		if length == 0 {
+			length = DefaultRandomLength
+		}
+		return NewRandom(alphabet, length)
+	case config.SlugStrategySnowflake:
+		if length == 0 {
+			length = DefaultLength
+		}
+		return NewSnowflake(alphabet, length, cfg.SlugNodeID)
+	case config.SlugStrategyHash:
+		if length == 0 {
+			length = DefaultLength
+		}
+		return NewHash(salt, alphabet, length)
+	default:
+		return nil, fmt.Errorf("%s: unknown slug strategy", cfg.SlugStrategy)
+	}
+}
+
+// validateAlphabet checks that alphabet consists of at least two distinct characters.
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return fmt.Errorf("%s: slug alphabet must have at least 2 characters", alphabet)
+	}
+	seen := make(map[rune]bool)
+	for _, c := range alphabet {
+		if seen[c] {
+			return fmt.Errorf("%s: slug alphabet must not repeat characters", alphabet)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// encode represents n in the positional system given by alphabet, left-padded to minLength with the zero digit.
+func encode(n *big.Int, alphabet []rune, minLength int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	n = new(big.Int).Set(n)
+	mod := new(big.Int)
+	var digits []rune
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		digits = append(digits, alphabet[mod.Int64()])
+	}
+	for len(digits) < minLength {
+		digits = append(digits, alphabet[0])
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
@@ -0,0 +1,112 @@
+package slug
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests
+
+func TestNewGenerator(t *testing.T) {
+	tests := []struct {
+		strategy string
+		expected interface{}
+	}{
+		{strategy: "", expected: &Hashids{}},
+		{strategy: config.SlugStrategyHashids, expected: &Hashids{}},
+		{strategy: config.SlugStrategyRandom, expected: &Random{}},
+		{strategy: config.SlugStrategySnowflake, expected: &Snowflake{}},
+		{strategy: config.SlugStrategyHash, expected: &Hash{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			cfg := config.NewDefaultConfiguration()
+			cfg.SlugStrategy = tt.strategy
+			g, err := NewGenerator(cfg)
+			assert.Nil(t, err)
+			assert.IsType(t, tt.expected, g)
+			sURL, err := g.Generate("https://www.yandex.ru", 0)
+			assert.Nil(t, err)
+			assert.GreaterOrEqual(t, len(sURL), DefaultLength)
+		})
+	}
+}
+
+func TestNewGenerator_Fail(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.SlugStrategy = "some_strategy"
+	_, err := NewGenerator(cfg)
+	assert.NotNil(t, err)
+
+	cfg.SlugStrategy = config.SlugStrategyRandom
+	cfg.SlugAlphabet = "aab"
+	_, err = NewGenerator(cfg)
+	assert.NotNil(t, err)
+
+	cfg.SlugStrategy = config.SlugStrategySnowflake
+	cfg.SlugAlphabet = ""
+	cfg.SlugNodeID = MaxNodeID + 1
+	_, err = NewGenerator(cfg)
+	assert.NotNil(t, err)
+
+	cfg.SlugStrategy = config.SlugStrategyHashids
+	cfg.SlugLength = -1
+	_, err = NewGenerator(cfg)
+	assert.NotNil(t, err)
+}
+
+func TestRandom_Generate(t *testing.T) {
+	g, _ := NewRandom("ab", 12)
+	sURL, err := g.Generate("", 0)
+	assert.Nil(t, err)
+	assert.Len(t, sURL, 12)
+	assert.Equal(t, "", strings.Trim(sURL, "ab"))
+}
+
+func TestSnowflake_Generate(t *testing.T) {
+	g, _ := NewSnowflake(DefaultAlphabet, DefaultLength, 7)
+	seen := make(map[string]bool)
+	var last int64
+	for i := 0; i < 10000; i++ {
+		id := g.next()
+		assert.Greater(t, id, last)
+		assert.Equal(t, int64(7), id>>snowflakeSequenceBits&MaxNodeID)
+		last = id
+	}
+	for i := 0; i < 1000; i++ {
+		sURL, _ := g.Generate("", 0)
+		assert.False(t, seen[sURL], sURL)
+		seen[sURL] = true
+	}
+
+	// IDs of different nodes do not collide
+	other, _ := NewSnowflake(DefaultAlphabet, DefaultLength, 8)
+	sURL, _ := other.Generate("", 0)
+	assert.False(t, seen[sURL])
+}
+
+func TestHash_Generate(t *testing.T) {
+	g, _ := NewHash(DefaultSalt, DefaultAlphabet, 7)
+	first, _ := g.Generate("https://www.yandex.ru", 0)
+	again, _ := g.Generate("https://www.yandex.ru", 0)
+	retried, _ := g.Generate("https://www.yandex.ru", 1)
+	other, _ := g.Generate("https://www.yandex.kz", 0)
+	assert.Len(t, first, 7)
+	assert.Equal(t, first, again)
+	assert.NotEqual(t, first, retried)
+	assert.NotEqual(t, first, other)
+
+	salted, _ := NewHash("some_salt", DefaultAlphabet, 7)
+	sURL, _ := salted.Generate("https://www.yandex.ru", 0)
+	assert.NotEqual(t, first, sURL)
+}
+
+func TestEncode(t *testing.T) {
+	alphabet := []rune("0123456789")
+	assert.Equal(t, "00042", encode(big.NewInt(42), alphabet, 5))
+	assert.Equal(t, "123456", encode(big.NewInt(123456), alphabet, 3))
+}
@@ -0,0 +1,43 @@
+package slug
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"strconv"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/slug"
+)
+
+// Check interface implementation explicitly
+var (
+	_ slug.Generator = (*Hash)(nil)
+)
+
+// Hash generates sURLs deterministically from salted hashes of URLs, hence shortening the same URL again yields
+// the same sURL unless it collides.
+type Hash struct {
+	salt     string
+	alphabet []rune
+	length   int
+}
+
+// NewHash initializes a Hash generator of sURLs of exactly length characters.
+func NewHash(salt, alphabet string, length int) (*Hash, error) {
+	err := validateAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &Hash{salt: salt, alphabet: []rune(alphabet), length: length}, nil
+}
+
+// Generate returns a sURL derived from URL, retries after collisions mix attempt into the hash.
+func (g *Hash) Generate(URL string, attempt int) (string, error) {
+	data := g.salt + "\x00" + URL
+	if attempt > 0 {
+		data += "\x00" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(data))
+	// keep the least significant digits of the hash
+	sURL := []rune(encode(new(big.Int).SetBytes(sum[:]), g.alphabet, g.length))
+	return string(sURL[len(sURL)-g.length:]), nil
+}
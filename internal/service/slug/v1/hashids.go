@@ -0,0 +1,37 @@
+package slug
+
+import (
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/slug"
+	"github.com/speps/go-hashids/v2"
+)
+
+// Check interface implementation explicitly
+var (
+	_ slug.Generator = (*Hashids)(nil)
+)
+
+// Hashids generates sURLs by encoding the current time with hashids, sURLs of requests made within the same
+// nanosecond, e.g. by different instances, collide.
+type Hashids struct {
+	hashID *hashids.HashID
+}
+
+// NewHashids initializes a Hashids generator, sURLs are at least minLength characters long.
+func NewHashids(salt, alphabet string, minLength int) (*Hashids, error) {
+	hd := hashids.NewData()
+	hd.Salt = salt
+	hd.Alphabet = alphabet
+	hd.MinLength = minLength
+	hashID, err := hashids.NewWithData(hd)
+	if err != nil {
+		return nil, err
+	}
+	return &Hashids{hashID: hashID}, nil
+}
+
+// Generate returns a sURL derived from the current time, URL and attempt are ignored.
+func (g *Hashids) Generate(URL string, attempt int) (string, error) {
+	return g.hashID.EncodeInt64([]int64{time.Now().UnixNano()})
+}
@@ -0,0 +1,42 @@
+package slug
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/slug"
+)
+
+// Check interface implementation explicitly
+var (
+	_ slug.Generator = (*Random)(nil)
+)
+
+// Random generates sURLs of characters drawn uniformly from an alphabet by a cryptographic random source.
+type Random struct {
+	alphabet []rune
+	length   int
+}
+
+// NewRandom initializes a Random generator of sURLs of exactly length characters.
+func NewRandom(alphabet string, length int) (*Random, error) {
+	err := validateAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &Random{alphabet: []rune(alphabet), length: length}, nil
+}
+
+// Generate returns a random sURL, URL and attempt are ignored.
+func (g *Random) Generate(URL string, attempt int) (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	sURL := make([]rune, g.length)
+	for i := range sURL {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sURL[i] = g.alphabet[n.Int64()]
+	}
+	return string(sURL), nil
+}
@@ -0,0 +1,80 @@
+package slug
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/slug"
+)
+
+// Check interface implementation explicitly
+var (
+	_ slug.Generator = (*Snowflake)(nil)
+)
+
+// snowflake ID layout: milliseconds since snowflakeEpoch, node ID and a sequence number within a millisecond
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	// MaxNodeID is the largest node ID a Snowflake generator accepts
+	MaxNodeID   = 1<<snowflakeNodeBits - 1
+	maxSequence = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch keeps IDs short by counting time from 2022-01-01.
+var snowflakeEpoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake generates sURLs of monotonic IDs composed of time, node ID and a sequence number, sURLs of
+// instances with distinct node IDs never collide.
+type Snowflake struct {
+	alphabet  []rune
+	minLength int
+	nodeID    int64
+	mu        sync.Mutex
+	lastMilli int64
+	sequence  int64
+}
+
+// NewSnowflake initializes a Snowflake generator of node nodeID, sURLs are at least minLength characters long.
+func NewSnowflake(alphabet string, minLength int, nodeID int64) (*Snowflake, error) {
+	err := validateAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	if nodeID < 0 || nodeID > MaxNodeID {
+		return nil, fmt.Errorf("%d: node ID must be within [0, %d]", nodeID, MaxNodeID)
+	}
+	return &Snowflake{alphabet: []rune(alphabet), minLength: minLength, nodeID: nodeID}, nil
+}
+
+// Generate returns a sURL of the next ID, URL and attempt are ignored.
+func (g *Snowflake) Generate(URL string, attempt int) (string, error) {
+	return encode(big.NewInt(g.next()), g.alphabet, g.minLength), nil
+}
+
+// next returns the next ID, it waits for the next millisecond once the sequence is exhausted and does not go
+// back if the clock does.
+func (g *Snowflake) next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	milli := time.Since(snowflakeEpoch).Milliseconds()
+	if milli < g.lastMilli {
+		milli = g.lastMilli
+	}
+	if milli == g.lastMilli {
+		g.sequence++
+		if g.sequence > maxSequence {
+			for milli <= g.lastMilli {
+				time.Sleep(time.Millisecond)
+				milli = time.Since(snowflakeEpoch).Milliseconds()
+			}
+			g.sequence = 0
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMilli = milli
+	return milli<<(snowflakeNodeBits+snowflakeSequenceBits) | g.nodeID<<snowflakeSequenceBits | g.sequence
+}
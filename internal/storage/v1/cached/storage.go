@@ -0,0 +1,218 @@
+// Package cached provides a read-through cache decorator for URL storages.
+package cached
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// Check interface implementation explicitly
+var (
+	_ storage.URLStorage = (*Storage)(nil)
+	_ storage.Unwrapper  = (*Storage)(nil)
+)
+
+// cache metrics
+var (
+	cacheHits   = expvar.NewInt("cache.hits")
+	cacheMisses = expvar.NewInt("cache.misses")
+)
+
+// cacheEntry defines an outcome of a sURL lookup, err is set for negative lookups.
+type cacheEntry struct {
+	sURL      string
+	URL       string
+	err       error
+	expiresAt time.Time
+}
+
+// Storage struct wraps a URL storage and serves sURL lookups from a bounded LRU cache with TTL, not found,
+// expired, deleted and password-protected lookups are cached as well. Lookups of links are cached until the links
+// expire if that happens within TTL, links are only cached if the underlying storage is a
+// storage.ExpiringURLGetter since their expiration times are unknown otherwise. Entries are invalidated by writes
+// and deletions performed via this Storage, queued deletions are invalidated once flushed by the underlying
+// storage. Other instances sharing the same backend may observe stale entries for up to TTL.
+type Storage struct {
+	storage.URLStorage
+	// expiring is set if the underlying storage reports expiration times of links
+	expiring storage.ExpiringURLGetter
+	size     int
+	ttl      time.Duration
+	mu       sync.Mutex
+	// LRU list of *cacheEntry, most recently used entries are at the front
+	lru     *list.List
+	entries map[string]*list.Element
+	// generation is incremented on each invalidation so that lookups which started earlier are not cached
+	generation uint64
+}
+
+// InitStorage wraps s with a cache, s is returned as is if caching is disabled by cfg.
+func InitStorage(s storage.URLStorage, cfg *config.Config) storage.URLStorage {
+	if cfg.CacheSize <= 0 || cfg.CacheTTL <= 0 {
+		return s
+	}
+	st := &Storage{
+		URLStorage: s,
+		size:       cfg.CacheSize,
+		ttl:        cfg.CacheTTL,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+	st.expiring, _ = s.(storage.ExpiringURLGetter)
+	// lookups made between queueing a deletion and flushing it would otherwise keep serving the deleted link
+	var observer storage.DeleteObserver
+	if storage.As(s, &observer) {
+		observer.ObserveDeletes(func(sURLs []string) {
+			st.invalidate(sURLs...)
+		})
+	}
+	return st
+}
+
+// Unwrap returns the underlying storage so that its optional capabilities are found by storage.As, purged
+// entries are served from cache as deleted ones for up to TTL.
+func (s *Storage) Unwrap() storage.URLStorage {
+	return s.URLStorage
+}
+
+// Retrieve returns a cached lookup outcome for sURL or retrieves it from the underlying storage.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+	s.mu.Lock()
+	entry, ok := s.get(sURL)
+	generation := s.generation
+	s.mu.Unlock()
+	if ok {
+		cacheHits.Add(1)
+		return entry.URL, entry.err
+	}
+	cacheMisses.Add(1)
+	var linkExpiresAt *time.Time
+	if s.expiring != nil {
+		URL, linkExpiresAt, err = s.expiring.RetrieveWithExpiry(ctx, sURL)
+	} else {
+		URL, err = s.URLStorage.Retrieve(ctx, sURL)
+	}
+	if err != nil && !isCacheable(err) {
+		return "", err
+	}
+	// links which may expire at an unknown time are not cached
+	if s.expiring == nil && (err == nil || isProtected(err)) {
+		return URL, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+	if linkExpiresAt != nil && linkExpiresAt.After(now) && linkExpiresAt.Before(expiresAt) {
+		expiresAt = *linkExpiresAt
+	}
+	s.mu.Lock()
+	// skip caching if sURL could have been changed while the lookup was in progress
+	if generation == s.generation {
+		s.put(&cacheEntry{sURL: sURL, URL: URL, err: err, expiresAt: expiresAt})
+	}
+	s.mu.Unlock()
+	return URL, err
+}
+
+// Dump stores entry in the underlying storage and invalidates a cached negative lookup of its sURL.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	defer s.invalidate(entry.SURL)
+	return s.URLStorage.Dump(ctx, entry)
+}
+
+// DumpBatch stores entries in the underlying storage and invalidates cached negative lookups of their sURLs.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	sURLs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sURLs = append(sURLs, entry.SURL)
+	}
+	defer s.invalidate(sURLs...)
+	return s.URLStorage.DumpBatch(ctx, entries)
+}
+
+// DeleteBatch deletes entries in the underlying storage and invalidates cached lookups of sURLs.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	defer s.invalidate(sURLs...)
+	return s.URLStorage.DeleteBatch(ctx, sURLs, userID)
+}
+
+// RestoreBatch restores entries in the underlying storage and invalidates cached lookups of sURLs.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (results []string, err error) {
+	defer s.invalidate(sURLs...)
+	return s.URLStorage.RestoreBatch(ctx, sURLs, userID)
+}
+
+// SendToQueue passes item for asynchronous deletion and invalidates a cached lookup of its sURL, the lookup is
+// invalidated again once the deletion is flushed if the underlying storage is a storage.DeleteObserver.
+func (s *Storage) SendToQueue(ctx context.Context, item modelstorage.URLChannelEntry) error {
+	defer s.invalidate(item.SURL)
+	return s.URLStorage.SendToQueue(ctx, item)
+}
+
+// get returns a non-expired entry for sURL and marks it as recently used, must be called under the lock.
+func (s *Storage) get(sURL string) (*cacheEntry, bool) {
+	element, ok := s.entries[sURL]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		s.lru.Remove(element)
+		delete(s.entries, sURL)
+		return nil, false
+	}
+	s.lru.MoveToFront(element)
+	return entry, true
+}
+
+// put adds or replaces an entry and evicts the least recently used one if needed, must be called under
+// the lock.
+func (s *Storage) put(entry *cacheEntry) {
+	if element, ok := s.entries[entry.sURL]; ok {
+		element.Value = entry
+		s.lru.MoveToFront(element)
+		return
+	}
+	s.entries[entry.sURL] = s.lru.PushFront(entry)
+	if s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry).sURL)
+	}
+}
+
+// invalidate removes cached lookups of sURLs.
+func (s *Storage) invalidate(sURLs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for _, sURL := range sURLs {
+		if element, ok := s.entries[sURL]; ok {
+			s.lru.Remove(element)
+			delete(s.entries, sURL)
+		}
+	}
+}
+
+// isProtected checks whether a lookup error reports a password-protected link.
+func isProtected(err error) bool {
+	var protectedError *storageErrors.ProtectedError
+	return errors.As(err, &protectedError)
+}
+
+// isCacheable checks whether a lookup error reflects a state of sURL rather than a failure of the storage.
+func isCacheable(err error) bool {
+	var notFoundError *storageErrors.NotFoundError
+	var deletedError *storageErrors.DeletedError
+	var expiredError *storageErrors.ExpiredError
+	var protectedError *storageErrors.ProtectedError
+	return errors.As(err, &notFoundError) || errors.As(err, &deletedError) || errors.As(err, &expiredError) || errors.As(err, &protectedError)
+}
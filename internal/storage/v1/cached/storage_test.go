@@ -0,0 +1,275 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/mocks"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests
+
+func newCachedStorage(s storage.URLStorage, size int, ttl time.Duration) *Storage {
+	cfg := config.NewDefaultConfiguration()
+	cfg.CacheSize = size
+	cfg.CacheTTL = ttl
+	return InitStorage(s, cfg).(*Storage)
+}
+
+// expiringStorage is a storage mock reporting expiration times of links.
+type expiringStorage struct {
+	*mocks.MockURLStorage
+	*mocks.MockExpiringURLGetter
+}
+
+func newExpiringStorage(ctrl *gomock.Controller) *expiringStorage {
+	return &expiringStorage{MockURLStorage: mocks.NewMockURLStorage(ctrl), MockExpiringURLGetter: mocks.NewMockExpiringURLGetter(ctrl)}
+}
+
+func TestInitStorage_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	cfg := config.NewDefaultConfiguration()
+	assert.Equal(t, storage.URLStorage(s), InitStorage(s, cfg))
+}
+
+// capableStorage is a storage mock supporting all optional capabilities.
+type capableStorage struct {
+	*mocks.MockURLStorage
+	*mocks.MockPurger
+	compacted int
+}
+
+// Compact implements storage.Compactor.
+func (s *capableStorage) Compact(_ context.Context) error {
+	s.compacted++
+	return nil
+}
+
+// ListUserIDs implements storage.UserLister.
+func (s *capableStorage) ListUserIDs(_ context.Context) (userIDs []string, err error) {
+	return []string{"user1"}, nil
+}
+
+func TestInitStorage_Capabilities(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := &capableStorage{MockURLStorage: mocks.NewMockURLStorage(ctrl), MockPurger: mocks.NewMockPurger(ctrl)}
+	ctx := context.Background()
+	s.MockPurger.EXPECT().GetPurgeStats(ctx).Return(modelurl.PurgeStats{PurgedURLs: 1}, nil)
+	cfg := config.NewDefaultConfiguration()
+	cfg.CacheSize = 10
+	cfg.CacheTTL = time.Minute
+	cached := InitStorage(s, cfg)
+
+	// every optional capability of the wrapped storage is reachable
+	var purger storage.Purger
+	assert.True(t, storage.As(cached, &purger))
+	stats, err := purger.GetPurgeStats(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), stats.PurgedURLs)
+	var compactor storage.Compactor
+	assert.True(t, storage.As(cached, &compactor))
+	assert.Nil(t, compactor.Compact(ctx))
+	assert.Equal(t, 1, s.compacted)
+	var userLister storage.UserLister
+	assert.True(t, storage.As(cached, &userLister))
+	userIDs, err := userLister.ListUserIDs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user1"}, userIDs)
+
+	// capabilities which the wrapped storage lacks are not found
+	cached = InitStorage(mocks.NewMockURLStorage(ctrl), cfg)
+	assert.False(t, storage.As(cached, &compactor))
+}
+
+func TestStorage_Retrieve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newExpiringStorage(ctrl)
+	ctx := context.Background()
+	s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("https://www.yandex.ru", nil, nil).Times(1)
+	s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL2").Return("", nil, &storageErrors.NotFoundError{SURL: "sURL2"}).Times(1)
+	cached := newCachedStorage(s, 10, time.Minute)
+	hits := cacheHits.Value()
+	for i := 0; i < 3; i++ {
+		URL, err := cached.Retrieve(ctx, "sURL1")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://www.yandex.ru", URL)
+		_, err = cached.Retrieve(ctx, "sURL2")
+		var notFoundError *storageErrors.NotFoundError
+		assert.True(t, errors.As(err, &notFoundError))
+	}
+	assert.Equal(t, hits+4, cacheHits.Value())
+}
+
+func TestStorage_RetrieveFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	ctx := context.Background()
+	// storage failures must not be cached
+	s.EXPECT().Retrieve(ctx, "sURL1").Return("", errors.New("generic error")).Times(2)
+	cached := newCachedStorage(s, 10, time.Minute)
+	for i := 0; i < 2; i++ {
+		_, err := cached.Retrieve(ctx, "sURL1")
+		assert.Equal(t, errors.New("generic error"), err)
+	}
+}
+
+func TestStorage_Eviction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newExpiringStorage(ctrl)
+	ctx := context.Background()
+	s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("https://www.yandex.ru", nil, nil).Times(2)
+	s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL2").Return("https://www.yandex.kz", nil, nil).Times(1)
+	s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL3").Return("https://www.yandex.by", nil, nil).Times(1)
+	cached := newCachedStorage(s, 2, time.Minute)
+	_, _ = cached.Retrieve(ctx, "sURL1")
+	_, _ = cached.Retrieve(ctx, "sURL2")
+	// sURL2 becomes the most recently used one, sURL1 is evicted
+	_, _ = cached.Retrieve(ctx, "sURL2")
+	_, _ = cached.Retrieve(ctx, "sURL3")
+	_, _ = cached.Retrieve(ctx, "sURL1")
+	assert.Equal(t, 2, cached.lru.Len())
+}
+
+func TestStorage_Expiration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newExpiringStorage(ctrl)
+	ctx := context.Background()
+	s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("https://www.yandex.ru", nil, nil).Times(2)
+	cached := newCachedStorage(s, 10, time.Millisecond)
+	_, _ = cached.Retrieve(ctx, "sURL1")
+	time.Sleep(2 * time.Millisecond)
+	_, _ = cached.Retrieve(ctx, "sURL1")
+}
+
+func TestStorage_LinkExpiration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newExpiringStorage(ctrl)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	gomock.InOrder(
+		s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("https://www.yandex.ru", &expiresAt, nil),
+		s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("", &expiresAt, &storageErrors.ExpiredError{SURL: "sURL1"}),
+	)
+	cached := newCachedStorage(s, 10, time.Minute)
+	URL, err := cached.Retrieve(ctx, "sURL1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.yandex.ru", URL)
+	// the link is served from cache until it expires rather than for the whole TTL
+	URL, err = cached.Retrieve(ctx, "sURL1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.yandex.ru", URL)
+	time.Sleep(time.Until(expiresAt))
+	_, err = cached.Retrieve(ctx, "sURL1")
+	var expiredError *storageErrors.ExpiredError
+	assert.True(t, errors.As(err, &expiredError))
+	// the expired lookup is served from cache
+	_, err = cached.Retrieve(ctx, "sURL1")
+	assert.True(t, errors.As(err, &expiredError))
+}
+
+func TestStorage_UnknownExpiration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	ctx := context.Background()
+	// links of storages which do not report expiration times are not cached, negative lookups are
+	s.EXPECT().Retrieve(ctx, "sURL1").Return("https://www.yandex.ru", nil).Times(2)
+	s.EXPECT().Retrieve(ctx, "sURL2").Return("", &storageErrors.ProtectedError{SURL: "sURL2"}).Times(2)
+	s.EXPECT().Retrieve(ctx, "sURL3").Return("", &storageErrors.NotFoundError{SURL: "sURL3"}).Times(1)
+	cached := newCachedStorage(s, 10, time.Minute)
+	for i := 0; i < 2; i++ {
+		_, _ = cached.Retrieve(ctx, "sURL1")
+		_, _ = cached.Retrieve(ctx, "sURL2")
+		_, _ = cached.Retrieve(ctx, "sURL3")
+	}
+}
+
+func TestStorage_Invalidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := newExpiringStorage(ctrl)
+	ctx := context.Background()
+	gomock.InOrder(
+		s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("", nil, &storageErrors.NotFoundError{SURL: "sURL1"}),
+		s.MockURLStorage.EXPECT().Dump(ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"}).Return(nil),
+		s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("https://www.yandex.ru", nil, nil),
+		s.MockURLStorage.EXPECT().DeleteBatch(ctx, []string{"sURL1"}, "user1").Return(nil),
+		s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("", nil, &storageErrors.DeletedError{SURL: "sURL1"}),
+		s.MockURLStorage.EXPECT().RestoreBatch(ctx, []string{"sURL1"}, "user1").Return([]string{modelurl.RestoreOutcomeRestored}, nil),
+		s.MockExpiringURLGetter.EXPECT().RetrieveWithExpiry(ctx, "sURL1").Return("https://www.yandex.ru", nil, nil),
+	)
+	cached := newCachedStorage(s, 10, time.Minute)
+	_, err := cached.Retrieve(ctx, "sURL1")
+	assert.NotNil(t, err)
+	_ = cached.Dump(ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	URL, err := cached.Retrieve(ctx, "sURL1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.yandex.ru", URL)
+	_ = cached.DeleteBatch(ctx, []string{"sURL1"}, "user1")
+	_, err = cached.Retrieve(ctx, "sURL1")
+	var deletedError *storageErrors.DeletedError
+	assert.True(t, errors.As(err, &deletedError))
+	// the deleted lookup is served from cache
+	_, err = cached.Retrieve(ctx, "sURL1")
+	assert.True(t, errors.As(err, &deletedError))
+	_, _ = cached.RestoreBatch(ctx, []string{"sURL1"}, "user1")
+	URL, err = cached.Retrieve(ctx, "sURL1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.yandex.ru", URL)
+}
+
+func TestStorage_SendToQueue_Flush(t *testing.T) {
+	cfg := config.NewDefaultConfiguration()
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "url_storage.json")
+	cfg.CacheSize = 100
+	cfg.CacheTTL = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	backend, _ := infile.InitStorage(ctx, wg, cfg)
+	cached := InitStorage(backend, cfg)
+	// the file storage flushes queued deletions once ten of them are accumulated
+	const flushPartsAmount = 10
+	for i := 0; i < flushPartsAmount; i++ {
+		_ = cached.Dump(ctx, modelstorage.URLStorageEntry{SURL: fmt.Sprintf("sURL%d", i), URL: fmt.Sprintf("https://www.yandex.ru/%d", i), UserID: "user1"})
+	}
+	for i := 0; i < flushPartsAmount-1; i++ {
+		_ = cached.SendToQueue(ctx, modelstorage.URLChannelEntry{SURL: fmt.Sprintf("sURL%d", i), UserID: "user1"})
+	}
+
+	// a lookup made before the deletion is flushed caches the live link
+	URL, err := cached.Retrieve(ctx, "sURL0")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.yandex.ru/0", URL)
+
+	// the cached lookup is invalidated once the deletion is flushed
+	_ = cached.SendToQueue(ctx, modelstorage.URLChannelEntry{SURL: fmt.Sprintf("sURL%d", flushPartsAmount-1), UserID: "user1"})
+	assert.Eventually(t, func() bool {
+		_, err := cached.Retrieve(ctx, "sURL0")
+		var deletedError *storageErrors.DeletedError
+		return errors.As(err, &deletedError)
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	wg.Wait()
+}
@@ -15,10 +15,37 @@ type (
 		ValidSURL string
 		Err       error
 	}
+	SURLAlreadyExistsError struct {
+		SURL string
+		Err  error
+	}
+	URLTakenError struct {
+		URL string
+		Err error
+	}
 	DeletedError struct {
 		SURL string
 		Err  error
 	}
+	ExpiredError struct {
+		SURL string
+		Err  error
+	}
+	// BlockedError is returned for links to domains listed in the threat feed, SURL is empty for rejected writes
+	// of new entries.
+	BlockedError struct {
+		SURL string
+		Host string
+		Err  error
+	}
+	// ProtectedError is returned for password-protected entries, URL is only to be revealed once a password
+	// matching PasswordHash is given.
+	ProtectedError struct {
+		SURL         string
+		URL          string
+		PasswordHash string
+		Err          error
+	}
 	ContextTimeoutExceededError struct {
 		Err error
 	}
@@ -34,20 +61,61 @@ type (
 	FileWriteError struct {
 		Err error
 	}
+	ExecutionBoltError struct {
+		Err error
+	}
+	FileCompactionError struct {
+		Err error
+	}
+	MigrationError struct {
+		Version int64
+		Err     error
+	}
+	JobNotFoundError struct {
+		JobID string
+		Err   error
+	}
 )
 
 func (e *NotFoundError) Error() string {
 	return fmt.Sprintf("%s: not found in storage", e.SURL)
 }
 
+func (e *JobNotFoundError) Error() string {
+	return fmt.Sprintf("%s: deletion job not found", e.JobID)
+}
+
 func (e *AlreadyExistsError) Error() string {
 	return fmt.Sprintf("%s: already exists in storage", e.URL)
 }
 
+func (e *SURLAlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s: short URL is already taken", e.SURL)
+}
+
+func (e *URLTakenError) Error() string {
+	return fmt.Sprintf("%s: already shortened by another user", e.URL)
+}
+
 func (e *DeletedError) Error() string {
 	return fmt.Sprintf("%s: was deleted", e.SURL)
 }
 
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("%s: has expired", e.SURL)
+}
+
+func (e *BlockedError) Error() string {
+	if e.SURL == "" {
+		return fmt.Sprintf("%s: listed in the threat feed", e.Host)
+	}
+	return fmt.Sprintf("%s: links to %s listed in the threat feed", e.SURL, e.Host)
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("%s: is password-protected", e.SURL)
+}
+
 func (e *ContextTimeoutExceededError) Error() string {
 	return fmt.Sprintf("%s: context timeout exceeded", e.Err.Error())
 }
@@ -68,6 +136,18 @@ func (e *FileWriteError) Error() string {
 	return fmt.Sprintf("%s: could not add to file", e.Err.Error())
 }
 
+func (e *ExecutionBoltError) Error() string {
+	return fmt.Sprintf("%s: could not access bolt DB", e.Err.Error())
+}
+
+func (e *FileCompactionError) Error() string {
+	return fmt.Sprintf("%s: could not compact file", e.Err.Error())
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("%s: could not apply migration %d", e.Err.Error(), e.Version)
+}
+
 func (e *NotFoundError) Unwrap() error {
 	return e.Err
 }
@@ -76,6 +156,26 @@ func (e *AlreadyExistsError) Unwrap() error {
 	return e.Err
 }
 
+func (e *SURLAlreadyExistsError) Unwrap() error {
+	return e.Err
+}
+
+func (e *URLTakenError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExpiredError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BlockedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProtectedError) Unwrap() error {
+	return e.Err
+}
+
 func (e *ContextTimeoutExceededError) Unwrap() error {
 	return e.Err
 }
@@ -95,3 +195,19 @@ func (e *ExecutionPSQLError) Unwrap() error {
 func (e *FileWriteError) Unwrap() error {
 	return e.Err
 }
+
+func (e *ExecutionBoltError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FileCompactionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *JobNotFoundError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,122 @@
+package guarded
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hostSet is a set of domains kept as sorted hashes of their names, it takes 8 bytes per domain and is searched
+// in logarithmic time so that feeds of millions of domains fit in memory. A hash collision may produce a false
+// match with a negligible probability.
+type hostSet []uint64
+
+// matches checks whether host is one of the domains or a subdomain of one of them.
+func (h hostSet) matches(host string) bool {
+	if len(h) == 0 {
+		return false
+	}
+	for {
+		hash := hashHost(host)
+		i := sort.Search(len(h), func(i int) bool { return h[i] >= hash })
+		if i < len(h) && h[i] == hash {
+			return true
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return false
+		}
+		host = host[dot+1:]
+	}
+}
+
+// feedFile is a threat feed file which is either in hosts format, with an address followed by domains on each
+// line, or lists one domain per line. Comments starting with # are skipped as well as single-label names such
+// as localhost which hosts files map to loopback addresses.
+type feedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// load reads the feed file.
+func (f *feedFile) load() (hostSet, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := parseFeed(file)
+	if err != nil {
+		return nil, err
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return hosts, nil
+}
+
+// changed checks whether the feed file was modified since it was loaded.
+func (f *feedFile) changed() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size, nil
+}
+
+// parseFeed reads domains of a threat feed.
+func parseFeed(r io.Reader) (hostSet, error) {
+	var hosts hostSet
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		names := strings.Fields(line)
+		if len(names) > 0 && net.ParseIP(names[0]) != nil {
+			names = names[1:]
+		}
+		for _, name := range names {
+			name = strings.TrimSuffix(strings.ToLower(name), ".")
+			if !strings.Contains(name, ".") {
+				continue
+			}
+			hosts = append(hosts, hashHost(name))
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i] < hosts[j] })
+	// drop duplicates
+	unique := hosts[:0]
+	for _, hash := range hosts {
+		if len(unique) == 0 || hash != unique[len(unique)-1] {
+			unique = append(unique, hash)
+		}
+	}
+	return unique, nil
+}
+
+// hashHost returns the 64-bit FNV-1a hash of host.
+func hashHost(host string) uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+	hash := uint64(offset)
+	for i := 0; i < len(host); i++ {
+		hash ^= uint64(host[i])
+		hash *= prime
+	}
+	return hash
+}
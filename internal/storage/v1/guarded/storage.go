@@ -0,0 +1,206 @@
+// Package guarded provides a storage decorator blocking links to domains listed in a threat feed.
+package guarded
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// DefaultPeriod is a period of checking the feed file applied to a zero configuration value.
+const DefaultPeriod = time.Minute
+
+// scanBatchSize is the number of stored entries listed at once while scanning.
+const scanBatchSize = 1000
+
+// Check interface implementation explicitly
+var (
+	_ storage.URLStorage = (*Storage)(nil)
+	_ storage.Unwrapper  = (*Storage)(nil)
+)
+
+// Storage struct wraps a URL storage and blocks links to domains listed in a threat feed. New entries are checked
+// against the feed before being stored and redirects are checked against the feed once URLs are retrieved, hence
+// links stored before a domain was listed, restored links and links stored by other instances sharing the same
+// backend are blocked as soon as the feed lists their domains. A background scan run at startup and each time the
+// feed file changes keeps blocked sURLs in memory so that redirects of known blocked links skip the backend.
+type Storage struct {
+	storage.URLStorage
+	feed   *feedFile
+	period time.Duration
+	// hosts holds the hostSet of the feed
+	hosts atomic.Value
+	// blocked holds a map[string]string of blocked sURLs to hosts of their URLs
+	blocked atomic.Value
+}
+
+// InitStorage wraps s with a threat feed guard and starts watching the feed file until ctx is done, s is returned
+// as is if no feed is configured by cfg. The feed is read at once, stored entries are scanned in background.
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, s storage.URLStorage, cfg *config.Config) (storage.URLStorage, error) {
+	if cfg.ThreatFeedPath == "" {
+		return s, nil
+	}
+	st := &Storage{
+		URLStorage: s,
+		feed:       &feedFile{path: cfg.ThreatFeedPath},
+		period:     cfg.ThreatFeedPeriod,
+	}
+	if st.period <= 0 {
+		st.period = DefaultPeriod
+	}
+	hosts, err := st.feed.load()
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Loading threat feed:", cfg.ThreatFeedPath, len(hosts), "domains")
+	st.hosts.Store(hosts)
+	st.blocked.Store(map[string]string{})
+	wg.Add(1)
+	go st.watch(ctx, wg)
+	return st, nil
+}
+
+// Unwrap returns the underlying storage so that its optional capabilities are found by storage.As.
+func (s *Storage) Unwrap() storage.URLStorage {
+	return s.URLStorage
+}
+
+// Retrieve returns storageErrors.BlockedError for blocked sURLs or for URLs listed in the threat feed, otherwise it
+// retrieves URL from the underlying storage.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+	if host, ok := s.blocked.Load().(map[string]string)[sURL]; ok {
+		return "", &storageErrors.BlockedError{SURL: sURL, Host: host}
+	}
+	URL, err = s.URLStorage.Retrieve(ctx, sURL)
+	if err != nil {
+		return "", err
+	}
+	if host, ok := s.match(URL); ok {
+		return "", &storageErrors.BlockedError{SURL: sURL, Host: host}
+	}
+	return URL, nil
+}
+
+// Dump stores entry in the underlying storage unless its URL is listed in the threat feed.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	if host, ok := s.match(entry.URL); ok {
+		return &storageErrors.BlockedError{Host: host}
+	}
+	return s.URLStorage.Dump(ctx, entry)
+}
+
+// DumpBatch stores entries in the underlying storage, entries with URLs listed in the threat feed are reported
+// with storageErrors.BlockedError and are not stored. Deleted entries are stored as is.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	results = make([]error, len(entries))
+	allowed := make([]modelstorage.URLStorageEntry, 0, len(entries))
+	positions := make([]int, 0, len(entries))
+	for i, entry := range entries {
+		if host, ok := s.match(entry.URL); ok && !entry.IsDeleted {
+			results[i] = &storageErrors.BlockedError{Host: host}
+			continue
+		}
+		allowed = append(allowed, entry)
+		positions = append(positions, i)
+	}
+	if len(allowed) == 0 {
+		return results, nil
+	}
+	dumpResults, err := s.URLStorage.DumpBatch(ctx, allowed)
+	if err != nil {
+		return nil, err
+	}
+	for j, dumpErr := range dumpResults {
+		results[positions[j]] = dumpErr
+	}
+	return results, nil
+}
+
+// match checks whether the host of URL is listed in the threat feed and returns the host.
+func (s *Storage) match(URL string) (string, bool) {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "", false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", false
+	}
+	return host, s.hosts.Load().(hostSet).matches(host)
+}
+
+// watch scans stored entries and then rescans them each time the feed file changes, it is checked once per
+// period until ctx is done.
+func (s *Storage) watch(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	s.scan(ctx)
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.reload() {
+				s.scan(ctx)
+			}
+		}
+	}
+}
+
+// reload reads the feed file again if it has changed and reports whether it was replaced, the previous feed is
+// kept if the file cannot be read.
+func (s *Storage) reload() bool {
+	changed, err := s.feed.changed()
+	if err == nil && !changed {
+		return false
+	}
+	var hosts hostSet
+	if err == nil {
+		hosts, err = s.feed.load()
+	}
+	if err != nil {
+		log.Println("Reloading threat feed:", s.feed.path, err)
+		return false
+	}
+	log.Println("Reloading threat feed:", s.feed.path, len(hosts), "domains")
+	s.hosts.Store(hosts)
+	return true
+}
+
+// scan lists stored entries in batches and replaces blocked sURLs with those of entries listed in the threat
+// feed, deleted entries are skipped. Blocked sURLs are kept if the scan fails.
+func (s *Storage) scan(ctx context.Context) {
+	blocked := make(map[string]string)
+	after := ""
+	for {
+		entries, err := s.URLStorage.List(ctx, after, scanBatchSize)
+		if err != nil {
+			log.Println("Scanning stored URLs against threat feed:", err)
+			return
+		}
+		for _, entry := range entries {
+			if entry.IsDeleted {
+				continue
+			}
+			if host, ok := s.match(entry.URL); ok {
+				blocked[entry.SURL] = host
+			}
+		}
+		if len(entries) < scanBatchSize {
+			break
+		}
+		after = entries[len(entries)-1].SURL
+	}
+	s.blocked.Store(blocked)
+	log.Println("Scanning stored URLs against threat feed:", len(blocked), "links blocked")
+}
@@ -0,0 +1,138 @@
+package guarded
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/mocks"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// isBlocked checks whether err is storageErrors.BlockedError.
+func isBlocked(err error) bool {
+	var blockedError *storageErrors.BlockedError
+	return errors.As(err, &blockedError)
+}
+
+// Tests
+
+func TestParseFeed(t *testing.T) {
+	feed := `# hosts format
+127.0.0.1 localhost
+::1 ip6-localhost ip6-loopback
+0.0.0.0 Evil.com www.malware.net. # trailing comment
+0.0.0.0 evil.com
+
+phishing.org
+`
+	hosts, err := parseFeed(strings.NewReader(feed))
+	assert.Nil(t, err)
+	assert.Len(t, hosts, 3)
+	assert.True(t, hosts.matches("evil.com"))
+	assert.True(t, hosts.matches("login.evil.com"))
+	assert.True(t, hosts.matches("www.malware.net"))
+	assert.True(t, hosts.matches("a.b.phishing.org"))
+	assert.False(t, hosts.matches("malware.net"))
+	assert.False(t, hosts.matches("notevil.com"))
+	assert.False(t, hosts.matches("localhost"))
+	assert.False(t, hostSet(nil).matches("evil.com"))
+}
+
+func TestInitStorage_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	cfg := config.NewDefaultConfiguration()
+	guarded, err := InitStorage(context.Background(), &sync.WaitGroup{}, s, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, storage.URLStorage(s), guarded)
+}
+
+func TestInitStorage_Fail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockURLStorage(ctrl)
+	cfg := config.NewDefaultConfiguration()
+	cfg.ThreatFeedPath = filepath.Join(t.TempDir(), "absent.txt")
+	_, err := InitStorage(context.Background(), &sync.WaitGroup{}, s, cfg)
+	assert.NotNil(t, err)
+}
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.NewDefaultConfiguration()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.ThreatFeedPath = filepath.Join(dir, "feed.txt")
+	cfg.ThreatFeedPeriod = 10 * time.Millisecond
+	cfg.RestoreGraceWindow = time.Hour
+	_ = os.WriteFile(cfg.ThreatFeedPath, []byte("0.0.0.0 evil.com\n"), 0644)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	backend, _ := infile.InitStorage(ctx, wg, cfg)
+	_ = backend.Dump(ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.evil.com/a", UserID: "user1"})
+	_ = backend.Dump(ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	s, err := InitStorage(ctx, wg, backend, cfg)
+	assert.Nil(t, err)
+	var compactor storage.Compactor
+	assert.True(t, storage.As(s, &compactor))
+	var userLister storage.UserLister
+	assert.True(t, storage.As(s, &userLister))
+
+	// stored links to listed domains are blocked before being scanned
+	_, err = s.Retrieve(ctx, "sURL1")
+	assert.True(t, isBlocked(err))
+	URL, err := s.Retrieve(ctx, "sURL2")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.yandex.ru", URL)
+
+	// new links to listed domains are rejected
+	assert.True(t, isBlocked(s.Dump(ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "http://EVIL.com", UserID: "user1"})))
+	results, err := s.DumpBatch(ctx, []modelstorage.URLStorageEntry{
+		{SURL: "sURL4", URL: "https://evil.com/b", UserID: "user1"},
+		{SURL: "sURL5", URL: "https://www.yandex.kz", UserID: "user1"},
+	})
+	assert.Nil(t, err)
+	assert.True(t, isBlocked(results[0]))
+	assert.Nil(t, results[1])
+	_, err = backend.Retrieve(ctx, "sURL4")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(t, errors.As(err, &notFoundError))
+
+	// stored links newly listed in the feed are blocked retroactively, delisted ones are unblocked
+	_ = os.WriteFile(cfg.ThreatFeedPath, []byte("yandex.ru\nyandex.kz\n"), 0644)
+	assert.Eventually(t, func() bool {
+		_, err := s.Retrieve(ctx, "sURL5")
+		return isBlocked(err)
+	}, time.Second, 10*time.Millisecond)
+	_, err = s.Retrieve(ctx, "sURL2")
+	assert.True(t, isBlocked(err))
+	URL, err = s.Retrieve(ctx, "sURL1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.evil.com/a", URL)
+
+	// restored links to listed domains are blocked at once
+	_ = backend.Dump(ctx, modelstorage.URLStorageEntry{SURL: "sURL6", URL: "https://mail.yandex.ru", UserID: "user1"})
+	_ = backend.DeleteBatch(ctx, []string{"sURL6"}, "user1")
+	restored, err := s.RestoreBatch(ctx, []string{"sURL6"}, "user1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{modelurl.RestoreOutcomeRestored}, restored)
+	_, err = s.Retrieve(ctx, "sURL6")
+	assert.True(t, isBlocked(err))
+
+	cancel()
+	wg.Wait()
+}
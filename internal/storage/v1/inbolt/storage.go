@@ -0,0 +1,1021 @@
+// Package inbolt provides data types and methods for embedded key-value storage operations.
+package inbolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/jobs"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Check interface implementation explicitly
+var (
+	_ storage.URLStorage        = (*Storage)(nil)
+	_ storage.UserLister        = (*Storage)(nil)
+	_ storage.DeleteObserver    = (*Storage)(nil)
+	_ storage.Remover           = (*Storage)(nil)
+	_ storage.DuplicateChecker  = (*Storage)(nil)
+	_ storage.ExpiringURLGetter = (*Storage)(nil)
+	_ storage.OwnerChecker      = (*Storage)(nil)
+)
+
+// bucket names, idx_user keys are userID and sURL joined by indexSeparator and hold no values,
+// idx_url keys are original URLs and hold sURLs, idx_user_url keys are userID and original URL joined
+// by indexSeparator and hold sURLs, URL indexes only point to entries which were not deleted
+var (
+	urlsBucket     = []byte("urls")
+	userIndex      = []byte("idx_user")
+	urlIndex       = []byte("idx_url")
+	userURLIndex   = []byte("idx_user_url")
+	indexSeparator = []byte{0}
+)
+
+// Storage struct defines data structure handling and provides support for adding new implementations.
+type Storage struct {
+	Cfg *config.Config
+	DB  *bolt.DB
+	ch  chan modelstorage.URLChannelEntry
+	// jobs tracks outcomes of queued deletions, deletes are notified of flushed ones
+	jobs    *jobs.Registry
+	deletes storage.DeleteObservers
+}
+
+// InitStorage initializes a Storage object and sets its attributes.
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*Storage, error) {
+	// bolt holds an exclusive file lock, do not wait forever if another process has opened the same file
+	db, err := bolt.Open(cfg.BoltStoragePath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		// DB files created prior to per-user deduplication lack the per-user URL index
+		backfill := tx.Bucket(urlsBucket) != nil && tx.Bucket(userURLIndex) == nil
+		for _, name := range [][]byte{urlsBucket, userIndex, urlIndex, userURLIndex} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		if backfill {
+			return backfillUserURLIndex(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// make a channel for tunneling batches for deletion from processor to DB
+	recordCh := make(chan modelstorage.URLChannelEntry)
+	// initialize a Storage
+	st := Storage{
+		Cfg:  cfg,
+		DB:   db,
+		ch:   recordCh,
+		jobs: jobs.NewRegistry(),
+	}
+	const flushPartsAmount = 10
+	const flushPartsInterval = time.Second * 10
+
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(flushPartsInterval)
+		defer t.Stop()
+		parts := make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
+		for {
+			select {
+			case <-ctx.Done():
+				if len(parts) > 0 {
+					log.Println("Deleting URLs due to context cancellation", parts)
+					// ctx is already cancelled, use a detached one for the last flush
+					err := st.Flush(context.Background(), parts)
+					if err != nil {
+						log.Println("Deleting URLs:", err)
+					}
+				}
+				err := st.DB.Close()
+				if err != nil {
+					log.Println("Bolt DB closure:", err)
+					return
+				}
+				log.Println("Bolt DB closed successfully")
+				return
+			case <-t.C:
+				if len(parts) > 0 {
+					log.Println("Deleting URLs due to timeout", parts)
+					err := st.Flush(ctx, parts)
+					if err != nil {
+						log.Println("Deleting URLs:", err)
+					}
+					parts = make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
+				}
+			case part := <-st.ch:
+				parts = append(parts, part)
+				if len(parts) >= flushPartsAmount {
+					log.Println("Deleting URLs due to exceeding capacity", parts)
+					err := st.Flush(ctx, parts)
+					if err != nil {
+						log.Println("Deleting URLs:", err)
+					}
+					parts = make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
+				}
+			}
+		}
+	}()
+	return &st, nil
+}
+
+// Flush flushes URL entries from buffer and sends them for deletion, outcomes of items are recorded to their jobs.
+func (s *Storage) Flush(ctx context.Context, batch []modelstorage.URLChannelEntry) error {
+	outcomes, err := s.classify(batch)
+	if err != nil {
+		s.jobs.Fail(batch, err)
+		return err
+	}
+	uniqueMap := make(map[string][]string)
+	for _, b := range batch {
+		uniqueMap[b.UserID] = append(uniqueMap[b.UserID], b.SURL)
+	}
+	for userID, sURLs := range uniqueMap {
+		err := s.DeleteBatch(ctx, sURLs, userID)
+		// a failed batch may be deleted in part, hence observers are notified regardless
+		s.deletes.Notify(sURLs)
+		if err != nil {
+			s.jobs.Fail(batch, err)
+			return err
+		}
+	}
+	s.jobs.Done(batch, outcomes)
+	return nil
+}
+
+// ObserveDeletes registers fn to be called with sURLs once their queued deletion is flushed.
+func (s *Storage) ObserveDeletes(fn func(sURLs []string)) {
+	s.deletes.Add(fn)
+}
+
+// classify returns outcomes of deleting batch items, outcomes[i] corresponds to batch[i].
+func (s *Storage) classify(batch []modelstorage.URLChannelEntry) ([]string, error) {
+	outcomes := make([]string, len(batch))
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(urlsBucket)
+		for i, item := range batch {
+			var entry modelstorage.URLBoltEntry
+			value := urls.Get([]byte(item.SURL))
+			if value != nil {
+				err := json.Unmarshal(value, &entry)
+				if err != nil {
+					return err
+				}
+			}
+			outcomes[i] = jobs.Outcome(value != nil, entry.UserID, item.UserID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &storageErrors.ExecutionBoltError{Err: err}
+	}
+	return outcomes, nil
+}
+
+// SendToQueue sends a modelstorage.URLChannelEntry batch of sURLs from one userID to the deletion task queue,
+// the queue is kept in memory only.
+func (s *Storage) SendToQueue(ctx context.Context, item modelstorage.URLChannelEntry) error {
+	// register item prior to sending so that its outcome is not flushed before the job is known
+	s.jobs.Add(item)
+	select {
+	case s.ch <- item:
+		return nil
+	case <-ctx.Done():
+		err := &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		s.jobs.Fail([]modelstorage.URLChannelEntry{item}, err)
+		return err
+	}
+}
+
+// RetrieveDeleteJob reports outcomes of a deletion job, jobs are kept in memory for jobs.Retention.
+func (s *Storage) RetrieveDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error) {
+	job, ok := s.jobs.Get(jobID, userID)
+	if !ok {
+		log.Println("Retrieving deletion job:", jobID, "not found")
+		return modelurl.DeleteJob{}, &storageErrors.JobNotFoundError{Err: nil, JobID: jobID}
+	}
+	log.Println("Retrieving deletion job:", jobID, "is", job.Status)
+	return job, nil
+}
+
+// GetStats returns the number of stored sURLs and the number of unique users.
+func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []int64, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var countURLs, countUsers int64
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			countURLs = int64(tx.Bucket(urlsBucket).Stats().KeyN)
+			// user index keys are sorted, hence keys of one user are adjacent
+			var lastUserID []byte
+			return tx.Bucket(userIndex).ForEach(func(k, _ []byte) error {
+				userID := k[:bytes.Index(k, indexSeparator)]
+				if countUsers == 0 || !bytes.Equal(userID, lastUserID) {
+					countUsers++
+					lastUserID = append(lastUserID[:0], userID...)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		retrieveDone <- []int64{countURLs, countUsers}
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving stats:", ctx.Err())
+		return 0, 0, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving stats:", rtrvError.Error())
+		return 0, 0, rtrvError
+	case stats := <-retrieveDone:
+		log.Println("Retrieving stats: done")
+		return stats[0], stats[1], nil
+	}
+}
+
+// ListUserIDs returns distinct IDs of users who own entries.
+func (s *Storage) ListUserIDs(ctx context.Context) (userIDs []string, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []string, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var IDs []string
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			// user index keys are sorted, hence keys of one user are adjacent
+			var lastUserID []byte
+			return tx.Bucket(userIndex).ForEach(func(k, _ []byte) error {
+				userID := k[:bytes.Index(k, indexSeparator)]
+				if len(IDs) == 0 || !bytes.Equal(userID, lastUserID) {
+					IDs = append(IDs, string(userID))
+					lastUserID = append(lastUserID[:0], userID...)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		retrieveDone <- IDs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing users:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Listing users:", rtrvError.Error())
+		return nil, rtrvError
+	case IDs := <-retrieveDone:
+		log.Println("Listing users: done")
+		return IDs, nil
+	}
+}
+
+// Retrieve returns a URL corresponding to sURL.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+	URL, _, err = s.RetrieveWithExpiry(ctx, sURL)
+	return URL, err
+}
+
+// RetrieveWithExpiry returns a URL corresponding to sURL along with its expiration time.
+func (s *Storage) RetrieveWithExpiry(ctx context.Context, sURL string) (URL string, expiresAt *time.Time, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan string, 1)
+	retrieveError := make(chan error, 1)
+	// entryExpiresAt is set before a result is sent
+	var entryExpiresAt *time.Time
+	go func() {
+		var entry modelstorage.URLBoltEntry
+		found := false
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			value := tx.Bucket(urlsBucket).Get([]byte(sURL))
+			if value == nil {
+				return nil
+			}
+			found = true
+			return json.Unmarshal(value, &entry)
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		if !found {
+			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
+			return
+		}
+		entryExpiresAt = entry.ExpiresAt
+		if entry.IsExpired() {
+			retrieveError <- &storageErrors.ExpiredError{Err: nil, SURL: sURL}
+			return
+		}
+		if entry.IsDeleted {
+			retrieveError <- &storageErrors.DeletedError{Err: nil, SURL: sURL}
+			return
+		}
+		if entry.PasswordHash != "" {
+			retrieveError <- &storageErrors.ProtectedError{Err: nil, SURL: sURL, URL: entry.URL, PasswordHash: entry.PasswordHash}
+			return
+		}
+		retrieveDone <- entry.URL
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving URL:", ctx.Err())
+		return "", nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving URL:", rtrvError.Error())
+		return "", entryExpiresAt, rtrvError
+	case URL := <-retrieveDone:
+		log.Println("Retrieving URL:", sURL, "as", URL)
+		return URL, entryExpiresAt, nil
+	}
+}
+
+// RetrieveByUserID returns a slice of URL:sURL pairs defined as modelurl.FullURL for one particular user ID.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var URLs []modelurl.FullURL
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			urls := tx.Bucket(urlsBucket)
+			prefix := userIndexPrefix(userID)
+			c := tx.Bucket(userIndex).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				sURL := k[len(prefix):]
+				var entry modelstorage.URLBoltEntry
+				err := json.Unmarshal(urls.Get(sURL), &entry)
+				if err != nil {
+					return err
+				}
+				if entry.IsDeleted {
+					continue
+				}
+				URLs = append(URLs, modelurl.FullURL{URL: entry.URL, OriginalURL: entry.OriginalURL, SURL: string(sURL), ExpiresAt: entry.ExpiresAt})
+			}
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		retrieveDone <- URLs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving URLs by user ID:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving URLs by user ID:", rtrvError.Error())
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		log.Println("Retrieving URLs by user ID:", URLs)
+		return URLs, nil
+	}
+}
+
+// IsOwner reports whether userID owns a non-deleted entry with sURL.
+func (s *Storage) IsOwner(ctx context.Context, userID, sURL string) (owned bool, err error) {
+	// create channels for listening to the go routine result
+	checkDone := make(chan bool, 1)
+	checkError := make(chan error, 1)
+	go func() {
+		var owned bool
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			value := tx.Bucket(urlsBucket).Get([]byte(sURL))
+			if value == nil {
+				return nil
+			}
+			var entry modelstorage.URLBoltEntry
+			err := json.Unmarshal(value, &entry)
+			if err != nil {
+				return err
+			}
+			owned = entry.UserID == userID && !entry.IsDeleted
+			return nil
+		})
+		if err != nil {
+			checkError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		checkDone <- owned
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Checking URL owner:", ctx.Err())
+		return false, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case chkError := <-checkError:
+		log.Println("Checking URL owner:", chkError.Error())
+		return false, chkError
+	case owned := <-checkDone:
+		log.Println("Checking URL owner:", sURL, "owned by", userID, owned)
+		return owned, nil
+	}
+}
+
+// ListByUserID returns up to limit URLs of userID with sURLs greater than afterSURL in ascending order of sURLs,
+// the user index keeps sURLs of a user in this order.
+func (s *Storage) ListByUserID(ctx context.Context, userID, afterSURL string, limit int) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var URLs []modelurl.FullURL
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			urls := tx.Bucket(urlsBucket)
+			prefix := userIndexPrefix(userID)
+			c := tx.Bucket(userIndex).Cursor()
+			k, _ := c.Seek(userIndexKey(userID, afterSURL))
+			if k != nil && string(k[len(prefix):]) == afterSURL {
+				k, _ = c.Next()
+			}
+			for ; k != nil && bytes.HasPrefix(k, prefix) && len(URLs) < limit; k, _ = c.Next() {
+				sURL := k[len(prefix):]
+				var entry modelstorage.URLBoltEntry
+				err := json.Unmarshal(urls.Get(sURL), &entry)
+				if err != nil {
+					return err
+				}
+				if entry.IsDeleted {
+					continue
+				}
+				URLs = append(URLs, modelurl.FullURL{URL: entry.URL, OriginalURL: entry.OriginalURL, SURL: string(sURL), ExpiresAt: entry.ExpiresAt})
+			}
+			return nil
+		})
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		retrieveDone <- URLs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing URLs by user ID:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Listing URLs by user ID:", rtrvError.Error())
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		log.Println("Listing URLs by user ID:", len(URLs), "URLs after", afterSURL)
+		return URLs, nil
+	}
+}
+
+// Dump stores a pair of sURL and URL along with index entries within one transaction.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		value, err := json.Marshal(modelstorage.URLBoltEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: entry.UserID, ExpiresAt: entry.ExpiresAt})
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		err = s.DB.Update(func(tx *bolt.Tx) error {
+			return s.put(tx, entry, value)
+		})
+		if err != nil {
+			if isConflict(err) {
+				dumpError <- err
+			} else {
+				dumpError <- &storageErrors.ExecutionBoltError{Err: err}
+			}
+			return
+		}
+		dumpDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Dumping URL:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		log.Println("Dumping URL:", dmpError.Error())
+		return dmpError
+	case <-dumpDone:
+		log.Println("Dumping URL:", entry.SURL, "as", entry.URL)
+		return nil
+	}
+}
+
+// DumpBatch stores a batch of sURL and URL pairs within one transaction, conflicting entries are skipped and
+// reported in results.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan []error, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		var results []error
+		err := s.DB.Update(func(tx *bolt.Tx) error {
+			// the transaction function may be retried, hence results are collected from scratch
+			results = make([]error, len(entries))
+			for i, entry := range entries {
+				value, err := json.Marshal(modelstorage.URLBoltEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: entry.UserID, IsDeleted: entry.IsDeleted, ExpiresAt: entry.ExpiresAt, DeletedAt: entry.DeletedAt})
+				if err != nil {
+					return err
+				}
+				err = s.put(tx, entry, value)
+				if isConflict(err) {
+					results[i] = err
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			dumpError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		dumpDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Dumping URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		log.Println("Dumping URLs:", dmpError.Error())
+		return nil, dmpError
+	case results := <-dumpDone:
+		log.Println("Dumping URLs:", len(entries), "entries processed")
+		return results, nil
+	}
+}
+
+// List retrieves a page of entries ordered by sURL.
+func (s *Storage) List(ctx context.Context, afterSURL string, limit int) (entries []modelstorage.URLStorageEntry, err error) {
+	// create channels for listening to the go routine result
+	listDone := make(chan []modelstorage.URLStorageEntry, 1)
+	listError := make(chan error, 1)
+	go func() {
+		entries := make([]modelstorage.URLStorageEntry, 0, limit)
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(urlsBucket).Cursor()
+			k, v := c.Seek([]byte(afterSURL))
+			if k != nil && string(k) == afterSURL {
+				k, v = c.Next()
+			}
+			for ; k != nil && len(entries) < limit; k, v = c.Next() {
+				var entry modelstorage.URLBoltEntry
+				err := json.Unmarshal(v, &entry)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, modelstorage.URLStorageEntry{
+					SURL:         string(k),
+					URL:          entry.URL,
+					OriginalURL:  entry.OriginalURL,
+					PasswordHash: entry.PasswordHash,
+					UserID:       entry.UserID,
+					ExpiresAt:    entry.ExpiresAt,
+					IsDeleted:    entry.IsDeleted,
+					DeletedAt:    entry.DeletedAt,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			listError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		listDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case lstError := <-listError:
+		log.Println("Listing URLs:", lstError.Error())
+		return nil, lstError
+	case entries := <-listDone:
+		log.Println("Listing URLs:", len(entries), "entries retrieved")
+		return entries, nil
+	}
+}
+
+// DeleteBatch assigns a deletion flag for entries owned by userID, does not use task management.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	// create channels for listening to the go routine result
+	deleteDone := make(chan bool, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		deletedAt := time.Now()
+		err := s.DB.Update(func(tx *bolt.Tx) error {
+			urls := tx.Bucket(urlsBucket)
+			for _, sURL := range sURLs {
+				value := urls.Get([]byte(sURL))
+				if value == nil {
+					continue
+				}
+				var entry modelstorage.URLBoltEntry
+				err := json.Unmarshal(value, &entry)
+				if err != nil {
+					return err
+				}
+				if entry.UserID != userID || entry.IsDeleted {
+					continue
+				}
+				entry.IsDeleted = true
+				entry.DeletedAt = &deletedAt
+				value, err = json.Marshal(entry)
+				if err != nil {
+					return err
+				}
+				err = urls.Put([]byte(sURL), value)
+				if err != nil {
+					return err
+				}
+				// deleted entries do not block shortening the same URL again
+				err = deleteIndexEntry(tx.Bucket(urlIndex), []byte(entry.URL), sURL)
+				if err != nil {
+					return err
+				}
+				err = deleteIndexEntry(tx.Bucket(userURLIndex), userIndexKey(userID, entry.URL), sURL)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			deleteError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		deleteDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Deleting URL:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		log.Println("Deleting URL:", dltError.Error())
+		return dltError
+	case <-deleteDone:
+		log.Println("Deleting URL:", sURLs)
+		return nil
+	}
+}
+
+// RemoveBatch hard-deletes entries with sURLs along with their index entries within one transaction.
+func (s *Storage) RemoveBatch(ctx context.Context, sURLs []string) (removed int64, err error) {
+	// create channels for listening to the go routine result
+	removeDone := make(chan int64, 1)
+	removeError := make(chan error, 1)
+	go func() {
+		var n int64
+		err := s.DB.Update(func(tx *bolt.Tx) error {
+			urls := tx.Bucket(urlsBucket)
+			for _, sURL := range sURLs {
+				value := urls.Get([]byte(sURL))
+				if value == nil {
+					continue
+				}
+				var entry modelstorage.URLBoltEntry
+				err := json.Unmarshal(value, &entry)
+				if err != nil {
+					return err
+				}
+				err = urls.Delete([]byte(sURL))
+				if err != nil {
+					return err
+				}
+				err = tx.Bucket(userIndex).Delete(userIndexKey(entry.UserID, sURL))
+				if err != nil {
+					return err
+				}
+				err = deleteIndexEntry(tx.Bucket(urlIndex), []byte(entry.URL), sURL)
+				if err != nil {
+					return err
+				}
+				err = deleteIndexEntry(tx.Bucket(userURLIndex), userIndexKey(entry.UserID, entry.URL), sURL)
+				if err != nil {
+					return err
+				}
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			removeError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		removeDone <- n
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Removing URLs:", ctx.Err())
+		return 0, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rmvError := <-removeError:
+		log.Println("Removing URLs:", rmvError.Error())
+		return 0, rmvError
+	case n := <-removeDone:
+		log.Println("Removing URLs:", n, "entries removed")
+		return n, nil
+	}
+}
+
+// RestoreBatch clears the deletion flag of entries owned by userID which were deleted within
+// Cfg.RestoreGraceWindow and puts them back to URL indexes within one transaction, entries whose URL was
+// shortened again meanwhile are not restored.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (results []string, err error) {
+	// create channels for listening to the go routine result
+	restoreDone := make(chan []string, 1)
+	restoreError := make(chan error, 1)
+	go func() {
+		deletedAfter := time.Now().Add(-s.Cfg.RestoreGraceWindow)
+		var results []string
+		err := s.DB.Update(func(tx *bolt.Tx) error {
+			// the transaction function may be retried, hence results are collected from scratch
+			results = make([]string, len(sURLs))
+			urls := tx.Bucket(urlsBucket)
+			for i, sURL := range sURLs {
+				value := urls.Get([]byte(sURL))
+				if value == nil {
+					results[i] = modelurl.RestoreOutcomeNotFound
+					continue
+				}
+				var entry modelstorage.URLBoltEntry
+				err := json.Unmarshal(value, &entry)
+				if err != nil {
+					return err
+				}
+				mapEntry := modelstorage.URLMapEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: entry.UserID, ExpiresAt: entry.ExpiresAt, IsDeleted: entry.IsDeleted, DeletedAt: entry.DeletedAt}
+				results[i] = mapEntry.RestoreOutcome(userID, deletedAfter)
+				if results[i] != modelurl.RestoreOutcomeRestored {
+					continue
+				}
+				storageEntry := modelstorage.URLStorageEntry{SURL: sURL, URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: userID, ExpiresAt: entry.ExpiresAt}
+				err = s.checkDuplicate(tx, storageEntry)
+				if isConflict(err) {
+					results[i] = modelurl.RestoreOutcomeConflict
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				value, err = json.Marshal(modelstorage.URLBoltEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: userID, ExpiresAt: entry.ExpiresAt})
+				if err != nil {
+					return err
+				}
+				// put the entry back along with its index entries
+				err = urls.Delete([]byte(sURL))
+				if err != nil {
+					return err
+				}
+				err = s.put(tx, storageEntry, value)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			restoreError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		restoreDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Restoring URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rstrError := <-restoreError:
+		log.Println("Restoring URLs:", rstrError.Error())
+		return nil, rstrError
+	case results := <-restoreDone:
+		log.Println("Restoring URLs:", sURLs, results)
+		return results, nil
+	}
+}
+
+// PingDB checks that the DB file is open.
+func (s *Storage) PingDB() error {
+	return s.DB.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// CloseDB performs DB closure.
+func (s *Storage) CloseDB() error {
+	return s.DB.Close()
+}
+
+// userIndexPrefix returns a key prefix of all user index entries of userID.
+func userIndexPrefix(userID string) []byte {
+	return append([]byte(userID), indexSeparator...)
+}
+
+// userIndexKey returns a user index key for a sURL owned by userID.
+func userIndexKey(userID, sURL string) []byte {
+	return append(userIndexPrefix(userID), sURL...)
+}
+
+// put stores an entry along with index entries within tx unless its sURL or URL conflicts with existing ones.
+func (s *Storage) put(tx *bolt.Tx, entry modelstorage.URLStorageEntry, value []byte) error {
+	urls := tx.Bucket(urlsBucket)
+	if urls.Get([]byte(entry.SURL)) != nil {
+		return &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
+	}
+	// deleted and password-protected entries are never referenced by URL indexes
+	if entry.IsDeleted || entry.PasswordHash != "" {
+		err := urls.Put([]byte(entry.SURL), value)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(userIndex).Put(userIndexKey(entry.UserID, entry.SURL), nil)
+	}
+	err := s.checkDuplicate(tx, entry)
+	if err != nil {
+		return err
+	}
+	err = urls.Put([]byte(entry.SURL), value)
+	if err != nil {
+		return err
+	}
+	// under per-user scope the global index keeps the first live entry of a URL
+	urlIdx := tx.Bucket(urlIndex)
+	indexed, err := liveEntry(tx, urlIdx.Get([]byte(entry.URL)))
+	if err != nil {
+		return err
+	}
+	if indexed == nil || s.Cfg.DedupScope == config.DedupScopeGlobal {
+		err = urlIdx.Put([]byte(entry.URL), []byte(entry.SURL))
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Bucket(userURLIndex).Put(userIndexKey(entry.UserID, entry.URL), []byte(entry.SURL))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(userIndex).Put(userIndexKey(entry.UserID, entry.SURL), nil)
+}
+
+// liveEntry returns an entry an index points to at sURL within tx or nil if sURL is nil or the entry is not live.
+// Indexes of DB files created prior to per-user deduplication may point to deleted entries and indexes point to
+// expired entries until they are replaced by new entries with the same URLs.
+func liveEntry(tx *bolt.Tx, sURL []byte) (*modelstorage.URLBoltEntry, error) {
+	if sURL == nil {
+		return nil, nil
+	}
+	value := tx.Bucket(urlsBucket).Get(sURL)
+	if value == nil {
+		return nil, nil
+	}
+	var entry modelstorage.URLBoltEntry
+	err := json.Unmarshal(value, &entry)
+	if err != nil {
+		return nil, err
+	}
+	if entry.IsDeleted || entry.IsExpired() {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// isConflict checks whether err reports a conflict with an existing entry rather than a DB failure.
+func isConflict(err error) bool {
+	switch err.(type) {
+	case *storageErrors.SURLAlreadyExistsError, *storageErrors.AlreadyExistsError, *storageErrors.URLTakenError:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckDuplicate looks up a live entry with the same original URL as entry without storing it.
+func (s *Storage) CheckDuplicate(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	// create channels for listening to the go routine result
+	checkDone := make(chan error, 1)
+	checkError := make(chan error, 1)
+	go func() {
+		var conflict error
+		err := s.DB.View(func(tx *bolt.Tx) error {
+			// deleted entries are never referenced by URL indexes
+			if entry.IsDeleted {
+				return nil
+			}
+			err := s.checkDuplicate(tx, entry)
+			if isConflict(err) {
+				conflict = err
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			checkError <- &storageErrors.ExecutionBoltError{Err: err}
+			return
+		}
+		checkDone <- conflict
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Checking URL:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case chckError := <-checkError:
+		log.Println("Checking URL:", chckError.Error())
+		return chckError
+	case conflict := <-checkDone:
+		return conflict
+	}
+}
+
+// checkDuplicate looks up a live entry with the same original URL within config.DedupScope, sURLs of other
+// users are never returned. Password-protected entries are never deduplicated.
+func (s *Storage) checkDuplicate(tx *bolt.Tx, entry modelstorage.URLStorageEntry) error {
+	if entry.PasswordHash != "" {
+		return nil
+	}
+	validSURL := tx.Bucket(userURLIndex).Get(userIndexKey(entry.UserID, entry.URL))
+	existing, err := liveEntry(tx, validSURL)
+	if err != nil {
+		return err
+	}
+	if existing == nil && s.Cfg.DedupScope == config.DedupScopeGlobal {
+		validSURL = tx.Bucket(urlIndex).Get([]byte(entry.URL))
+		existing, err = liveEntry(tx, validSURL)
+		if err != nil {
+			return err
+		}
+	}
+	if existing == nil {
+		return nil
+	}
+	if existing.UserID != entry.UserID {
+		return &storageErrors.URLTakenError{Err: nil, URL: entry.URL}
+	}
+	return &storageErrors.AlreadyExistsError{Err: nil, URL: entry.URL, ValidSURL: string(validSURL)}
+}
+
+// deleteIndexEntry removes an index entry if it still points to sURL.
+func deleteIndexEntry(bucket *bolt.Bucket, key []byte, sURL string) error {
+	if !bytes.Equal(bucket.Get(key), []byte(sURL)) {
+		return nil
+	}
+	return bucket.Delete(key)
+}
+
+// backfillUserURLIndex fills the per-user URL index from entries which were not deleted.
+func backfillUserURLIndex(tx *bolt.Tx) error {
+	userURLIdx := tx.Bucket(userURLIndex)
+	return tx.Bucket(urlsBucket).ForEach(func(k, v []byte) error {
+		var entry modelstorage.URLBoltEntry
+		err := json.Unmarshal(v, &entry)
+		if err != nil {
+			return err
+		}
+		if entry.IsDeleted {
+			return nil
+		}
+		return userURLIdx.Put(userIndexKey(entry.UserID, entry.URL), k)
+	})
+}
@@ -0,0 +1,321 @@
+package inbolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StorageTestSuite struct {
+	suite.Suite
+	storage *Storage
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      *sync.WaitGroup
+}
+
+func (suite *StorageTestSuite) SetupTest() {
+	cfg := config.NewDefaultConfiguration()
+	cfg.BoltStoragePath = filepath.Join(suite.T().TempDir(), "url_storage.db")
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg = &sync.WaitGroup{}
+	suite.wg.Add(1)
+	var err error
+	suite.storage, err = InitStorage(suite.ctx, suite.wg, cfg)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+}
+
+func (suite *StorageTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func TestStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTestSuite))
+}
+
+func (suite *StorageTestSuite) TestDumpAndRetrieve() {
+	expiredAt := time.Now().Add(-time.Minute)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1", ExpiresAt: &expiredAt})
+
+	URL, err := suite.storage.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL2")
+	var expiredError *storageErrors.ExpiredError
+	assert.True(suite.T(), errors.As(err, &expiredError))
+
+	_, err = suite.storage.Retrieve(suite.ctx, "some_absent_sURL")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(suite.T(), errors.As(err, &notFoundError))
+
+	// expiration times are reported along with lookup outcomes
+	expiresAt := time.Now().Add(time.Hour).Round(0)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.by", UserID: "user1", ExpiresAt: &expiresAt})
+	URL, linkExpiresAt, err := suite.storage.RetrieveWithExpiry(suite.ctx, "sURL3")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.by", URL)
+	assert.True(suite.T(), expiresAt.Equal(*linkExpiresAt))
+	_, linkExpiresAt, err = suite.storage.RetrieveWithExpiry(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), linkExpiresAt)
+}
+
+func (suite *StorageTestSuite) TestOriginalURL() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru/", OriginalURL: "HTTPS://www.Yandex.ru:443/#a", UserID: "user1"})
+	URLs, err := suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []modelurl.FullURL{{URL: "https://www.yandex.ru/", OriginalURL: "HTTPS://www.Yandex.ru:443/#a", SURL: "sURL1"}}, URLs)
+	entries, err := suite.storage.List(suite.ctx, "", 1)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "HTTPS://www.Yandex.ru:443/#a", entries[0].OriginalURL)
+}
+
+func (suite *StorageTestSuite) TestPasswordHash() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	// password-protected entries are not deduplicated in either direction
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", PasswordHash: "someHash", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.kz", PasswordHash: "someHash", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL4", URL: "https://www.yandex.kz", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL2")
+	var protectedError *storageErrors.ProtectedError
+	assert.True(suite.T(), errors.As(err, &protectedError))
+	assert.Equal(suite.T(), "https://www.yandex.ru", protectedError.URL)
+	assert.Equal(suite.T(), "someHash", protectedError.PasswordHash)
+	URL, err := suite.storage.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+	entries, err := suite.storage.List(suite.ctx, "sURL1", 1)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "someHash", entries[0].PasswordHash)
+}
+
+func (suite *StorageTestSuite) TestDumpConflicts() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.by", UserID: "user2"})
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &sURLAlreadyExistsError))
+
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+
+	// URLs are deduplicated per user by default
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user2"})
+	assert.Nil(suite.T(), err)
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user2")
+	assert.Len(suite.T(), URLs, 1)
+
+	// deleted entries do not block shortening the same URL again
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1"}, "user1")
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL4", URL: "https://www.yandex.ru", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *StorageTestSuite) TestDumpConflictsGlobalScope() {
+	suite.storage.Cfg.DedupScope = config.DedupScopeGlobal
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+
+	// sURLs of other users must not be exposed
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user2"})
+	var urlTakenError *storageErrors.URLTakenError
+	assert.True(suite.T(), errors.As(err, &urlTakenError))
+}
+
+func (suite *StorageTestSuite) TestDumpExpired() {
+	suite.storage.Cfg.DedupScope = config.DedupScopeGlobal
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1", ExpiresAt: &expiresAt})
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+
+	// expired entries do not block shortening the same URL again
+	time.Sleep(time.Until(expiresAt))
+	assert.Nil(suite.T(), suite.storage.CheckDuplicate(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user2"}))
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user2"})
+	assert.Nil(suite.T(), err)
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user1"})
+	var urlTakenError *storageErrors.URLTakenError
+	assert.True(suite.T(), errors.As(err, &urlTakenError))
+}
+
+func (suite *StorageTestSuite) TestDumpBatch() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+
+	results, err := suite.storage.DumpBatch(suite.ctx, []modelstorage.URLStorageEntry{
+		{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"},
+		{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user1"},
+		{SURL: "sURL1", URL: "https://www.yandex.by", UserID: "user1"},
+		{SURL: "sURL4", URL: "https://www.yandex.kz", UserID: "user1"},
+	})
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), results, 4)
+	assert.Nil(suite.T(), results[0])
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(results[1], &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.True(suite.T(), errors.As(results[2], &sURLAlreadyExistsError))
+	// duplicates within the batch resolve to the entry stored first
+	assert.True(suite.T(), errors.As(results[3], &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL2", alreadyExistsError.ValidSURL)
+
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Len(suite.T(), URLs, 2)
+}
+
+func (suite *StorageTestSuite) TestRetrieveByUserIDAndStats() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.by", UserID: "user10"})
+
+	URLs, err := suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), URLs, 2)
+
+	nURLs, nUsers, err := suite.storage.GetStats(suite.ctx)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(3), nURLs)
+	assert.Equal(suite.T(), int64(2), nUsers)
+
+	userIDs, err := suite.storage.ListUserIDs(suite.ctx)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"user1", "user10"}, userIDs)
+}
+
+func (suite *StorageTestSuite) TestDeleteBatch() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user2"})
+
+	// entries of other users must stay intact
+	err := suite.storage.DeleteBatch(suite.ctx, []string{"sURL1", "sURL2"}, "user1")
+	assert.Nil(suite.T(), err)
+
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL1")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Len(suite.T(), URLs, 0)
+
+	URL, err := suite.storage.Retrieve(suite.ctx, "sURL2")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.kz", URL)
+	owned, err := suite.storage.IsOwner(suite.ctx, "user1", "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), owned)
+	owned, _ = suite.storage.IsOwner(suite.ctx, "user2", "sURL2")
+	assert.True(suite.T(), owned)
+	owned, _ = suite.storage.IsOwner(suite.ctx, "user1", "some_absent_sURL")
+	assert.False(suite.T(), owned)
+}
+
+func (suite *StorageTestSuite) TestRemoveBatch() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	removed, err := suite.storage.RemoveBatch(suite.ctx, []string{"sURL1", "some_absent_sURL"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), removed)
+
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL1")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(suite.T(), errors.As(err, &notFoundError))
+	// the URL of a removed entry may be shortened again
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Len(suite.T(), URLs, 2)
+	nURLs, _, _ := suite.storage.GetStats(suite.ctx)
+	assert.Equal(suite.T(), int64(2), nURLs)
+}
+
+func (suite *StorageTestSuite) TestSendToQueue() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.SendToQueue(suite.ctx, modelstorage.URLChannelEntry{SURL: "sURL1", UserID: "user1"})
+	// pending deletions are flushed upon ctx cancellation
+	suite.cancel()
+	suite.wg.Wait()
+	cfg := suite.storage.Cfg
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	var err error
+	suite.storage, err = InitStorage(suite.ctx, suite.wg, cfg)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL1")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+}
+
+func (suite *StorageTestSuite) TestDeleteJob() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user2"})
+	for _, sURL := range []string{"sURL1", "sURL2", "sURL3"} {
+		err := suite.storage.SendToQueue(suite.ctx, modelstorage.URLChannelEntry{SURL: sURL, UserID: "user1", JobID: "job1"})
+		assert.Nil(suite.T(), err)
+	}
+	// pending deletions are flushed upon ctx cancellation
+	suite.cancel()
+	suite.wg.Wait()
+	job, err := suite.storage.RetrieveDeleteJob(context.Background(), "job1", "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), modelurl.DeleteJob{
+		ID:       "job1",
+		Status:   modelurl.DeleteJobDone,
+		Deleted:  []string{"sURL1"},
+		NotOwned: []string{"sURL2"},
+		NotFound: []string{"sURL3"},
+	}, job)
+	// jobs of other users are not disclosed
+	_, err = suite.storage.RetrieveDeleteJob(context.Background(), "job1", "user2")
+	var jobNotFoundError *storageErrors.JobNotFoundError
+	assert.True(suite.T(), errors.As(err, &jobNotFoundError))
+}
+
+func (suite *StorageTestSuite) TestRestoreBatch() {
+	suite.storage.Cfg.RestoreGraceWindow = time.Hour
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1", "sURL2"}, "user1")
+	// the URL of sURL2 is shortened again after deletion
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.kz", UserID: "user1"})
+	results, err := suite.storage.RestoreBatch(suite.ctx, []string{"sURL1", "sURL2", "sURL1"}, "user2")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{modelurl.RestoreOutcomeNotOwned, modelurl.RestoreOutcomeNotOwned, modelurl.RestoreOutcomeNotOwned}, results)
+	results, err = suite.storage.RestoreBatch(suite.ctx, []string{"sURL1", "sURL2", "sURL1"}, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{modelurl.RestoreOutcomeRestored, modelurl.RestoreOutcomeConflict, modelurl.RestoreOutcomeNotDeleted}, results)
+	URL, err := suite.storage.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+	// the restored entry is indexed again
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL4", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+}
@@ -0,0 +1,273 @@
+package infile
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// Check interface implementation explicitly
+var (
+	_ storage.ClickStorage = (*ClickStorage)(nil)
+)
+
+// click events are buffered and written asynchronously in batches
+const (
+	clickQueueSize      = 1024
+	flushClicksAmount   = 100
+	flushClicksInterval = time.Second * 5
+)
+
+// ClickStorage struct defines data structure handling for click events stored in a local file.
+type ClickStorage struct {
+	mu         sync.Mutex
+	Cfg        *config.Config
+	Encoder    *json.Encoder
+	ch         chan modelstorage.ClickEntry
+	aggregates map[string]*clickAggregate
+}
+
+// clickAggregate holds rolled-up click counters of one sURL, buckets are keyed by their start as Unix time.
+type clickAggregate struct {
+	hourly     map[int64]int64
+	daily      map[int64]int64
+	visitors   map[int64]map[string]struct{}
+	referrers  map[int64]map[string]int64
+	userAgents map[int64]map[string]int64
+}
+
+// InitClickStorage initializes a ClickStorage object and starts its batch writer.
+func InitClickStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*ClickStorage, error) {
+	st := ClickStorage{
+		Cfg:        cfg,
+		ch:         make(chan modelstorage.ClickEntry, clickQueueSize),
+		aggregates: make(map[string]*clickAggregate),
+	}
+	err := st.restore()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(cfg.ClickStoragePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return nil, err
+	}
+	st.Encoder = json.NewEncoder(file)
+	// start a goroutine for batch writing which closes file storage upon ctx cancellation
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(flushClicksInterval)
+		defer t.Stop()
+		parts := make([]modelstorage.ClickEntry, 0, flushClicksAmount)
+		for {
+			select {
+			case <-ctx.Done():
+				// collect clicks which were queued prior to cancellation
+				for len(st.ch) > 0 {
+					parts = append(parts, <-st.ch)
+				}
+				if len(parts) > 0 {
+					log.Println("Saving clicks due to context cancellation", len(parts))
+					err := st.Flush(parts)
+					if err != nil {
+						log.Println("Saving clicks:", err)
+					}
+				}
+				err := file.Close()
+				if err != nil {
+					log.Println("Click file storage closure:", err)
+					return
+				}
+				log.Println("Click file storage closed successfully")
+				return
+			case <-t.C:
+				if len(parts) > 0 {
+					err := st.Flush(parts)
+					if err != nil {
+						log.Println("Saving clicks:", err)
+					}
+					parts = make([]modelstorage.ClickEntry, 0, flushClicksAmount)
+				}
+			case part := <-st.ch:
+				parts = append(parts, part)
+				if len(parts) >= flushClicksAmount {
+					err := st.Flush(parts)
+					if err != nil {
+						log.Println("Saving clicks:", err)
+					}
+					parts = make([]modelstorage.ClickEntry, 0, flushClicksAmount)
+				}
+			}
+		}
+	}()
+	return &st, nil
+}
+
+// SendClick sends a click event to the writing queue without blocking, the event is dropped if the queue is full.
+func (s *ClickStorage) SendClick(item modelstorage.ClickEntry) {
+	select {
+	case s.ch <- item:
+	default:
+		log.Println("Click queue is full, dropping click for", item.SURL)
+	}
+}
+
+// Flush writes a batch of click events to file storage and updates in-memory rollups.
+func (s *ClickStorage) Flush(batch []modelstorage.ClickEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, click := range batch {
+		err := s.Encoder.Encode(click)
+		if err != nil {
+			return err
+		}
+		s.aggregate(click)
+	}
+	return nil
+}
+
+// RetrieveClickStats returns click statistics of sURL for buckets starting within [from, to).
+func (s *ClickStorage) RetrieveClickStats(ctx context.Context, sURL string, from, to time.Time, top int) (stats modelurl.ClickStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ClickStats, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var stats modelurl.ClickStats
+		agg, ok := s.aggregates[sURL]
+		if !ok {
+			retrieveDone <- stats
+			return
+		}
+		inRange := func(start int64) bool {
+			return start >= from.Unix() && start < to.Unix()
+		}
+		for start, clicks := range agg.hourly {
+			if inRange(start) {
+				stats.Hourly = append(stats.Hourly, modelurl.ClickBucket{Start: time.Unix(start, 0).UTC(), Clicks: clicks})
+				stats.TotalClicks += clicks
+			}
+		}
+		for start, clicks := range agg.daily {
+			if inRange(start) {
+				stats.Daily = append(stats.Daily, modelurl.ClickBucket{Start: time.Unix(start, 0).UTC(), Clicks: clicks})
+			}
+		}
+		sortBuckets(stats.Hourly)
+		sortBuckets(stats.Daily)
+		visitors := make(map[string]struct{})
+		referrers := make(map[string]int64)
+		userAgents := make(map[string]int64)
+		for start := range agg.daily {
+			if !inRange(start) {
+				continue
+			}
+			for visitor := range agg.visitors[start] {
+				visitors[visitor] = struct{}{}
+			}
+			for referrer, clicks := range agg.referrers[start] {
+				referrers[referrer] += clicks
+			}
+			for userAgent, clicks := range agg.userAgents[start] {
+				userAgents[userAgent] += clicks
+			}
+		}
+		stats.UniqueVisitors = int64(len(visitors))
+		stats.TopReferrers = topCounters(referrers, top)
+		stats.TopUserAgents = topCounters(userAgents, top)
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving click stats:", ctx.Err())
+		return modelurl.ClickStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case stats := <-retrieveDone:
+		log.Println("Retrieving click stats: done for", sURL)
+		return stats, nil
+	}
+}
+
+// restore fills in-memory rollups with click events from file storage.
+func (s *ClickStorage) restore() error {
+	file, err := os.OpenFile(s.Cfg.ClickStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewScanner(file)
+	for reader.Scan() {
+		var click modelstorage.ClickEntry
+		err := json.Unmarshal(reader.Bytes(), &click)
+		if err != nil {
+			return err
+		}
+		s.aggregate(click)
+	}
+	return reader.Err()
+}
+
+// aggregate adds one click event to in-memory rollups, it must be called with the mutex held.
+func (s *ClickStorage) aggregate(click modelstorage.ClickEntry) {
+	agg, ok := s.aggregates[click.SURL]
+	if !ok {
+		agg = &clickAggregate{
+			hourly:     make(map[int64]int64),
+			daily:      make(map[int64]int64),
+			visitors:   make(map[int64]map[string]struct{}),
+			referrers:  make(map[int64]map[string]int64),
+			userAgents: make(map[int64]map[string]int64),
+		}
+		s.aggregates[click.SURL] = agg
+	}
+	clickedAt := click.ClickedAt.UTC()
+	hour := clickedAt.Truncate(time.Hour).Unix()
+	day := time.Date(clickedAt.Year(), clickedAt.Month(), clickedAt.Day(), 0, 0, 0, 0, time.UTC).Unix()
+	agg.hourly[hour]++
+	agg.daily[day]++
+	if agg.visitors[day] == nil {
+		agg.visitors[day] = make(map[string]struct{})
+		agg.referrers[day] = make(map[string]int64)
+		agg.userAgents[day] = make(map[string]int64)
+	}
+	agg.visitors[day][click.VisitorID()] = struct{}{}
+	agg.referrers[day][click.Referrer]++
+	agg.userAgents[day][click.UserAgent]++
+}
+
+// sortBuckets sorts time series buckets in chronological order.
+func sortBuckets(buckets []modelurl.ClickBucket) {
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+}
+
+// topCounters returns at most top values with the highest number of clicks.
+func topCounters(counters map[string]int64, top int) []modelurl.ClickCounter {
+	result := make([]modelurl.ClickCounter, 0, len(counters))
+	for value, clicks := range counters {
+		result = append(result, modelurl.ClickCounter{Value: value, Clicks: clicks})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Clicks != result[j].Clicks {
+			return result[i].Clicks > result[j].Clicks
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
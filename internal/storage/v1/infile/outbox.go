@@ -0,0 +1,118 @@
+package infile
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// outboxSuffix is appended to the file storage path to name a side file of queued deletions.
+const outboxSuffix = ".outbox"
+
+// outboxRecord defines one line of the outbox file, it either queues a deletion or marks one as done.
+type outboxRecord struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"userID,omitempty"`
+	SURL   string `json:"sURL,omitempty"`
+	JobID  string `json:"jobID,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// outbox persists queued deletions to an append-only side file until they are flushed, the file is truncated
+// once no deletions are pending.
+type outbox struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	lastID  int64
+	pending map[int64]bool
+}
+
+// openOutbox opens the outbox file at path and returns deletions which were queued but not done.
+func openOutbox(path string) (*outbox, []modelstorage.URLChannelEntry, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := &outbox{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		pending: make(map[int64]bool),
+	}
+	var queued []modelstorage.URLChannelEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record outboxRecord
+		// a torn last line of a crashed write is skipped, its deletion was not acknowledged
+		if json.Unmarshal(scanner.Bytes(), &record) != nil {
+			continue
+		}
+		if record.ID > o.lastID {
+			o.lastID = record.ID
+		}
+		if record.Done {
+			delete(o.pending, record.ID)
+			continue
+		}
+		o.pending[record.ID] = true
+		queued = append(queued, modelstorage.URLChannelEntry{UserID: record.UserID, SURL: record.SURL, OutboxID: record.ID, JobID: record.JobID})
+	}
+	err = scanner.Err()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	var items []modelstorage.URLChannelEntry
+	for _, item := range queued {
+		if o.pending[item.OutboxID] {
+			items = append(items, item)
+		}
+	}
+	return o, items, nil
+}
+
+// add persists item and returns it with OutboxID set.
+func (o *outbox) add(item modelstorage.URLChannelEntry) (modelstorage.URLChannelEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lastID++
+	item.OutboxID = o.lastID
+	err := o.encoder.Encode(outboxRecord{ID: item.OutboxID, UserID: item.UserID, SURL: item.SURL, JobID: item.JobID})
+	if err != nil {
+		return item, err
+	}
+	err = o.file.Sync()
+	if err != nil {
+		return item, err
+	}
+	o.pending[item.OutboxID] = true
+	return item, nil
+}
+
+// done marks items as flushed.
+func (o *outbox) done(items []modelstorage.URLChannelEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, item := range items {
+		if !o.pending[item.OutboxID] {
+			continue
+		}
+		delete(o.pending, item.OutboxID)
+		err := o.encoder.Encode(outboxRecord{ID: item.OutboxID, Done: true})
+		if err != nil {
+			return err
+		}
+	}
+	if len(o.pending) == 0 {
+		return o.file.Truncate(0)
+	}
+	return o.file.Sync()
+}
+
+// close closes the outbox file.
+func (o *outbox) close() error {
+	return o.file.Close()
+}
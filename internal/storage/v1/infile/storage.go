@@ -3,22 +3,45 @@ package infile
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/jobs"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
 )
 
 // Check interface implementation explicitly
 var (
-	_ storage.URLStorage = (*Storage)(nil)
+	_ storage.URLStorage        = (*Storage)(nil)
+	_ storage.Compactor         = (*Storage)(nil)
+	_ storage.UserLister        = (*Storage)(nil)
+	_ storage.DeleteObserver    = (*Storage)(nil)
+	_ storage.Remover           = (*Storage)(nil)
+	_ storage.DuplicateChecker  = (*Storage)(nil)
+	_ storage.ExpiringURLGetter = (*Storage)(nil)
+	_ storage.OwnerChecker      = (*Storage)(nil)
+)
+
+// compaction parameters
+const (
+	// compactSuffix is appended to the file storage path to name a snapshot being written
+	compactSuffix = ".compact"
+	// compactCheckInterval defines how often size and ratio thresholds are checked
+	compactCheckInterval = time.Minute
+	// minCompactRecords prevents ratio-triggered compaction of tiny logs
+	minCompactRecords = 100
 )
 
 // Storage struct defines data structure handling and provides support for adding new implementations.
@@ -27,14 +50,42 @@ type Storage struct {
 	Cfg     *config.Config
 	DB      map[string]modelstorage.URLMapEntry
 	Encoder *json.Encoder
+	// userURLs maps user IDs and URLs of live entries which are not password-protected to their sURLs, globalURLs
+	// maps the URLs to sURLs of the first of them, see config.DedupScope
+	userURLs   map[string]string
+	globalURLs map[string]string
+	ch         chan modelstorage.URLChannelEntry
+	file       *os.File
+	// outbox keeps queued deletions until they are flushed, done is closed once the deletion flusher stops
+	outbox *outbox
+	done   chan struct{}
+	// deferred keeps outbox items which the flusher was too busy to accept in time, they are picked up on its next tick
+	deferredMu sync.Mutex
+	deferred   []modelstorage.URLChannelEntry
+	// jobs tracks outcomes of queued deletions, deletes are notified of flushed ones
+	jobs    *jobs.Registry
+	deletes storage.DeleteObservers
+	// records is the number of records in the file log, baseSize is the log size right after the last compaction
+	records  int
+	baseSize int64
+	// compactMu serializes compactions and file closure, pending accumulates records written during compaction
+	compactMu  sync.Mutex
+	compacting bool
+	pending    []modelstorage.URLStorageEntry
+	closed     bool
 }
 
 // InitStorage initializes a Storage object and sets its attributes.
 func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*Storage, error) {
 	db := make(map[string]modelstorage.URLMapEntry)
 	st := Storage{
-		Cfg: cfg,
-		DB:  db,
+		Cfg:        cfg,
+		DB:         db,
+		userURLs:   make(map[string]string),
+		globalURLs: make(map[string]string),
+		ch:         make(chan modelstorage.URLChannelEntry),
+		done:       make(chan struct{}),
+		jobs:       jobs.NewRegistry(),
 	}
 	err := st.restore()
 	if err != nil {
@@ -46,21 +97,136 @@ func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*
 		log.Fatal(err)
 	}
 	// set an encoder
+	st.file = file
 	st.Encoder = json.NewEncoder(file)
-	// start a goroutine to listen for ctx cancellation followed by file storage closure,
-	// use sync.WaitGroup to prevent goroutine premature termination when main exits
+	// replay deletions which were accepted but not flushed prior to the last shutdown
+	outbox, queued, err := openOutbox(st.Cfg.FileStoragePath + outboxSuffix)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.outbox = outbox
+	for _, item := range queued {
+		st.jobs.Add(item)
+	}
+	if len(queued) > 0 {
+		log.Println("Deleting URLs due to replaying outbox", queued)
+		err = st.Flush(ctx, queued)
+		if err != nil {
+			log.Println("Deleting URLs:", err)
+		}
+	}
+	const flushPartsAmount = 10
+	const flushPartsInterval = time.Second * 10
+	// start a goroutine to accumulate deletion tasks and to listen for ctx cancellation followed by file storage
+	// closure, use sync.WaitGroup to prevent goroutine premature termination when main exits
 	go func() {
 		defer wg.Done()
-		<-ctx.Done()
-		err := file.Close()
-		if err != nil {
-			log.Fatal(err)
+		defer close(st.done)
+		t := time.NewTicker(flushPartsInterval)
+		defer t.Stop()
+		ct := time.NewTicker(compactCheckInterval)
+		defer ct.Stop()
+		parts := make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
+		for {
+			select {
+			case <-ctx.Done():
+				parts = append(parts, st.takeDeferred()...)
+				if len(parts) > 0 {
+					log.Println("Deleting URLs due to context cancellation", parts)
+					// ctx is already cancelled, use a detached one for the last flush
+					err := st.Flush(context.Background(), parts)
+					if err != nil {
+						log.Println("Deleting URLs:", err)
+					}
+				}
+				err := st.outbox.close()
+				if err != nil {
+					log.Println("Closing outbox:", err)
+				}
+				err = st.closeFile()
+				if err != nil {
+					log.Fatal(err)
+				}
+				log.Println("File storage closed successfully")
+				return
+			case <-ct.C:
+				if st.needsCompaction() {
+					// run compaction aside so that deletion tasks are still accepted
+					go func() {
+						err := st.Compact(ctx)
+						if err != nil {
+							log.Println("Compacting file storage:", err)
+						}
+					}()
+				}
+			case <-t.C:
+				parts = append(parts, st.takeDeferred()...)
+				if len(parts) > 0 {
+					log.Println("Deleting URLs due to timeout", parts)
+					err := st.Flush(ctx, parts)
+					if err != nil {
+						log.Println("Deleting URLs:", err)
+					}
+					parts = make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
+				}
+			case part := <-st.ch:
+				parts = append(parts, part)
+				if len(parts) >= flushPartsAmount {
+					log.Println("Deleting URLs due to exceeding capacity", parts)
+					err := st.Flush(ctx, parts)
+					if err != nil {
+						log.Println("Deleting URLs:", err)
+					}
+					parts = make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
+				}
+			}
 		}
-		log.Println("File storage closed successfully")
 	}()
 	return &st, nil
 }
 
+// Flush flushes URL entries from buffer, sends them for deletion and marks them as done in the outbox, the whole
+// batch is kept in the outbox for replaying if any deletion fails. Outcomes of items are recorded to their jobs.
+func (s *Storage) Flush(ctx context.Context, batch []modelstorage.URLChannelEntry) error {
+	outcomes := s.classify(batch)
+	uniqueMap := make(map[string][]string)
+	for _, b := range batch {
+		uniqueMap[b.UserID] = append(uniqueMap[b.UserID], b.SURL)
+	}
+	for userID, sURLs := range uniqueMap {
+		err := s.DeleteBatch(ctx, sURLs, userID)
+		// a failed batch may be deleted in part, hence observers are notified regardless
+		s.deletes.Notify(sURLs)
+		if err != nil {
+			s.jobs.Fail(batch, err)
+			return err
+		}
+	}
+	s.jobs.Done(batch, outcomes)
+	err := s.outbox.done(batch)
+	if err != nil {
+		return &storageErrors.FileWriteError{Err: err}
+	}
+	return nil
+}
+
+// ObserveDeletes registers fn to be called with sURLs once their queued deletion is flushed.
+func (s *Storage) ObserveDeletes(fn func(sURLs []string)) {
+	s.deletes.Add(fn)
+}
+
+// classify returns outcomes of deleting batch items, outcomes[i] corresponds to batch[i].
+func (s *Storage) classify(batch []modelstorage.URLChannelEntry) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	outcomes := make([]string, len(batch))
+	for i, item := range batch {
+		URLMapEntry, ok := s.DB[item.SURL]
+		outcomes[i] = jobs.Outcome(ok, URLMapEntry.UserID, item.UserID)
+	}
+	return outcomes
+}
+
 func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error) {
 	// create channels for listening to the go routine result
 	retrieveDone := make(chan []int64, 1)
@@ -87,11 +253,48 @@ func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error)
 	}
 }
 
+// ListUserIDs returns distinct IDs of users who own entries.
+func (s *Storage) ListUserIDs(ctx context.Context) (userIDs []string, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []string, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		uniqueUsers := map[string]bool{}
+		var IDs []string
+		for _, URL := range s.DB {
+			if !uniqueUsers[URL.UserID] {
+				uniqueUsers[URL.UserID] = true
+				IDs = append(IDs, URL.UserID)
+			}
+		}
+		retrieveDone <- IDs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing users:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case IDs := <-retrieveDone:
+		log.Println("Listing users: done")
+		return IDs, nil
+	}
+}
+
 // Retrieve returns a URL corresponding to sURL.
 func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+	URL, _, err = s.RetrieveWithExpiry(ctx, sURL)
+	return URL, err
+}
+
+// RetrieveWithExpiry returns a URL corresponding to sURL along with its expiration time.
+func (s *Storage) RetrieveWithExpiry(ctx context.Context, sURL string) (URL string, expiresAt *time.Time, err error) {
 	// create channels for listening to the go routine result
 	retrieveDone := make(chan string)
 	retrieveError := make(chan error)
+	// entryExpiresAt is set before a result is sent
+	var entryExpiresAt *time.Time
 	go func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
@@ -100,6 +303,19 @@ func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err er
 			retrieveError <- &storageErrors.NotFoundError{Err: nil, SURL: sURL}
 			return
 		}
+		entryExpiresAt = URLMapEntry.ExpiresAt
+		if URLMapEntry.IsExpired() {
+			retrieveError <- &storageErrors.ExpiredError{Err: nil, SURL: sURL}
+			return
+		}
+		if URLMapEntry.IsDeleted {
+			retrieveError <- &storageErrors.DeletedError{Err: nil, SURL: sURL}
+			return
+		}
+		if URLMapEntry.PasswordHash != "" {
+			retrieveError <- &storageErrors.ProtectedError{Err: nil, SURL: sURL, URL: URLMapEntry.URL, PasswordHash: URLMapEntry.PasswordHash}
+			return
+		}
 		retrieveDone <- URLMapEntry.URL
 	}()
 
@@ -107,13 +323,13 @@ func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err er
 	select {
 	case <-ctx.Done():
 		log.Println("Retrieving URL:", ctx.Err())
-		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		return "", nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case rtrvError := <-retrieveError:
 		log.Println("Retrieving URL:", rtrvError.Error())
-		return "", rtrvError
+		return "", entryExpiresAt, rtrvError
 	case URL := <-retrieveDone:
 		log.Println("Retrieving URL:", sURL, "as", URL)
-		return URL, nil
+		return URL, entryExpiresAt, nil
 	}
 }
 
@@ -126,10 +342,12 @@ func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []m
 		defer s.mu.Unlock()
 		var URLs []modelurl.FullURL
 		for sURL, URL := range s.DB {
-			if URL.UserID == userID {
+			if URL.UserID == userID && !URL.IsDeleted {
 				fullURL := modelurl.FullURL{
-					URL:  URL.URL,
-					SURL: sURL,
+					URL:         URL.URL,
+					OriginalURL: URL.OriginalURL,
+					SURL:        sURL,
+					ExpiresAt:   URL.ExpiresAt,
 				}
 				URLs = append(URLs, fullURL)
 			}
@@ -148,25 +366,85 @@ func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []m
 	}
 }
 
+// IsOwner reports whether userID owns a non-deleted entry with sURL.
+func (s *Storage) IsOwner(ctx context.Context, userID, sURL string) (owned bool, err error) {
+	// create channels for listening to the go routine result
+	checkDone := make(chan bool, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		URLMapEntry, ok := s.DB[sURL]
+		checkDone <- ok && URLMapEntry.UserID == userID && !URLMapEntry.IsDeleted
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Checking URL owner:", ctx.Err())
+		return false, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case owned := <-checkDone:
+		log.Println("Checking URL owner:", sURL, "owned by", userID, owned)
+		return owned, nil
+	}
+}
+
+// ListByUserID returns up to limit URLs of userID with sURLs greater than afterSURL in ascending order of sURLs.
+func (s *Storage) ListByUserID(ctx context.Context, userID, afterSURL string, limit int) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var URLs []modelurl.FullURL
+		for sURL, URL := range s.DB {
+			if URL.UserID == userID && !URL.IsDeleted && sURL > afterSURL {
+				URLs = append(URLs, modelurl.FullURL{URL: URL.URL, OriginalURL: URL.OriginalURL, SURL: sURL, ExpiresAt: URL.ExpiresAt})
+			}
+		}
+		sort.Slice(URLs, func(i, j int) bool { return URLs[i].SURL < URLs[j].SURL })
+		if len(URLs) > limit {
+			URLs = URLs[:limit]
+		}
+		retrieveDone <- URLs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing URLs by user ID:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case URLs := <-retrieveDone:
+		log.Println("Listing URLs by user ID:", len(URLs), "URLs after", afterSURL)
+		return URLs, nil
+	}
+}
+
 // Dump stores a pair of sURL and URL as a key-value pair.
-func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID string) error {
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
 	// create channels for listening to the go routine result
 	dumpDone := make(chan bool)
 	dumpError := make(chan error)
 	go func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		_, ok := s.DB[sURL]
+		_, ok := s.DB[entry.SURL]
 		if ok {
-			dumpError <- &storageErrors.AlreadyExistsError{Err: nil, URL: sURL, ValidSURL: ""}
+			dumpError <- &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
 			return
 		}
-		s.DB[sURL] = modelstorage.URLMapEntry{URL: URL, UserID: userID}
-		err := s.addToFileDB(sURL, URL, userID)
+		err := s.checkDuplicate(entry)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		// write to the file log first so that an entry which failed to persist is not served
+		err = s.addToFileDB(entry)
 		if err != nil {
 			dumpError <- &storageErrors.FileWriteError{Err: err}
 			return
 		}
+		s.DB[entry.SURL] = modelstorage.URLMapEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: entry.UserID, ExpiresAt: entry.ExpiresAt}
+		s.index(entry.SURL, s.DB[entry.SURL])
 		dumpDone <- true
 	}()
 
@@ -179,59 +457,607 @@ func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID stri
 		log.Println("Dumping URL:", dmpError.Error())
 		return dmpError
 	case <-dumpDone:
-		log.Println("Dumping URL:", sURL, "as", URL)
+		log.Println("Dumping URL:", entry.SURL, "as", entry.URL)
 		return nil
 	}
 }
 
-// DeleteBatch is a mock for PSQL DB batch deleter for infile DB handling.
+// DumpBatch stores a batch of sURL and URL pairs under one lock, entries with taken sURLs or duplicate URLs are
+// skipped and reported in results.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	// create channels for listening to the go routine result
+	dumpDone := make(chan []error, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		results := make([]error, len(entries))
+		for i, entry := range entries {
+			_, ok := s.DB[entry.SURL]
+			if ok {
+				results[i] = &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
+				continue
+			}
+			err := s.checkDuplicate(entry)
+			if err != nil {
+				results[i] = err
+				continue
+			}
+			err = s.addToFileDB(entry)
+			if err != nil {
+				dumpError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			s.DB[entry.SURL] = modelstorage.URLMapEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: entry.UserID, ExpiresAt: entry.ExpiresAt, IsDeleted: entry.IsDeleted, DeletedAt: entry.DeletedAt}
+			s.index(entry.SURL, s.DB[entry.SURL])
+		}
+		dumpDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Dumping URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		log.Println("Dumping URLs:", dmpError.Error())
+		return nil, dmpError
+	case results := <-dumpDone:
+		log.Println("Dumping URLs:", len(entries), "entries processed")
+		return results, nil
+	}
+}
+
+// List retrieves a page of entries ordered by sURL.
+func (s *Storage) List(ctx context.Context, afterSURL string, limit int) (entries []modelstorage.URLStorageEntry, err error) {
+	// create channels for listening to the go routine result
+	listDone := make(chan []modelstorage.URLStorageEntry, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var sURLs []string
+		for sURL := range s.DB {
+			if sURL > afterSURL {
+				sURLs = append(sURLs, sURL)
+			}
+		}
+		sort.Strings(sURLs)
+		if len(sURLs) > limit {
+			sURLs = sURLs[:limit]
+		}
+		entries := make([]modelstorage.URLStorageEntry, 0, len(sURLs))
+		for _, sURL := range sURLs {
+			URLMapEntry := s.DB[sURL]
+			entries = append(entries, modelstorage.URLStorageEntry{
+				SURL:         sURL,
+				URL:          URLMapEntry.URL,
+				OriginalURL:  URLMapEntry.OriginalURL,
+				PasswordHash: URLMapEntry.PasswordHash,
+				UserID:       URLMapEntry.UserID,
+				ExpiresAt:    URLMapEntry.ExpiresAt,
+				IsDeleted:    URLMapEntry.IsDeleted,
+				DeletedAt:    URLMapEntry.DeletedAt,
+			})
+		}
+		listDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case entries := <-listDone:
+		log.Println("Listing URLs:", len(entries), "entries retrieved")
+		return entries, nil
+	}
+}
+
+// DeleteBatch assigns a deletion flag for entries owned by userID and persists tombstone records for them,
+// does not use task management.
 func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	// create channels for listening to the go routine result
+	deleteDone := make(chan bool, 1)
+	deleteError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		deletedAt := time.Now()
+		for _, sURL := range sURLs {
+			URLMapEntry, ok := s.DB[sURL]
+			if !ok || URLMapEntry.UserID != userID || URLMapEntry.IsDeleted {
+				continue
+			}
+			err := s.addToFileDB(modelstorage.URLStorageEntry{SURL: sURL, UserID: userID, IsDeleted: true, DeletedAt: &deletedAt})
+			if err != nil {
+				deleteError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			s.unindex(sURL, URLMapEntry)
+			URLMapEntry.IsDeleted = true
+			URLMapEntry.DeletedAt = &deletedAt
+			s.DB[sURL] = URLMapEntry
+		}
+		deleteDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Deleting URL:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dltError := <-deleteError:
+		log.Println("Deleting URL:", dltError.Error())
+		return dltError
+	case <-deleteDone:
+		log.Println("Deleting URL:", sURLs)
+		return nil
+	}
+}
+
+// RemoveBatch drops entries with sURLs from the tmpfs DB and persists removal records for them.
+func (s *Storage) RemoveBatch(ctx context.Context, sURLs []string) (removed int64, err error) {
+	// create channels for listening to the go routine result
+	removeDone := make(chan int64, 1)
+	removeError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var n int64
+		for _, sURL := range sURLs {
+			URLMapEntry, ok := s.DB[sURL]
+			if !ok {
+				continue
+			}
+			err := s.addToFileDB(modelstorage.URLStorageEntry{SURL: sURL, IsRemoved: true})
+			if err != nil {
+				removeError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			s.unindex(sURL, URLMapEntry)
+			delete(s.DB, sURL)
+			n++
+		}
+		removeDone <- n
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Removing URLs:", ctx.Err())
+		return 0, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rmvError := <-removeError:
+		log.Println("Removing URLs:", rmvError.Error())
+		return 0, rmvError
+	case n := <-removeDone:
+		log.Println("Removing URLs:", n, "entries removed")
+		return n, nil
+	}
+}
+
+// RestoreBatch clears the deletion flag of entries owned by userID which were deleted within
+// Cfg.RestoreGraceWindow and persists them as full records.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (results []string, err error) {
+	// create channels for listening to the go routine result
+	restoreDone := make(chan []string, 1)
+	restoreError := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		deletedAfter := time.Now().Add(-s.Cfg.RestoreGraceWindow)
+		results := make([]string, len(sURLs))
+		for i, sURL := range sURLs {
+			URLMapEntry, ok := s.DB[sURL]
+			if !ok {
+				results[i] = modelurl.RestoreOutcomeNotFound
+				continue
+			}
+			results[i] = URLMapEntry.RestoreOutcome(userID, deletedAfter)
+			if results[i] != modelurl.RestoreOutcomeRestored {
+				continue
+			}
+			storageEntry := modelstorage.URLStorageEntry{SURL: sURL, URL: URLMapEntry.URL, OriginalURL: URLMapEntry.OriginalURL, PasswordHash: URLMapEntry.PasswordHash, UserID: userID, ExpiresAt: URLMapEntry.ExpiresAt}
+			if s.checkDuplicate(storageEntry) != nil {
+				results[i] = modelurl.RestoreOutcomeConflict
+				continue
+			}
+			err := s.addToFileDB(storageEntry)
+			if err != nil {
+				restoreError <- &storageErrors.FileWriteError{Err: err}
+				return
+			}
+			URLMapEntry.IsDeleted = false
+			URLMapEntry.DeletedAt = nil
+			s.DB[sURL] = URLMapEntry
+			s.index(sURL, URLMapEntry)
+		}
+		restoreDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Restoring URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rstrError := <-restoreError:
+		log.Println("Restoring URLs:", rstrError.Error())
+		return nil, rstrError
+	case results := <-restoreDone:
+		log.Println("Restoring URLs:", sURLs, results)
+		return results, nil
+	}
+}
+
+// SendToQueue persists a modelstorage.URLChannelEntry to the outbox and sends it to the deletion task queue.
+func (s *Storage) SendToQueue(ctx context.Context, item modelstorage.URLChannelEntry) error {
+	item, err := s.outbox.add(item)
+	if err != nil {
+		return &storageErrors.FileWriteError{Err: err}
+	}
+	s.jobs.Add(item)
+	// item is durable from now on, it is deferred to the next flusher tick if ctx expires while the flusher is busy
+	// and replayed on the next start if the flusher is stopped
+	select {
+	case s.ch <- item:
+	case <-s.done:
+	case <-ctx.Done():
+		s.deferredMu.Lock()
+		s.deferred = append(s.deferred, item)
+		s.deferredMu.Unlock()
+	}
 	return nil
 }
 
-// SendToQueue is a mock for PSQL DB batch concurrent deleter for infile DB handling.
-func (s *Storage) SendToQueue(item modelstorage.URLChannelEntry) {
+// takeDeferred returns and clears items deferred by SendToQueue.
+func (s *Storage) takeDeferred() []modelstorage.URLChannelEntry {
+	s.deferredMu.Lock()
+	defer s.deferredMu.Unlock()
+	items := s.deferred
+	s.deferred = nil
+	return items
+}
+
+// RetrieveDeleteJob reports outcomes of a deletion job, jobs are kept in memory for jobs.Retention.
+func (s *Storage) RetrieveDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error) {
+	job, ok := s.jobs.Get(jobID, userID)
+	if !ok {
+		log.Println("Retrieving deletion job:", jobID, "not found")
+		return modelurl.DeleteJob{}, &storageErrors.JobNotFoundError{Err: nil, JobID: jobID}
+	}
+	log.Println("Retrieving deletion job:", jobID, "is", job.Status)
+	return job, nil
 }
 
 // restore fills the tmpfs DB with URL-sURL entries from file storage.
 func (s *Storage) restore() error {
+	// a leftover snapshot means that compaction was interrupted before the swap, the log itself is intact
+	err := os.Remove(s.Cfg.FileStoragePath + compactSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	var storageEntries []modelstorage.URLStorageEntry
 	file, err := os.OpenFile(s.Cfg.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	reader := bufio.NewScanner(file)
-	for reader.Scan() {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// the last record was not written completely, cut it off so that new records are not glued to it
+				log.Println("Restoring DB: dropping truncated record at offset", offset)
+				err = os.Truncate(s.Cfg.FileStoragePath, offset)
+				if err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
 		var storageEntry modelstorage.URLStorageEntry
-		err := json.Unmarshal(reader.Bytes(), &storageEntry)
+		err = json.Unmarshal(line, &storageEntry)
 		if err != nil {
 			return err
 		}
 		storageEntries = append(storageEntries, storageEntry)
 	}
 	log.Print("DB was restored")
+	// records are applied in the order of writing, hence tombstones always follow the entries they delete
 	for _, entry := range storageEntries {
-		s.DB[entry.SURL] = modelstorage.URLMapEntry{URL: entry.URL, UserID: entry.UserID}
+		if entry.IsRemoved {
+			delete(s.DB, entry.SURL)
+			continue
+		}
+		if entry.IsTombstone() {
+			URLMapEntry, ok := s.DB[entry.SURL]
+			if ok && URLMapEntry.UserID == entry.UserID {
+				URLMapEntry.IsDeleted = true
+				URLMapEntry.DeletedAt = entry.DeletedAt
+				s.DB[entry.SURL] = URLMapEntry
+			}
+			continue
+		}
+		// restored entries are written as full records and override tombstones
+		s.DB[entry.SURL] = modelstorage.URLMapEntry{URL: entry.URL, OriginalURL: entry.OriginalURL, PasswordHash: entry.PasswordHash, UserID: entry.UserID, ExpiresAt: entry.ExpiresAt, IsDeleted: entry.IsDeleted, DeletedAt: entry.DeletedAt}
+	}
+	// URL indexes are built once all records are applied since tombstones and restored entries override earlier
+	// records
+	for sURL, URLMapEntry := range s.DB {
+		s.index(sURL, URLMapEntry)
+	}
+	s.records = len(storageEntries)
+	return nil
+}
+
+// userURLKey returns a userURLs key of URL owned by userID.
+func userURLKey(userID, URL string) string {
+	return userID + "\x00" + URL
+}
+
+// index adds a live entry which has not expired and is not password-protected to URL indexes, it must be called
+// with mu held.
+func (s *Storage) index(sURL string, entry modelstorage.URLMapEntry) {
+	if entry.IsDeleted || entry.PasswordHash != "" || entry.IsExpired() {
+		return
+	}
+	key := userURLKey(entry.UserID, entry.URL)
+	if _, ok := s.userURLs[key]; !ok {
+		s.userURLs[key] = sURL
+	}
+	if _, ok := s.globalURLs[entry.URL]; !ok {
+		s.globalURLs[entry.URL] = sURL
+	}
+}
+
+// unindex removes an entry from URL indexes, it must be called with mu held.
+func (s *Storage) unindex(sURL string, entry modelstorage.URLMapEntry) {
+	key := userURLKey(entry.UserID, entry.URL)
+	if s.userURLs[key] == sURL {
+		delete(s.userURLs, key)
+	}
+	if s.globalURLs[entry.URL] == sURL {
+		delete(s.globalURLs, entry.URL)
+	}
+}
+
+// CheckDuplicate looks up a live entry with the same original URL as entry without storing it.
+func (s *Storage) CheckDuplicate(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	// create channels for listening to the go routine result
+	checkDone := make(chan error, 1)
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		checkDone <- s.checkDuplicate(entry)
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Checking URL:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case err := <-checkDone:
+		return err
+	}
+}
+
+// checkDuplicate looks up a live entry with the same original URL within config.DedupScope, sURLs of other
+// users are never returned. Deleted and password-protected entries are never deduplicated and expired entries are
+// unindexed once found. It must be called with mu held.
+func (s *Storage) checkDuplicate(entry modelstorage.URLStorageEntry) error {
+	if entry.IsDeleted || entry.PasswordHash != "" {
+		return nil
+	}
+	if validSURL, ok := s.userURLs[userURLKey(entry.UserID, entry.URL)]; ok && !s.unindexExpired(validSURL) {
+		return &storageErrors.AlreadyExistsError{Err: nil, URL: entry.URL, ValidSURL: validSURL}
+	}
+	if validSURL, ok := s.globalURLs[entry.URL]; ok && !s.unindexExpired(validSURL) && s.Cfg.DedupScope == config.DedupScopeGlobal {
+		return &storageErrors.URLTakenError{Err: nil, URL: entry.URL}
 	}
 	return nil
 }
 
-// addToFileDB adds one sURL:URL key-value pair to a file DB.
-func (s *Storage) addToFileDB(sURL, URL, userID string) error {
-	rowToEncode := modelstorage.URLStorageEntry{
-		SURL:   sURL,
-		URL:    URL,
-		UserID: userID,
+// unindexExpired removes an indexed entry from URL indexes if it has expired since being indexed and reports
+// whether it was removed, it must be called with mu held.
+func (s *Storage) unindexExpired(sURL string) bool {
+	entry := s.DB[sURL]
+	if !entry.IsExpired() {
+		return false
 	}
-	err := s.Encoder.Encode(rowToEncode)
+	s.unindex(sURL, entry)
+	return true
+}
+
+// addToFileDB adds one sURL:URL key-value pair or a tombstone record to a file DB.
+func (s *Storage) addToFileDB(entry modelstorage.URLStorageEntry) error {
+	err := s.Encoder.Encode(entry)
 	if err != nil {
 		return err
 	}
+	s.records++
+	if s.compacting {
+		s.pending = append(s.pending, entry)
+	}
 	log.Print("POST query was saved to DB")
 	return nil
 }
 
+// Compact rewrites the file log as a snapshot of the current entries, writes are accepted while the snapshot is
+// being written and are carried over to it before the swap.
+func (s *Storage) Compact(ctx context.Context) error {
+	// create channels for listening to the go routine result
+	compactDone := make(chan bool, 1)
+	compactError := make(chan error, 1)
+	go func() {
+		err := s.compact()
+		if err != nil {
+			compactError <- &storageErrors.FileCompactionError{Err: err}
+			return
+		}
+		compactDone <- true
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Compacting file storage:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case cmpctError := <-compactError:
+		log.Println("Compacting file storage:", cmpctError.Error())
+		return cmpctError
+	case <-compactDone:
+		log.Println("Compacting file storage: done")
+		return nil
+	}
+}
+
+// compact writes a snapshot to a temporary file, appends records written meanwhile and atomically renames
+// the snapshot over the file log.
+func (s *Storage) compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	path := s.Cfg.FileStoragePath
+	tmpPath := path + compactSuffix
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return os.ErrClosed
+	}
+	snapshot := make([]modelstorage.URLStorageEntry, 0, len(s.DB))
+	for sURL, URLMapEntry := range s.DB {
+		snapshot = append(snapshot, modelstorage.URLStorageEntry{
+			SURL:         sURL,
+			URL:          URLMapEntry.URL,
+			OriginalURL:  URLMapEntry.OriginalURL,
+			PasswordHash: URLMapEntry.PasswordHash,
+			UserID:       URLMapEntry.UserID,
+			ExpiresAt:    URLMapEntry.ExpiresAt,
+			IsDeleted:    URLMapEntry.IsDeleted,
+			DeletedAt:    URLMapEntry.DeletedAt,
+		})
+	}
+	s.compacting = true
+	s.pending = nil
+	s.mu.Unlock()
+
+	// the snapshot is written without holding the lock
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		s.stopCompacting()
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range snapshot {
+		err = encoder.Encode(entry)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		s.stopCompacting()
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		s.compacting = false
+		s.pending = nil
+	}()
+	encoder = json.NewEncoder(tmp)
+	for _, entry := range s.pending {
+		err = encoder.Encode(entry)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	err = s.file.Close()
+	if err != nil {
+		log.Println("Compacting file storage:", err)
+	}
+	s.file = tmp
+	s.Encoder = encoder
+	s.records = len(snapshot) + len(s.pending)
+	info, err := tmp.Stat()
+	if err == nil {
+		s.baseSize = info.Size()
+	}
+	log.Println("Compacting file storage:", s.records, "records kept")
+	return nil
+}
+
+// stopCompacting resets compaction state after a failed snapshot.
+func (s *Storage) stopCompacting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compacting = false
+	s.pending = nil
+}
+
+// needsCompaction checks whether the file log has grown or accumulated superseded records beyond thresholds.
+func (s *Storage) needsCompaction() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.records <= len(s.DB) {
+		return false
+	}
+	if s.Cfg.FileCompactRatio > 0 && s.records >= minCompactRecords &&
+		float64(s.records) >= s.Cfg.FileCompactRatio*float64(len(s.DB)) {
+		return true
+	}
+	if s.Cfg.FileCompactSize > 0 {
+		info, err := s.file.Stat()
+		if err == nil && info.Size()-s.baseSize >= s.Cfg.FileCompactSize {
+			return true
+		}
+	}
+	return false
+}
+
+// closeFile closes the file log, waits for a running compaction to finish and prevents subsequent ones.
+func (s *Storage) closeFile() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.file.Close()
+}
+
+// syncDir flushes directory metadata so that a rename survives a crash, errors are not critical here.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
+
 // PingDB is a mock for PSQL DB pinger.
 func (s *Storage) PingDB() error {
 	return nil
@@ -0,0 +1,465 @@
+package infile
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StorageTestSuite struct {
+	suite.Suite
+	cfg     *config.Config
+	storage *Storage
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      *sync.WaitGroup
+}
+
+func (suite *StorageTestSuite) SetupTest() {
+	suite.cfg = config.NewDefaultConfiguration()
+	suite.cfg.FileStoragePath = filepath.Join(suite.T().TempDir(), "url_storage.json")
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg = &sync.WaitGroup{}
+	suite.wg.Add(1)
+	suite.storage, _ = InitStorage(suite.ctx, suite.wg, suite.cfg)
+}
+
+func (suite *StorageTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func TestStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTestSuite))
+}
+
+func (suite *StorageTestSuite) TestDumpBatch() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+
+	results, err := suite.storage.DumpBatch(suite.ctx, []modelstorage.URLStorageEntry{
+		{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"},
+		{SURL: "sURL1", URL: "https://www.yandex.by", UserID: "user1"},
+		{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user1"},
+		{SURL: "sURL4", URL: "https://www.yandex.kz", UserID: "user1"},
+	})
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), results, 4)
+	assert.Nil(suite.T(), results[0])
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.True(suite.T(), errors.As(results[1], &sURLAlreadyExistsError))
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(results[2], &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+	// duplicates within the batch resolve to the entry stored first
+	assert.True(suite.T(), errors.As(results[3], &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL2", alreadyExistsError.ValidSURL)
+	assert.Equal(suite.T(), 2, countLines(suite.T(), suite.cfg.FileStoragePath))
+}
+
+func (suite *StorageTestSuite) TestDumpConflicts() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.by", UserID: "user2"})
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &sURLAlreadyExistsError))
+
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+
+	// URLs are deduplicated per user by default
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user2"})
+	assert.Nil(suite.T(), err)
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user2")
+	assert.Len(suite.T(), URLs, 1)
+
+	// deleted entries do not block shortening the same URL again
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1"}, "user1")
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL4", URL: "https://www.yandex.ru", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+
+	// URL indexes are rebuilt on restart
+	suite.cancel()
+	suite.wg.Wait()
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	err = restored.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL5", URL: "https://www.yandex.ru", UserID: "user1"})
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL4", alreadyExistsError.ValidSURL)
+}
+
+func (suite *StorageTestSuite) TestDumpConflictsGlobalScope() {
+	suite.storage.Cfg.DedupScope = config.DedupScopeGlobal
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+
+	// sURLs of other users must not be exposed
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user2"})
+	var urlTakenError *storageErrors.URLTakenError
+	assert.True(suite.T(), errors.As(err, &urlTakenError))
+	results, err := suite.storage.DumpBatch(suite.ctx, []modelstorage.URLStorageEntry{{SURL: "sURL4", URL: "https://www.yandex.ru", UserID: "user2"}})
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), errors.As(results[0], &urlTakenError))
+}
+
+func (suite *StorageTestSuite) TestDumpExpired() {
+	suite.storage.Cfg.DedupScope = config.DedupScopeGlobal
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1", ExpiresAt: &expiresAt})
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+
+	// expired entries do not block shortening the same URL again
+	time.Sleep(time.Until(expiresAt))
+	assert.Nil(suite.T(), suite.storage.CheckDuplicate(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user2"}))
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user2"})
+	assert.Nil(suite.T(), err)
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user1"})
+	var urlTakenError *storageErrors.URLTakenError
+	assert.True(suite.T(), errors.As(err, &urlTakenError))
+}
+
+func (suite *StorageTestSuite) TestDumpWriteFailure() {
+	suite.storage.Encoder = json.NewEncoder(failingWriter{})
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	var fileWriteError *storageErrors.FileWriteError
+	assert.True(suite.T(), errors.As(err, &fileWriteError))
+	// an entry which failed to persist is neither served nor blocks its URL
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL1")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(suite.T(), errors.As(err, &notFoundError))
+	assert.Nil(suite.T(), suite.storage.CheckDuplicate(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.ru", UserID: "user1"}))
+}
+
+func (suite *StorageTestSuite) TestDeleteBatch() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+
+	// foreign entries must stay intact
+	err := suite.storage.DeleteBatch(suite.ctx, []string{"sURL1", "sURL2"}, "user2")
+	assert.Nil(suite.T(), err)
+	URL, err := suite.storage.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+
+	err = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1", "some_absent_sURL"}, "user1")
+	assert.Nil(suite.T(), err)
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL1")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+
+	URLs, err := suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), URLs, 1)
+	assert.Equal(suite.T(), "sURL2", URLs[0].SURL)
+	owned, err := suite.storage.IsOwner(suite.ctx, "user1", "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), owned)
+	owned, _ = suite.storage.IsOwner(suite.ctx, "user1", "sURL2")
+	assert.True(suite.T(), owned)
+	owned, _ = suite.storage.IsOwner(suite.ctx, "user2", "sURL2")
+	assert.False(suite.T(), owned)
+}
+
+func (suite *StorageTestSuite) TestRestoreTombstones() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1"}, "user1")
+	suite.cancel()
+	suite.wg.Wait()
+
+	// reopen the same file storage and make sure tombstones were honoured
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	_, err := restored.Retrieve(suite.ctx, "sURL1")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	URL, err := restored.Retrieve(suite.ctx, "sURL2")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.kz", URL)
+}
+
+func (suite *StorageTestSuite) TestRemoveBatch() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	removed, err := suite.storage.RemoveBatch(suite.ctx, []string{"sURL1", "some_absent_sURL"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), removed)
+	suite.cancel()
+	suite.wg.Wait()
+
+	// reopen the same file storage and make sure removed entries are gone along with their URLs
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	_, err = restored.Retrieve(suite.ctx, "sURL1")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(suite.T(), errors.As(err, &notFoundError))
+	err = restored.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.ru", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+	URLs, _ := restored.RetrieveByUserID(suite.ctx, "user1")
+	assert.Len(suite.T(), URLs, 2)
+}
+
+func (suite *StorageTestSuite) TestCompact() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1"}, "user1")
+	assert.Equal(suite.T(), 3, countLines(suite.T(), suite.cfg.FileStoragePath))
+
+	err := suite.storage.Compact(suite.ctx)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, countLines(suite.T(), suite.cfg.FileStoragePath))
+	_, err = os.Stat(suite.cfg.FileStoragePath + compactSuffix)
+	assert.True(suite.T(), os.IsNotExist(err))
+
+	// writes after compaction go to the new file
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.by", UserID: "user1"})
+	suite.cancel()
+	suite.wg.Wait()
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	_, err = restored.Retrieve(suite.ctx, "sURL1")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	URL, err := restored.Retrieve(suite.ctx, "sURL3")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.by", URL)
+}
+
+func (suite *StorageTestSuite) TestOriginalURL() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru/", OriginalURL: "HTTPS://www.Yandex.ru:443/#a", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	err := suite.storage.Compact(suite.ctx)
+	assert.Nil(suite.T(), err)
+	suite.cancel()
+	suite.wg.Wait()
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	URLs, err := restored.RetrieveByUserID(suite.ctx, "user1")
+	assert.Nil(suite.T(), err)
+	assert.ElementsMatch(suite.T(), []modelurl.FullURL{
+		{URL: "https://www.yandex.ru/", OriginalURL: "HTTPS://www.Yandex.ru:443/#a", SURL: "sURL1"},
+		{URL: "https://www.yandex.kz", SURL: "sURL2"},
+	}, URLs)
+	entries, err := restored.List(suite.ctx, "", 1)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "HTTPS://www.Yandex.ru:443/#a", entries[0].OriginalURL)
+}
+
+func (suite *StorageTestSuite) TestPasswordHash() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", PasswordHash: "someHash", UserID: "user1"})
+	suite.cancel()
+	suite.wg.Wait()
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	_, err := restored.Retrieve(suite.ctx, "sURL1")
+	var protectedError *storageErrors.ProtectedError
+	assert.True(suite.T(), errors.As(err, &protectedError))
+	assert.Equal(suite.T(), "https://www.yandex.ru", protectedError.URL)
+	assert.Equal(suite.T(), "someHash", protectedError.PasswordHash)
+	entries, err := restored.List(suite.ctx, "", 1)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "someHash", entries[0].PasswordHash)
+}
+
+func (suite *StorageTestSuite) TestNeedsCompaction() {
+	suite.cfg.FileCompactRatio = 0
+	suite.cfg.FileCompactSize = 1
+	assert.False(suite.T(), suite.storage.needsCompaction())
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	// a log without superseded records is never compacted
+	assert.False(suite.T(), suite.storage.needsCompaction())
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1"}, "user1")
+	assert.True(suite.T(), suite.storage.needsCompaction())
+	_ = suite.storage.Compact(suite.ctx)
+	assert.False(suite.T(), suite.storage.needsCompaction())
+}
+
+func (suite *StorageTestSuite) TestRestoreAfterCrash() {
+	suite.cancel()
+	suite.wg.Wait()
+	// emulate a crash during compaction and during writing the last record
+	_ = os.WriteFile(suite.cfg.FileStoragePath+compactSuffix, []byte(`{"sURL":"sURL2","URL":"https://www.yandex.kz","userID":"user1"}`+"\n"), 0777)
+	_ = os.WriteFile(suite.cfg.FileStoragePath, []byte(`{"sURL":"sURL1","URL":"https://www.yandex.ru","userID":"user1"}`+"\n"+`{"sURL":"sURL3","URL":"https://www.ya`), 0777)
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	_, err := os.Stat(suite.cfg.FileStoragePath + compactSuffix)
+	assert.True(suite.T(), os.IsNotExist(err))
+	URL, err := restored.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+	_, err = restored.Retrieve(suite.ctx, "sURL2")
+	assert.NotNil(suite.T(), err)
+
+	// new records must not be glued to the truncated one
+	_ = restored.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.by", UserID: "user1"})
+	assert.Equal(suite.T(), 2, countLines(suite.T(), suite.cfg.FileStoragePath))
+}
+
+func (suite *StorageTestSuite) TestSendToQueue() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	err := suite.storage.SendToQueue(suite.ctx, modelstorage.URLChannelEntry{SURL: "sURL1", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+	// the deletion is persisted before it is flushed
+	assert.Equal(suite.T(), 1, countLines(suite.T(), suite.cfg.FileStoragePath+outboxSuffix))
+	// an expired request ctx does not keep the deletion from being flushed
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	reqCancel()
+	err = suite.storage.SendToQueue(reqCtx, modelstorage.URLChannelEntry{SURL: "sURL2", UserID: "user1"})
+	assert.Nil(suite.T(), err)
+	suite.cancel()
+	suite.wg.Wait()
+	assert.Equal(suite.T(), 0, countLines(suite.T(), suite.cfg.FileStoragePath+outboxSuffix))
+	_, err = suite.storage.Retrieve(context.Background(), "sURL2")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+}
+
+func (suite *StorageTestSuite) TestReplayOutbox() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	suite.cancel()
+	suite.wg.Wait()
+	// emulate a crash with one deletion done and one still pending
+	_ = os.WriteFile(suite.cfg.FileStoragePath+outboxSuffix, []byte(
+		`{"id":1,"userID":"user1","sURL":"sURL1","jobID":"job1"}`+"\n"+
+			`{"id":2,"userID":"user1","sURL":"sURL2","jobID":"job1"}`+"\n"+
+			`{"id":1,"done":true}`+"\n"), 0777)
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	URL, err := restored.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+	_, err = restored.Retrieve(suite.ctx, "sURL2")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	assert.Equal(suite.T(), 0, countLines(suite.T(), suite.cfg.FileStoragePath+outboxSuffix))
+	// replayed deletions keep reporting to their job
+	job, err := restored.RetrieveDeleteJob(suite.ctx, "job1", "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"sURL2"}, job.Deleted)
+}
+
+func (suite *StorageTestSuite) TestDeleteJob() {
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user2"})
+	for _, sURL := range []string{"sURL1", "sURL2", "sURL3"} {
+		err := suite.storage.SendToQueue(suite.ctx, modelstorage.URLChannelEntry{SURL: sURL, UserID: "user1", JobID: "job1"})
+		assert.Nil(suite.T(), err)
+	}
+	job, err := suite.storage.RetrieveDeleteJob(suite.ctx, "job1", "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), modelurl.DeleteJobPending, job.Status)
+	assert.Equal(suite.T(), []string{"sURL1", "sURL2", "sURL3"}, job.Pending)
+	// jobs of other users are not disclosed
+	_, err = suite.storage.RetrieveDeleteJob(suite.ctx, "job1", "user2")
+	var jobNotFoundError *storageErrors.JobNotFoundError
+	assert.True(suite.T(), errors.As(err, &jobNotFoundError))
+	// pending deletions are flushed upon ctx cancellation
+	suite.cancel()
+	suite.wg.Wait()
+	job, err = suite.storage.RetrieveDeleteJob(context.Background(), "job1", "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), modelurl.DeleteJob{
+		ID:       "job1",
+		Status:   modelurl.DeleteJobDone,
+		Deleted:  []string{"sURL1"},
+		NotOwned: []string{"sURL2"},
+		NotFound: []string{"sURL3"},
+	}, job)
+}
+
+func (suite *StorageTestSuite) TestRestoreBatch() {
+	suite.cfg.RestoreGraceWindow = time.Hour
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user2"})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL1"}, "user1")
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL2"}, "user2")
+	results, err := suite.storage.RestoreBatch(suite.ctx, []string{"sURL1", "sURL2", "sURL3", "sURL1"}, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{
+		modelurl.RestoreOutcomeRestored,
+		modelurl.RestoreOutcomeNotOwned,
+		modelurl.RestoreOutcomeNotFound,
+		modelurl.RestoreOutcomeNotDeleted,
+	}, results)
+	// restores of URLs which were shortened again after deletion conflict with the new entries
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL5", URL: "https://www.yandex.by", UserID: "user1"})
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL5"}, "user1")
+	_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL6", URL: "https://www.yandex.by", UserID: "user1"})
+	results, err = suite.storage.RestoreBatch(suite.ctx, []string{"sURL5"}, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{modelurl.RestoreOutcomeConflict}, results)
+	// restores are allowed within the grace window only
+	suite.cfg.RestoreGraceWindow = 0
+	results, err = suite.storage.RestoreBatch(suite.ctx, []string{"sURL2"}, "user2")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{modelurl.RestoreOutcomeGraceExpired}, results)
+
+	// the restored entry survives restarts under the same sURL
+	suite.cancel()
+	suite.wg.Wait()
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg.Add(1)
+	restored, _ := InitStorage(suite.ctx, suite.wg, suite.cfg)
+	URL, err := restored.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.ru", URL)
+	_, err = restored.Retrieve(suite.ctx, "sURL2")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk is full")
+}
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	n := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,300 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// Check interface implementation explicitly
+var (
+	_ storage.ClickStorage = (*ClickStorage)(nil)
+)
+
+// click events are buffered and written asynchronously in batches
+const (
+	clickQueueSize      = 1024
+	flushClicksAmount   = 100
+	flushClicksInterval = time.Second * 5
+	flushClicksTimeout  = time.Second * 5
+)
+
+// ClickStorage struct defines data structure handling for click events stored in DB.
+type ClickStorage struct {
+	Cfg *config.Config
+	DB  *sql.DB
+	ch  chan modelstorage.ClickEntry
+}
+
+// InitClickStorage initializes a ClickStorage object and starts its batch writer.
+func InitClickStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*ClickStorage, error) {
+	// use a separate connection pool so that URL storage closure does not affect pending clicks
+	db, err := openDB(cfg, cfg.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+	st := ClickStorage{
+		Cfg: cfg,
+		DB:  db,
+		ch:  make(chan modelstorage.ClickEntry, clickQueueSize),
+	}
+	// click tables are created by migrations as well, it is a no-op if URL storage has already applied them
+	_, err = MigrateUp(ctx, st.DB)
+	if err != nil {
+		return nil, err
+	}
+	// start a goroutine for batch writing which closes DB connection upon ctx cancellation
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(flushClicksInterval)
+		defer t.Stop()
+		parts := make([]modelstorage.ClickEntry, 0, flushClicksAmount)
+		for {
+			select {
+			case <-ctx.Done():
+				// collect clicks which were queued prior to cancellation
+				for len(st.ch) > 0 {
+					parts = append(parts, <-st.ch)
+				}
+				if len(parts) > 0 {
+					log.Println("Saving clicks due to context cancellation", len(parts))
+					// ctx is already cancelled, use a detached one for the last flush
+					flushCtx, cancel := context.WithTimeout(context.Background(), flushClicksTimeout)
+					err := st.Flush(flushCtx, parts)
+					cancel()
+					if err != nil {
+						log.Println("Saving clicks:", err)
+					}
+				}
+				err := st.DB.Close()
+				if err != nil {
+					log.Println("Click DB connection closure:", err)
+					return
+				}
+				log.Println("Click DB connection closed successfully")
+				return
+			case <-t.C:
+				if len(parts) > 0 {
+					err := st.Flush(ctx, parts)
+					if err != nil {
+						log.Println("Saving clicks:", err)
+					}
+					parts = make([]modelstorage.ClickEntry, 0, flushClicksAmount)
+				}
+			case part := <-st.ch:
+				parts = append(parts, part)
+				if len(parts) >= flushClicksAmount {
+					err := st.Flush(ctx, parts)
+					if err != nil {
+						log.Println("Saving clicks:", err)
+					}
+					parts = make([]modelstorage.ClickEntry, 0, flushClicksAmount)
+				}
+			}
+		}
+	}()
+	return &st, nil
+}
+
+// SendClick sends a click event to the writing queue without blocking, the event is dropped if the queue is full.
+func (s *ClickStorage) SendClick(item modelstorage.ClickEntry) {
+	select {
+	case s.ch <- item:
+	default:
+		log.Println("Click queue is full, dropping click for", item.SURL)
+	}
+}
+
+// clickRollup defines an upsert into a rollup table and its arguments derived from a click event.
+type clickRollup struct {
+	query string
+	args  func(click modelstorage.ClickEntry, hour, day time.Time) []interface{}
+}
+
+// clickRollups are executed within the raw click event transaction so that rollups never diverge from raw events.
+var clickRollups = []clickRollup{
+	{
+		query: `INSERT INTO clicks_hourly (short_url, bucket, clicks) VALUES ($1, $2, 1)
+			ON CONFLICT (short_url, bucket) DO UPDATE SET clicks = clicks_hourly.clicks + 1`,
+		args: func(click modelstorage.ClickEntry, hour, day time.Time) []interface{} {
+			return []interface{}{click.SURL, hour}
+		},
+	},
+	{
+		query: `INSERT INTO clicks_daily (short_url, day, clicks) VALUES ($1, $2, 1)
+			ON CONFLICT (short_url, day) DO UPDATE SET clicks = clicks_daily.clicks + 1`,
+		args: func(click modelstorage.ClickEntry, hour, day time.Time) []interface{} {
+			return []interface{}{click.SURL, day}
+		},
+	},
+	{
+		query: `INSERT INTO clicks_daily_visitors (short_url, day, visitor) VALUES ($1, $2, $3)
+			ON CONFLICT (short_url, day, visitor) DO NOTHING`,
+		args: func(click modelstorage.ClickEntry, hour, day time.Time) []interface{} {
+			return []interface{}{click.SURL, day, click.VisitorID()}
+		},
+	},
+	{
+		query: `INSERT INTO clicks_daily_referrers (short_url, day, referrer, clicks) VALUES ($1, $2, $3, 1)
+			ON CONFLICT (short_url, day, referrer) DO UPDATE SET clicks = clicks_daily_referrers.clicks + 1`,
+		args: func(click modelstorage.ClickEntry, hour, day time.Time) []interface{} {
+			return []interface{}{click.SURL, day, click.Referrer}
+		},
+	},
+	{
+		query: `INSERT INTO clicks_daily_user_agents (short_url, day, user_agent, clicks) VALUES ($1, $2, $3, 1)
+			ON CONFLICT (short_url, day, user_agent) DO UPDATE SET clicks = clicks_daily_user_agents.clicks + 1`,
+		args: func(click modelstorage.ClickEntry, hour, day time.Time) []interface{} {
+			return []interface{}{click.SURL, day, click.UserAgent}
+		},
+	},
+}
+
+// Flush writes a batch of click events to DB and updates rollup tables within one transaction.
+func (s *ClickStorage) Flush(ctx context.Context, batch []modelstorage.ClickEntry) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	insertStmt, err := tx.PrepareContext(ctx, "INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, client_ip) VALUES ($1, $2, $3, $4, $5)")
+	if err != nil {
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer insertStmt.Close()
+	rollupStmts := make([]*sql.Stmt, 0, len(clickRollups))
+	for _, rollup := range clickRollups {
+		rollupStmt, err := tx.PrepareContext(ctx, rollup.query)
+		if err != nil {
+			return &storageErrors.StatementPSQLError{Err: err}
+		}
+		defer rollupStmt.Close()
+		rollupStmts = append(rollupStmts, rollupStmt)
+	}
+	for _, click := range batch {
+		_, err = insertStmt.ExecContext(ctx, click.SURL, click.ClickedAt, click.Referrer, click.UserAgent, click.ClientIP)
+		if err != nil {
+			return &storageErrors.ExecutionPSQLError{Err: err}
+		}
+		clickedAt := click.ClickedAt.UTC()
+		hour := clickedAt.Truncate(time.Hour)
+		day := time.Date(clickedAt.Year(), clickedAt.Month(), clickedAt.Day(), 0, 0, 0, 0, time.UTC)
+		for i, rollup := range clickRollups {
+			_, err = rollupStmts[i].ExecContext(ctx, rollup.args(click, hour, day)...)
+			if err != nil {
+				return &storageErrors.ExecutionPSQLError{Err: err}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// RetrieveClickStats returns click statistics of sURL for buckets starting within [from, to), it reads rollup
+// tables only so that the cost does not depend on the number of raw click events.
+func (s *ClickStorage) RetrieveClickStats(ctx context.Context, sURL string, from, to time.Time, top int) (stats modelurl.ClickStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.ClickStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var stats modelurl.ClickStats
+		var err error
+		stats.Hourly, err = s.queryBuckets(ctx, "SELECT bucket, clicks FROM clicks_hourly WHERE short_url = $1 AND bucket >= $2 AND bucket < $3 ORDER BY bucket", sURL, from, to)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		for _, bucket := range stats.Hourly {
+			stats.TotalClicks += bucket.Clicks
+		}
+		stats.Daily, err = s.queryBuckets(ctx, "SELECT day::timestamp, clicks FROM clicks_daily WHERE short_url = $1 AND day >= $2::date AND day < $3::date ORDER BY day", sURL, from, to)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		err = s.DB.QueryRowContext(ctx, "SELECT COUNT(DISTINCT visitor) FROM clicks_daily_visitors WHERE short_url = $1 AND day >= $2::date AND day < $3::date", sURL, from, to).Scan(&stats.UniqueVisitors)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		stats.TopReferrers, err = s.queryCounters(ctx, "SELECT referrer, SUM(clicks) AS total FROM clicks_daily_referrers WHERE short_url = $1 AND day >= $2::date AND day < $3::date GROUP BY referrer ORDER BY total DESC, referrer LIMIT $4", sURL, from, to, top)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		stats.TopUserAgents, err = s.queryCounters(ctx, "SELECT user_agent, SUM(clicks) AS total FROM clicks_daily_user_agents WHERE short_url = $1 AND day >= $2::date AND day < $3::date GROUP BY user_agent ORDER BY total DESC, user_agent LIMIT $4", sURL, from, to, top)
+		if err != nil {
+			retrieveError <- err
+			return
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving click stats:", ctx.Err())
+		return modelurl.ClickStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving click stats:", rtrvError.Error())
+		return modelurl.ClickStats{}, rtrvError
+	case stats := <-retrieveDone:
+		log.Println("Retrieving click stats: done for", sURL)
+		return stats, nil
+	}
+}
+
+// queryBuckets runs a query returning (bucket start, clicks) rows.
+func (s *ClickStorage) queryBuckets(ctx context.Context, query string, args ...interface{}) ([]modelurl.ClickBucket, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	var buckets []modelurl.ClickBucket
+	for rows.Next() {
+		var bucket modelurl.ClickBucket
+		err = rows.Scan(&bucket.Start, &bucket.Clicks)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		bucket.Start = bucket.Start.UTC()
+		buckets = append(buckets, bucket)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return buckets, nil
+}
+
+// queryCounters runs a query returning (value, clicks) rows.
+func (s *ClickStorage) queryCounters(ctx context.Context, query string, args ...interface{}) ([]modelurl.ClickCounter, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	var counters []modelurl.ClickCounter
+	for rows.Next() {
+		var counter modelurl.ClickCounter
+		err = rows.Scan(&counter.Value, &counter.Clicks)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		counters = append(counters, counter)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return counters, nil
+}
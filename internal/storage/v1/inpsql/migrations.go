@@ -0,0 +1,251 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+)
+
+// migrationFiles keeps SQL migrations named as <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is a key of the PSQL advisory lock which serializes migrations of concurrent instances.
+const migrationLockKey int64 = 7203214455316045824
+
+// migrationFileName defines a pattern of migration file names.
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration defines one versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState defines a migration along with its application status.
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations returns embedded migrations sorted by version.
+func LoadMigrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		parts := migrationFileName.FindStringSubmatch(file.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("%s: invalid migration file name", file.Name())
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != parts[2] {
+			return nil, fmt.Errorf("%s: migration version %d is used twice", file.Name(), version)
+		}
+		switch parts[3] {
+		case "up":
+			migration.Up = string(body)
+		case "down":
+			migration.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%d_%s: both up and down migrations are required", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// MigrateUp applies all pending migrations and returns the applied ones.
+func MigrateUp(ctx context.Context, db *sql.DB) (applied []Migration, err error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			err = runMigration(ctx, conn, migration.Version, migration.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+			log.Println("Applying migration:", migration.Version, migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown rolls back up to steps latest applied migrations and returns the rolled back ones.
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) (rolledBack []Migration, err error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			err = runMigration(ctx, conn, migration.Version, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = $1;`, migration.Version)
+			if err != nil {
+				return err
+			}
+			log.Println("Rolling back migration:", migration.Version, migration.Name)
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// MigrationStatus returns all known migrations along with their application status.
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var states []MigrationState
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			appliedAt, ok := versions[migration.Version]
+			states = append(states, MigrationState{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	return states, err
+}
+
+// withMigrationLock runs f on a dedicated connection holding the migration advisory lock.
+func withMigrationLock(ctx context.Context, db *sql.DB, f func(conn *sql.Conn) error) error {
+	// advisory locks are bound to a session, hence all statements must share one connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLockKey)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer func() {
+		// use a detached context so that the lock is released even if ctx was cancelled
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockKey)
+		if err != nil {
+			log.Println("Releasing migration lock:", err)
+		}
+	}()
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint primary key,
+		name text not null,
+		applied_at timestamptz not null DEFAULT now()
+	);`)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return f(conn)
+}
+
+// appliedVersions returns versions of applied migrations along with their application time.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		versions[version] = appliedAt
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return versions, nil
+}
+
+// runMigration executes a migration script and updates schema_migrations within one transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, version int64, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.MigrationError{Version: version, Err: err}
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return &storageErrors.MigrationError{Version: version, Err: err}
+	}
+	_, err = tx.ExecContext(ctx, bookkeeping, args...)
+	if err != nil {
+		return &storageErrors.MigrationError{Version: version, Err: err}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return &storageErrors.MigrationError{Version: version, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+-- store user_id as text since we store encoded tokens
+CREATE TABLE IF NOT EXISTS urls (
+	id bigserial not null,
+	user_id text not null,
+	url text not null unique,
+	short_url text not null,
+	is_deleted boolean not null DEFAULT false
+);
+-- sURLs may be chosen by clients, hence they must be unique on the DB level
+CREATE UNIQUE INDEX IF NOT EXISTS urls_short_url_key ON urls (short_url);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS clicks (
+	id bigserial not null,
+	short_url text not null,
+	clicked_at timestamptz not null,
+	referrer text not null DEFAULT '',
+	user_agent text not null DEFAULT '',
+	client_ip text not null DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS clicks_short_url_clicked_at_idx ON clicks (short_url, clicked_at);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS clicks_daily_user_agents;
+DROP TABLE IF EXISTS clicks_daily_referrers;
+DROP TABLE IF EXISTS clicks_daily_visitors;
+DROP TABLE IF EXISTS clicks_daily;
+DROP TABLE IF EXISTS clicks_hourly;
@@ -0,0 +1,34 @@
+-- rollup tables keep pre-aggregated counters so that stats queries over long ranges do not scan raw events,
+-- unique visitors are approximated by a hash of client IP and user agent
+CREATE TABLE IF NOT EXISTS clicks_hourly (
+	short_url text not null,
+	bucket timestamptz not null,
+	clicks bigint not null,
+	PRIMARY KEY (short_url, bucket)
+);
+CREATE TABLE IF NOT EXISTS clicks_daily (
+	short_url text not null,
+	day date not null,
+	clicks bigint not null,
+	PRIMARY KEY (short_url, day)
+);
+CREATE TABLE IF NOT EXISTS clicks_daily_visitors (
+	short_url text not null,
+	day date not null,
+	visitor text not null,
+	PRIMARY KEY (short_url, day, visitor)
+);
+CREATE TABLE IF NOT EXISTS clicks_daily_referrers (
+	short_url text not null,
+	day date not null,
+	referrer text not null,
+	clicks bigint not null,
+	PRIMARY KEY (short_url, day, referrer)
+);
+CREATE TABLE IF NOT EXISTS clicks_daily_user_agents (
+	short_url text not null,
+	day date not null,
+	user_agent text not null,
+	clicks bigint not null,
+	PRIMARY KEY (short_url, day, user_agent)
+);
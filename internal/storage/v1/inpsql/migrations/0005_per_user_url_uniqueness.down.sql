@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS urls_user_id_url_key;
+DROP INDEX IF EXISTS urls_url_global_key;
+ALTER TABLE urls ADD CONSTRAINT urls_url_key UNIQUE (url);
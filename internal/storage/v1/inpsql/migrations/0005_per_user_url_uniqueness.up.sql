@@ -0,0 +1,4 @@
+-- original URLs are deduplicated per user, global deduplication is enforced by an optional index, see DedupScope
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_url_key;
+-- deleted entries do not block shortening the same URL again
+CREATE UNIQUE INDEX IF NOT EXISTS urls_user_id_url_key ON urls (user_id, url) WHERE NOT is_deleted;
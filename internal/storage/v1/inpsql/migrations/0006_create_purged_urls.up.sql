@@ -0,0 +1,14 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+-- the retention period of entries deleted prior to this migration starts now
+UPDATE urls SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE is_deleted;
+-- purged_urls keeps a record of entries hard-deleted by the purge job, purged_at is shared by all entries of one run
+CREATE TABLE IF NOT EXISTS purged_urls (
+	id bigserial not null,
+	user_id text not null,
+	url text not null,
+	short_url text not null,
+	deleted_at timestamptz,
+	purged_at timestamptz not null
+);
+CREATE INDEX IF NOT EXISTS purged_urls_purged_at_idx ON purged_urls (purged_at);
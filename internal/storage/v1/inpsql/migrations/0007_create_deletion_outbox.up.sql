@@ -0,0 +1,9 @@
+-- deletion_outbox keeps accepted deletions until they are flushed so that they survive restarts
+CREATE TABLE IF NOT EXISTS deletion_outbox (
+	id bigserial primary key,
+	user_id text not null,
+	short_url text not null,
+	created_at timestamptz not null DEFAULT now(),
+	done_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS deletion_outbox_pending_idx ON deletion_outbox (id) WHERE done_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS deletion_outbox_job_id_idx;
+ALTER TABLE deletion_outbox DROP COLUMN IF EXISTS error;
+ALTER TABLE deletion_outbox DROP COLUMN IF EXISTS outcome;
+ALTER TABLE deletion_outbox DROP COLUMN IF EXISTS job_id;
@@ -0,0 +1,6 @@
+-- deletion jobs are reported from outbox rows, outcome is set once a row is flushed and error keeps the last
+-- flush failure
+ALTER TABLE deletion_outbox ADD COLUMN IF NOT EXISTS job_id text;
+ALTER TABLE deletion_outbox ADD COLUMN IF NOT EXISTS outcome text;
+ALTER TABLE deletion_outbox ADD COLUMN IF NOT EXISTS error text;
+CREATE INDEX IF NOT EXISTS deletion_outbox_job_id_idx ON deletion_outbox (job_id) WHERE job_id IS NOT NULL;
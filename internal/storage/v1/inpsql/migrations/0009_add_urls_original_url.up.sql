@@ -0,0 +1,2 @@
+-- original_url keeps a URL as it was submitted if it differs from its canonical form kept in url
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS original_url text;
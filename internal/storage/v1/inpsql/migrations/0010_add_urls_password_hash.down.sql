@@ -0,0 +1,13 @@
+-- dropping password_hash would serve protected entries without a password, hence rolling back is refused until
+-- they are removed or unprotected by the operator
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM urls WHERE password_hash IS NOT NULL) THEN
+        RAISE EXCEPTION 'urls holds password-protected entries, remove or unprotect them before rolling back';
+    END IF;
+END
+$$;
+DROP INDEX IF EXISTS urls_url_global_key;
+DROP INDEX IF EXISTS urls_user_id_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_user_id_url_key ON urls (user_id, url) WHERE NOT is_deleted;
+ALTER TABLE urls DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,6 @@
+-- password_hash keeps a bcrypt hash of a password protecting the entry, protected entries are not deduplicated
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash text;
+DROP INDEX IF EXISTS urls_user_id_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_user_id_url_key ON urls (user_id, url) WHERE NOT is_deleted AND password_hash IS NULL;
+-- the global index is created again by the storage with the same predicate, see DedupScope
+DROP INDEX IF EXISTS urls_url_global_key;
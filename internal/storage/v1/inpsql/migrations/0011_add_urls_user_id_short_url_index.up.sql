@@ -0,0 +1,2 @@
+-- urls_user_id_short_url_idx serves paging through URLs of a user in order of sURLs, e.g. for exports
+CREATE INDEX IF NOT EXISTS urls_user_id_short_url_idx ON urls (user_id, short_url) WHERE NOT is_deleted;
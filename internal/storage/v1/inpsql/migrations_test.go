@@ -0,0 +1,22 @@
+package inpsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		// versions must be consecutive so that a gap is noticed before it reaches a DB
+		assert.Equal(t, int64(i+1), migration.Version)
+		assert.NotEmpty(t, migration.Name)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+}
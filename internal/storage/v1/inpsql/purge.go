@@ -0,0 +1,179 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/lib/pq"
+)
+
+// Check interface implementation explicitly
+var (
+	_ storage.Purger  = (*Storage)(nil)
+	_ storage.Remover = (*Storage)(nil)
+)
+
+// purgeLockKey is a key of the PSQL advisory lock which makes only one instance run the purge job at a time.
+const purgeLockKey int64 = 7203214455316045825
+
+// Purge hard-deletes up to limit soft-deleted entries together with their clicks and click rollups and records them
+// in purged_urls within one statement, sURLs of purged entries may be taken again without inheriting their analytics.
+func (s *Storage) Purge(ctx context.Context, deletedBefore, purgedAt time.Time, limit int) (purged int64, err error) {
+	// create channels for listening to the go routine result
+	purgeDone := make(chan int64, 1)
+	purgeError := make(chan error, 1)
+	go func() {
+		res, err := s.DB.ExecContext(ctx, `WITH purged AS (
+			DELETE FROM urls WHERE id IN (
+				SELECT id FROM urls WHERE is_deleted AND deleted_at < $1 ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED
+			) RETURNING user_id, url, short_url, deleted_at
+		),
+		purged_clicks AS (DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM purged)),
+		purged_hourly AS (DELETE FROM clicks_hourly WHERE short_url IN (SELECT short_url FROM purged)),
+		purged_daily AS (DELETE FROM clicks_daily WHERE short_url IN (SELECT short_url FROM purged)),
+		purged_visitors AS (DELETE FROM clicks_daily_visitors WHERE short_url IN (SELECT short_url FROM purged)),
+		purged_referrers AS (DELETE FROM clicks_daily_referrers WHERE short_url IN (SELECT short_url FROM purged)),
+		purged_user_agents AS (DELETE FROM clicks_daily_user_agents WHERE short_url IN (SELECT short_url FROM purged))
+		INSERT INTO purged_urls (user_id, url, short_url, deleted_at, purged_at)
+		SELECT user_id, url, short_url, deleted_at, $3 FROM purged`, deletedBefore, limit, purgedAt)
+		if err != nil {
+			purgeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			purgeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		purgeDone <- n
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Purging URLs:", ctx.Err())
+		return 0, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case prgError := <-purgeError:
+		log.Println("Purging URLs:", prgError.Error())
+		return 0, prgError
+	case n := <-purgeDone:
+		log.Println("Purging URLs:", n, "entries purged")
+		return n, nil
+	}
+}
+
+// RemoveBatch hard-deletes entries with sURLs, unlike Purge removed entries are not recorded in purged_urls since
+// they are expected to be kept elsewhere, e.g. on another shard.
+func (s *Storage) RemoveBatch(ctx context.Context, sURLs []string) (removed int64, err error) {
+	// create channels for listening to the go routine result
+	removeDone := make(chan int64, 1)
+	removeError := make(chan error, 1)
+	go func() {
+		res, err := s.DB.ExecContext(ctx, "DELETE FROM urls WHERE short_url = ANY($1)", pq.Array(sURLs))
+		if err != nil {
+			removeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			removeError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		removeDone <- n
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Removing URLs:", ctx.Err())
+		return 0, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rmvError := <-removeError:
+		log.Println("Removing URLs:", rmvError.Error())
+		return 0, rmvError
+	case n := <-removeDone:
+		log.Println("Removing URLs:", n, "entries removed")
+		return n, nil
+	}
+}
+
+// GetPurgeStats returns counters of entries recorded in purged_urls.
+func (s *Storage) GetPurgeStats(ctx context.Context) (stats modelurl.PurgeStats, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan modelurl.PurgeStats, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		var stats modelurl.PurgeStats
+		var lastPurgeAt sql.NullTime
+		err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*), MAX(purged_at) FROM purged_urls").Scan(&stats.PurgedURLs, &lastPurgeAt)
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if lastPurgeAt.Valid {
+			stats.LastPurgeAt = &lastPurgeAt.Time
+			err = s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM purged_urls WHERE purged_at = $1", lastPurgeAt.Time).Scan(&stats.LastPurgedURLs)
+			if err != nil {
+				retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+		}
+		retrieveDone <- stats
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving purge stats:", ctx.Err())
+		return modelurl.PurgeStats{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving purge stats:", rtrvError.Error())
+		return modelurl.PurgeStats{}, rtrvError
+	case stats := <-retrieveDone:
+		log.Println("Retrieving purge stats: done")
+		return stats, nil
+	}
+}
+
+// runPurge purges entries deleted more than Cfg.PurgeRetention ago batch by batch, the run is skipped if another
+// instance holds the purge advisory lock.
+func (s *Storage) runPurge(ctx context.Context) (purged int64, err error) {
+	// advisory locks are bound to a session, hence the lock is held on a dedicated connection
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer conn.Close()
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1);`, purgeLockKey).Scan(&locked)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	if !locked {
+		log.Println("Purging URLs: skipped, another instance is purging")
+		return 0, nil
+	}
+	defer func() {
+		// use a detached context so that the lock is released even if ctx was cancelled
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, purgeLockKey)
+		if err != nil {
+			log.Println("Releasing purge lock:", err)
+		}
+	}()
+	purgedAt := time.Now()
+	deletedBefore := purgedAt.Add(-s.Cfg.PurgeRetention)
+	for {
+		n, err := s.Purge(ctx, deletedBefore, purgedAt, s.Cfg.PurgeBatchSize)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+		if n < int64(s.Cfg.PurgeBatchSize) {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+)
+
+// replicaCheckTimeout limits one health check of a replica.
+const replicaCheckTimeout = time.Second
+
+// replica is a read-only DB serving lookups while it is healthy.
+type replica struct {
+	index int
+	db    *sql.DB
+	// stmts are prepared by the first successful health check and are set before healthy is
+	stmts   *readStatements
+	healthy int32
+}
+
+// isHealthy reports whether r passed its last health check and did not fail since.
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// setHealthy records a health state of r and reports whether it has changed.
+func (r *replica) setHealthy(healthy bool) bool {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	return atomic.SwapInt32(&r.healthy, v) != v
+}
+
+// replicaSet routes lookups to healthy replicas in turn and keeps users and sURLs which were recently written
+// sticky to the primary so that writers read their own writes. Stickiness is kept in memory of one instance.
+type replicaSet struct {
+	replicas   []*replica
+	next       uint32
+	stickiness time.Duration
+	mu         sync.Mutex
+	users      map[string]time.Time
+	sURLs      map[string]time.Time
+}
+
+// openReplicas opens connection pools to replicas given by cfg.DatabaseReplicas, replicas are unhealthy until
+// checked.
+func openReplicas(cfg *config.Config) (*replicaSet, error) {
+	rs := &replicaSet{
+		stickiness: cfg.ReplicaStickiness,
+		users:      make(map[string]time.Time),
+		sURLs:      make(map[string]time.Time),
+	}
+	for i, dsn := range cfg.DatabaseReplicas {
+		db, err := openDB(cfg, dsn)
+		if err != nil {
+			rs.close()
+			return nil, err
+		}
+		rs.replicas = append(rs.replicas, &replica{index: i, db: db})
+	}
+	return rs, nil
+}
+
+// pick returns the next healthy replica or nil if there is none.
+func (rs *replicaSet) pick() *replica {
+	n := len(rs.replicas)
+	start := int(atomic.AddUint32(&rs.next, 1))
+	for i := 0; i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		if r.isHealthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+// stick routes lookups of userID and sURLs to the primary for the stickiness period.
+func (rs *replicaSet) stick(userID string, sURLs ...string) {
+	if len(rs.replicas) == 0 || rs.stickiness <= 0 {
+		return
+	}
+	until := time.Now().Add(rs.stickiness)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if userID != "" {
+		rs.users[userID] = until
+	}
+	for _, sURL := range sURLs {
+		rs.sURLs[sURL] = until
+	}
+}
+
+// isStickyUser reports whether lookups of userID must be served by the primary.
+func (rs *replicaSet) isStickyUser(userID string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	until, ok := rs.users[userID]
+	return ok && time.Now().Before(until)
+}
+
+// isStickySURL reports whether lookups of sURL must be served by the primary.
+func (rs *replicaSet) isStickySURL(sURL string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	until, ok := rs.sURLs[sURL]
+	return ok && time.Now().Before(until)
+}
+
+// sweep forgets stickiness which is over.
+func (rs *replicaSet) sweep(now time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for userID, until := range rs.users {
+		if !now.Before(until) {
+			delete(rs.users, userID)
+		}
+	}
+	for sURL, until := range rs.sURLs {
+		if !now.Before(until) {
+			delete(rs.sURLs, sURL)
+		}
+	}
+}
+
+// check pings every replica and prepares lookups on replicas which have not had them prepared yet.
+func (rs *replicaSet) check(ctx context.Context) {
+	for _, r := range rs.replicas {
+		err := rs.checkOne(ctx, r)
+		if r.setHealthy(err == nil) {
+			switch err {
+			case nil:
+				log.Println("Checking replica:", r.index, "is up")
+			default:
+				log.Println("Checking replica:", r.index, "is down:", err)
+			}
+		}
+	}
+}
+
+// checkOne checks replica r.
+func (rs *replicaSet) checkOne(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+	err := r.db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+	if r.stmts == nil {
+		r.stmts, err = prepareReadStatements(ctx, r.db)
+	}
+	return err
+}
+
+// failover reports whether a lookup which failed on replica r with err must be retried on the primary. Lookup
+// outcomes are results rather than failures of r: missing and deleted entries are looked up on the primary again
+// since the replica may lag behind a recent write or restore, expired and protected entries are final. r is marked
+// as unhealthy until its next check on any other error.
+func (rs *replicaSet) failover(ctx context.Context, r *replica, err error) bool {
+	var notFoundError *storageErrors.NotFoundError
+	var deletedError *storageErrors.DeletedError
+	var expiredError *storageErrors.ExpiredError
+	var protectedError *storageErrors.ProtectedError
+	switch {
+	case err == nil || ctx.Err() != nil:
+		return false
+	case errors.As(err, &notFoundError) || errors.As(err, &deletedError):
+		return true
+	case errors.As(err, &expiredError) || errors.As(err, &protectedError):
+		return false
+	}
+	if r.setHealthy(false) {
+		log.Println("Checking replica:", r.index, "is down:", err)
+	}
+	return true
+}
+
+// close closes connection pools of all replicas.
+func (rs *replicaSet) close() {
+	for _, r := range rs.replicas {
+		if r.stmts != nil {
+			r.stmts.close()
+		}
+		err := r.db.Close()
+		if err != nil {
+			log.Println("Closing replica:", r.index, err)
+		}
+	}
+}
+
+// reader returns lookups of a healthy replica unless sticky is set and lookups of the primary otherwise, r is
+// nil for the primary.
+func (s *Storage) reader(sticky bool) (stmts *readStatements, r *replica) {
+	if !sticky {
+		r = s.replicas.pick()
+	}
+	if r == nil {
+		return &s.stmts.readStatements, nil
+	}
+	return r.stmts, r
+}
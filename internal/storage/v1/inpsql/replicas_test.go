@@ -0,0 +1,104 @@
+package inpsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestReplicas makes a replicaSet of n healthy replicas without connections.
+func newTestReplicas(n int, stickiness time.Duration) *replicaSet {
+	cfg := config.NewDefaultConfiguration()
+	cfg.ReplicaStickiness = stickiness
+	rs, _ := openReplicas(cfg)
+	for i := 0; i < n; i++ {
+		r := &replica{index: i, stmts: &readStatements{}}
+		r.setHealthy(true)
+		rs.replicas = append(rs.replicas, r)
+	}
+	return rs
+}
+
+// Tests
+
+func TestReplicaSet_Pick(t *testing.T) {
+	rs := newTestReplicas(2, 0)
+	first, second := rs.pick(), rs.pick()
+	assert.NotNil(t, first)
+	assert.NotNil(t, second)
+	assert.NotEqual(t, first.index, second.index)
+
+	rs.replicas[0].setHealthy(false)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 1, rs.pick().index)
+	}
+	rs.replicas[1].setHealthy(false)
+	assert.Nil(t, rs.pick())
+}
+
+func TestReplicaSet_Stick(t *testing.T) {
+	rs := newTestReplicas(1, time.Minute)
+	rs.stick("user1", "sURL1", "sURL2")
+	assert.True(t, rs.isStickyUser("user1"))
+	assert.True(t, rs.isStickySURL("sURL2"))
+	assert.False(t, rs.isStickyUser("user2"))
+	assert.False(t, rs.isStickySURL("sURL3"))
+
+	rs.sweep(time.Now().Add(time.Hour))
+	assert.False(t, rs.isStickyUser("user1"))
+	assert.Empty(t, rs.users)
+	assert.Empty(t, rs.sURLs)
+
+	// stickiness is not tracked without replicas
+	rs = newTestReplicas(0, time.Minute)
+	rs.stick("user1", "sURL1")
+	assert.False(t, rs.isStickyUser("user1"))
+}
+
+func TestReplicaSet_Failover(t *testing.T) {
+	rs := newTestReplicas(1, 0)
+	r := rs.replicas[0]
+	ctx := context.Background()
+	assert.False(t, rs.failover(ctx, r, nil))
+
+	// a missing entry is looked up on the primary without marking the replica down
+	assert.True(t, rs.failover(ctx, r, &storageErrors.NotFoundError{SURL: "sURL1"}))
+	assert.True(t, r.isHealthy())
+
+	// a deleted entry is looked up on the primary in case it was restored, the replica is kept up
+	assert.True(t, rs.failover(ctx, r, &storageErrors.DeletedError{SURL: "sURL1"}))
+	assert.True(t, r.isHealthy())
+
+	// expired and protected entries are final results
+	assert.False(t, rs.failover(ctx, r, &storageErrors.ExpiredError{SURL: "sURL1"}))
+	assert.True(t, r.isHealthy())
+	assert.False(t, rs.failover(ctx, r, &storageErrors.ProtectedError{SURL: "sURL1", URL: "https://www.yandex.ru"}))
+	assert.True(t, r.isHealthy())
+
+	assert.True(t, rs.failover(ctx, r, errors.New("connection refused")))
+	assert.False(t, r.isHealthy())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, rs.failover(cancelled, r, cancelled.Err()))
+}
+
+func TestStorage_Reader(t *testing.T) {
+	st := &Storage{stmts: &statements{}, replicas: newTestReplicas(1, 0)}
+	stmts, r := st.reader(false)
+	assert.NotNil(t, r)
+	assert.Same(t, st.replicas.replicas[0].stmts, stmts)
+
+	stmts, r = st.reader(true)
+	assert.Nil(t, r)
+	assert.Same(t, &st.stmts.readStatements, stmts)
+
+	st.replicas.replicas[0].setHealthy(false)
+	_, r = st.reader(false)
+	assert.Nil(t, r)
+}
@@ -0,0 +1,140 @@
+package inpsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+)
+
+// readStatements holds lookups which may be served by read replicas.
+type readStatements struct {
+	countURLs        *sql.Stmt
+	countUsers       *sql.Stmt
+	retrieve         *sql.Stmt
+	retrieveByUserID *sql.Stmt
+	listByUserID     *sql.Stmt
+	isOwner          *sql.Stmt
+}
+
+// statements holds queries prepared once at initialization, database/sql prepares them on each pooled
+// connection lazily and statements are safe for concurrent use.
+type statements struct {
+	readStatements
+	userIDs          *sql.Stmt
+	dump             *sql.Stmt
+	selectOwner      *sql.Stmt
+	list             *sql.Stmt
+	deleteBatch      *sql.Stmt
+	deleteExpired    *sql.Stmt
+	outboxAdd        *sql.Stmt
+	outboxDone       *sql.Stmt
+	outboxPending    *sql.Stmt
+	outboxFail       *sql.Stmt
+	selectOwners     *sql.Stmt
+	deleteJob        *sql.Stmt
+	selectRestorable *sql.Stmt
+	restore          *sql.Stmt
+}
+
+// query defines a statement to be prepared.
+type query struct {
+	stmt  **sql.Stmt
+	query string
+}
+
+// readQueries returns lookups of stmts which may be served by read replicas.
+func readQueries(stmts *readStatements) []query {
+	return []query{
+		{&stmts.countURLs, "SELECT COUNT(DISTINCT short_url) FROM urls"},
+		{&stmts.countUsers, "SELECT COUNT(DISTINCT user_id) FROM urls"},
+		{&stmts.retrieve, "SELECT id, user_id, url, short_url, is_deleted, expires_at, password_hash FROM urls WHERE short_url = $1"},
+		{&stmts.retrieveByUserID, "SELECT id, user_id, url, original_url, short_url, is_deleted, expires_at FROM urls WHERE user_id = $1 AND is_deleted = false"},
+		{&stmts.listByUserID, "SELECT id, user_id, url, original_url, short_url, is_deleted, expires_at FROM urls WHERE user_id = $1 AND is_deleted = false AND short_url > $2 ORDER BY short_url LIMIT $3"},
+		{&stmts.isOwner, "SELECT EXISTS (SELECT 1 FROM urls WHERE user_id = $1 AND short_url = $2 AND is_deleted = false)"},
+	}
+}
+
+// prepare prepares queries on db, prepared statements are closed by the caller on failure.
+func prepare(ctx context.Context, db *sql.DB, queries []query) error {
+	for _, q := range queries {
+		stmt, err := db.PrepareContext(ctx, q.query)
+		if err != nil {
+			return &storageErrors.StatementPSQLError{Err: err}
+		}
+		*q.stmt = stmt
+	}
+	return nil
+}
+
+// prepareReadStatements prepares lookups on a read replica.
+func prepareReadStatements(ctx context.Context, db *sql.DB) (*readStatements, error) {
+	var stmts readStatements
+	err := prepare(ctx, db, readQueries(&stmts))
+	if err != nil {
+		stmts.close()
+		return nil, err
+	}
+	return &stmts, nil
+}
+
+// prepareStatements prepares all queries of Storage, the schema must be up to date.
+func prepareStatements(ctx context.Context, db *sql.DB) (*statements, error) {
+	var stmts statements
+	queries := append(readQueries(&stmts.readStatements), []query{
+		{&stmts.userIDs, "SELECT DISTINCT user_id FROM urls"},
+		{&stmts.dump, "INSERT INTO urls (user_id, url, short_url, expires_at, original_url, password_hash) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))"},
+		// the caller's own entry takes precedence if there are several of them, expired ones are about to be released
+		{&stmts.selectOwner, "SELECT short_url, user_id FROM urls WHERE url = $1 AND NOT is_deleted AND password_hash IS NULL AND (expires_at IS NULL OR expires_at > now()) ORDER BY user_id = $2 DESC LIMIT 1"},
+		{&stmts.list, "SELECT user_id, url, original_url, password_hash, short_url, is_deleted, expires_at FROM urls WHERE short_url > $1 ORDER BY short_url LIMIT $2"},
+		{&stmts.deleteBatch, "UPDATE urls SET is_deleted = true, deleted_at = now() WHERE user_id = $1 AND short_url = ANY($2) AND NOT is_deleted"},
+		{&stmts.deleteExpired, "UPDATE urls SET is_deleted = true, deleted_at = now() WHERE is_deleted = false AND expires_at <= now()"},
+		{&stmts.outboxAdd, "INSERT INTO deletion_outbox (user_id, short_url, job_id) VALUES ($1, $2, NULLIF($3, '')) RETURNING id"},
+		{&stmts.outboxDone, "UPDATE deletion_outbox AS o SET done_at = now(), outcome = d.outcome, error = NULL FROM unnest($1::bigint[], $2::text[]) AS d(id, outcome) WHERE o.id = d.id AND o.done_at IS NULL"},
+		{&stmts.outboxPending, "SELECT id, user_id, short_url, COALESCE(job_id, '') FROM deletion_outbox WHERE done_at IS NULL ORDER BY id"},
+		{&stmts.outboxFail, "UPDATE deletion_outbox SET error = $2 WHERE id = ANY($1) AND done_at IS NULL"},
+		{&stmts.selectOwners, "SELECT short_url, user_id FROM urls WHERE short_url = ANY($1)"},
+		{&stmts.selectRestorable, "SELECT short_url, user_id, url, is_deleted, expires_at, deleted_at FROM urls WHERE short_url = ANY($1)"},
+		{&stmts.restore, "UPDATE urls SET is_deleted = false, deleted_at = NULL WHERE short_url = $1 AND user_id = $2 AND is_deleted AND deleted_at > $3"},
+		{&stmts.deleteJob, "SELECT short_url, COALESCE(outcome, ''), COALESCE(error, '') FROM deletion_outbox WHERE job_id = $1 AND user_id = $2 ORDER BY id"},
+	}...)
+	err := prepare(ctx, db, queries)
+	if err != nil {
+		stmts.close()
+		return nil, err
+	}
+	return &stmts, nil
+}
+
+// close closes all prepared lookups, it is safe to call on partially prepared statements.
+func (s *readStatements) close() {
+	for _, stmt := range []*sql.Stmt{s.countURLs, s.countUsers, s.retrieve, s.retrieveByUserID, s.listByUserID, s.isOwner} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
+}
+
+// close closes all prepared statements, it is safe to call on partially prepared statements.
+func (s *statements) close() {
+	s.readStatements.close()
+	for _, stmt := range []*sql.Stmt{s.userIDs, s.dump, s.selectOwner, s.list, s.deleteBatch, s.deleteExpired, s.outboxAdd, s.outboxDone, s.outboxPending, s.outboxFail, s.selectOwners, s.deleteJob, s.selectRestorable, s.restore} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
+}
+
+// openDB opens a connection pool to a DB given by dsn and configured by cfg.
+func openDB(cfg *config.Config, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+	return db, nil
+}
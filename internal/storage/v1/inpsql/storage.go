@@ -5,7 +5,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
 	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/jobs"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
@@ -20,8 +23,18 @@ import (
 	"github.com/lib/pq"
 )
 
-// Flush flushes URL entries from buffer and sends them for deletion.
+// Flush flushes URL entries from buffer, sends them for deletion and marks them as done in the outbox along with
+// their outcomes, the whole batch is kept in the outbox for replaying if any deletion fails.
 func (s *Storage) Flush(ctx context.Context, batch []modelstorage.URLChannelEntry) error {
+	outboxIDs := make([]int64, 0, len(batch))
+	for _, b := range batch {
+		outboxIDs = append(outboxIDs, b.OutboxID)
+	}
+	outcomes, err := s.classify(ctx, batch)
+	if err != nil {
+		s.failOutbox(ctx, outboxIDs, err)
+		return err
+	}
 	uniqueMap := make(map[string][]string)
 	for _, b := range batch {
 		if _, exist := uniqueMap[b.UserID]; !exist {
@@ -32,29 +45,97 @@ func (s *Storage) Flush(ctx context.Context, batch []modelstorage.URLChannelEntr
 	}
 	for userID, sURLs := range uniqueMap {
 		err := s.DeleteBatch(ctx, sURLs, userID)
+		// a failed batch may be deleted in part, hence observers are notified regardless
+		s.deletes.Notify(sURLs)
 		if err != nil {
+			s.failOutbox(ctx, outboxIDs, err)
 			return err
 		}
 	}
+	_, err = s.stmts.outboxDone.ExecContext(ctx, pq.Array(outboxIDs), pq.Array(outcomes))
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
 	return nil
 }
 
+// ObserveDeletes registers fn to be called with sURLs once their queued deletion is flushed.
+func (s *Storage) ObserveDeletes(fn func(sURLs []string)) {
+	s.deletes.Add(fn)
+}
+
+// classify returns outcomes of deleting batch items, outcomes[i] corresponds to batch[i].
+func (s *Storage) classify(ctx context.Context, batch []modelstorage.URLChannelEntry) ([]string, error) {
+	sURLs := make([]string, 0, len(batch))
+	for _, b := range batch {
+		sURLs = append(sURLs, b.SURL)
+	}
+	rows, err := s.stmts.selectOwners.QueryContext(ctx, pq.Array(sURLs))
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	owners := make(map[string]string)
+	for rows.Next() {
+		var sURL, userID string
+		err = rows.Scan(&sURL, &userID)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		owners[sURL] = userID
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	outcomes := make([]string, len(batch))
+	for i, b := range batch {
+		ownerID, ok := owners[b.SURL]
+		outcomes[i] = jobs.Outcome(ok, ownerID, b.UserID)
+	}
+	return outcomes, nil
+}
+
+// failOutbox records a flush failure for outbox entries, it is reported by their deletion jobs.
+func (s *Storage) failOutbox(ctx context.Context, outboxIDs []int64, flushErr error) {
+	// ctx may be the reason of the failure, use a detached one for recording it
+	failCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.stmts.outboxFail.ExecContext(failCtx, pq.Array(outboxIDs), flushErr.Error())
+	if err != nil {
+		log.Println("Recording deletion failure:", err)
+	}
+}
+
 // Check interface implementation explicitly
 var (
-	_ storage.URLStorage = (*Storage)(nil)
+	_ storage.URLStorage        = (*Storage)(nil)
+	_ storage.UserLister        = (*Storage)(nil)
+	_ storage.DeleteObserver    = (*Storage)(nil)
+	_ storage.DuplicateChecker  = (*Storage)(nil)
+	_ storage.ExpiringURLGetter = (*Storage)(nil)
+	_ storage.OwnerChecker      = (*Storage)(nil)
 )
 
 // Storage struct defines data structure handling and provides support for adding new implementations.
 type Storage struct {
-	mu  sync.Mutex
-	Cfg *config.Config
-	DB  *sql.DB
-	ch  chan modelstorage.URLChannelEntry
+	Cfg   *config.Config
+	DB    *sql.DB
+	ch    chan modelstorage.URLChannelEntry
+	stmts *statements
+	// replicas serve lookups while they are healthy
+	replicas *replicaSet
+	// done is closed once the deletion flusher stops, deletes are notified of flushed deletions
+	done    chan struct{}
+	deletes storage.DeleteObservers
+	// deferred keeps outbox items which the flusher was too busy to accept in time, they are picked up on its next tick
+	deferredMu sync.Mutex
+	deferred   []modelstorage.URLChannelEntry
 }
 
 // InitStorage initializes a Storage object and sets its attributes.
 func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*Storage, error) {
-	db, err := sql.Open("pgx", cfg.DatabaseDSN)
+	db, err := openDB(cfg, cfg.DatabaseDSN)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -62,33 +143,61 @@ func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*
 	recordCh := make(chan modelstorage.URLChannelEntry)
 	// initialize a Storage
 	st := Storage{
-		Cfg: cfg,
-		DB:  db,
-		ch:  recordCh,
+		Cfg:  cfg,
+		DB:   db,
+		ch:   recordCh,
+		done: make(chan struct{}),
 	}
 	const flushPartsAmount = 10
 	const flushPartsInterval = time.Second * 10
+	const flushTimeout = time.Second * 5
+	const reapExpiredInterval = time.Minute
 
-	err = st.createTable(ctx)
+	// bring DB schema up to date, concurrent instances are serialized by an advisory lock
+	_, err = MigrateUp(ctx, st.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = st.applyDedupScope(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
+	st.stmts, err = prepareStatements(ctx, st.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.replicas, err = openReplicas(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.replicas.check(ctx)
+	// replay deletions which were accepted but not flushed prior to the last shutdown
+	err = st.replayOutbox(ctx)
+	if err != nil {
+		log.Println("Deleting URLs:", err)
+	}
+	// failed flushes are not fatal since their deletions are kept in the outbox and replayed on the next start
 	go func() {
 		defer wg.Done()
+		defer close(st.done)
 		t := time.NewTicker(flushPartsInterval)
 		parts := make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
 		for {
 			select {
 			case <-ctx.Done():
+				parts = append(parts, st.takeDeferred()...)
 				if len(parts) > 0 {
 					log.Println("Deleting URLs due to context cancellation", parts)
-					err := st.Flush(ctx, parts)
+					// ctx is already cancelled, use a detached one for the last flush
+					flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+					err := st.Flush(flushCtx, parts)
+					cancel()
 					if err != nil {
-						log.Fatal(err)
+						log.Println("Deleting URLs:", err)
 					}
 				}
-				close(st.ch)
 				//buf.CtxCancelFunc()
+				st.stmts.close()
 				err := st.DB.Close()
 				if err != nil {
 					log.Fatal(err)
@@ -96,68 +205,228 @@ func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*
 				log.Println("PSQL DB connection closed successfully")
 				return
 			case <-t.C:
+				parts = append(parts, st.takeDeferred()...)
 				if len(parts) > 0 {
 					log.Println("Deleting URLs due to timeout", parts)
 					err := st.Flush(ctx, parts)
 					if err != nil {
-						log.Fatal(err)
+						log.Println("Deleting URLs:", err)
 					}
 					parts = make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
 				}
-			case part, ok := <-st.ch:
-				if !ok {
-					return
-				}
+			case part := <-st.ch:
 				parts = append(parts, part)
 				if len(parts) >= flushPartsAmount {
 					log.Println("Deleting URLs due to exceeding capacity", parts)
 					err := st.Flush(ctx, parts)
 					if err != nil {
-						log.Fatal(err)
+						log.Println("Deleting URLs:", err)
 					}
 					parts = make([]modelstorage.URLChannelEntry, 0, flushPartsAmount)
 				}
 			}
 		}
 	}()
+	// start a goroutine for periodic health checks of replicas which closes their connections upon ctx
+	// cancellation
+	if len(st.replicas.replicas) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer st.replicas.close()
+			t := time.NewTicker(cfg.ReplicaCheckPeriod)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-t.C:
+					st.replicas.check(ctx)
+					st.replicas.sweep(now)
+				}
+			}
+		}()
+	}
+	// start a goroutine for periodic soft deletion of expired entries, it shares the ctx/wg lifecycle
+	// of the deletion flusher above
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(reapExpiredInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				n, err := st.DeleteExpired(ctx)
+				if err != nil {
+					log.Println("Deleting expired URLs:", err)
+					continue
+				}
+				if n > 0 {
+					log.Println("Deleting expired URLs:", n, "entries were deleted")
+				}
+			}
+		}
+	}()
+	// start a goroutine for periodic hard deletion of entries whose retention period is over, it is disabled
+	// by non-positive purge settings
+	if cfg.PurgeRetention > 0 && cfg.PurgeInterval > 0 && cfg.PurgeBatchSize > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTicker(cfg.PurgeInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					n, err := st.runPurge(ctx)
+					if err != nil {
+						log.Println("Purging URLs:", err)
+						continue
+					}
+					if n > 0 {
+						log.Println("Purging URLs:", n, "entries were purged in total")
+					}
+				}
+			}
+		}()
+	}
 	return &st, nil
 }
 
-// SendToQueue sends a modelstorage.URLChannelEntry batch of sURLs from one userID to the deletion task queue.
-func (s *Storage) SendToQueue(item modelstorage.URLChannelEntry) {
-	s.ch <- item
+// SendToQueue persists a modelstorage.URLChannelEntry to the outbox and sends it to the deletion task queue.
+func (s *Storage) SendToQueue(ctx context.Context, item modelstorage.URLChannelEntry) error {
+	err := s.stmts.outboxAdd.QueryRowContext(ctx, item.UserID, item.SURL, item.JobID).Scan(&item.OutboxID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	// item is durable from now on, it is deferred to the next flusher tick if ctx expires while the flusher is busy
+	// and replayed on the next start if the flusher is stopped
+	select {
+	case s.ch <- item:
+	case <-s.done:
+	case <-ctx.Done():
+		s.deferredMu.Lock()
+		s.deferred = append(s.deferred, item)
+		s.deferredMu.Unlock()
+	}
+	return nil
+}
+
+// takeDeferred returns and clears items deferred by SendToQueue.
+func (s *Storage) takeDeferred() []modelstorage.URLChannelEntry {
+	s.deferredMu.Lock()
+	defer s.deferredMu.Unlock()
+	items := s.deferred
+	s.deferred = nil
+	return items
 }
 
-func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error) {
-	// prepare query statement
-	countStmtURLs, err := s.DB.PrepareContext(ctx, "SELECT COUNT(DISTINCT short_url) FROM urls")
+// replayOutbox flushes deletions which are still pending in the outbox.
+func (s *Storage) replayOutbox(ctx context.Context) error {
+	rows, err := s.stmts.outboxPending.QueryContext(ctx)
 	if err != nil {
-		return 0, 0, &storageErrors.StatementPSQLError{Err: err}
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	var queued []modelstorage.URLChannelEntry
+	for rows.Next() {
+		var item modelstorage.URLChannelEntry
+		err = rows.Scan(&item.OutboxID, &item.UserID, &item.SURL, &item.JobID)
+		if err != nil {
+			rows.Close()
+			return &storageErrors.ScanningPSQLError{Err: err}
+		}
+		queued = append(queued, item)
 	}
-	countStmtUsers, err := s.DB.PrepareContext(ctx, "SELECT COUNT(DISTINCT user_id) FROM urls")
+	err = rows.Err()
+	rows.Close()
 	if err != nil {
-		return 0, 0, &storageErrors.StatementPSQLError{Err: err}
+		return &storageErrors.ScanningPSQLError{Err: err}
 	}
+	if len(queued) == 0 {
+		return nil
+	}
+	log.Println("Deleting URLs due to replaying outbox", queued)
+	return s.Flush(ctx, queued)
+}
 
+// RetrieveDeleteJob reports outcomes of a deletion job from its outbox entries.
+func (s *Storage) RetrieveDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error) {
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan []int64, 1)
-	retrieveError := make(chan error)
+	retrieveDone := make(chan modelurl.DeleteJob, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		var countURLs int64
-		var countUsers int64
-		err := countStmtURLs.QueryRowContext(ctx).Scan(&countURLs)
+		rows, err := s.stmts.deleteJob.QueryContext(ctx, jobID, userID)
 		if err != nil {
 			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
 			return
 		}
-		err = countStmtUsers.QueryRowContext(ctx).Scan(&countUsers)
+		defer rows.Close()
+		job := modelurl.DeleteJob{ID: jobID}
+		found := false
+		for rows.Next() {
+			var sURL, outcome, flushError string
+			err = rows.Scan(&sURL, &outcome, &flushError)
+			if err != nil {
+				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			found = true
+			job.Add(sURL, outcome)
+			if outcome == "" && flushError != "" {
+				job.Error = flushError
+			}
+		}
+		err = rows.Err()
 		if err != nil {
-			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		if !found {
+			retrieveError <- &storageErrors.JobNotFoundError{Err: nil, JobID: jobID}
+			return
+		}
+		job.Resolve()
+		retrieveDone <- job
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving deletion job:", ctx.Err())
+		return modelurl.DeleteJob{}, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving deletion job:", rtrvError.Error())
+		return modelurl.DeleteJob{}, rtrvError
+	case job := <-retrieveDone:
+		log.Println("Retrieving deletion job:", jobID, "is", job.Status)
+		return job, nil
+	}
+}
+
+// GetStats counts entries and users, it is served by a healthy replica if there is one.
+func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []int64, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		stmts, r := s.reader(false)
+		stats, err := getStats(ctx, stmts)
+		if r != nil && s.replicas.failover(ctx, r, err) {
+			stats, err = getStats(ctx, &s.stmts.readStatements)
+		}
+		if err != nil {
+			retrieveError <- err
 			return
 		}
-		retrieveDone <- []int64{countURLs, countUsers}
+		retrieveDone <- stats
 	}()
 
 	// wait for the first channel to retrieve a value
@@ -174,148 +443,327 @@ func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error)
 	}
 }
 
-// Retrieve returns a URL corresponding to sURL.
-func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
-	// prepare query statement
-	selectStmt, err := s.DB.PrepareContext(ctx, "SELECT * FROM urls WHERE short_url = $1")
+// getStats counts entries and users using stmts.
+func getStats(ctx context.Context, stmts *readStatements) ([]int64, error) {
+	var countURLs int64
+	var countUsers int64
+	err := stmts.countURLs.QueryRowContext(ctx).Scan(&countURLs)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	err = stmts.countUsers.QueryRowContext(ctx).Scan(&countUsers)
 	if err != nil {
-		return "", &storageErrors.StatementPSQLError{Err: err}
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
 	}
-	defer selectStmt.Close()
+	return []int64{countURLs, countUsers}, nil
+}
 
+// ListUserIDs returns distinct IDs of users who own entries.
+func (s *Storage) ListUserIDs(ctx context.Context) (userIDs []string, err error) {
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan string)
-	retrieveError := make(chan error)
+	retrieveDone := make(chan []string, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		var queryOutput modelstorage.URLPostgresEntry
-		err := selectStmt.QueryRowContext(ctx, sURL).Scan(&queryOutput.ID, &queryOutput.UserID, &queryOutput.URL, &queryOutput.SURL, &queryOutput.IsDeleted)
+		rows, err := s.stmts.userIDs.QueryContext(ctx)
 		if err != nil {
-			switch {
-			case errors.Is(err, sql.ErrNoRows):
-				retrieveError <- &storageErrors.NotFoundError{Err: err, SURL: sURL}
-				return
-			default:
-				retrieveError <- err
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		var IDs []string
+		for rows.Next() {
+			var userID string
+			err = rows.Scan(&userID)
+			if err != nil {
+				retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
 				return
 			}
+			IDs = append(IDs, userID)
+		}
+		err = rows.Err()
+		if err != nil {
+			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		retrieveDone <- IDs
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing users:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Listing users:", rtrvError.Error())
+		return nil, rtrvError
+	case IDs := <-retrieveDone:
+		log.Println("Listing users: done")
+		return IDs, nil
+	}
+}
+
+// Retrieve returns a URL corresponding to sURL, it is served by a healthy replica unless sURL was written
+// recently and falls back to the primary if the replica fails or misses sURL.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+	URL, _, err = s.RetrieveWithExpiry(ctx, sURL)
+	return URL, err
+}
+
+// RetrieveWithExpiry returns a URL corresponding to sURL along with its expiration time, it is served the way
+// Retrieve is.
+func (s *Storage) RetrieveWithExpiry(ctx context.Context, sURL string) (URL string, expiresAt *time.Time, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan string, 1)
+	retrieveError := make(chan error, 1)
+	// entryExpiresAt is set before a result is sent
+	var entryExpiresAt *time.Time
+	go func() {
+		stmts, r := s.reader(s.replicas.isStickySURL(sURL))
+		URL, expiresAt, err := retrieve(ctx, stmts, sURL)
+		if r != nil && s.replicas.failover(ctx, r, err) {
+			URL, expiresAt, err = retrieve(ctx, &s.stmts.readStatements, sURL)
 		}
-		if queryOutput.IsDeleted {
-			retrieveError <- &storageErrors.DeletedError{Err: err, SURL: sURL}
+		entryExpiresAt = expiresAt
+		if err != nil {
+			retrieveError <- err
 			return
 		}
-		retrieveDone <- queryOutput.URL
+		retrieveDone <- URL
 	}()
 
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
 		log.Println("Retrieving URL:", ctx.Err())
-		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		return "", nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case rtrvError := <-retrieveError:
 		log.Println("Retrieving URL:", rtrvError.Error())
-		return "", rtrvError
+		return "", entryExpiresAt, rtrvError
 	case URL := <-retrieveDone:
 		log.Println("Retrieving URL:", sURL, "as", URL)
-		return URL, nil
+		return URL, entryExpiresAt, nil
 	}
 }
 
-// RetrieveByUserID returns a slice of URL:sURL pairs defined as modelurl.FullURL for one particular user ID.
-func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
-	// prepare query statement
-	selectStmt, err := s.DB.PrepareContext(ctx, "SELECT * FROM urls WHERE user_id = $1 AND is_deleted = false")
+// retrieve looks sURL up using stmts.
+func retrieve(ctx context.Context, stmts *readStatements, sURL string) (string, *time.Time, error) {
+	var queryOutput modelstorage.URLPostgresEntry
+	err := stmts.retrieve.QueryRowContext(ctx, sURL).Scan(&queryOutput.ID, &queryOutput.UserID, &queryOutput.URL, &queryOutput.SURL, &queryOutput.IsDeleted, &queryOutput.ExpiresAt, &queryOutput.PasswordHash)
 	if err != nil {
-		return nil, &storageErrors.StatementPSQLError{Err: err}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", nil, &storageErrors.NotFoundError{Err: err, SURL: sURL}
+		default:
+			return "", nil, err
+		}
+	}
+	var expiresAt *time.Time
+	if queryOutput.ExpiresAt.Valid {
+		expiresAt = &queryOutput.ExpiresAt.Time
+	}
+	// check expiration first since expired entries get soft-deleted by the reaper
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", expiresAt, &storageErrors.ExpiredError{Err: err, SURL: sURL}
 	}
-	defer selectStmt.Close()
+	if queryOutput.IsDeleted {
+		return "", expiresAt, &storageErrors.DeletedError{Err: err, SURL: sURL}
+	}
+	if queryOutput.PasswordHash.Valid {
+		return "", expiresAt, &storageErrors.ProtectedError{Err: nil, SURL: sURL, URL: queryOutput.URL, PasswordHash: queryOutput.PasswordHash.String}
+	}
+	return queryOutput.URL, expiresAt, nil
+}
 
+// RetrieveByUserID returns a slice of URL:sURL pairs defined as modelurl.FullURL for one particular user ID, it
+// is served by a healthy replica unless the user wrote recently.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
 	// create channels for listening to the go routine result
-	retrieveDone := make(chan []modelurl.FullURL)
-	retrieveError := make(chan error)
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		rows, err := selectStmt.QueryContext(ctx, userID)
+		stmts, r := s.reader(s.replicas.isStickyUser(userID))
+		URLs, err := retrieveByUserID(ctx, stmts, userID)
+		if r != nil && s.replicas.failover(ctx, r, err) {
+			URLs, err = retrieveByUserID(ctx, &s.stmts.readStatements, userID)
+		}
 		if err != nil {
-			retrieveError <- &storageErrors.ExecutionPSQLError{Err: err}
+			retrieveError <- err
 			return
 		}
-		defer rows.Close()
+		retrieveDone <- URLs
+	}()
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Retrieving URLs by user ID:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rtrvError := <-retrieveError:
+		log.Println("Retrieving URLs by user ID:", rtrvError.Error())
+		return nil, rtrvError
+	case URLs := <-retrieveDone:
+		log.Println("Retrieving URLs by user ID:", URLs)
+		return URLs, nil
+	}
+}
 
-		// extract DB row data into corresponding go structure
-		var queryOutput []modelstorage.URLPostgresEntry
-		for rows.Next() {
-			var queryOutputRow modelstorage.URLPostgresEntry
-			err = rows.Scan(&queryOutputRow.ID, &queryOutputRow.UserID, &queryOutputRow.URL, &queryOutputRow.SURL, &queryOutputRow.IsDeleted)
-			if err != nil {
-				retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
-				return
-			}
-			queryOutput = append(queryOutput, queryOutputRow)
+// retrieveByUserID looks entries of userID up using stmts.
+func retrieveByUserID(ctx context.Context, stmts *readStatements, userID string) ([]modelurl.FullURL, error) {
+	rows, err := stmts.retrieveByUserID.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return scanFullURLs(rows)
+}
+
+// IsOwner reports whether userID owns a non-deleted entry with sURL, it is served by a healthy replica unless the
+// user wrote recently.
+func (s *Storage) IsOwner(ctx context.Context, userID, sURL string) (owned bool, err error) {
+	// create channels for listening to the go routine result
+	checkDone := make(chan bool, 1)
+	checkError := make(chan error, 1)
+	go func() {
+		var owned bool
+		stmts, r := s.reader(s.replicas.isStickyUser(userID))
+		err := stmts.isOwner.QueryRowContext(ctx, userID, sURL).Scan(&owned)
+		if r != nil && s.replicas.failover(ctx, r, err) {
+			err = s.stmts.isOwner.QueryRowContext(ctx, userID, sURL).Scan(&owned)
 		}
-		err = rows.Err()
 		if err != nil {
-			retrieveError <- &storageErrors.ScanningPSQLError{Err: err}
+			checkError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
 		}
-		// extract go structure data into necessary output structure
-		var URLs []modelurl.FullURL
-		for _, entry := range queryOutput {
-			fullURL := modelurl.FullURL{
-				URL:  entry.URL,
-				SURL: entry.SURL,
-			}
-			URLs = append(URLs, fullURL)
+		checkDone <- owned
+	}()
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Checking URL owner:", ctx.Err())
+		return false, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case chkError := <-checkError:
+		log.Println("Checking URL owner:", chkError.Error())
+		return false, chkError
+	case owned := <-checkDone:
+		log.Println("Checking URL owner:", sURL, "owned by", userID, owned)
+		return owned, nil
+	}
+}
+
+// ListByUserID returns up to limit URLs of userID with sURLs greater than afterSURL in ascending order of sURLs,
+// it is served by a healthy replica unless the user wrote recently.
+func (s *Storage) ListByUserID(ctx context.Context, userID, afterSURL string, limit int) (URLs []modelurl.FullURL, err error) {
+	// create channels for listening to the go routine result
+	retrieveDone := make(chan []modelurl.FullURL, 1)
+	retrieveError := make(chan error, 1)
+	go func() {
+		stmts, r := s.reader(s.replicas.isStickyUser(userID))
+		URLs, err := listByUserID(ctx, stmts, userID, afterSURL, limit)
+		if r != nil && s.replicas.failover(ctx, r, err) {
+			URLs, err = listByUserID(ctx, &s.stmts.readStatements, userID, afterSURL, limit)
+		}
+		if err != nil {
+			retrieveError <- err
+			return
 		}
 		retrieveDone <- URLs
 	}()
 	// wait for the first channel to retrieve a value
 	select {
 	case <-ctx.Done():
-		log.Println("Retrieving URLs by user ID:", ctx.Err())
+		log.Println("Listing URLs by user ID:", ctx.Err())
 		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case rtrvError := <-retrieveError:
-		log.Println("Retrieving URLs by user ID:", rtrvError.Error())
+		log.Println("Listing URLs by user ID:", rtrvError.Error())
 		return nil, rtrvError
 	case URLs := <-retrieveDone:
-		log.Println("Retrieving URLs by user ID:", URLs)
+		log.Println("Listing URLs by user ID:", len(URLs), "URLs after", afterSURL)
 		return URLs, nil
 	}
 }
 
-// Dump stores a pair of sURL and URL as a key-value pair in DB.
-func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID string) error {
-	// prepare INSERT statement
-	dumpStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO urls (user_id, url, short_url) VALUES ($1, $2, $3)")
+// listByUserID looks a page of entries of userID up using stmts.
+func listByUserID(ctx context.Context, stmts *readStatements, userID, afterSURL string, limit int) ([]modelurl.FullURL, error) {
+	rows, err := stmts.listByUserID.QueryContext(ctx, userID, afterSURL, limit)
 	if err != nil {
-		return &storageErrors.StatementPSQLError{Err: err}
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return scanFullURLs(rows)
+}
+
+// scanFullURLs reads rows of entries and closes them.
+func scanFullURLs(rows *sql.Rows) ([]modelurl.FullURL, error) {
+	defer rows.Close()
+
+	// extract DB row data into corresponding go structure
+	var queryOutput []modelstorage.URLPostgresEntry
+	for rows.Next() {
+		var queryOutputRow modelstorage.URLPostgresEntry
+		err := rows.Scan(&queryOutputRow.ID, &queryOutputRow.UserID, &queryOutputRow.URL, &queryOutputRow.OriginalURL, &queryOutputRow.SURL, &queryOutputRow.IsDeleted, &queryOutputRow.ExpiresAt)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		queryOutput = append(queryOutput, queryOutputRow)
 	}
-	defer dumpStmt.Close()
-	// prepare SELECT statement
-	selectStmt, err := s.DB.PrepareContext(ctx, "SELECT short_url FROM urls WHERE url = $1")
+	err := rows.Err()
 	if err != nil {
-		return &storageErrors.StatementPSQLError{Err: err}
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	// extract go structure data into necessary output structure
+	var URLs []modelurl.FullURL
+	for _, entry := range queryOutput {
+		fullURL := modelurl.FullURL{
+			URL:         entry.URL,
+			OriginalURL: entry.OriginalURL.String,
+			SURL:        entry.SURL,
+		}
+		if entry.ExpiresAt.Valid {
+			expiresAt := entry.ExpiresAt.Time
+			fullURL.ExpiresAt = &expiresAt
+		}
+		URLs = append(URLs, fullURL)
 	}
-	defer selectStmt.Close()
+	return URLs, nil
+}
 
+// Dump stores a pair of sURL and URL as a key-value pair in DB.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	URL, sURL, userID := entry.URL, entry.SURL, entry.UserID
+	// let the writer read its own write from the primary
+	defer s.replicas.stick(userID, sURL)
 	// create channels for listening to the go routine result
-	dumpDone := make(chan bool)
-	dumpError := make(chan error)
+	dumpDone := make(chan bool, 1)
+	dumpError := make(chan error, 1)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		_, err := dumpStmt.ExecContext(ctx, userID, URL, sURL)
+		_, err := s.stmts.dump.ExecContext(ctx, userID, URL, sURL, entry.ExpiresAt, entry.OriginalURL, entry.PasswordHash)
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
+				// sURL is already taken by another entry
+				if err.ConstraintName == sURLUniqueIndex {
+					dumpError <- &storageErrors.SURLAlreadyExistsError{Err: err, SURL: sURL}
+					return
+				}
+				// expired entries keep their URLs until soft-deleted by DeleteExpired unless released at once
+				stored, err := s.dumpReleasingExpired(ctx, entry)
+				if err != nil {
+					dumpError <- err
+					return
+				}
+				if stored {
+					dumpDone <- true
+					return
+				}
 				// retrieve already existing sURL for violating unique constraint URL
-				var validsURL string
-				err := selectStmt.QueryRowContext(ctx, URL).Scan(&validsURL)
+				var validsURL, ownerID string
+				err = s.stmts.selectOwner.QueryRowContext(ctx, URL, userID).Scan(&validsURL, &ownerID)
 				if err != nil {
 					dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
 					return
 				}
-				dumpError <- &storageErrors.AlreadyExistsError{Err: err, URL: URL, ValidSURL: validsURL}
+				// sURLs of other users must not be exposed
+				if ownerID != userID {
+					dumpError <- &storageErrors.URLTakenError{Err: nil, URL: URL}
+					return
+				}
+				dumpError <- &storageErrors.AlreadyExistsError{Err: nil, URL: URL, ValidSURL: validsURL}
 				return
 			}
 			dumpError <- &storageErrors.ExecutionPSQLError{Err: err}
@@ -338,32 +786,397 @@ func (s *Storage) Dump(ctx context.Context, URL string, sURL string, userID stri
 	}
 }
 
-// DeleteBatch assigns a deletion flag for DB entries, does not use task management.
-func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
-	// prepare DELETE statement
-	deleteStmt, err := s.DB.PrepareContext(ctx, "UPDATE urls SET is_deleted = true WHERE user_id = $1 AND short_url = ANY($2)")
+// dumpReleasingExpired stores entry within a transaction after soft-deleting expired entries it conflicts with by
+// URL and reports whether it was stored, it is not if there are no such entries or entry conflicts again.
+func (s *Storage) dumpReleasingExpired(ctx context.Context, entry modelstorage.URLStorageEntry) (bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer tx.Rollback()
+	released, err := s.releaseExpired(ctx, tx, []modelstorage.URLStorageEntry{entry})
+	if err != nil || released == 0 {
+		return false, err
+	}
+	_, err = tx.StmtContext(ctx, s.stmts.dump).ExecContext(ctx, entry.UserID, entry.URL, entry.SURL, entry.ExpiresAt, entry.OriginalURL, entry.PasswordHash)
+	if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
+		return false, nil
+	}
+	if err != nil {
+		return false, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return true, nil
+}
+
+// releaseExpired soft-deletes live entries which have expired but are not soft-deleted by DeleteExpired yet and
+// share URLs with entries within config.DedupScope, so that entries stored within tx do not conflict with them.
+// Deleted and password-protected entries are skipped since they are not covered by unique indexes on URLs.
+func (s *Storage) releaseExpired(ctx context.Context, tx *sql.Tx, entries []modelstorage.URLStorageEntry) (released int64, err error) {
+	var userIDs, URLs []string
+	for _, entry := range entries {
+		if entry.IsDeleted || entry.PasswordHash != "" {
+			continue
+		}
+		userIDs = append(userIDs, entry.UserID)
+		URLs = append(URLs, entry.URL)
+	}
+	if len(URLs) == 0 {
+		return 0, nil
+	}
+	query := "UPDATE urls SET is_deleted = true, deleted_at = now() FROM unnest($1::text[], $2::text[]) AS e(user_id, url) WHERE urls.user_id = e.user_id AND urls.url = e.url AND NOT urls.is_deleted AND urls.password_hash IS NULL AND urls.expires_at <= now()"
+	args := []interface{}{pq.Array(userIDs), pq.Array(URLs)}
+	if s.Cfg.DedupScope == config.DedupScopeGlobal {
+		query = "UPDATE urls SET is_deleted = true, deleted_at = now() WHERE url = ANY($1) AND NOT is_deleted AND password_hash IS NULL AND expires_at <= now()"
+		args = []interface{}{pq.Array(URLs)}
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return &storageErrors.StatementPSQLError{Err: err}
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	released, err = result.RowsAffected()
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return released, nil
+}
+
+// CheckDuplicate looks up a live entry with the same original URL as entry without storing it.
+func (s *Storage) CheckDuplicate(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	// deleted and password-protected entries are not covered by unique indexes on URLs
+	if entry.IsDeleted || entry.PasswordHash != "" {
+		return nil
+	}
+	// create channels for listening to the go routine result
+	checkDone := make(chan error, 1)
+	checkError := make(chan error, 1)
+	go func() {
+		var validsURL, ownerID string
+		err := s.stmts.selectOwner.QueryRowContext(ctx, entry.URL, entry.UserID).Scan(&validsURL, &ownerID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			checkDone <- nil
+		case err != nil:
+			checkError <- &storageErrors.ExecutionPSQLError{Err: err}
+		case ownerID == entry.UserID:
+			checkDone <- &storageErrors.AlreadyExistsError{Err: nil, URL: entry.URL, ValidSURL: validsURL}
+		// sURLs of other users must not be exposed
+		case s.Cfg.DedupScope == config.DedupScopeGlobal:
+			checkDone <- &storageErrors.URLTakenError{Err: nil, URL: entry.URL}
+		default:
+			checkDone <- nil
+		}
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Checking URL:", ctx.Err())
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case chckError := <-checkError:
+		log.Println("Checking URL:", chckError.Error())
+		return chckError
+	case conflict := <-checkDone:
+		return conflict
+	}
+}
+
+// dumpBatchChunkSize limits the number of rows of one INSERT statement since PSQL limits the number of parameters.
+const dumpBatchChunkSize = 1000
+
+// DumpBatch stores a batch of sURL and URL pairs with multi-row inserts within one transaction, conflicting
+// entries are skipped and reported in results.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	// let writers read their own writes from the primary
+	defer func() {
+		for _, entry := range entries {
+			s.replicas.stick(entry.UserID, entry.SURL)
+		}
+	}()
+	// create channels for listening to the go routine result
+	dumpDone := make(chan []error, 1)
+	dumpError := make(chan error, 1)
+	go func() {
+		results, err := s.dumpBatch(ctx, entries)
+		if err != nil {
+			dumpError <- err
+			return
+		}
+		dumpDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Dumping URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case dmpError := <-dumpError:
+		log.Println("Dumping URLs:", dmpError.Error())
+		return nil, dmpError
+	case results := <-dumpDone:
+		log.Println("Dumping URLs:", len(entries), "entries processed")
+		return results, nil
 	}
-	defer deleteStmt.Close()
-	//begin transaction
+}
+
+// dumpBatch inserts entries skipping conflicting ones and resolves conflicts afterwards.
+func (s *Storage) dumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) ([]error, error) {
+	results := make([]error, len(entries))
+	// entries repeating a sURL or URL of a preceding entry of the batch are not sent to DB
+	firstBySURL := make(map[string]bool)
+	firstByURL := make(map[string]int)
+	duplicateOf := make(map[int]int)
+	var pending []int
+	for i, entry := range entries {
+		if firstBySURL[entry.SURL] {
+			results[i] = &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
+			continue
+		}
+		// deleted and password-protected entries are not covered by unique indexes on URLs
+		if entry.IsDeleted || entry.PasswordHash != "" {
+			firstBySURL[entry.SURL] = true
+			pending = append(pending, i)
+			continue
+		}
+		key := entry.URL
+		if s.Cfg.DedupScope != config.DedupScopeGlobal {
+			key = entry.UserID + "\x00" + entry.URL
+		}
+		if j, ok := firstByURL[key]; ok {
+			duplicateOf[i] = j
+			continue
+		}
+		firstBySURL[entry.SURL] = true
+		firstByURL[key] = i
+		pending = append(pending, i)
+	}
+
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return &storageErrors.ExecutionPSQLError{Err: err}
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
 	}
 	defer tx.Rollback()
-	txDeleteStmt := tx.StmtContext(ctx, deleteStmt)
+	pendingEntries := make([]modelstorage.URLStorageEntry, 0, len(pending))
+	for _, i := range pending {
+		pendingEntries = append(pendingEntries, entries[i])
+	}
+	// expired entries keep their URLs until soft-deleted by DeleteExpired unless released at once
+	_, err = s.releaseExpired(ctx, tx, pendingEntries)
+	if err != nil {
+		return nil, err
+	}
+	inserted := make(map[string]bool)
+	now := time.Now()
+	for start := 0; start < len(pending); start += dumpBatchChunkSize {
+		end := start + dumpBatchChunkSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		var query strings.Builder
+		query.WriteString("INSERT INTO urls (user_id, url, short_url, expires_at, is_deleted, deleted_at, original_url, password_hash) VALUES ")
+		args := make([]interface{}, 0, 8*(end-start))
+		for k, i := range pending[start:end] {
+			if k > 0 {
+				query.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''))", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+			// the retention period of deleted entries starts once they are stored
+			var deletedAt *time.Time
+			if entries[i].IsDeleted {
+				deletedAt = &now
+			}
+			args = append(args, entries[i].UserID, entries[i].URL, entries[i].SURL, entries[i].ExpiresAt, entries[i].IsDeleted, deletedAt, entries[i].OriginalURL, entries[i].PasswordHash)
+		}
+		// conflicts with any unique index skip a row instead of aborting the whole transaction
+		query.WriteString(" ON CONFLICT DO NOTHING RETURNING short_url")
+		rows, err := tx.QueryContext(ctx, query.String(), args...)
+		if err != nil {
+			return nil, &storageErrors.ExecutionPSQLError{Err: err}
+		}
+		for rows.Next() {
+			var sURL string
+			err = rows.Scan(&sURL)
+			if err != nil {
+				rows.Close()
+				return nil, &storageErrors.ScanningPSQLError{Err: err}
+			}
+			inserted[sURL] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+	}
+
+	err = s.resolveConflicts(ctx, tx, entries, pending, inserted, results)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := range duplicateOf {
+		var validSURL string
+		switch first := results[j].(type) {
+		case nil:
+			validSURL = entries[j].SURL
+		case *storageErrors.AlreadyExistsError:
+			validSURL = first.ValidSURL
+		default:
+			results[i] = results[j]
+			continue
+		}
+		if entries[j].UserID != entries[i].UserID {
+			results[i] = &storageErrors.URLTakenError{Err: nil, URL: entries[i].URL}
+			continue
+		}
+		results[i] = &storageErrors.AlreadyExistsError{Err: nil, URL: entries[i].URL, ValidSURL: validSURL}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return results, nil
+}
+
+// resolveConflicts sets results for pending entries which were not inserted.
+func (s *Storage) resolveConflicts(ctx context.Context, tx *sql.Tx, entries []modelstorage.URLStorageEntry, pending []int, inserted map[string]bool, results []error) error {
+	var skippedSURLs, skippedURLs []string
+	for _, i := range pending {
+		if !inserted[entries[i].SURL] {
+			skippedSURLs = append(skippedSURLs, entries[i].SURL)
+			skippedURLs = append(skippedURLs, entries[i].URL)
+		}
+	}
+	if len(skippedSURLs) == 0 {
+		return nil
+	}
+	takenSURLs := make(map[string]bool)
+	rows, err := tx.QueryContext(ctx, "SELECT short_url FROM urls WHERE short_url = ANY($1)", pq.Array(skippedSURLs))
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	for rows.Next() {
+		var sURL string
+		err = rows.Scan(&sURL)
+		if err != nil {
+			rows.Close()
+			return &storageErrors.ScanningPSQLError{Err: err}
+		}
+		takenSURLs[sURL] = true
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return &storageErrors.ScanningPSQLError{Err: err}
+	}
+	// existing live entries by URL and user, one user may own a URL only once
+	owners := make(map[string]map[string]string)
+	rows, err = tx.QueryContext(ctx, "SELECT url, user_id, short_url FROM urls WHERE url = ANY($1) AND NOT is_deleted AND password_hash IS NULL", pq.Array(skippedURLs))
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	for rows.Next() {
+		var URL, userID, sURL string
+		err = rows.Scan(&URL, &userID, &sURL)
+		if err != nil {
+			rows.Close()
+			return &storageErrors.ScanningPSQLError{Err: err}
+		}
+		if owners[URL] == nil {
+			owners[URL] = make(map[string]string)
+		}
+		owners[URL][userID] = sURL
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return &storageErrors.ScanningPSQLError{Err: err}
+	}
+	for _, i := range pending {
+		entry := entries[i]
+		if inserted[entry.SURL] {
+			continue
+		}
+		// sURLs of other users must not be exposed
+		if validSURL, ok := owners[entry.URL][entry.UserID]; ok {
+			results[i] = &storageErrors.AlreadyExistsError{Err: nil, URL: entry.URL, ValidSURL: validSURL}
+		} else if takenSURLs[entry.SURL] {
+			results[i] = &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
+		} else {
+			results[i] = &storageErrors.URLTakenError{Err: nil, URL: entry.URL}
+		}
+	}
+	return nil
+}
+
+// List retrieves a page of entries ordered by sURL.
+func (s *Storage) List(ctx context.Context, afterSURL string, limit int) (entries []modelstorage.URLStorageEntry, err error) {
+	// create channels for listening to the go routine result
+	listDone := make(chan []modelstorage.URLStorageEntry, 1)
+	listError := make(chan error, 1)
+	go func() {
+		rows, err := s.stmts.list.QueryContext(ctx, afterSURL, limit)
+		if err != nil {
+			listError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+		entries := make([]modelstorage.URLStorageEntry, 0, limit)
+		for rows.Next() {
+			var row modelstorage.URLPostgresEntry
+			err = rows.Scan(&row.UserID, &row.URL, &row.OriginalURL, &row.PasswordHash, &row.SURL, &row.IsDeleted, &row.ExpiresAt)
+			if err != nil {
+				listError <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			entry := modelstorage.URLStorageEntry{SURL: row.SURL, URL: row.URL, OriginalURL: row.OriginalURL.String, PasswordHash: row.PasswordHash.String, UserID: row.UserID, IsDeleted: row.IsDeleted}
+			if row.ExpiresAt.Valid {
+				expiresAt := row.ExpiresAt.Time
+				entry.ExpiresAt = &expiresAt
+			}
+			entries = append(entries, entry)
+		}
+		err = rows.Err()
+		if err != nil {
+			listError <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		listDone <- entries
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Listing URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case lstError := <-listError:
+		log.Println("Listing URLs:", lstError.Error())
+		return nil, lstError
+	case entries := <-listDone:
+		log.Println("Listing URLs:", len(entries), "entries retrieved")
+		return entries, nil
+	}
+}
+
+// DeleteBatch assigns a deletion flag for DB entries, does not use task management.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	// let the writer read its own write from the primary
+	defer s.replicas.stick(userID, sURLs...)
 	// create channels for listening to the go routine result
-	deleteDone := make(chan bool)
-	deleteError := make(chan error)
+	deleteDone := make(chan bool, 1)
+	deleteError := make(chan error, 1)
 	go func() {
-		_, err = txDeleteStmt.ExecContext(
+		_, err := s.stmts.deleteBatch.ExecContext(
 			ctx,
 			userID,
 			pq.Array(sURLs),
 		)
 		if err != nil {
 			deleteError <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
 		}
 		deleteDone <- true
 	}()
@@ -378,8 +1191,116 @@ func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string
 		return dltError
 	case <-deleteDone:
 		log.Println("Deleting URL:", sURLs)
-		return tx.Commit()
+		return nil
+	}
+}
+
+// RestoreBatch clears the deletion flag of entries owned by userID which were deleted within
+// Cfg.RestoreGraceWindow, entries whose URL was shortened again meanwhile violate URL uniqueness and are not restored.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (results []string, err error) {
+	// let the writer read its own write from the primary
+	defer s.replicas.stick(userID, sURLs...)
+	// create channels for listening to the go routine result
+	restoreDone := make(chan []string, 1)
+	restoreError := make(chan error, 1)
+	go func() {
+		deletedAfter := time.Now().Add(-s.Cfg.RestoreGraceWindow)
+		entries, err := s.selectRestorable(ctx, sURLs)
+		if err != nil {
+			restoreError <- err
+			return
+		}
+		results := make([]string, len(sURLs))
+		for i, sURL := range sURLs {
+			entry, ok := entries[sURL]
+			if !ok {
+				results[i] = modelurl.RestoreOutcomeNotFound
+				continue
+			}
+			results[i] = entry.RestoreOutcome(userID, deletedAfter)
+			if results[i] != modelurl.RestoreOutcomeRestored {
+				continue
+			}
+			// entries are restored one by one so that a conflict does not abort the others
+			res, err := s.stmts.restore.ExecContext(ctx, sURL, userID, deletedAfter)
+			if err != nil {
+				if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
+					results[i] = modelurl.RestoreOutcomeConflict
+					continue
+				}
+				restoreError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				restoreError <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+			// the entry was restored or purged concurrently
+			if n == 0 {
+				results[i] = modelurl.RestoreOutcomeNotDeleted
+			}
+			entries[sURL] = modelstorage.URLMapEntry{URL: entry.URL, UserID: entry.UserID, ExpiresAt: entry.ExpiresAt}
+		}
+		restoreDone <- results
+	}()
+
+	// wait for the first channel to retrieve a value
+	select {
+	case <-ctx.Done():
+		log.Println("Restoring URLs:", ctx.Err())
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case rstrError := <-restoreError:
+		log.Println("Restoring URLs:", rstrError.Error())
+		return nil, rstrError
+	case results := <-restoreDone:
+		log.Println("Restoring URLs:", sURLs, results)
+		return results, nil
+	}
+}
+
+// selectRestorable returns entries of sURLs by sURL.
+func (s *Storage) selectRestorable(ctx context.Context, sURLs []string) (map[string]modelstorage.URLMapEntry, error) {
+	rows, err := s.stmts.selectRestorable.QueryContext(ctx, pq.Array(sURLs))
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+	entries := make(map[string]modelstorage.URLMapEntry)
+	for rows.Next() {
+		var sURL string
+		var entry modelstorage.URLMapEntry
+		var expiresAt, deletedAt sql.NullTime
+		err = rows.Scan(&sURL, &entry.UserID, &entry.URL, &entry.IsDeleted, &expiresAt, &deletedAt)
+		if err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		if expiresAt.Valid {
+			entry.ExpiresAt = &expiresAt.Time
+		}
+		if deletedAt.Valid {
+			entry.DeletedAt = &deletedAt.Time
+		}
+		entries[sURL] = entry
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return entries, nil
+}
+
+// DeleteExpired assigns a deletion flag for DB entries which have expired, does not use task management.
+func (s *Storage) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := s.stmts.deleteExpired.ExecContext(ctx)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
 	}
+	return n, nil
 }
 
 // PingDB performs DB ping.
@@ -392,16 +1313,20 @@ func (s *Storage) CloseDB() error {
 	return s.DB.Close()
 }
 
-// createTable creates a table for PSQL DB storage if not exist.
-func (s *Storage) createTable(ctx context.Context) error {
-	// store user_id as text since we store encoded tokens
-	query := `CREATE TABLE IF NOT EXISTS urls (
-		id bigserial not null,
-		user_id text not null,
-		url text not null unique,
-		short_url text not null,
-		is_deleted boolean not null DEFAULT false 
-	);`
+// sURLUniqueIndex is a name of the unique index guarding sURLs against duplicates, it is created by migrations.
+const sURLUniqueIndex = "urls_short_url_key"
+
+// applyDedupScope creates or drops a partial unique index on original URLs according to config.DedupScope,
+// per-user uniqueness is always guarded by an index created by migrations.
+func (s *Storage) applyDedupScope(ctx context.Context) error {
+	query := `DROP INDEX IF EXISTS urls_url_global_key;`
+	if s.Cfg.DedupScope == config.DedupScopeGlobal {
+		// fails if different users have already shortened the same URL under per-user scope
+		query = `CREATE UNIQUE INDEX IF NOT EXISTS urls_url_global_key ON urls (url) WHERE NOT is_deleted AND password_hash IS NULL;`
+	}
 	_, err := s.DB.ExecContext(ctx, query)
-	return err
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return nil
 }
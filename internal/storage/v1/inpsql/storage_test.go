@@ -0,0 +1,98 @@
+package inpsql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// benchmarkEntries is the number of entries looked up by benchmarks.
+const benchmarkEntries = 100
+
+// newBenchmarkStorage initializes a Storage over a DB given by DATABASE_DSN and fills it with entries, the
+// benchmark is skipped if no DB is available.
+func newBenchmarkStorage(b *testing.B) (st *Storage, sURLs []string) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("DATABASE_DSN is not set")
+	}
+	cfg := config.NewDefaultConfiguration()
+	cfg.DatabaseDSN = dsn
+	cfg.DBMaxOpenConns = 25
+	cfg.DBMaxIdleConns = 25
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	st, _ = InitStorage(ctx, wg, cfg)
+	prefix := fmt.Sprintf("bench%d_", time.Now().UnixNano())
+	for i := 0; i < benchmarkEntries; i++ {
+		sURL := fmt.Sprintf("%s%d", prefix, i)
+		err := st.Dump(ctx, modelstorage.URLStorageEntry{SURL: sURL, URL: "https://www.yandex.ru/" + sURL, UserID: prefix})
+		if err != nil {
+			b.Fatal(err)
+		}
+		sURLs = append(sURLs, sURL)
+	}
+	b.Cleanup(func() {
+		_, _ = st.DB.ExecContext(context.Background(), "DELETE FROM urls WHERE user_id = $1", prefix)
+		cancel()
+		wg.Wait()
+	})
+	return st, sURLs
+}
+
+// retrieveSerialized looks sURL up the way Storage did before statements were prepared at initialization,
+// i.e. preparing a statement per call under a storage-wide mutex, it serves as a baseline.
+func retrieveSerialized(ctx context.Context, st *Storage, mu *sync.Mutex, sURL string) error {
+	stmt, err := st.DB.PrepareContext(ctx, "SELECT id, user_id, url, short_url, is_deleted, expires_at FROM urls WHERE short_url = $1")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	var row modelstorage.URLPostgresEntry
+	return stmt.QueryRowContext(ctx, sURL).Scan(&row.ID, &row.UserID, &row.URL, &row.SURL, &row.IsDeleted, &row.ExpiresAt)
+}
+
+// Benchmarks
+
+func BenchmarkStorage_Retrieve(b *testing.B) {
+	st, sURLs := newBenchmarkStorage(b)
+	ctx := context.Background()
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&n, 1)
+			_, err := st.Retrieve(ctx, sURLs[i%benchmarkEntries])
+			if err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkStorage_RetrieveSerialized(b *testing.B) {
+	st, sURLs := newBenchmarkStorage(b)
+	ctx := context.Background()
+	mu := &sync.Mutex{}
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&n, 1)
+			err := retrieveSerialized(ctx, st, mu, sURLs[i%benchmarkEntries])
+			if err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
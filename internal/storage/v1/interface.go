@@ -3,6 +3,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
 	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
@@ -10,13 +11,31 @@ import (
 
 // URLSetter defines a set of methods for types implementing URLSetter.
 type URLSetter interface {
-	Dump(ctx context.Context, URL, sURL string, userID string) error
+	Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error
+}
+
+// URLBatchSetter defines a set of methods for types implementing URLBatchSetter.
+type URLBatchSetter interface {
+	// DumpBatch stores entries at once and returns per-entry conflict errors, err is set if nothing was stored.
+	// Entries with IsDeleted set are stored as deleted and are not checked for URL duplicates.
+	DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error)
 }
 
 // URLBatchDeleter defines a set of methods for types implementing URLBatchDeleter.
 type URLBatchDeleter interface {
 	DeleteBatch(ctx context.Context, sURLs []string, userID string) error
-	SendToQueue(item modelstorage.URLChannelEntry)
+	// SendToQueue accepts item for asynchronous deletion, item is persisted before SendToQueue returns if the
+	// storage supports it, so that accepted deletions survive restarts.
+	SendToQueue(ctx context.Context, item modelstorage.URLChannelEntry) error
+	// RetrieveDeleteJob reports outcomes of items queued with JobID set to jobID by userID.
+	RetrieveDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error)
+}
+
+// URLBatchRestorer defines a set of methods for types implementing URLBatchRestorer.
+type URLBatchRestorer interface {
+	// RestoreBatch clears the deletion flag of entries owned by userID which were deleted within
+	// Cfg.RestoreGraceWindow, sURLs are kept. Outcomes are reported per sURL, results[i] corresponds to sURLs[i].
+	RestoreBatch(ctx context.Context, sURLs []string, userID string) (results []string, err error)
 }
 
 // URLGetter defines a set of methods for types implementing URLGetter.
@@ -27,6 +46,16 @@ type URLGetter interface {
 // URLGetterByUserID defines a set of methods for types implementing URLGetterByUserID.
 type URLGetterByUserID interface {
 	RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error)
+	// ListByUserID pages through URLs RetrieveByUserID returns, it returns up to limit URLs with sURLs greater than
+	// afterSURL in ascending order of sURLs.
+	ListByUserID(ctx context.Context, userID, afterSURL string, limit int) (URLs []modelurl.FullURL, err error)
+}
+
+// URLLister defines a set of methods for types implementing URLLister.
+type URLLister interface {
+	// List returns up to limit entries with sURLs greater than afterSURL in ascending order of sURLs,
+	// deleted and expired entries are included.
+	List(ctx context.Context, afterSURL string, limit int) (entries []modelstorage.URLStorageEntry, err error)
 }
 
 // Pinger defines a set of methods for types implementing Pinger.
@@ -44,13 +73,90 @@ type Maintainer interface {
 	GetStats(ctx context.Context) (nURLs, nUsers int64, err error)
 }
 
+// Compactor defines a set of methods for storages which support on-demand compaction, it is optional
+// and is not a part of URLStorage.
+type Compactor interface {
+	Compact(ctx context.Context) error
+}
+
+// Purger defines a set of methods for storages which hard-delete soft-deleted entries once their retention
+// period is over, it is optional and is not a part of URLStorage.
+type Purger interface {
+	// Purge hard-deletes up to limit entries deleted before deletedBefore and records them as purged at purgedAt.
+	Purge(ctx context.Context, deletedBefore, purgedAt time.Time, limit int) (purged int64, err error)
+	GetPurgeStats(ctx context.Context) (stats modelurl.PurgeStats, err error)
+}
+
+// Remover defines a set of methods for storages which hard-delete entries on demand, e.g. once they are moved to
+// another shard, it is optional and is not a part of URLStorage.
+type Remover interface {
+	// RemoveBatch hard-deletes entries with sURLs regardless of their state, sURLs which are not stored are skipped.
+	RemoveBatch(ctx context.Context, sURLs []string) (removed int64, err error)
+}
+
+// DuplicateChecker defines a set of methods for storages which can look up entries with the same URL ahead of
+// writing, e.g. to deduplicate URLs across shards, it is optional and is not a part of URLStorage.
+type DuplicateChecker interface {
+	// CheckDuplicate returns the error storing entry would fail with due to a live entry with the same URL within
+	// config.DedupScope, either AlreadyExistsError or URLTakenError, or nil if there is no such entry.
+	CheckDuplicate(ctx context.Context, entry modelstorage.URLStorageEntry) error
+}
+
+// UserLister defines a set of methods for storages which can enumerate users who stored entries, it is optional
+// and is not a part of URLStorage.
+type UserLister interface {
+	// ListUserIDs returns distinct IDs of users who own entries, deleted and expired entries are included.
+	ListUserIDs(ctx context.Context) (userIDs []string, err error)
+}
+
+// DeleteObserver defines a set of methods for storages which flush queued deletions asynchronously, it is
+// optional and is not a part of URLStorage.
+type DeleteObserver interface {
+	// ObserveDeletes registers fn to be called with sURLs of queued items once their deletion is flushed.
+	ObserveDeletes(fn func(sURLs []string))
+}
+
+// ExpiringURLGetter defines a set of methods for storages which report expiration times of looked up links, e.g.
+// for caches to expire lookups along with links, it is optional and is not a part of URLStorage.
+type ExpiringURLGetter interface {
+	// RetrieveWithExpiry retrieves URL the way Retrieve does and returns an expiration time of the link as well,
+	// expiresAt is set along with URL or storageErrors.ProtectedError and is nil for links which do not expire.
+	RetrieveWithExpiry(ctx context.Context, sURL string) (URL string, expiresAt *time.Time, err error)
+}
+
+// OwnerChecker defines a set of methods for storages which can check ownership of a single entry without listing
+// all entries of its user, it is optional and is not a part of URLStorage.
+type OwnerChecker interface {
+	// IsOwner reports whether sURL is among URLs RetrieveByUserID returns for userID.
+	IsOwner(ctx context.Context, userID, sURL string) (owned bool, err error)
+}
+
 // URLStorage defines a set of embedded interfaces for types implementing URLStorage.
 type URLStorage interface {
 	URLSetter
+	URLBatchSetter
 	URLBatchDeleter
+	URLBatchRestorer
 	URLGetter
 	URLGetterByUserID
+	URLLister
 	Pinger
 	Closer
 	Maintainer
 }
+
+// ClickSetter defines a set of methods for types implementing ClickSetter.
+type ClickSetter interface {
+	SendClick(item modelstorage.ClickEntry)
+}
+
+// ClickGetter defines a set of methods for types implementing ClickGetter.
+type ClickGetter interface {
+	RetrieveClickStats(ctx context.Context, sURL string, from, to time.Time, top int) (stats modelurl.ClickStats, err error)
+}
+
+// ClickStorage defines a set of embedded interfaces for types implementing ClickStorage.
+type ClickStorage interface {
+	ClickSetter
+	ClickGetter
+}
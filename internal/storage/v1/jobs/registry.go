@@ -0,0 +1,129 @@
+// Package jobs provides an in-memory registry of deletion jobs for storages which do not persist them.
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// Retention defines how long a job is kept after its last update.
+const Retention = 24 * time.Hour
+
+// jobItem defines one sURL of a job, an empty outcome means that the sURL is not flushed yet.
+type jobItem struct {
+	sURL    string
+	outcome string
+}
+
+// job defines a deletion job of one user.
+type job struct {
+	userID    string
+	items     []jobItem
+	err       string
+	updatedAt time.Time
+}
+
+// Registry keeps deletion jobs in memory, jobs are lost on restart unless their items are replayed.
+type Registry struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// NewRegistry initializes a Registry object.
+func NewRegistry() *Registry {
+	return &Registry{jobs: make(map[string]*job)}
+}
+
+// Add registers item as a pending part of its job, items without JobID are ignored.
+func (r *Registry) Add(item modelstorage.URLChannelEntry) {
+	if item.JobID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.sweep(now)
+	j, ok := r.jobs[item.JobID]
+	if !ok {
+		j = &job{userID: item.UserID}
+		r.jobs[item.JobID] = j
+	}
+	j.items = append(j.items, jobItem{sURL: item.SURL})
+	j.updatedAt = now
+}
+
+// Done records outcomes of flushed batch items, outcomes[i] corresponds to batch[i].
+func (r *Registry) Done(batch []modelstorage.URLChannelEntry, outcomes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for i, item := range batch {
+		j, ok := r.jobs[item.JobID]
+		if !ok || j.userID != item.UserID {
+			continue
+		}
+		for k := range j.items {
+			if j.items[k].sURL == item.SURL && j.items[k].outcome == "" {
+				j.items[k].outcome = outcomes[i]
+				break
+			}
+		}
+		j.updatedAt = now
+	}
+}
+
+// Fail records err for jobs of batch items which could not be flushed.
+func (r *Registry) Fail(batch []modelstorage.URLChannelEntry, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, item := range batch {
+		j, ok := r.jobs[item.JobID]
+		if !ok || j.userID != item.UserID {
+			continue
+		}
+		j.err = err.Error()
+		j.updatedAt = now
+	}
+}
+
+// Get returns a report of job jobID created by userID.
+func (r *Registry) Get(jobID, userID string) (modelurl.DeleteJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[jobID]
+	if !ok || j.userID != userID {
+		return modelurl.DeleteJob{}, false
+	}
+	report := modelurl.DeleteJob{ID: jobID, Error: j.err}
+	for _, item := range j.items {
+		report.Add(item.sURL, item.outcome)
+	}
+	report.Resolve()
+	return report, true
+}
+
+// Outcome classifies deleting an sURL queued by userID, found reports whether the sURL is stored and ownerID is
+// the user who stored it, an entry deleted earlier by its owner is reported as deleted.
+func Outcome(found bool, ownerID, userID string) string {
+	switch {
+	case !found:
+		return modelurl.DeleteOutcomeNotFound
+	case ownerID != userID:
+		return modelurl.DeleteOutcomeNotOwned
+	default:
+		return modelurl.DeleteOutcomeDeleted
+	}
+}
+
+// sweep removes jobs which were not updated within Retention.
+func (r *Registry) sweep(now time.Time) {
+	for jobID, j := range r.jobs {
+		if now.Sub(j.updatedAt) > Retention {
+			delete(r.jobs, jobID)
+		}
+	}
+}
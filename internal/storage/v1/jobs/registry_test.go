@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	batch := []modelstorage.URLChannelEntry{
+		{SURL: "sURL1", UserID: "user1", JobID: "job1"},
+		{SURL: "sURL2", UserID: "user1", JobID: "job1"},
+		{SURL: "sURL3", UserID: "user1"},
+	}
+	for _, item := range batch {
+		r.Add(item)
+	}
+	_, ok := r.Get("job1", "user2")
+	assert.False(t, ok)
+
+	// a failed flush is reported while sURLs are still pending
+	r.Fail(batch[:1], errors.New("generic error"))
+	job, ok := r.Get("job1", "user1")
+	assert.True(t, ok)
+	assert.Equal(t, modelurl.DeleteJob{
+		ID:      "job1",
+		Status:  modelurl.DeleteJobFailed,
+		Pending: []string{"sURL1", "sURL2"},
+		Error:   "generic error",
+	}, job)
+
+	r.Done(batch, []string{modelurl.DeleteOutcomeDeleted, modelurl.DeleteOutcomeNotOwned, modelurl.DeleteOutcomeNotFound})
+	job, ok = r.Get("job1", "user1")
+	assert.True(t, ok)
+	assert.Equal(t, modelurl.DeleteJob{
+		ID:       "job1",
+		Status:   modelurl.DeleteJobDone,
+		Deleted:  []string{"sURL1"},
+		NotOwned: []string{"sURL2"},
+	}, job)
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, modelurl.DeleteOutcomeNotFound, Outcome(false, "", "user1"))
+	assert.Equal(t, modelurl.DeleteOutcomeNotOwned, Outcome(true, "user2", "user1"))
+	assert.Equal(t, modelurl.DeleteOutcomeDeleted, Outcome(true, "user1", "user1"))
+}
@@ -1,26 +1,110 @@
 // Package modelstorage provides locally used types and their structure for storage objects.
 package modelstorage
 
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+)
+
 type URLStorageEntry struct {
-	SURL   string `json:"sURL"`
-	URL    string `json:"URL"`
-	UserID string `json:"userID"`
+	SURL        string `json:"sURL"`
+	URL         string `json:"URL"`                   // canonical form, deduplicated and redirected to
+	OriginalURL string `json:"originalURL,omitempty"` // set if URL was submitted in a non-canonical form
+	// PasswordHash is a bcrypt hash of a password protecting the entry, protected entries are not deduplicated
+	PasswordHash string     `json:"passwordHash,omitempty"`
+	UserID       string     `json:"userID"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	IsDeleted    bool       `json:"isDeleted,omitempty"` // set for tombstones and compacted deleted entries
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"` // set along with IsDeleted, absent for records written prior to restores
+	IsRemoved    bool       `json:"isRemoved,omitempty"` // set for records marking a previously stored sURL as hard-deleted
+}
+
+// IsTombstone checks whether the entry only marks a previously stored sURL as deleted.
+func (e URLStorageEntry) IsTombstone() bool {
+	return e.IsDeleted && e.URL == ""
 }
 
 type URLMapEntry struct {
-	URL    string
-	UserID string
+	URL          string
+	OriginalURL  string
+	PasswordHash string
+	UserID       string
+	ExpiresAt    *time.Time
+	IsDeleted    bool
+	DeletedAt    *time.Time
+}
+
+// RestoreOutcome classifies restoring the entry by userID, only entries deleted after deletedAfter may be
+// restored and entries deleted at an unknown time may not.
+func (e URLMapEntry) RestoreOutcome(userID string, deletedAfter time.Time) string {
+	switch {
+	case e.UserID != userID:
+		return modelurl.RestoreOutcomeNotOwned
+	case !e.IsDeleted:
+		return modelurl.RestoreOutcomeNotDeleted
+	case e.IsExpired():
+		return modelurl.RestoreOutcomeExpired
+	case e.DeletedAt == nil || !e.DeletedAt.After(deletedAfter):
+		return modelurl.RestoreOutcomeGraceExpired
+	default:
+		return modelurl.RestoreOutcomeRestored
+	}
+}
+
+// IsExpired checks whether the entry has expired.
+func (e URLMapEntry) IsExpired() bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(time.Now())
 }
 
 type URLPostgresEntry struct {
-	ID        uint   `db:"id"`
-	UserID    string `db:"user_id"` // store as a string since we store encoded tokens
-	URL       string `db:"url"`
-	SURL      string `db:"short_url"`
-	IsDeleted bool   `db:"is_deleted"`
+	ID           uint           `db:"id"`
+	UserID       string         `db:"user_id"` // store as a string since we store encoded tokens
+	URL          string         `db:"url"`
+	OriginalURL  sql.NullString `db:"original_url"`
+	PasswordHash sql.NullString `db:"password_hash"`
+	SURL         string         `db:"short_url"`
+	IsDeleted    bool           `db:"is_deleted"`
+	ExpiresAt    sql.NullTime   `db:"expires_at"`
+}
+
+type URLBoltEntry struct {
+	URL          string     `json:"URL"`
+	OriginalURL  string     `json:"originalURL,omitempty"`
+	PasswordHash string     `json:"passwordHash,omitempty"`
+	UserID       string     `json:"userID"`
+	IsDeleted    bool       `json:"isDeleted"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+}
+
+// IsExpired checks whether the entry has expired.
+func (e URLBoltEntry) IsExpired() bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(time.Now())
 }
 
 type URLChannelEntry struct {
 	UserID string
 	SURL   string
+	// OutboxID identifies a persisted deletion task, it is set by storages which keep a deletion outbox
+	OutboxID int64
+	// JobID identifies a deletion job the task belongs to
+	JobID string
+}
+
+type ClickEntry struct {
+	SURL      string    `json:"sURL"`
+	ClickedAt time.Time `json:"clickedAt"`
+	Referrer  string    `json:"referrer"`
+	UserAgent string    `json:"userAgent"`
+	ClientIP  string    `json:"clientIP"`
+}
+
+// VisitorID returns an anonymized visitor identifier derived from client IP address and user agent.
+func (e ClickEntry) VisitorID() string {
+	h := sha256.Sum256([]byte(e.ClientIP + "|" + e.UserAgent))
+	return hex.EncodeToString(h[:16])
 }
@@ -0,0 +1,26 @@
+package storage
+
+import "sync"
+
+// DeleteObservers keeps functions registered by DeleteObserver.ObserveDeletes, its zero value is ready to use.
+type DeleteObservers struct {
+	mu  sync.Mutex
+	fns []func(sURLs []string)
+}
+
+// Add registers fn.
+func (o *DeleteObservers) Add(fn func(sURLs []string)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.fns = append(o.fns, fn)
+}
+
+// Notify calls registered functions with sURLs which were deleted.
+func (o *DeleteObservers) Notify(sURLs []string) {
+	o.mu.Lock()
+	fns := o.fns
+	o.mu.Unlock()
+	for _, fn := range fns {
+		fn(sURLs)
+	}
+}
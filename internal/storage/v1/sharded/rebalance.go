@@ -0,0 +1,86 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/transfer"
+)
+
+// ErrNotRemovable is returned by Rebalance if a shard of both topologies cannot hard-delete moved entries.
+var ErrNotRemovable = errors.New("shards kept in the target topology must support removing entries")
+
+// Rebalance moves entries from a Storage over from shards to a Storage over to shards, e.g. to add shards to
+// a topology. Shards may be a part of both topologies: entries which stay on the same shard are left in place,
+// the others are copied to their new shards and then removed from their former ones if those are kept in the
+// target topology, such shards must implement storage.Remover. Shards which are only a part of the source
+// topology are left intact. Moving is resumable and reports conflicts the way transfer.Copy does, conflicting
+// entries remain on their former shards.
+func Rebalance(ctx context.Context, from, to []storage.URLStorage, opts transfer.Options) (transfer.Report, error) {
+	src, err := New(from)
+	if err != nil {
+		return transfer.Report{}, err
+	}
+	if len(to) == 0 {
+		return transfer.Report{}, ErrNoShards
+	}
+	dst := placement{Storage: &Storage{shards: to}}
+	// removers[i] is set for source shards which are kept in the target topology
+	removers := make([]storage.Remover, len(from))
+	for i, shard := range from {
+		if indexOf(to, shard) < 0 {
+			continue
+		}
+		if !storage.As(shard, &removers[i]) {
+			return transfer.Report{}, ErrNotRemovable
+		}
+	}
+	opts.Keep = func(entry modelstorage.URLStorageEntry) bool {
+		return from[ShardOf(entry.SURL, len(from))] == to[ShardOf(entry.SURL, len(to))]
+	}
+	opts.Moved = func(ctx context.Context, entries []modelstorage.URLStorageEntry) (removed int64, err error) {
+		sURLs := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			sURLs = append(sURLs, entry.SURL)
+		}
+		for i, positions := range (&Storage{shards: from}).group(sURLs) {
+			if removers[i] == nil {
+				continue
+			}
+			shardSURLs := make([]string, 0, len(positions))
+			for _, pos := range positions {
+				shardSURLs = append(shardSURLs, sURLs[pos])
+			}
+			n, err := removers[i].RemoveBatch(ctx, shardSURLs)
+			removed += n
+			if err != nil {
+				return removed, err
+			}
+		}
+		return removed, nil
+	}
+	return transfer.Copy(ctx, src, dst, opts)
+}
+
+// indexOf returns an index of shard among shards or -1 if it is absent.
+func indexOf(shards []storage.URLStorage, shard storage.URLStorage) int {
+	for i, s := range shards {
+		if s == shard {
+			return i
+		}
+	}
+	return -1
+}
+
+// placement is a Storage which stores entries in their shards without checking other shards for duplicates since
+// entries being moved would otherwise be found on their former shards.
+type placement struct {
+	*Storage
+}
+
+// DumpBatch stores entries in their shards.
+func (p placement) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	return p.dumpBatch(ctx, entries)
+}
@@ -0,0 +1,657 @@
+// Package sharded provides a URL storage distributing entries across several underlying storages by hashes
+// of their sURLs.
+package sharded
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inpsql"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// Check interface implementation explicitly
+var (
+	_ storage.URLStorage        = (*Storage)(nil)
+	_ storage.Purger            = (*purgingStorage)(nil)
+	_ storage.DeleteObserver    = (*Storage)(nil)
+	_ storage.ExpiringURLGetter = (*Storage)(nil)
+	_ storage.OwnerChecker      = (*Storage)(nil)
+)
+
+// dedupLocks is the number of mutexes serializing deduplicated writes, URLs are mapped to them by their hashes.
+const dedupLocks = 64
+
+// ErrNoShards is returned if a Storage is initialized without shards.
+var ErrNoShards = errors.New("sharded storage requires at least one shard")
+
+// Storage routes each entry to one of its shards by a hash of its sURL, see ShardOf. Lookups by user, listing
+// and stats fan out across all shards and merge their results. Original URLs are deduplicated across shards
+// within config.DedupScope: prior to writing an entry, shards other than its own are checked for a live entry
+// with the same URL, shards which do not implement storage.DuplicateChecker are not checked. Checking and
+// writing are serialized within one Storage only, writes of several instances may still race, and restored
+// entries are checked by their own shards only. The order of shards is a part of the topology, changing it
+// requires moving entries with Rebalance.
+type Storage struct {
+	shards []storage.URLStorage
+	// locks serialize checking and writing entries with the same URL, see lockURLs
+	locks [dedupLocks]sync.Mutex
+}
+
+// purgingStorage is a Storage over shards which all support purging.
+type purgingStorage struct {
+	*Storage
+}
+
+// New initializes a Storage over shards, the result supports purging if all shards do.
+func New(shards []storage.URLStorage) (storage.URLStorage, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	st := &Storage{shards: shards}
+	for _, shard := range shards {
+		if _, ok := shard.(storage.Purger); !ok {
+			return st, nil
+		}
+	}
+	return &purgingStorage{Storage: st}, nil
+}
+
+// InitStorage initializes a Storage over PSQL DBs given by cfg.DatabaseShards in order. The caller's wg member
+// is taken by the first shard, members for the other shards are added here.
+func InitStorage(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (storage.URLStorage, error) {
+	if len(cfg.DatabaseShards) == 0 {
+		return nil, ErrNoShards
+	}
+	shards := make([]storage.URLStorage, 0, len(cfg.DatabaseShards))
+	for i, dsn := range cfg.DatabaseShards {
+		// each shard keeps its own copy of settings pointing at its DB
+		shardCfg := *cfg
+		shardCfg.DatabaseDSN = dsn
+		// replicas are configured for a single DB and are not applicable to shards
+		shardCfg.DatabaseReplicas = nil
+		if i > 0 {
+			wg.Add(1)
+		}
+		st, err := inpsql.InitStorage(ctx, wg, &shardCfg)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, st)
+	}
+	log.Println("Sharded storage initialized with", len(shards), "shards")
+	return New(shards)
+}
+
+// ShardOf returns an index of the shard keeping sURL among n shards.
+func ShardOf(sURL string, n int) int {
+	return int(hash(sURL) % uint32(n))
+}
+
+// hash returns an FNV-1a hash of key.
+func hash(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// isDeduplicated checks whether entry is subject to URL deduplication, deleted and password-protected entries
+// are not.
+func isDeduplicated(entry modelstorage.URLStorageEntry) bool {
+	return !entry.IsDeleted && entry.PasswordHash == ""
+}
+
+// lockURLs locks mutexes of URLs in ascending order and returns a function unlocking them.
+func (s *Storage) lockURLs(URLs []string) (unlock func()) {
+	var held [dedupLocks]bool
+	for _, URL := range URLs {
+		held[hash(URL)%dedupLocks] = true
+	}
+	for i := range held {
+		if held[i] {
+			s.locks[i].Lock()
+		}
+	}
+	return func() {
+		for i := range held {
+			if held[i] {
+				s.locks[i].Unlock()
+			}
+		}
+	}
+}
+
+// checkDuplicates looks up live entries with the same URLs as entries on shards other than their own ones,
+// conflicts[i] is either AlreadyExistsError or URLTakenError for entries[i] and nil if there is no duplicate.
+// The caller's own entry takes precedence over entries of other users.
+func (s *Storage) checkDuplicates(ctx context.Context, entries []modelstorage.URLStorageEntry) (conflicts []error, err error) {
+	shardConflicts := make([][]error, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var checker storage.DuplicateChecker
+		if !storage.As(shard, &checker) {
+			return nil
+		}
+		shardConflicts[i] = make([]error, len(entries))
+		for j, entry := range entries {
+			if !isDeduplicated(entry) || ShardOf(entry.SURL, len(s.shards)) == i {
+				continue
+			}
+			err := checker.CheckDuplicate(ctx, entry)
+			var alreadyExistsError *storageErrors.AlreadyExistsError
+			var urlTakenError *storageErrors.URLTakenError
+			switch {
+			case errors.As(err, &alreadyExistsError), errors.As(err, &urlTakenError):
+				shardConflicts[i][j] = err
+			case err != nil:
+				return err
+			}
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	conflicts = make([]error, len(entries))
+	for _, shardConflict := range shardConflicts {
+		for j, conflict := range shardConflict {
+			var alreadyExistsError *storageErrors.AlreadyExistsError
+			if conflict != nil && (conflicts[j] == nil || errors.As(conflict, &alreadyExistsError)) {
+				conflicts[j] = conflict
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// shardFor returns the shard keeping sURL.
+func (s *Storage) shardFor(sURL string) storage.URLStorage {
+	return s.shards[ShardOf(sURL, len(s.shards))]
+}
+
+// group returns positions of sURLs keyed by indexes of their shards.
+func (s *Storage) group(sURLs []string) map[int][]int {
+	positions := make(map[int][]int)
+	for i, sURL := range sURLs {
+		shard := ShardOf(sURL, len(s.shards))
+		positions[shard] = append(positions[shard], i)
+	}
+	return positions
+}
+
+// fanOut calls f for every shard concurrently and returns errors of shards, errs[i] corresponds to shard i.
+func (s *Storage) fanOut(f func(i int, shard storage.URLStorage) error) (errs []error) {
+	errs = make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard storage.URLStorage) {
+			defer wg.Done()
+			errs[i] = f(i, shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	return errs
+}
+
+// firstError returns the first non-nil error of errs.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump stores entry in its shard unless another shard keeps a live entry with the same URL.
+func (s *Storage) Dump(ctx context.Context, entry modelstorage.URLStorageEntry) error {
+	if !isDeduplicated(entry) {
+		return s.shardFor(entry.SURL).Dump(ctx, entry)
+	}
+	defer s.lockURLs([]string{entry.URL})()
+	conflicts, err := s.checkDuplicates(ctx, []modelstorage.URLStorageEntry{entry})
+	if err != nil {
+		return err
+	}
+	if conflicts[0] != nil {
+		return conflicts[0]
+	}
+	return s.shardFor(entry.SURL).Dump(ctx, entry)
+}
+
+// DumpBatch stores entries in their shards skipping ones whose URLs are kept by live entries of other shards.
+// Entries repeating a URL of a preceding entry of the batch are checked and stored in a later round so that the
+// preceding entry is taken into account whichever shard it lands on. Entries of a failed shard get its error as
+// their results while entries of other shards are stored, err is only set if all shards involved in the first
+// round failed.
+func (s *Storage) DumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	URLs := make([]string, 0, len(entries))
+	pending := make([]int, 0, len(entries))
+	for i, entry := range entries {
+		if isDeduplicated(entry) {
+			URLs = append(URLs, entry.URL)
+		}
+		pending = append(pending, i)
+	}
+	defer s.lockURLs(URLs)()
+	results = make([]error, len(entries))
+	for round := 0; len(pending) > 0; round++ {
+		var current, next []int
+		seen := make(map[string]bool)
+		for _, pos := range pending {
+			if isDeduplicated(entries[pos]) {
+				if seen[entries[pos].URL] {
+					next = append(next, pos)
+					continue
+				}
+				seen[entries[pos].URL] = true
+			}
+			current = append(current, pos)
+		}
+		failed, err := s.dumpRound(ctx, entries, current, results)
+		if err != nil {
+			if round == 0 {
+				return nil, err
+			}
+			// entries of preceding rounds are stored, hence the error is reported for the remaining ones only
+			for _, pos := range append(failed, next...) {
+				results[pos] = err
+			}
+			return results, nil
+		}
+		pending = next
+	}
+	return results, nil
+}
+
+// dumpRound checks entries at positions for duplicates on other shards, stores the rest and records outcomes
+// in results. If err is set, failed are positions of entries which were not stored.
+func (s *Storage) dumpRound(ctx context.Context, entries []modelstorage.URLStorageEntry, positions []int, results []error) (failed []int, err error) {
+	roundEntries := make([]modelstorage.URLStorageEntry, 0, len(positions))
+	for _, pos := range positions {
+		roundEntries = append(roundEntries, entries[pos])
+	}
+	conflicts, err := s.checkDuplicates(ctx, roundEntries)
+	if err != nil {
+		return positions, err
+	}
+	batch := make([]modelstorage.URLStorageEntry, 0, len(positions))
+	batchPositions := make([]int, 0, len(positions))
+	for j, pos := range positions {
+		if conflicts[j] != nil {
+			results[pos] = conflicts[j]
+			continue
+		}
+		batch = append(batch, entries[pos])
+		batchPositions = append(batchPositions, pos)
+	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	batchResults, err := s.dumpBatch(ctx, batch)
+	if err != nil {
+		return batchPositions, err
+	}
+	for j, pos := range batchPositions {
+		results[pos] = batchResults[j]
+	}
+	return nil, nil
+}
+
+// dumpBatch stores entries in their shards. Entries of a failed shard get its error as their results while
+// entries of other shards are stored, err is only set if all involved shards failed.
+func (s *Storage) dumpBatch(ctx context.Context, entries []modelstorage.URLStorageEntry) (results []error, err error) {
+	sURLs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sURLs = append(sURLs, entry.SURL)
+	}
+	positions := s.group(sURLs)
+	results = make([]error, len(entries))
+	errs := s.fanOut(func(i int, shard storage.URLStorage) error {
+		if len(positions[i]) == 0 {
+			return nil
+		}
+		shardEntries := make([]modelstorage.URLStorageEntry, 0, len(positions[i]))
+		for _, pos := range positions[i] {
+			shardEntries = append(shardEntries, entries[pos])
+		}
+		shardResults, err := shard.DumpBatch(ctx, shardEntries)
+		for j, pos := range positions[i] {
+			switch {
+			case err != nil:
+				results[pos] = err
+			default:
+				results[pos] = shardResults[j]
+			}
+		}
+		return err
+	})
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 && failed == len(positions) {
+		return nil, firstError(errs)
+	}
+	return results, nil
+}
+
+// DeleteBatch deletes sURLs owned by userID in their shards.
+func (s *Storage) DeleteBatch(ctx context.Context, sURLs []string, userID string) error {
+	positions := s.group(sURLs)
+	return firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		if len(positions[i]) == 0 {
+			return nil
+		}
+		shardSURLs := make([]string, 0, len(positions[i]))
+		for _, pos := range positions[i] {
+			shardSURLs = append(shardSURLs, sURLs[pos])
+		}
+		return shard.DeleteBatch(ctx, shardSURLs, userID)
+	}))
+}
+
+// ObserveDeletes registers fn to be called with sURLs once their queued deletion is flushed by any shard.
+func (s *Storage) ObserveDeletes(fn func(sURLs []string)) {
+	for _, shard := range s.shards {
+		var observer storage.DeleteObserver
+		if storage.As(shard, &observer) {
+			observer.ObserveDeletes(fn)
+		}
+	}
+}
+
+// SendToQueue queues item for asynchronous deletion in the shard keeping its sURL.
+func (s *Storage) SendToQueue(ctx context.Context, item modelstorage.URLChannelEntry) error {
+	return s.shardFor(item.SURL).SendToQueue(ctx, item)
+}
+
+// RetrieveDeleteJob merges reports of job jobID from all shards which received its items.
+func (s *Storage) RetrieveDeleteJob(ctx context.Context, jobID, userID string) (job modelurl.DeleteJob, err error) {
+	reports := make([]*modelurl.DeleteJob, len(s.shards))
+	errs := s.fanOut(func(i int, shard storage.URLStorage) error {
+		report, err := shard.RetrieveDeleteJob(ctx, jobID, userID)
+		var jobNotFoundError *storageErrors.JobNotFoundError
+		switch {
+		case errors.As(err, &jobNotFoundError):
+			return nil
+		case err != nil:
+			return err
+		}
+		reports[i] = &report
+		return nil
+	})
+	err = firstError(errs)
+	if err != nil {
+		return modelurl.DeleteJob{}, err
+	}
+	job = modelurl.DeleteJob{ID: jobID}
+	found := false
+	for _, report := range reports {
+		if report == nil {
+			continue
+		}
+		found = true
+		job.Deleted = append(job.Deleted, report.Deleted...)
+		job.NotOwned = append(job.NotOwned, report.NotOwned...)
+		job.NotFound = append(job.NotFound, report.NotFound...)
+		job.Pending = append(job.Pending, report.Pending...)
+		if job.Error == "" {
+			job.Error = report.Error
+		}
+	}
+	if !found {
+		return modelurl.DeleteJob{}, &storageErrors.JobNotFoundError{Err: nil, JobID: jobID}
+	}
+	job.Resolve()
+	return job, nil
+}
+
+// RestoreBatch restores sURLs owned by userID in their shards.
+func (s *Storage) RestoreBatch(ctx context.Context, sURLs []string, userID string) (results []string, err error) {
+	positions := s.group(sURLs)
+	results = make([]string, len(sURLs))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		if len(positions[i]) == 0 {
+			return nil
+		}
+		shardSURLs := make([]string, 0, len(positions[i]))
+		for _, pos := range positions[i] {
+			shardSURLs = append(shardSURLs, sURLs[pos])
+		}
+		shardResults, err := shard.RestoreBatch(ctx, shardSURLs, userID)
+		if err != nil {
+			return err
+		}
+		for j, pos := range positions[i] {
+			results[pos] = shardResults[j]
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Retrieve returns a URL corresponding to sURL from its shard.
+func (s *Storage) Retrieve(ctx context.Context, sURL string) (URL string, err error) {
+	return s.shardFor(sURL).Retrieve(ctx, sURL)
+}
+
+// RetrieveWithExpiry returns a URL corresponding to sURL along with its expiration time from its shard, the
+// expiration time is nil if the shard does not report it.
+func (s *Storage) RetrieveWithExpiry(ctx context.Context, sURL string) (URL string, expiresAt *time.Time, err error) {
+	shard := s.shardFor(sURL)
+	var getter storage.ExpiringURLGetter
+	if !storage.As(shard, &getter) {
+		URL, err = shard.Retrieve(ctx, sURL)
+		return URL, nil, err
+	}
+	return getter.RetrieveWithExpiry(ctx, sURL)
+}
+
+// RetrieveByUserID returns URLs of userID collected from all shards.
+func (s *Storage) RetrieveByUserID(ctx context.Context, userID string) (URLs []modelurl.FullURL, err error) {
+	shardURLs := make([][]modelurl.FullURL, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		shardURLs[i], err = shard.RetrieveByUserID(ctx, userID)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range shardURLs {
+		URLs = append(URLs, u...)
+	}
+	return URLs, nil
+}
+
+// IsOwner reports whether userID owns a non-deleted entry with sURL on its shard, shards which cannot check
+// ownership are looked up among URLs of userID.
+func (s *Storage) IsOwner(ctx context.Context, userID, sURL string) (owned bool, err error) {
+	shard := s.shardFor(sURL)
+	var checker storage.OwnerChecker
+	if storage.As(shard, &checker) {
+		return checker.IsOwner(ctx, userID, sURL)
+	}
+	URLs, err := shard.RetrieveByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, URL := range URLs {
+		if URL.SURL == sURL {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListByUserID returns up to limit URLs of userID with sURLs greater than afterSURL merged from all shards in
+// ascending order of sURLs.
+func (s *Storage) ListByUserID(ctx context.Context, userID, afterSURL string, limit int) (URLs []modelurl.FullURL, err error) {
+	shardURLs := make([][]modelurl.FullURL, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		shardURLs[i], err = shard.ListByUserID(ctx, userID, afterSURL, limit)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range shardURLs {
+		URLs = append(URLs, u...)
+	}
+	sort.Slice(URLs, func(i, j int) bool { return URLs[i].SURL < URLs[j].SURL })
+	if len(URLs) > limit {
+		URLs = URLs[:limit]
+	}
+	return URLs, nil
+}
+
+// List returns up to limit entries with sURLs greater than afterSURL merged from all shards in ascending order
+// of sURLs.
+func (s *Storage) List(ctx context.Context, afterSURL string, limit int) (entries []modelstorage.URLStorageEntry, err error) {
+	shardEntries := make([][]modelstorage.URLStorageEntry, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		shardEntries[i], err = shard.List(ctx, afterSURL, limit)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range shardEntries {
+		entries = append(entries, e...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].SURL < entries[j].SURL })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// GetStats sums numbers of entries of all shards, users present on several shards are counted once if all
+// shards can list their users and are summed up otherwise.
+func (s *Storage) GetStats(ctx context.Context) (nURLs, nUsers int64, err error) {
+	counts := make([][2]int64, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		counts[i][0], counts[i][1], err = shard.GetStats(ctx)
+		return err
+	}))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, c := range counts {
+		nURLs += c[0]
+		nUsers += c[1]
+	}
+	userIDs, ok, err := s.listUserIDs(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ok {
+		nUsers = int64(len(userIDs))
+	}
+	return nURLs, nUsers, nil
+}
+
+// listUserIDs returns distinct user IDs of all shards, ok is false if some shard cannot list its users.
+func (s *Storage) listUserIDs(ctx context.Context) (userIDs map[string]bool, ok bool, err error) {
+	for _, shard := range s.shards {
+		if _, ok := shard.(storage.UserLister); !ok {
+			return nil, false, nil
+		}
+	}
+	shardUserIDs := make([][]string, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		shardUserIDs[i], err = shard.(storage.UserLister).ListUserIDs(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, false, err
+	}
+	userIDs = make(map[string]bool)
+	for _, IDs := range shardUserIDs {
+		for _, userID := range IDs {
+			userIDs[userID] = true
+		}
+	}
+	return userIDs, true, nil
+}
+
+// PingDB checks all shards.
+func (s *Storage) PingDB() error {
+	for _, shard := range s.shards {
+		err := shard.PingDB()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseDB closes all shards and returns the first error.
+func (s *Storage) CloseDB() error {
+	var firstErr error
+	for _, shard := range s.shards {
+		err := shard.CloseDB()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Purge purges each shard independently, limit applies to every shard.
+func (s *purgingStorage) Purge(ctx context.Context, deletedBefore, purgedAt time.Time, limit int) (purged int64, err error) {
+	counts := make([]int64, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		counts[i], err = shard.(storage.Purger).Purge(ctx, deletedBefore, purgedAt, limit)
+		return err
+	}))
+	for _, n := range counts {
+		purged += n
+	}
+	return purged, err
+}
+
+// GetPurgeStats sums purge counters of all shards, the last purge is the latest one among shards.
+func (s *purgingStorage) GetPurgeStats(ctx context.Context) (stats modelurl.PurgeStats, err error) {
+	shardStats := make([]modelurl.PurgeStats, len(s.shards))
+	err = firstError(s.fanOut(func(i int, shard storage.URLStorage) error {
+		var err error
+		shardStats[i], err = shard.(storage.Purger).GetPurgeStats(ctx)
+		return err
+	}))
+	if err != nil {
+		return modelurl.PurgeStats{}, err
+	}
+	for _, st := range shardStats {
+		stats.PurgedURLs += st.PurgedURLs
+		switch {
+		case st.LastPurgeAt == nil:
+		case stats.LastPurgeAt == nil || st.LastPurgeAt.After(*stats.LastPurgeAt):
+			stats.LastPurgeAt = st.LastPurgeAt
+			stats.LastPurgedURLs = st.LastPurgedURLs
+		case st.LastPurgeAt.Equal(*stats.LastPurgeAt):
+			stats.LastPurgedURLs += st.LastPurgedURLs
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,323 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/service/modelurl"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// numShards is the number of local stand-in shards.
+const numShards = 3
+
+type ShardedTestSuite struct {
+	suite.Suite
+	dir string
+	// dedupScope is applied to shards opened by openShards
+	dedupScope string
+	shards     []storage.URLStorage
+	storage    storage.URLStorage
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         *sync.WaitGroup
+}
+
+// openShards initializes n file storages named by prefix as stand-ins for PSQL shards.
+func (suite *ShardedTestSuite) openShards(prefix string, n int) []storage.URLStorage {
+	shards := make([]storage.URLStorage, 0, n)
+	for i := 0; i < n; i++ {
+		cfg := config.NewDefaultConfiguration()
+		cfg.FileStoragePath = filepath.Join(suite.dir, fmt.Sprintf("%s%d.json", prefix, i))
+		cfg.RestoreGraceWindow = time.Hour
+		cfg.DedupScope = suite.dedupScope
+		suite.wg.Add(1)
+		st, _ := infile.InitStorage(suite.ctx, suite.wg, cfg)
+		shards = append(shards, st)
+	}
+	return shards
+}
+
+// sURLOn returns a sURL starting with prefix which is routed to shard i among numShards shards.
+func sURLOn(prefix string, i int) string {
+	for n := 0; ; n++ {
+		sURL := fmt.Sprintf("%s%d", prefix, n)
+		if ShardOf(sURL, numShards) == i {
+			return sURL
+		}
+	}
+}
+
+func (suite *ShardedTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+	suite.dedupScope = config.DedupScopeUser
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg = &sync.WaitGroup{}
+	suite.shards = suite.openShards("shard", numShards)
+	suite.storage, _ = New(suite.shards)
+	for i := 0; i < 9; i++ {
+		_ = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{
+			SURL:   fmt.Sprintf("sURL%d", i),
+			URL:    fmt.Sprintf("https://www.yandex.ru/%d", i),
+			UserID: fmt.Sprintf("user%d", i%2),
+		})
+	}
+}
+
+func (suite *ShardedTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func TestShardedTestSuite(t *testing.T) {
+	suite.Run(t, new(ShardedTestSuite))
+}
+
+func (suite *ShardedTestSuite) TestNew_NoShards() {
+	_, err := New(nil)
+	assert.Equal(suite.T(), ErrNoShards, err)
+}
+
+func (suite *ShardedTestSuite) TestRouting() {
+	used := map[int]bool{}
+	for i := 0; i < 9; i++ {
+		sURL := fmt.Sprintf("sURL%d", i)
+		shard := ShardOf(sURL, numShards)
+		used[shard] = true
+		for j, st := range suite.shards {
+			_, err := st.Retrieve(suite.ctx, sURL)
+			var notFoundError *storageErrors.NotFoundError
+			assert.Equal(suite.T(), j != shard, errors.As(err, &notFoundError), sURL)
+		}
+		URL, err := suite.storage.Retrieve(suite.ctx, sURL)
+		assert.Nil(suite.T(), err)
+		assert.Equal(suite.T(), fmt.Sprintf("https://www.yandex.ru/%d", i), URL)
+	}
+	assert.Len(suite.T(), used, numShards)
+}
+
+func (suite *ShardedTestSuite) TestRetrieveByUserID() {
+	URLs, err := suite.storage.RetrieveByUserID(suite.ctx, "user0")
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), URLs, 5)
+	URLs, err = suite.storage.RetrieveByUserID(suite.ctx, "user1")
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), URLs, 4)
+}
+
+func (suite *ShardedTestSuite) TestIsOwner() {
+	checker := suite.storage.(storage.OwnerChecker)
+	owned, err := checker.IsOwner(suite.ctx, "user1", "sURL3")
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), owned)
+	owned, _ = checker.IsOwner(suite.ctx, "user0", "sURL3")
+	assert.False(suite.T(), owned)
+	owned, _ = checker.IsOwner(suite.ctx, "user1", "some_absent_sURL")
+	assert.False(suite.T(), owned)
+}
+
+func (suite *ShardedTestSuite) TestGetStats() {
+	nURLs, nUsers, err := suite.storage.GetStats(suite.ctx)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(9), nURLs)
+	// both users own entries on several shards
+	assert.Equal(suite.T(), int64(2), nUsers)
+}
+
+func (suite *ShardedTestSuite) TestList() {
+	var sURLs []string
+	afterSURL := ""
+	for {
+		entries, err := suite.storage.List(suite.ctx, afterSURL, 2)
+		assert.Nil(suite.T(), err)
+		if len(entries) == 0 {
+			break
+		}
+		assert.LessOrEqual(suite.T(), len(entries), 2)
+		for _, entry := range entries {
+			sURLs = append(sURLs, entry.SURL)
+		}
+		afterSURL = entries[len(entries)-1].SURL
+	}
+	var expected []string
+	for i := 0; i < 9; i++ {
+		expected = append(expected, fmt.Sprintf("sURL%d", i))
+	}
+	assert.Equal(suite.T(), expected, sURLs)
+}
+
+func (suite *ShardedTestSuite) TestDumpBatch() {
+	entries := []modelstorage.URLStorageEntry{
+		{SURL: "sURL10", URL: "https://www.yandex.kz/10", UserID: "user2"},
+		{SURL: "sURL3", URL: "https://www.yandex.kz/3", UserID: "user2"},
+		{SURL: "sURL11", URL: "https://www.yandex.kz/11", UserID: "user2"},
+	}
+	results, err := suite.storage.DumpBatch(suite.ctx, entries)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), results, 3)
+	assert.Nil(suite.T(), results[0])
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.True(suite.T(), errors.As(results[1], &sURLAlreadyExistsError))
+	assert.Nil(suite.T(), results[2])
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user2")
+	assert.Len(suite.T(), URLs, 2)
+}
+
+func (suite *ShardedTestSuite) TestDump_Dedup() {
+	// sURL1 keeps the URL on another shard
+	other := (ShardOf("sURL1", numShards) + 1) % numShards
+	err := suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLOn("dup", other), URL: "https://www.yandex.ru/1", UserID: "user1"})
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+
+	// other users and password-protected entries are not deduplicated under per-user scope
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLOn("dup", other), URL: "https://www.yandex.ru/1", UserID: "user0"})
+	assert.Nil(suite.T(), err)
+	err = suite.storage.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLOn("protected", other), URL: "https://www.yandex.ru/1", UserID: "user1", PasswordHash: "hash"})
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ShardedTestSuite) TestDump_DedupGlobalScope() {
+	suite.dedupScope = config.DedupScopeGlobal
+	st, _ := New(suite.openShards("global", numShards))
+	err := st.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLOn("first", 0), URL: "https://www.yandex.kz", UserID: "user0"})
+	assert.Nil(suite.T(), err)
+	err = st.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: sURLOn("second", 1), URL: "https://www.yandex.kz", UserID: "user1"})
+	var urlTakenError *storageErrors.URLTakenError
+	assert.True(suite.T(), errors.As(err, &urlTakenError))
+}
+
+func (suite *ShardedTestSuite) TestDumpBatch_Dedup() {
+	entries := []modelstorage.URLStorageEntry{
+		{SURL: sURLOn("batch", 0), URL: "https://www.yandex.kz", UserID: "user2"},
+		{SURL: sURLOn("batch", 1), URL: "https://www.yandex.kz", UserID: "user2"},
+		{SURL: sURLOn("batch", 2), URL: "https://www.yandex.ru/1", UserID: "user1"},
+		{SURL: sURLOn("other", 1), URL: "https://www.yandex.kz", UserID: "user3"},
+	}
+	results, err := suite.storage.DumpBatch(suite.ctx, entries)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), results, 4)
+	assert.Nil(suite.T(), results[0])
+	// a repeated URL of the batch is checked against the preceding entry stored on another shard
+	var alreadyExistsError *storageErrors.AlreadyExistsError
+	assert.True(suite.T(), errors.As(results[1], &alreadyExistsError))
+	assert.Equal(suite.T(), entries[0].SURL, alreadyExistsError.ValidSURL)
+	assert.True(suite.T(), errors.As(results[2], &alreadyExistsError))
+	assert.Equal(suite.T(), "sURL1", alreadyExistsError.ValidSURL)
+	assert.Nil(suite.T(), results[3])
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user2")
+	assert.Len(suite.T(), URLs, 1)
+}
+
+func (suite *ShardedTestSuite) TestDeleteAndRestoreBatch() {
+	sURLs := []string{"sURL0", "sURL2", "sURL4", "sURL1"}
+	err := suite.storage.DeleteBatch(suite.ctx, sURLs, "user0")
+	assert.Nil(suite.T(), err)
+	var deletedError *storageErrors.DeletedError
+	for _, sURL := range sURLs[:3] {
+		_, err = suite.storage.Retrieve(suite.ctx, sURL)
+		assert.True(suite.T(), errors.As(err, &deletedError), sURL)
+	}
+	// sURL1 is owned by another user
+	_, err = suite.storage.Retrieve(suite.ctx, "sURL1")
+	assert.Nil(suite.T(), err)
+
+	results, err := suite.storage.RestoreBatch(suite.ctx, sURLs, "user0")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{modelurl.RestoreOutcomeRestored, modelurl.RestoreOutcomeRestored, modelurl.RestoreOutcomeRestored, modelurl.RestoreOutcomeNotOwned}, results)
+	URLs, _ := suite.storage.RetrieveByUserID(suite.ctx, "user0")
+	assert.Len(suite.T(), URLs, 5)
+}
+
+func (suite *ShardedTestSuite) TestRetrieveDeleteJob() {
+	for _, sURL := range []string{"sURL0", "sURL2", "sURL4", "sURL6"} {
+		err := suite.storage.SendToQueue(suite.ctx, modelstorage.URLChannelEntry{UserID: "user0", SURL: sURL, JobID: "job1"})
+		assert.Nil(suite.T(), err)
+	}
+	job, err := suite.storage.RetrieveDeleteJob(suite.ctx, "job1", "user0")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "job1", job.ID)
+	assert.Equal(suite.T(), modelurl.DeleteJobPending, job.Status)
+	assert.ElementsMatch(suite.T(), []string{"sURL0", "sURL2", "sURL4", "sURL6"}, job.Pending)
+
+	_, err = suite.storage.RetrieveDeleteJob(suite.ctx, "job1", "user1")
+	var jobNotFoundError *storageErrors.JobNotFoundError
+	assert.True(suite.T(), errors.As(err, &jobNotFoundError))
+}
+
+func (suite *ShardedTestSuite) TestRebalance() {
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL0"}, "user0")
+	target := suite.openShards("target", numShards+2)
+	report, err := Rebalance(suite.ctx, suite.shards, target, transfer.Options{BatchSize: 4, Checkpoint: filepath.Join(suite.dir, "rebalance.checkpoint")})
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), report.Reconcile(false))
+	assert.Equal(suite.T(), int64(9), report.Copied)
+
+	rebalanced, _ := New(target)
+	for i := 1; i < 9; i++ {
+		sURL := fmt.Sprintf("sURL%d", i)
+		_, err = target[ShardOf(sURL, len(target))].Retrieve(suite.ctx, sURL)
+		assert.Nil(suite.T(), err, sURL)
+	}
+	_, err = rebalanced.Retrieve(suite.ctx, "sURL0")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	URLs, _ := rebalanced.RetrieveByUserID(suite.ctx, "user1")
+	assert.Len(suite.T(), URLs, 4)
+}
+
+func (suite *ShardedTestSuite) TestRebalance_Grow() {
+	_ = suite.storage.DeleteBatch(suite.ctx, []string{"sURL0"}, "user0")
+	target := append([]storage.URLStorage{}, suite.shards...)
+	target = append(target, suite.openShards("target", 1)...)
+	moving := 0
+	for i := 0; i < 9; i++ {
+		sURL := fmt.Sprintf("sURL%d", i)
+		if ShardOf(sURL, numShards) != ShardOf(sURL, len(target)) {
+			moving++
+		}
+	}
+	report, err := Rebalance(suite.ctx, suite.shards, target, transfer.Options{BatchSize: 4, Checkpoint: filepath.Join(suite.dir, "rebalance.checkpoint")})
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), report.Reconcile(false))
+	assert.Equal(suite.T(), int64(moving), report.Copied)
+	assert.Equal(suite.T(), int64(moving), report.Removed)
+	assert.Equal(suite.T(), int64(9-moving), report.Kept)
+
+	// every entry is kept by its new owner only
+	for i := 0; i < 9; i++ {
+		sURL := fmt.Sprintf("sURL%d", i)
+		owner := ShardOf(sURL, len(target))
+		for j, shard := range target {
+			_, err = shard.Retrieve(suite.ctx, sURL)
+			var notFoundError *storageErrors.NotFoundError
+			assert.Equal(suite.T(), j != owner, errors.As(err, &notFoundError), sURL)
+		}
+	}
+	rebalanced, _ := New(target)
+	_, err = rebalanced.Retrieve(suite.ctx, "sURL0")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	URLs, _ := rebalanced.RetrieveByUserID(suite.ctx, "user1")
+	assert.Len(suite.T(), URLs, 4)
+	nURLs, _, _ := rebalanced.GetStats(suite.ctx)
+	assert.Equal(suite.T(), int64(9), nURLs)
+
+	// rebalancing again finds every entry in place
+	report, err = Rebalance(suite.ctx, target, target, transfer.Options{})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(9), report.Kept)
+}
@@ -0,0 +1,260 @@
+// Package transfer provides copying of URL entries between storages of different kinds.
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+)
+
+// conflict policies
+const (
+	// ConflictSkip reports conflicting entries and continues copying
+	ConflictSkip = "skip"
+	// ConflictFail stops copying at the first conflicting entry
+	ConflictFail = "fail"
+)
+
+// DefaultBatchSize is a number of entries read and written at once if Options.BatchSize is not set.
+const DefaultBatchSize = 1000
+
+// Options defines parameters of copying.
+type Options struct {
+	BatchSize  int
+	OnConflict string
+	// DryRun makes Copy check entries against the destination without writing them
+	DryRun bool
+	// Checkpoint is a path of a file keeping the last processed sURL, copying resumes after it if the file
+	// exists and the file is removed once copying is complete
+	Checkpoint string
+	// Keep, if set, reports entries which are already in place, e.g. on their shard, such entries are neither
+	// copied nor passed to Moved
+	Keep func(entry modelstorage.URLStorageEntry) bool
+	// Moved, if set, is called with entries of a batch which are present in the destination, either copied or
+	// identical, before the checkpoint is written, e.g. to remove them from the source; it returns the number of
+	// removed entries which are counted in the destination and is not called for a dry run
+	Moved func(ctx context.Context, entries []modelstorage.URLStorageEntry) (removed int64, err error)
+}
+
+// Report defines an outcome of copying, counters refer to the current run only.
+type Report struct {
+	Scanned int64
+	// Copied is a number of written entries or, for a dry run, of entries which would be written
+	Copied int64
+	// Identical is a number of entries already present in the destination with the same URL
+	Identical int64
+	// Conflicts is a number of entries skipped due to conflicts
+	Conflicts int64
+	// Kept is a number of entries left in place as reported by Options.Keep
+	Kept int64
+	// Removed is a number of moved entries removed from storages which the destination consists of
+	Removed int64
+	// ResumedAfter is a sURL copying was resumed after, empty for a fresh run
+	ResumedAfter          string
+	SourceURLs            int64
+	DestinationURLsBefore int64
+	DestinationURLsAfter  int64
+}
+
+// Reconcile checks that every scanned entry is accounted for and that the destination has grown by the number
+// of copied entries less removed ones, the latter only holds if the destination is not written to concurrently.
+func (r Report) Reconcile(dryRun bool) error {
+	if r.Copied+r.Identical+r.Conflicts+r.Kept != r.Scanned {
+		return fmt.Errorf("%d entries scanned, but %d copied, %d identical, %d conflicting and %d kept", r.Scanned, r.Copied, r.Identical, r.Conflicts, r.Kept)
+	}
+	if !dryRun && r.DestinationURLsAfter-r.DestinationURLsBefore != r.Copied-r.Removed {
+		return fmt.Errorf("%d entries copied and %d removed, but destination has grown from %d to %d entries", r.Copied, r.Removed, r.DestinationURLsBefore, r.DestinationURLsAfter)
+	}
+	return nil
+}
+
+// Copy streams all entries, including deleted and expired ones, from src to dst in batches ordered by sURL.
+func Copy(ctx context.Context, src, dst storage.URLStorage, opts Options) (report Report, err error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictSkip
+	}
+	if opts.OnConflict != ConflictSkip && opts.OnConflict != ConflictFail {
+		return report, fmt.Errorf("%s: conflict policy must be either %s or %s", opts.OnConflict, ConflictSkip, ConflictFail)
+	}
+	afterSURL, err := readCheckpoint(opts.Checkpoint)
+	if err != nil {
+		return report, err
+	}
+	report.ResumedAfter = afterSURL
+	report.SourceURLs, _, err = src.GetStats(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.DestinationURLsBefore, _, err = dst.GetStats(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for {
+		entries, err := src.List(ctx, afterSURL, opts.BatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		report.Scanned += int64(len(entries))
+		lastSURL := entries[len(entries)-1].SURL
+		if opts.Keep != nil {
+			pending := make([]modelstorage.URLStorageEntry, 0, len(entries))
+			for _, entry := range entries {
+				if opts.Keep(entry) {
+					report.Kept++
+					continue
+				}
+				pending = append(pending, entry)
+			}
+			entries = pending
+		}
+		var results []error
+		switch {
+		case len(entries) == 0:
+		case opts.DryRun:
+			results, err = checkBatch(ctx, dst, entries)
+		default:
+			results, err = dst.DumpBatch(ctx, entries)
+		}
+		if err != nil {
+			return report, err
+		}
+		moved := make([]modelstorage.URLStorageEntry, 0, len(entries))
+		for i, result := range results {
+			if result == nil {
+				report.Copied++
+				moved = append(moved, entries[i])
+				continue
+			}
+			identical, err := isIdentical(ctx, dst, entries[i], result)
+			if err != nil {
+				return report, err
+			}
+			if identical {
+				report.Identical++
+				moved = append(moved, entries[i])
+				continue
+			}
+			report.Conflicts++
+			log.Println("Copying URL:", entries[i].SURL, result)
+			if opts.OnConflict == ConflictFail {
+				// written entries of this batch are found identical once copying is resumed
+				if !opts.DryRun {
+					err = writeCheckpoint(opts.Checkpoint, afterSURL)
+					if err != nil {
+						return report, err
+					}
+				}
+				return report, fmt.Errorf("%s: %w", entries[i].SURL, result)
+			}
+		}
+		// entries are only removed once they are present in the destination, an interrupted run finds them
+		// identical and removes them when resumed
+		if opts.Moved != nil && !opts.DryRun && len(moved) > 0 {
+			removed, err := opts.Moved(ctx, moved)
+			report.Removed += removed
+			if err != nil {
+				return report, err
+			}
+		}
+		afterSURL = lastSURL
+		if !opts.DryRun {
+			err = writeCheckpoint(opts.Checkpoint, afterSURL)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	report.DestinationURLsAfter, _, err = dst.GetStats(ctx)
+	if err != nil {
+		return report, err
+	}
+	if !opts.DryRun && opts.Checkpoint != "" {
+		err = os.Remove(opts.Checkpoint)
+		if err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// checkBatch reports entries whose sURLs are already present in dst the same way DumpBatch does.
+func checkBatch(ctx context.Context, dst storage.URLStorage, entries []modelstorage.URLStorageEntry) ([]error, error) {
+	results := make([]error, len(entries))
+	for i, entry := range entries {
+		_, err := dst.Retrieve(ctx, entry.SURL)
+		var notFoundError *storageErrors.NotFoundError
+		switch {
+		case errors.As(err, &notFoundError):
+			continue
+		case err != nil && !isEntryState(err):
+			return nil, err
+		}
+		results[i] = &storageErrors.SURLAlreadyExistsError{Err: nil, SURL: entry.SURL}
+	}
+	return results, nil
+}
+
+// isIdentical checks whether a conflicting entry was already copied to dst, e.g. by an interrupted run.
+func isIdentical(ctx context.Context, dst storage.URLStorage, entry modelstorage.URLStorageEntry, conflict error) (bool, error) {
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	if !errors.As(conflict, &sURLAlreadyExistsError) {
+		return false, nil
+	}
+	URL, err := dst.Retrieve(ctx, entry.SURL)
+	var deletedError *storageErrors.DeletedError
+	var expiredError *storageErrors.ExpiredError
+	switch {
+	case errors.As(err, &deletedError):
+		return entry.IsDeleted, nil
+	case errors.As(err, &expiredError):
+		return entry.ExpiresAt != nil, nil
+	case err != nil:
+		return false, err
+	}
+	return !entry.IsDeleted && URL == entry.URL, nil
+}
+
+// isEntryState checks whether a lookup error reflects a state of an existing entry.
+func isEntryState(err error) bool {
+	var deletedError *storageErrors.DeletedError
+	var expiredError *storageErrors.ExpiredError
+	return errors.As(err, &deletedError) || errors.As(err, &expiredError)
+}
+
+// readCheckpoint returns the last processed sURL kept in path, if any.
+func readCheckpoint(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// writeCheckpoint persists the last processed sURL to path.
+func writeCheckpoint(path string, sURL string) error {
+	if path == "" {
+		return nil
+	}
+	return os.WriteFile(path, []byte(sURL+"\n"), 0644)
+}
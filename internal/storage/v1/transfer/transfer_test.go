@@ -0,0 +1,113 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/danilovkiri/dk_go_url_shortener/internal/config"
+	storageErrors "github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/errors"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/inbolt"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/infile"
+	"github.com/danilovkiri/dk_go_url_shortener/internal/storage/v1/modelstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TransferTestSuite struct {
+	suite.Suite
+	src        *infile.Storage
+	dst        *inbolt.Storage
+	checkpoint string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         *sync.WaitGroup
+}
+
+func (suite *TransferTestSuite) SetupTest() {
+	dir := suite.T().TempDir()
+	cfg := config.NewDefaultConfiguration()
+	cfg.FileStoragePath = filepath.Join(dir, "url_storage.json")
+	cfg.BoltStoragePath = filepath.Join(dir, "url_storage.db")
+	suite.checkpoint = filepath.Join(dir, "url_copy.checkpoint")
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.wg = &sync.WaitGroup{}
+	suite.wg.Add(2)
+	suite.src, _ = infile.InitStorage(suite.ctx, suite.wg, cfg)
+	suite.dst, _ = inbolt.InitStorage(suite.ctx, suite.wg, cfg)
+	_ = suite.src.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.ru", UserID: "user1"})
+	_ = suite.src.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL2", URL: "https://www.yandex.kz", UserID: "user1"})
+	_ = suite.src.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.by", UserID: "user2"})
+	_ = suite.src.DeleteBatch(suite.ctx, []string{"sURL2"}, "user1")
+}
+
+func (suite *TransferTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.wg.Wait()
+}
+
+func TestTransferTestSuite(t *testing.T) {
+	suite.Run(t, new(TransferTestSuite))
+}
+
+func (suite *TransferTestSuite) TestCopy() {
+	report, err := Copy(suite.ctx, suite.src, suite.dst, Options{BatchSize: 2, Checkpoint: suite.checkpoint})
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), report.Reconcile(false))
+	assert.Equal(suite.T(), int64(3), report.Copied)
+	assert.Equal(suite.T(), int64(3), report.DestinationURLsAfter)
+	_, err = os.Stat(suite.checkpoint)
+	assert.True(suite.T(), os.IsNotExist(err))
+
+	URL, err := suite.dst.Retrieve(suite.ctx, "sURL3")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "https://www.yandex.by", URL)
+	_, err = suite.dst.Retrieve(suite.ctx, "sURL2")
+	var deletedError *storageErrors.DeletedError
+	assert.True(suite.T(), errors.As(err, &deletedError))
+	URLs, _ := suite.dst.RetrieveByUserID(suite.ctx, "user2")
+	assert.Len(suite.T(), URLs, 1)
+
+	// copying again finds all entries in place
+	report, err = Copy(suite.ctx, suite.src, suite.dst, Options{})
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), report.Reconcile(false))
+	assert.Equal(suite.T(), int64(3), report.Identical)
+}
+
+func (suite *TransferTestSuite) TestCopyDryRun() {
+	_ = suite.dst.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL1", URL: "https://www.yandex.com", UserID: "user1"})
+	report, err := Copy(suite.ctx, suite.src, suite.dst, Options{DryRun: true})
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), report.Reconcile(true))
+	assert.Equal(suite.T(), int64(2), report.Copied)
+	assert.Equal(suite.T(), int64(1), report.Conflicts)
+	assert.Equal(suite.T(), int64(1), report.DestinationURLsAfter)
+}
+
+func (suite *TransferTestSuite) TestCopyResume() {
+	_ = os.WriteFile(suite.checkpoint, []byte("sURL2\n"), 0644)
+	report, err := Copy(suite.ctx, suite.src, suite.dst, Options{Checkpoint: suite.checkpoint})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "sURL2", report.ResumedAfter)
+	assert.Equal(suite.T(), int64(1), report.Copied)
+	_, err = suite.dst.Retrieve(suite.ctx, "sURL1")
+	var notFoundError *storageErrors.NotFoundError
+	assert.True(suite.T(), errors.As(err, &notFoundError))
+}
+
+func (suite *TransferTestSuite) TestCopyFailOnConflict() {
+	_ = suite.dst.Dump(suite.ctx, modelstorage.URLStorageEntry{SURL: "sURL3", URL: "https://www.yandex.com", UserID: "user2"})
+	report, err := Copy(suite.ctx, suite.src, suite.dst, Options{BatchSize: 2, OnConflict: ConflictFail, Checkpoint: suite.checkpoint})
+	var sURLAlreadyExistsError *storageErrors.SURLAlreadyExistsError
+	assert.True(suite.T(), errors.As(err, &sURLAlreadyExistsError))
+	assert.Equal(suite.T(), int64(2), report.Copied)
+	checkpoint, _ := os.ReadFile(suite.checkpoint)
+	assert.Equal(suite.T(), "sURL2\n", string(checkpoint))
+
+	_, err = Copy(suite.ctx, suite.src, suite.dst, Options{OnConflict: "overwrite"})
+	assert.NotNil(suite.T(), err)
+}
@@ -0,0 +1,32 @@
+package storage
+
+import "reflect"
+
+// Unwrapper defines a set of methods for storage decorators, it exposes the wrapped storage so that optional
+// capabilities such as Compactor or Purger remain reachable through any number of decorators.
+type Unwrapper interface {
+	Unwrap() URLStorage
+}
+
+// As finds the first storage in the chain of decorators starting at s which implements the interface target
+// points to, sets target to that storage and reports whether one was found. As panics if target is not a non-nil
+// pointer to an interface type, see errors.As for the same convention.
+func As(s URLStorage, target interface{}) bool {
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Interface {
+		panic("storage: target must be a non-nil pointer to an interface")
+	}
+	targetType := val.Elem().Type()
+	for s != nil {
+		if reflect.TypeOf(s).Implements(targetType) {
+			val.Elem().Set(reflect.ValueOf(s))
+			return true
+		}
+		unwrapper, ok := s.(Unwrapper)
+		if !ok {
+			return false
+		}
+		s = unwrapper.Unwrap()
+	}
+	return false
+}